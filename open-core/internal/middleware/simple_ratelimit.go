@@ -11,6 +11,10 @@ import (
 // The commercial version uses Redis for distributed rate limiting across
 // multiple router instances with persistent state.
 //
+// Policy bundle rate limits and their rateLimit.algorithm (sliding window,
+// fixed window, GCRA) are commercial only: open-core limits each tenant with
+// this token bucket, whatever algorithm a bundle selects.
+//
 // Algorithm: Token Bucket
 // - Each tenant has a bucket with a fixed capacity (RPM limit)
 // - Tokens are added at a constant rate (refill)
@@ -22,11 +22,13 @@ type UsageEvent struct {
 	Timestamp     time.Time
 	TenantID      string
 	Tier          string
-	RequestCount  int
+	RequestCount  int64 // Rate limit and quota units charged; 1 per request in open-core
 	Endpoint      string
 	Method        string
 	StatusCode    int
 	ResponseTime  int64 // milliseconds
+	BytesIn       int64 // Bytes relayed from the client over an upgraded connection
+	BytesOut      int64 // Bytes relayed to the client over an upgraded connection
 	Cached        bool
 	Region        string
 	Version       string
@@ -49,8 +51,11 @@ func (t *NoOpUsageTracker) TrackRequest(ctx context.Context, event UsageEvent) e
 		zap.String("tenant_id", event.TenantID),
 		zap.String("endpoint", event.Endpoint),
 		zap.String("method", event.Method),
+		zap.Int64("request_count", event.RequestCount),
 		zap.Int("status_code", event.StatusCode),
-		zap.Int64("response_time_ms", event.ResponseTime))
+		zap.Int64("response_time_ms", event.ResponseTime),
+		zap.Int64("bytes_in", event.BytesIn),
+		zap.Int64("bytes_out", event.BytesOut))
 	return nil
 }
 
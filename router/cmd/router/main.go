@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"net/http"
@@ -15,9 +16,12 @@ import (
 	"github.com/stratus-meridian/apx-private/control/usage"
 	"github.com/stratus-meridian/apx/router/internal/auth"
 	"github.com/stratus-meridian/apx/router/internal/config"
+	"github.com/stratus-meridian/apx/router/internal/crd"
+	"github.com/stratus-meridian/apx/router/internal/limiter"
 	"github.com/stratus-meridian/apx/router/internal/middleware"
 	"github.com/stratus-meridian/apx/router/internal/policy"
 	"github.com/stratus-meridian/apx/router/internal/routes"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
 	"github.com/stratus-meridian/apx/router/pkg/health"
 	"github.com/stratus-meridian/apx/router/pkg/observability"
 	"github.com/stratus-meridian/apx/router/pkg/status"
@@ -109,6 +113,15 @@ func main() {
 	}
 	defer rateLimiter.Close()
 
+	// While Redis is unavailable, rate limits are enforced by the failure
+	// policy; local mode gives each router its share of every limit
+	failurePolicy, err := limiter.ParseFailurePolicy(cfg.RateLimitFailurePolicy)
+	if err != nil {
+		logger.Fatal("invalid rate limit failure policy", zap.Error(err))
+	}
+	rateLimitFailover := limiter.NewFailover(redisClient, failurePolicy, logger)
+	go rateLimitFailover.Run(ctx)
+
 	// Initialize quota enforcer for monthly quota limits
 	quotaEnforcer := apxratelimit.NewQuotaEnforcer(redisClient)
 
@@ -119,10 +132,25 @@ func main() {
 	}
 	defer tenantRepo.Close()
 
-	// Initialize tenant resolver with Redis caching
-	tenantResolver := auth.NewFirestoreTenantResolver(tenantRepo, redisClient, logger)
+	// Initialize tenant resolver with Redis caching. API keys with key IDs are
+	// stored hashed in Redis and resolved to their tenant by ID; legacy keys
+	// are still looked up in Firestore.
+	tenantLoader, ok := tenantRepo.(auth.TenantRepository)
+	if !ok {
+		logger.Fatal("tenant repository cannot load tenants by resource ID")
+	}
+	apiKeyStore := auth.NewRedisAPIKeyStore(redisClient)
+	tenantResolver := auth.NewFirestoreTenantResolver(tenantLoader, apiKeyStore, redisClient, logger)
 	defer tenantResolver.Close()
 
+	// Drop cached tenants as soon as any router or the control plane revokes
+	// a key or suspends a tenant
+	go func() {
+		if err := tenantResolver.Subscribe(ctx); err != nil {
+			logger.Error("tenant cache invalidation subscription stopped", zap.Error(err))
+		}
+	}()
+
 	// Initialize usage tracker for BigQuery analytics
 	var usageTracker usage.UsageTracker
 	usageConfig := usage.DefaultTrackerConfig(cfg.ProjectID)
@@ -190,8 +218,47 @@ func main() {
 	// Initialize route matcher with real topic (async mode)
 	routeMatcher := routes.NewMatcher(pubsubTopic, statusStore, logger, baseURL)
 
-	// Load route configurations (sync/async modes)
-	routeConfigs := config.LoadRoutesFromEnv()
+	// loadRoutes loads the route configurations (sync/async modes). An
+	// apx/v1 manifest adds its routes and policy bundles; the bundles are
+	// applied by the caller once the whole manifest is known to be valid.
+	loadRoutes := func() ([]config.RouteConfig, *crd.Manifest, error) {
+		routeConfigs := config.LoadRoutesFromEnv()
+		if cfg.RoutesFile == "" {
+			return routeConfigs, nil, nil
+		}
+
+		manifest, err := crd.LoadFile(cfg.RoutesFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Info("loaded routes manifest",
+			zap.String("file", cfg.RoutesFile),
+			zap.Int("products", len(manifest.Products)),
+			zap.Int("routes", len(manifest.RouteConfigs)),
+			zap.Int("policy_bundles", len(manifest.PolicyBundles)))
+		return append(routeConfigs, manifest.RouteConfigs...), manifest, nil
+	}
+
+	applyManifestBundles := func(manifest *crd.Manifest) {
+		if manifest == nil {
+			return
+		}
+		if policyStore != nil {
+			policyStore.Replace(cfg.RoutesFile, manifest.PolicyBundles)
+		} else if len(manifest.PolicyBundles) > 0 {
+			logger.Warn("policy store unavailable, ignoring manifest policy bundles",
+				zap.Int("count", len(manifest.PolicyBundles)))
+		}
+	}
+
+	routeConfigs, manifest, err := loadRoutes()
+	if err != nil {
+		logger.Fatal("invalid routes manifest",
+			zap.String("file", cfg.RoutesFile),
+			zap.Error(err))
+	}
+	applyManifestBundles(manifest)
+
 	if len(routeConfigs) == 0 {
 		logger.Info("no route configurations found, using defaults (async-only mode)")
 	} else {
@@ -205,14 +272,80 @@ func main() {
 		}
 	}
 
-	// Initialize sync proxy for configured routes
-	syncProxyMulti := routes.NewSyncProxyMulti(routeConfigs, logger)
-	defer syncProxyMulti.Close()
+	// Initialize sync proxy for configured routes. Reloads swap in a new
+	// generation; the previous one is closed once its requests have drained
+	routeHolder := routes.NewRouteHolder(routes.NewSyncProxyMulti(routeConfigs, logger), logger)
+	defer routeHolder.Close()
+
+	// Async route resolution shares the sync proxy's route table
+	routeMatcher.SetRouteTable(routeHolder.Table())
+
+	// Routes come from the environment and routes file, and from
+	// control-API. A reload of either swaps in both sources' latest routes.
+	routeSources := config.NewRouteSources(config.RouteSourceLocal, config.RouteSourceControlAPI)
+	swapRoutes := func(newRoutes []config.RouteConfig) {
+		newProxy := routes.NewSyncProxyMulti(newRoutes, logger)
+		routeHolder.Swap(newProxy)
+		routeMatcher.SetRouteTable(newProxy.Table())
+	}
+	routeSources.Update(config.RouteSourceLocal, routeConfigs, func([]config.RouteConfig) {}) // Already live
+
+	// Reload the routes manifest and local policy bundles when they change
+	// or on SIGHUP. A reload that fails validation is rejected and the
+	// running config kept.
+	if cfg.RoutesFile != "" {
+		routesWatcher := config.NewFileWatcher(config.FileWatcherConfig{
+			Name:   "routes",
+			Paths:  []string{cfg.RoutesFile},
+			Logger: logger,
+			OnReload: func() error {
+				newRoutes, manifest, err := loadRoutes()
+				if err != nil {
+					return err
+				}
+				routeSources.Update(config.RouteSourceLocal, newRoutes, swapRoutes)
+				applyManifestBundles(manifest)
+				return nil
+			},
+		})
+		go func() {
+			if err := routesWatcher.Start(ctx); err != nil {
+				logger.Error("routes watcher stopped", zap.Error(err))
+			}
+		}()
+	}
+	if policyStore != nil && cfg.PolicyStoreType == "local" {
+		policyWatcher := config.NewFileWatcher(config.FileWatcherConfig{
+			Name:   "policies",
+			Paths:  []string{cfg.PolicyDir},
+			Logger: logger,
+			OnReload: func() error {
+				return policyStore.Reload(ctx)
+			},
+		})
+		go func() {
+			if err := policyWatcher.Start(ctx); err != nil {
+				logger.Error("policy watcher stopped", zap.Error(err))
+			}
+		}()
+	}
 
 	// Initialize dynamic config loader (polls control-API for gateway configs)
 	controlAPIURL := os.Getenv("CONTROL_API_URL")
 	tenantID := os.Getenv("TENANT_ID")
 
+	// Routes last fetched from control-API are kept here, so a restart serves
+	// them even while control-API is unreachable
+	snapshotPath := os.Getenv("ROUTES_SNAPSHOT_PATH")
+	reloadInterval := config.DefaultReloadInterval
+	if v := os.Getenv("ROUTES_RELOAD_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logger.Fatal("invalid ROUTES_RELOAD_INTERVAL", zap.String("value", v), zap.Error(err))
+		}
+		reloadInterval = d
+	}
+
 	var dynamicLoader *config.DynamicLoader
 	if controlAPIURL != "" && tenantID != "" {
 		logger.Info("initializing dynamic config loader",
@@ -222,27 +355,18 @@ func main() {
 		dynamicLoader = config.NewDynamicLoader(config.DynamicLoaderConfig{
 			ControlAPIURL:  controlAPIURL,
 			TenantID:       tenantID,
-			ReloadInterval: 60 * time.Second,
+			ReloadInterval: reloadInterval,
+			SnapshotPath:   snapshotPath,
 			Logger:         logger,
 			OnChange: func(newRoutes []config.RouteConfig) error {
 				// Reload sync proxy with new routes
 				logger.Info("reloading sync proxy with new routes",
 					zap.Int("route_count", len(newRoutes)))
 
-				// Create new sync proxy with updated routes
-				newProxy := routes.NewSyncProxyMulti(newRoutes, logger)
-
-				// Replace the old proxy (graceful swap)
-				// Note: We can't close the old proxy immediately as there might be
-				// in-flight requests. In production, use a more sophisticated approach.
-				oldProxy := syncProxyMulti
-				syncProxyMulti = newProxy
-
-				// Close old proxy after a grace period
-				go func() {
-					time.Sleep(30 * time.Second)
-					oldProxy.Close()
-				}()
+				// Create new sync proxy with the updated routes, plus the
+				// local ones, and swap it in; requests in flight finish on
+				// the old generation
+				routeSources.Update(config.RouteSourceControlAPI, newRoutes, swapRoutes)
 
 				return nil
 			},
@@ -268,7 +392,7 @@ func main() {
 	}
 
 	// Initialize health checker with component clients
-	healthChecker := health.NewChecker(policyStore, pubsubTopic, observabilityInit, logger)
+	healthChecker := health.NewChecker(policyStore, pubsubTopic, observabilityInit, logger).WithRateLimit(rateLimitFailover)
 
 	// Health check endpoint - matches portal expectations
 	r.HandleFunc("/health", healthChecker.Handler()).Methods(http.MethodGet)
@@ -291,24 +415,145 @@ func main() {
 	// Prometheus metrics endpoint
 	r.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
 
+	// Routes accept the credentials configured in their policy bundle's auth
+	// section (API keys, JWTs, OAuth2 access tokens or client certificates);
+	// routes without one take API keys
+	authOptions := middleware.AuthOptions{
+		JWT:          auth.NewJWTAuthenticator(pkgauth.RemoteKeySetConfig{}, logger),
+		OAuth2:       auth.NewOAuth2Authenticator(pkgauth.IntrospectionConfig{}, logger),
+		Certificates: auth.NewCertificateAuthenticator(logger),
+		Policy: func(r *http.Request) *policy.AuthPolicy {
+			if policyStore == nil {
+				return nil
+			}
+			match, err := routeHolder.Match(r)
+			if err != nil || match.Route.Config.PolicyBundle == "" {
+				return nil
+			}
+			bundle, err := policyStore.Get(r.Context(), match.Route.Config.PolicyBundle)
+			if err != nil {
+				return nil
+			}
+			authPolicy, err := bundle.Auth()
+			if err != nil {
+				logger.Warn("invalid auth policy",
+					zap.String("policy_bundle", match.Route.Config.PolicyBundle),
+					zap.Error(err))
+				return nil
+			}
+			return authPolicy
+		},
+	}
+
+	// Certificate-authenticated requests carry a signed identity header to
+	// backends when a signing key is configured
+	if cfg.IdentitySigningKey != "" {
+		signer, err := pkgauth.NewIdentitySigner([]byte(cfg.IdentitySigningKey))
+		if err != nil {
+			logger.Fatal("invalid IDENTITY_SIGNING_KEY", zap.Error(err))
+		}
+		authOptions.IdentitySigner = signer
+	}
+
+	// Routes can require scopes of the API key or token calling them
+	requiredScopes := func(r *http.Request) []string {
+		match, err := routeHolder.Match(r)
+		if err != nil {
+			return nil
+		}
+		return match.Route.Config.Scopes
+	}
+
+	// Rate limit and quota headers follow the format chosen by the route's
+	// product
+	limitHeaderFormat := func(r *http.Request) middleware.LimitHeaderFormat {
+		match, err := routeHolder.Match(r)
+		if err != nil {
+			return middleware.LimitHeadersLegacy
+		}
+		return middleware.LimitHeaderFormat(match.Route.Config.RateLimitHeaders)
+	}
+
+	// Requests cost their route's weight, plus a unit per bodyBytes of body;
+	// backends can report the actual cost for quotas and usage
+	costModel := func(r *http.Request) *middleware.CostModel {
+		match, err := routeHolder.Match(r)
+		if err != nil {
+			return nil
+		}
+		cost := match.Route.Config.Cost
+		if cost == (config.CostConfig{}) {
+			return nil
+		}
+		return &middleware.CostModel{
+			Weight:         cost.Weight,
+			BodyBytes:      cost.BodyBytes,
+			ResponseHeader: cost.ResponseHeader,
+		}
+	}
+
+	// Routes are also limited by their policy bundle's quotas (per API key,
+	// client IP, route, tenant and route...), counted in Redis
+	rateLimitOptions := middleware.RateLimitOptions{
+		Limiter:        rateLimitFailover.Wrap(limiter.NewRedisLimiter(redisClient, "")),
+		Failover:       rateLimitFailover,
+		TrustedProxies: cfg.TrustedProxies,
+		Limits: func(r *http.Request) *middleware.RouteRateLimits {
+			if policyStore == nil {
+				return nil
+			}
+			match, err := routeHolder.Match(r)
+			if err != nil || match.Route.Config.PolicyBundle == "" {
+				return nil
+			}
+			bundle, err := policyStore.Get(r.Context(), match.Route.Config.PolicyBundle)
+			if err != nil {
+				return nil
+			}
+			rules, err := bundle.RateLimits()
+			if err != nil {
+				logger.Warn("invalid rate limit policy",
+					zap.String("policy_bundle", match.Route.Config.PolicyBundle),
+					zap.Error(err))
+				return nil
+			}
+			if len(rules) == 0 {
+				return nil
+			}
+			return &middleware.RouteRateLimits{
+				Bundle: bundle.Name,
+				Route:  cmp.Or(match.Route.Config.Name, match.Route.Config.Path),
+				Rules:  rules,
+			}
+		},
+	}
+
 	// Main routing handler
 	// Supports both sync (direct proxy) and async (pub/sub) modes
 	// Middleware order:
 	//   1. RequestID - Generate unique request ID
-	//   2. TenantContext - Resolve tenant from API key (security-critical)
-	//   3. QuotaEnforcement - Check monthly quota limits (returns 402 if exceeded)
-	//   4. RateLimit - Check per-minute rate limits (returns 429 if exceeded)
-	//   5. PolicyVersionTag - Add policy version metadata
-	//   6. UsageTracker - Track usage events to BigQuery (async, non-blocking)
-	//   7. Metrics - Record metrics
-	//   8. Logging - Log request details
-	//   9. Tracing - Add distributed tracing
+	//   2. MatchRoute - Match the request's route once for the steps below and the proxy
+	//   3. TenantContext - Resolve tenant from API key, token or client certificate (security-critical)
+	//   4. Permissions - Check API key allowlists and route scopes (returns 403 if denied)
+	//   5. LimitHeaders - Send rate limit and quota headers in the product's format
+	//   6. Cost - Price the request by its route's cost model
+	//   7. QuotaEnforcement - Check monthly quota limits (returns 402 if exceeded)
+	//   8. RateLimit - Check tier and policy bundle rate limits (returns 429 if exceeded)
+	//   9. PolicyVersionTag - Add policy version metadata
+	//   10. UsageTracker - Track usage events to BigQuery (async, non-blocking)
+	//   11. Metrics - Record metrics
+	//   12. Logging - Log request details
+	//   13. Tracing - Add distributed tracing
 	asyncHandler := middleware.Chain(
 		http.HandlerFunc(routeMatcher.Handle),
 		middleware.WithStepLogging("RequestID", logger, middleware.RequestID(logger)),
-		middleware.WithStepLogging("TenantContext", logger, middleware.TenantContext(tenantResolver, logger)), // Secure tenant resolution
+		middleware.WithStepLogging("MatchRoute", logger, routeHolder.MatchRoute()),
+		middleware.WithStepLogging("TenantContext", logger, middleware.TenantContextWithAuth(tenantResolver, authOptions, logger)), // Secure tenant resolution
+		middleware.WithStepLogging("Permissions", logger, middleware.Permissions(requiredScopes, logger)), // API key allowlists and route scopes
+		middleware.WithStepLogging("LimitHeaders", logger, middleware.LimitHeaders(limitHeaderFormat)), // X-RateLimit-* or IETF RateLimit headers
+		middleware.WithStepLogging("Cost", logger, middleware.Cost(costModel)), // Request cost for limits, quotas and usage
 		middleware.WithStepLogging("QuotaEnforcement", logger, middleware.QuotaEnforcement(quotaEnforcer, logger)), // Monthly quota enforcement
-		middleware.WithStepLogging("RateLimit", logger, middleware.RateLimit(rateLimiter, logger)), // Per-minute rate limiting
+		middleware.WithStepLogging("RateLimit", logger, middleware.RateLimitWithOptions(rateLimiter, rateLimitOptions, logger)), // Tier and policy bundle rate limits
 		middleware.WithStepLogging("PolicyVersionTag", logger, middleware.PolicyVersionTag(policyStore, logger)),
 		middleware.WithStepLogging("UsageTracker", logger, middleware.UsageTracker(usageTracker, logger)), // BigQuery usage tracking
 		middleware.WithStepLogging("Metrics", logger, middleware.Metrics()),
@@ -321,11 +566,15 @@ func main() {
 	// Otherwise, falls back to async (pub/sub) mode
 	r.PathPrefix("/").Handler(
 		middleware.Chain(
-			syncProxyMulti.HandleWithFallback(asyncHandler),
+			routeHolder.HandleWithFallback(asyncHandler),
 			middleware.WithStepLogging("RequestID", logger, middleware.RequestID(logger)),
-			middleware.WithStepLogging("TenantContext", logger, middleware.TenantContext(tenantResolver, logger)), // Secure tenant resolution
+			middleware.WithStepLogging("MatchRoute", logger, routeHolder.MatchRoute()),
+			middleware.WithStepLogging("TenantContext", logger, middleware.TenantContextWithAuth(tenantResolver, authOptions, logger)), // Secure tenant resolution
+			middleware.WithStepLogging("Permissions", logger, middleware.Permissions(requiredScopes, logger)), // API key allowlists and route scopes
+			middleware.WithStepLogging("LimitHeaders", logger, middleware.LimitHeaders(limitHeaderFormat)), // X-RateLimit-* or IETF RateLimit headers
+			middleware.WithStepLogging("Cost", logger, middleware.Cost(costModel)), // Request cost for limits, quotas and usage
 			middleware.WithStepLogging("QuotaEnforcement", logger, middleware.QuotaEnforcement(quotaEnforcer, logger)), // Monthly quota enforcement
-			middleware.WithStepLogging("RateLimit", logger, middleware.RateLimit(rateLimiter, logger)), // Per-minute rate limiting
+			middleware.WithStepLogging("RateLimit", logger, middleware.RateLimitWithOptions(rateLimiter, rateLimitOptions, logger)), // Tier and policy bundle rate limits
 			middleware.WithStepLogging("PolicyVersionTag", logger, middleware.PolicyVersionTag(policyStore, logger)),
 			middleware.WithStepLogging("UsageTracker", logger, middleware.UsageTracker(usageTracker, logger)), // BigQuery usage tracking
 			middleware.WithStepLogging("Metrics", logger, middleware.Metrics()),
@@ -339,17 +588,41 @@ func main() {
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      r,
 		ReadTimeout:  30 * time.Second,  // Increased for long-running requests
-		WriteTimeout: 300 * time.Second, // Match Envoy timeout (5 minutes)
+		WriteTimeout: 300 * time.Second, // Match Envoy timeout (5 minutes); sync routes extend it
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// gRPC clients speak HTTP/2 without TLS (h2c) to the router; HTTP/1
+	// clients are unaffected
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+
+	// Serve TLS, optionally requesting client certificates, when a server
+	// certificate is configured
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		logger.Fatal("failed to configure TLS", zap.Error(err))
+	}
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+		srv.Protocols.SetHTTP2(true)
+	}
+
 	// Start server in goroutine
 	go func() {
 		logger.Info("starting router service",
 			zap.Int("port", cfg.Port),
 			zap.String("environment", cfg.Environment),
+			zap.Bool("tls", tlsConfig != nil),
+			zap.String("client_auth", cfg.TLSClientAuth),
 		)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		serve := srv.ListenAndServe
+		if tlsConfig != nil {
+			// The certificate is already in TLSConfig
+			serve = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			logger.Fatal("server failed", zap.Error(err))
 		}
 	}()
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	"go.uber.org/zap"
+)
+
+func TestTenantContextWithAuth_APIKeyLocations(t *testing.T) {
+	policies := map[string]*policy.PolicyBundle{
+		"/migrated": {AuthConfig: map[string]interface{}{"apiKey": map[string]interface{}{}}},
+		"/partner":  {AuthConfig: map[string]interface{}{"apiKey": map[string]interface{}{"header": "X-Partner-Key"}}},
+		"/webhook":  {AuthConfig: map[string]interface{}{"apiKey": map[string]interface{}{"queryParam": "api_key"}}},
+	}
+
+	var backendURI string
+	handler := middleware.TenantContextWithAuth(apiKeyResolver{}, middleware.AuthOptions{
+		Policy: func(r *http.Request) *policy.AuthPolicy {
+			bundle, ok := policies[r.URL.Path]
+			if !ok {
+				return nil
+			}
+			p, err := bundle.Auth()
+			if err != nil {
+				t.Fatalf("Auth() error: %v", err)
+			}
+			return p
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendURI = r.URL.RequestURI()
+		w.Write([]byte(middleware.GetTenantID(r.Context())))
+	}))
+
+	const apiKey = "apx_test_0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		target     string
+		header     string
+		wantStatus int
+		wantURI    string
+	}{
+		{"default header", "/migrated", "X-API-Key", http.StatusOK, "/migrated"},
+		{"custom header", "/partner", "X-Partner-Key", http.StatusOK, "/partner"},
+		{"default header on custom route", "/partner", "X-API-Key", http.StatusUnauthorized, ""},
+		{"header without bundle", "/plain", "X-API-Key", http.StatusUnauthorized, ""},
+		{"query parameter", "/webhook?event=paid&api_key=" + apiKey + "&attempt=2", "", http.StatusOK, "/webhook?event=paid&attempt=2"},
+		{"query parameter not allowed", "/migrated?api_key=" + apiKey, "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backendURI = ""
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, apiKey)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got %d %q, want %d", rr.Code, rr.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && (rr.Body.String() != "key-tenant" || backendURI != tt.wantURI) {
+				t.Errorf("got tenant %q, backend URI %q; want key-tenant, %q", rr.Body.String(), backendURI, tt.wantURI)
+			}
+		})
+	}
+
+	// A rejected query key is stripped as well
+	req := httptest.NewRequest(http.MethodGet, "/webhook?api_key=apx_test_bad", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if req.URL.RawQuery != "" || req.RequestURI != "/webhook" {
+		t.Errorf("query key left in request: %q %q", req.URL.RawQuery, req.RequestURI)
+	}
+}
+
+// TestTenantContextWithAuth_AsyncChain tests a query parameter key on an
+// async route, whose requests pass through the middleware chain twice
+func TestTenantContextWithAuth_AsyncChain(t *testing.T) {
+	bundle := &policy.PolicyBundle{AuthConfig: map[string]interface{}{"apiKey": map[string]interface{}{"queryParam": "api_key"}}}
+	authPolicy, err := bundle.Auth()
+	if err != nil {
+		t.Fatalf("Auth() error: %v", err)
+	}
+	tenantContext := middleware.TenantContextWithAuth(apiKeyResolver{}, middleware.AuthOptions{
+		Policy: func(r *http.Request) *policy.AuthPolicy { return authPolicy },
+	}, zap.NewNop())
+
+	var backendURI string
+	asyncHandler := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendURI = r.URL.RequestURI()
+		w.Write([]byte(middleware.GetTenantID(r.Context())))
+	}), tenantContext)
+	handler := middleware.Chain(asyncHandler, tenantContext)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook?api_key=apx_test_0123456789abcdef0123456789abcdef&event=paid", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "key-tenant" || backendURI != "/webhook?event=paid" {
+		t.Errorf("got %d %q, backend URI %q; want 200 key-tenant, /webhook?event=paid", rr.Code, rr.Body.String(), backendURI)
+	}
+}
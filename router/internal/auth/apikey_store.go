@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+)
+
+// API key store errors
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyExpired  = errors.New("api key has expired")
+)
+
+// APIKeyRecord is a stored API key. Only the key's hash is kept; the key
+// itself is shown once, when it is issued. The tenant is referenced by ID,
+// so its current state is read whenever the key is resolved.
+type APIKeyRecord struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`      // pkgauth.HashAPIKey of the full key
+	TenantID  string    `json:"tenant_id"` // Tenant resource ID
+	Live      bool      `json:"live"`      // apx_live_ rather than apx_test_
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // Zero: never expires
+
+	// Scopes and route/method allowlists; a key without them can call
+	// every route that requires no scopes
+	pkgauth.Permissions
+}
+
+// Active reports whether the key has not expired at now
+func (k *APIKeyRecord) Active(now time.Time) bool {
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// APIKeyStore stores hashed API keys by key ID. A tenant can hold any
+// number of keys.
+type APIKeyStore interface {
+	// Get returns the key with the given ID, or ErrAPIKeyNotFound
+	Get(ctx context.Context, id string) (*APIKeyRecord, error)
+
+	// Put creates or replaces a key
+	Put(ctx context.Context, key *APIKeyRecord) error
+
+	// Delete removes a key
+	Delete(ctx context.Context, id string) error
+
+	// List returns a tenant's keys, oldest first
+	List(ctx context.Context, tenantID string) ([]*APIKeyRecord, error)
+}
+
+// IssueAPIKey creates a key for the tenant with the given permissions and
+// returns it. expiresAt may be zero.
+func IssueAPIKey(ctx context.Context, store APIKeyStore, tenantID string, live bool, expiresAt time.Time, perms pkgauth.Permissions) (string, *APIKeyRecord, error) {
+	info, err := pkgauth.GenerateAPIKey(live)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := &APIKeyRecord{
+		ID:          info.KeyID,
+		Hash:        pkgauth.HashAPIKey(info.RawKey),
+		TenantID:    tenantID,
+		Live:        live,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expiresAt,
+		Permissions: perms,
+	}
+	if err := store.Put(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return info.RawKey, key, nil
+}
+
+// RotateAPIKey issues a replacement for key id for the same tenant and
+// permissions. The old key keeps working for the overlap window, so clients
+// can switch without downtime.
+func RotateAPIKey(ctx context.Context, store APIKeyStore, id string, overlap time.Duration) (string, *APIKeyRecord, error) {
+	old, err := store.Get(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if !old.Active(time.Now()) {
+		return "", nil, ErrAPIKeyExpired
+	}
+
+	raw, key, err := IssueAPIKey(ctx, store, old.TenantID, old.Live, time.Time{}, old.Permissions)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if deadline := time.Now().Add(overlap); old.ExpiresAt.IsZero() || deadline.Before(old.ExpiresAt) {
+		old.ExpiresAt = deadline
+		if err := store.Put(ctx, old); err != nil {
+			return "", nil, fmt.Errorf("failed to expire rotated key: %w", err)
+		}
+	}
+	return raw, key, nil
+}
+
+// ImportLegacyAPIKey stores the hash of a legacy 41-character key under its
+// hash-derived key ID, so it resolves without the raw-key tenant lookup and
+// can be rotated like any other key
+func ImportLegacyAPIKey(ctx context.Context, store APIKeyStore, apiKey string, tenantID string) (*APIKeyRecord, error) {
+	info, err := pkgauth.ParseAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Legacy {
+		return nil, fmt.Errorf("%w: not a legacy key", pkgauth.ErrInvalidAPIKey)
+	}
+
+	key := &APIKeyRecord{
+		ID:        info.KeyID,
+		Hash:      pkgauth.HashAPIKey(apiKey),
+		TenantID:  tenantID,
+		Live:      info.IsProduction,
+		CreatedAt: time.Now(),
+	}
+	if err := store.Put(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RedisAPIKeyStore implements APIKeyStore using Redis. Keys are stored as
+// JSON under apikey:<id> and indexed per tenant in the apikey-tenant:<id>
+// set; expiring keys are evicted by Redis once they expire.
+type RedisAPIKeyStore struct {
+	client *redis.Client
+}
+
+// NewRedisAPIKeyStore creates a Redis-backed API key store
+func NewRedisAPIKeyStore(client *redis.Client) *RedisAPIKeyStore {
+	return &RedisAPIKeyStore{client: client}
+}
+
+func (s *RedisAPIKeyStore) recordKey(id string) string {
+	return fmt.Sprintf("apikey:%s", id)
+}
+
+func (s *RedisAPIKeyStore) tenantIndexKey(tenantID string) string {
+	return fmt.Sprintf("apikey-tenant:%s", tenantID)
+}
+
+// Get returns the key with the given ID
+func (s *RedisAPIKeyStore) Get(ctx context.Context, id string) (*APIKeyRecord, error) {
+	data, err := s.client.Get(ctx, s.recordKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	var key APIKeyRecord
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal api key: %w", err)
+	}
+	return &key, nil
+}
+
+// Put creates or replaces a key
+func (s *RedisAPIKeyStore) Put(ctx context.Context, key *APIKeyRecord) error {
+	if key.ID == "" || key.Hash == "" || key.TenantID == "" {
+		return fmt.Errorf("api key id, hash and tenant are required")
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal api key: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, s.recordKey(key.ID), data, 0)
+	if !key.ExpiresAt.IsZero() {
+		pipe.ExpireAt(ctx, s.recordKey(key.ID), key.ExpiresAt)
+	}
+	pipe.SAdd(ctx, s.tenantIndexKey(key.TenantID), key.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store api key: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a key
+func (s *RedisAPIKeyStore) Delete(ctx context.Context, id string) error {
+	key, err := s.Get(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, s.recordKey(id))
+	pipe.SRem(ctx, s.tenantIndexKey(key.TenantID), id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	return nil
+}
+
+// List returns a tenant's keys, dropping expired keys from the index
+func (s *RedisAPIKeyStore) List(ctx context.Context, tenantID string) ([]*APIKeyRecord, error) {
+	ids, err := s.client.SMembers(ctx, s.tenantIndexKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	var keys []*APIKeyRecord
+	for _, id := range ids {
+		key, err := s.Get(ctx, id)
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			s.client.SRem(ctx, s.tenantIndexKey(tenantID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	sortKeys(keys)
+	return keys, nil
+}
+
+// MemoryAPIKeyStore implements APIKeyStore in memory, for tests and
+// single-instance development setups
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKeyRecord
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[string]*APIKeyRecord)}
+}
+
+// Get returns the key with the given ID
+func (s *MemoryAPIKeyStore) Get(ctx context.Context, id string) (*APIKeyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// Put creates or replaces a key
+func (s *MemoryAPIKeyStore) Put(ctx context.Context, key *APIKeyRecord) error {
+	if key.ID == "" || key.Hash == "" || key.TenantID == "" {
+		return fmt.Errorf("api key id, hash and tenant are required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *key
+	s.keys[key.ID] = &copied
+	return nil
+}
+
+// Delete removes a key
+func (s *MemoryAPIKeyStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	return nil
+}
+
+// List returns a tenant's keys
+func (s *MemoryAPIKeyStore) List(ctx context.Context, tenantID string) ([]*APIKeyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*APIKeyRecord
+	for _, key := range s.keys {
+		if key.TenantID == tenantID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+
+	sortKeys(keys)
+	return keys, nil
+}
+
+func sortKeys(keys []*APIKeyRecord) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+}
@@ -0,0 +1,117 @@
+//go:build integration
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+// TestRedisAPIKeyStore runs against the Redis at REDIS_ADDR (DB 1)
+func TestRedisAPIKeyStore(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD"), DB: 1})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available:", err)
+	}
+
+	store := NewRedisAPIKeyStore(client)
+	tenantID := "apikey_store_test_" + time.Now().Format("150405.000000")
+	defer client.Del(ctx, store.tenantIndexKey(tenantID))
+
+	raw, key, err := IssueAPIKey(ctx, store, tenantID, true, time.Time{}, pkgauth.Permissions{})
+	if err != nil {
+		t.Fatalf("IssueAPIKey() error: %v", err)
+	}
+	defer store.Delete(ctx, key.ID)
+
+	// Redis holds the key ID and hash, never the key
+	names, _ := client.Keys(ctx, "*"+raw+"*").Result()
+	if len(names) != 0 {
+		t.Errorf("raw key found in Redis key names: %v", names)
+	}
+
+	_, rotated, err := RotateAPIKey(ctx, store, key.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("RotateAPIKey() error: %v", err)
+	}
+	defer store.Delete(ctx, rotated.ID)
+
+	if ttl := client.TTL(ctx, store.recordKey(key.ID)).Val(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("rotated key TTL = %v, want the overlap window", ttl)
+	}
+	keys, err := store.List(ctx, tenantID)
+	if err != nil || len(keys) != 2 {
+		t.Errorf("List() = %d keys, %v; want 2", len(keys), err)
+	}
+
+	store.Delete(ctx, key.ID)
+	if _, err := store.Get(ctx, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Get() after Delete error = %v", err)
+	}
+}
+
+// TestTenantCacheInvalidation checks that a key revoked on one router stops
+// working on another immediately, through the Redis invalidation channel
+func TestTenantCacheInvalidation(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD"), DB: 1})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available:", err)
+	}
+
+	tenantID := "tenant_cache_test_" + time.Now().Format("150405.000000")
+	store := NewRedisAPIKeyStore(client)
+	routerA := NewFirestoreTenantResolver(newTenantRepo(tenantID), store, client, zap.NewNop())
+	routerB := NewFirestoreTenantResolver(newTenantRepo(tenantID), store, client, zap.NewNop())
+	go routerB.Subscribe(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	defer client.Del(ctx, store.tenantIndexKey(tenantID), routerA.tenantIndexKey(tenantID))
+	raw, key, err := IssueAPIKey(ctx, store, tenantID, true, time.Time{}, pkgauth.Permissions{})
+	if err != nil {
+		t.Fatalf("IssueAPIKey() error: %v", err)
+	}
+	defer store.Delete(ctx, key.ID)
+
+	for _, r := range []*FirestoreTenantResolver{routerA, routerB} {
+		if _, err := r.ResolveTenant(ctx, raw); err != nil {
+			t.Fatalf("ResolveTenant() error: %v", err)
+		}
+	}
+
+	if err := routerA.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := routerB.ResolveTenant(ctx, raw)
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("revoked key still resolves on another router: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
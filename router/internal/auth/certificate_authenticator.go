@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+// CertificateAuthenticator implements middleware.CertificateAuthenticator.
+// It verifies client certificates against the CA bundle named by the route's
+// policy bundle, or the chains already verified by the TLS server, and maps
+// the certificate identity to a tenant. CA bundles are read once and shared
+// by all bundles using the same file.
+type CertificateAuthenticator struct {
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	pools map[string]*x509.CertPool
+}
+
+// NewCertificateAuthenticator creates a client certificate authenticator
+func NewCertificateAuthenticator(logger *zap.Logger) *CertificateAuthenticator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &CertificateAuthenticator{
+		logger: logger,
+		pools:  make(map[string]*x509.CertPool),
+	}
+}
+
+// AuthenticateCertificate verifies the client certificate chain (leaf
+// first) and returns the tenant it maps to. verified reports whether the TLS
+// server already verified the chain against its own client CA.
+func (a *CertificateAuthenticator) AuthenticateCertificate(ctx context.Context, chain []*x509.Certificate, verified bool, p *policy.MTLSAuth) (*tenant.Tenant, *pkgauth.CertificateIdentity, error) {
+	if len(chain) == 0 {
+		return nil, nil, pkgauth.ErrNoClientCertificate
+	}
+
+	var id *pkgauth.CertificateIdentity
+	switch {
+	case p.TrustStore != "":
+		roots, err := a.pool(p.TrustStore)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id, err = pkgauth.VerifyClientCertificate(chain, roots); err != nil {
+			return nil, nil, err
+		}
+	case verified:
+		id = pkgauth.NewCertificateIdentity(chain[0])
+	default:
+		return nil, nil, errors.New("no trust store configured for client certificates")
+	}
+
+	for _, m := range p.Identities {
+		if !id.Matches(m.Identity) {
+			continue
+		}
+		t, err := tenantFromClaims(pkgauth.Claims{
+			policy.DefaultTenantClaim:       m.Tenant,
+			policy.DefaultOrganizationClaim: m.Organization,
+			policy.DefaultTierClaim:         m.Tier,
+		}, policy.ClaimMappings{
+			Tenant:       policy.DefaultTenantClaim,
+			Organization: policy.DefaultOrganizationClaim,
+			Tier:         policy.DefaultTierClaim,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return t, id, nil
+	}
+	return nil, nil, fmt.Errorf("client certificate %q is not mapped to a tenant", id.Name())
+}
+
+// pool returns the shared CA pool for a bundle file
+func (a *CertificateAuthenticator) pool(path string) (*x509.CertPool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if pool, ok := a.pools[path]; ok {
+		return pool, nil
+	}
+
+	pool, err := pkgauth.LoadCertPool(path)
+	if err != nil {
+		return nil, err
+	}
+	a.pools[path] = pool
+	a.logger.Info("client CA bundle loaded", zap.String("trust_store", path))
+	return pool, nil
+}
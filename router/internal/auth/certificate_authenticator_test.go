@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+// newClientCA creates a CA, writes it to a PEM file and returns the file
+// and a function issuing client certificates for a SPIFFE ID
+func newClientCA(t *testing.T) (string, func(spiffeID string) tls.Certificate) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Partner CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o644); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	issue := func(spiffeID string) tls.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		u, _ := url.Parse(spiffeID)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: "client"},
+			URIs:         []*url.URL{u},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("issue certificate: %v", err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return path, issue
+}
+
+func TestTenantContextWithAuth_ClientCertificates(t *testing.T) {
+	caFile, issue := newClientCA(t)
+	_, untrusted := newClientCA(t)
+
+	mtls := map[string]interface{}{
+		"trustStore": caFile,
+		"identities": []interface{}{
+			map[string]interface{}{"identity": "spiffe://acme.example/ns/payments/*", "tenant": "acme_payments_prod", "tier": "enterprise"},
+		},
+	}
+	policies := map[string]*policy.PolicyBundle{
+		"/mtls":     {AuthConfig: map[string]interface{}{"mtls": mtls}},
+		"/optional": {AuthConfig: map[string]interface{}{"mtls": mergeMap(mtls, "requireClientCert", false), "apiKey": map[string]interface{}{}}},
+	}
+
+	key := []byte(strings.Repeat("s", 32))
+	signer, _ := pkgauth.NewIdentitySigner(key)
+	handler := middleware.TenantContextWithAuth(apiKeyResolver{}, middleware.AuthOptions{
+		Certificates:   NewCertificateAuthenticator(zap.NewNop()),
+		IdentitySigner: signer,
+		Policy: func(r *http.Request) *policy.AuthPolicy {
+			bundle, ok := policies[r.URL.Path]
+			if !ok {
+				return nil
+			}
+			p, err := bundle.Auth()
+			if err != nil {
+				t.Fatalf("Auth() error: %v", err)
+			}
+			return p
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := "-"
+		if value := r.Header.Get(pkgauth.IdentityHeader); value != "" {
+			id, err := signer.Verify(value, time.Minute)
+			if err != nil {
+				t.Errorf("backend got an invalid identity header: %v", err)
+			} else {
+				identity = id.Subject
+			}
+		}
+		w.Write([]byte(middleware.GetTenantID(r.Context()) + " " + identity))
+	}))
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	apiKey := "apx_test_0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		path       string
+		cert       *tls.Certificate
+		apiKey     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"mapped certificate", "/mtls", ptr(issue("spiffe://acme.example/ns/payments/sa/billing")), "", http.StatusOK,
+			"acme_payments_prod spiffe://acme.example/ns/payments/sa/billing"},
+		{"unmapped certificate", "/mtls", ptr(issue("spiffe://acme.example/ns/orders/sa/api")), "", http.StatusUnauthorized, ""},
+		{"untrusted CA", "/mtls", ptr(untrusted("spiffe://acme.example/ns/payments/sa/billing")), "", http.StatusUnauthorized, ""},
+		{"certificate required", "/mtls", nil, apiKey, http.StatusUnauthorized, ""},
+		{"optional certificate, API key", "/optional", nil, apiKey, http.StatusOK, "key-tenant -"},
+		{"optional certificate presented", "/optional", ptr(issue("spiffe://acme.example/ns/payments/sa/billing")), "", http.StatusOK,
+			"acme_payments_prod spiffe://acme.example/ns/payments/sa/billing"},
+		{"no policy ignores certificates", "/plain", ptr(issue("spiffe://acme.example/ns/payments/sa/billing")), apiKey, http.StatusOK, "key-tenant -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := srv.Client().Transport.(*http.Transport).Clone()
+			if tt.cert != nil {
+				transport.TLSClientConfig.Certificates = []tls.Certificate{*tt.cert}
+			}
+			client := &http.Client{Transport: transport}
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.apiKey)
+			}
+			// Client-supplied identity headers are never forwarded
+			req.Header.Set(pkgauth.IdentityHeader, "forged")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus || (tt.wantBody != "" && string(body) != tt.wantBody) {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func mergeMap(m map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	out := map[string]interface{}{key: value}
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func ptr[T any](v T) *T { return &v }
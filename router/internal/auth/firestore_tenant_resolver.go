@@ -5,51 +5,115 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stratus-meridian/apx-private/control/tenant"
 	"github.com/stratus-meridian/apx/router/internal/middleware"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	defaultCacheTTL = 5 * time.Minute
 
 	cacheKeyPrefix = "tenant-resolver"
+
+	// InvalidationChannel is the Redis pub/sub channel on which Invalidation
+	// messages are published
+	InvalidationChannel = "tenant-resolver:invalidate"
 )
 
+// Invalidation drops cached tenants on every router: a single key (by its
+// pkgauth.HashAPIKey hash) or every key of a tenant, e.g. after a revocation
+// or when an organization is suspended.
+type Invalidation struct {
+	KeyHash  string `json:"key_hash,omitempty"`
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// TenantLoader loads a tenant's current state by resource ID. Keys from the
+// key store reference their tenant by ID.
+type TenantLoader interface {
+	GetByResourceID(ctx context.Context, resourceID string) (*tenant.Tenant, error)
+}
+
+// TenantRepository is a tenant repository that also loads tenants by ID
+type TenantRepository interface {
+	tenant.Repository
+	TenantLoader
+}
+
+// cachedTenant is a resolved key, as cached in Redis and in process
+type cachedTenant struct {
+	Tenant      *tenant.Tenant       `json:"tenant"`
+	Permissions *pkgauth.Permissions `json:"permissions,omitempty"` // Nil for unrestricted keys
+	ExpiresAt   time.Time            `json:"expires_at,omitzero"`   // Key expiry
+}
+
 // FirestoreTenantResolver implements middleware.TenantResolver by looking up tenant
 // metadata from the control-plane Firestore repository with an optional Redis cache.
+// Keys with a key ID are resolved from the hashed API key store; legacy keys fall
+// back to the repository until they have been imported or rotated.
+//
+// An in-process LRU sits in front of Redis. Both are invalidated through
+// InvalidationChannel (see Subscribe), and concurrent misses for the same key
+// share a single lookup.
 type FirestoreTenantResolver struct {
-	repo          tenant.Repository
+	repo          TenantRepository
+	keys          APIKeyStore
 	cache         *redis.Client
+	local         *tenantLRU
+	flight        singleflight.Group
 	logger        *zap.Logger
 	cacheTTL      time.Duration
+	localTTL      time.Duration
 	defaultTenant *tenant.Tenant
+
+	// epoch advances on every invalidation; lookups that raced with one are
+	// not cached
+	epoch atomic.Uint64
 }
 
-// NewFirestoreTenantResolver builds a resolver backed by the shared tenant repository.
-// A Redis client is optional; when provided it is used to cache API key lookups for
-// defaultCacheTTL to minimize Firestore reads in Cloud Run/GKE.
-func NewFirestoreTenantResolver(repo tenant.Repository, cache *redis.Client, logger *zap.Logger) *FirestoreTenantResolver {
+// NewFirestoreTenantResolver builds a resolver backed by the shared tenant repository
+// and the hashed API key store. A Redis client is optional; when provided it is used
+// to cache API key lookups for defaultCacheTTL to minimize Firestore reads in Cloud
+// Run/GKE. Cache entries are keyed by key hash, never by the raw key. Lookups are
+// also cached in process for defaultLocalCacheTTL.
+//
+// Keys from the key store are resolved to the tenant's current state, loaded
+// from repo by ID.
+func NewFirestoreTenantResolver(repo TenantRepository, keys APIKeyStore, cache *redis.Client, logger *zap.Logger) *FirestoreTenantResolver {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
 	return &FirestoreTenantResolver{
 		repo:          repo,
+		keys:          keys,
 		cache:         cache,
+		local:         newTenantLRU(defaultLocalCacheSize),
 		logger:        logger,
 		cacheTTL:      defaultCacheTTL,
+		localTTL:      defaultLocalCacheTTL,
 		defaultTenant: buildDefaultTenant(),
 	}
 }
 
 // ResolveTenant fetches the tenant hierarchy for the provided API key.
 func (r *FirestoreTenantResolver) ResolveTenant(ctx context.Context, apiKey string) (*tenant.Tenant, error) {
+	t, _, err := r.ResolveAPIKey(ctx, apiKey)
+	return t, err
+}
+
+// ResolveAPIKey fetches the tenant hierarchy and the permissions of the
+// provided API key. Keys without scopes or allowlists have nil permissions.
+func (r *FirestoreTenantResolver) ResolveAPIKey(ctx context.Context, apiKey string) (*tenant.Tenant, *pkgauth.Permissions, error) {
 	if apiKey == "" {
-		return nil, fmt.Errorf("api key is required")
+		return nil, nil, fmt.Errorf("api key is required")
 	}
 
 	start := time.Now()
@@ -73,28 +137,210 @@ func (r *FirestoreTenantResolver) ResolveTenant(ctx context.Context, apiKey stri
 		)
 	}()
 
-	if err := tenant.ValidateAPIKey(apiKey); err != nil {
-		return nil, err
+	info, err := pkgauth.ParseAPIKey(apiKey)
+	if err != nil {
+		return nil, nil, err
 	}
+	keyHash := pkgauth.HashAPIKey(apiKey)
 
-	if cached := r.getFromCache(ctx, apiKey); cached != nil {
+	if cached, ok := r.local.get(keyHash); ok {
 		fromCache = true
-		tenantCtx = cached
-		return cached, nil
+		tenantCtx = cached.Tenant
+		return cached.Tenant, cached.Permissions, nil
 	}
 
-	var err error
-	tenantCtx, err = r.repo.GetByAPIKey(ctx, apiKey)
+	// Concurrent misses for the same key share one Redis and Firestore read.
+	// Misses after an invalidation don't join a read that started before it,
+	// so they see the tenant's new state.
+	epoch := r.epoch.Load()
+	v, err, _ := r.flight.Do(keyHash+"@"+strconv.FormatUint(epoch, 10), func() (interface{}, error) {
+		if cached := r.getFromCache(ctx, keyHash); cached != nil {
+			r.setLocal(keyHash, cached, epoch)
+			fromCache = true
+			return cached, nil
+		}
+
+		resolved, err := r.lookup(ctx, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateTenantState(resolved.Tenant); err != nil {
+			return nil, err
+		}
+
+		// An invalidation during the lookup may have been for this tenant
+		if r.epoch.Load() == epoch {
+			r.setCache(ctx, keyHash, resolved)
+			r.setLocal(keyHash, resolved, epoch)
+		}
+		return resolved, nil
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if err := validateTenantState(tenantCtx); err != nil {
-		return nil, err
+	resolved := v.(*cachedTenant)
+	tenantCtx = resolved.Tenant
+	return resolved.Tenant, resolved.Permissions, nil
+}
+
+// InvalidateKey drops a key from the shared Redis cache and, through
+// InvalidationChannel, from every router's in-process cache
+func (r *FirestoreTenantResolver) InvalidateKey(ctx context.Context, keyHash string) error {
+	r.invalidate(Invalidation{KeyHash: keyHash})
+	if r.cache == nil {
+		return nil
+	}
+
+	if err := r.cache.Del(ctx, r.cacheKey(keyHash)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cached key: %w", err)
+	}
+	return r.publish(ctx, Invalidation{KeyHash: keyHash})
+}
+
+// InvalidateTenant drops every cached key of a tenant, e.g. after its
+// organization or environment was suspended
+func (r *FirestoreTenantResolver) InvalidateTenant(ctx context.Context, tenantID string) error {
+	r.invalidate(Invalidation{TenantID: tenantID})
+	if r.cache == nil {
+		return nil
+	}
+
+	index := r.tenantIndexKey(tenantID)
+	hashes, err := r.cache.SMembers(ctx, index).Result()
+	if err != nil {
+		return fmt.Errorf("failed to invalidate cached tenant: %w", err)
+	}
+	keys := []string{index}
+	for _, keyHash := range hashes {
+		keys = append(keys, r.cacheKey(keyHash))
+	}
+	if err := r.cache.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cached tenant: %w", err)
+	}
+	return r.publish(ctx, Invalidation{TenantID: tenantID})
+}
+
+// RevokeAPIKey deletes a key from the key store and invalidates it
+// everywhere, so it stops working immediately
+func (r *FirestoreTenantResolver) RevokeAPIKey(ctx context.Context, id string) error {
+	if r.keys == nil {
+		return fmt.Errorf("no api key store configured")
+	}
+
+	key, err := r.keys.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.keys.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.InvalidateKey(ctx, key.Hash)
+}
+
+// Subscribe applies invalidations published by any router (or the control
+// plane) to the in-process cache until ctx is cancelled. The in-process
+// cache is cleared whenever the subscription is (re)established, since
+// messages may have been missed while it was down.
+func (r *FirestoreTenantResolver) Subscribe(ctx context.Context) error {
+	if r.cache == nil {
+		return nil
+	}
+
+	pubsub := r.cache.Subscribe(ctx, InvalidationChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.ChannelWithSubscriptions()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				r.epoch.Add(1)
+				r.local.clear()
+				r.logger.Info("subscribed to tenant cache invalidations",
+					zap.String("channel", m.Channel))
+			case *redis.Message:
+				var inv Invalidation
+				if err := json.Unmarshal([]byte(m.Payload), &inv); err != nil {
+					r.logger.Warn("invalid tenant cache invalidation", zap.Error(err))
+					continue
+				}
+				r.invalidate(inv)
+			}
+		}
+	}
+}
+
+// invalidate applies an invalidation to the in-process cache
+func (r *FirestoreTenantResolver) invalidate(inv Invalidation) {
+	r.epoch.Add(1)
+	if inv.KeyHash != "" {
+		r.local.removeKey(inv.KeyHash)
+	}
+	if inv.TenantID != "" {
+		r.local.removeTenant(inv.TenantID)
+	}
+}
+
+func (r *FirestoreTenantResolver) publish(ctx context.Context, inv Invalidation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	if err := r.cache.Publish(ctx, InvalidationChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish tenant cache invalidation: %w", err)
+	}
+	return nil
+}
+
+// lookup resolves a key by its ID from the key store, comparing hashes in
+// constant time, and loads the key's tenant from the repository. Legacy keys
+// that have not been imported into the store are looked up in the
+// repository by raw key and are unrestricted.
+func (r *FirestoreTenantResolver) lookup(ctx context.Context, info *pkgauth.APIKeyInfo) (*cachedTenant, error) {
+	if r.keys != nil {
+		key, err := r.keys.Get(ctx, info.KeyID)
+		switch {
+		case err == nil:
+			if !pkgauth.VerifyAPIKeyHash(info.RawKey, key.Hash) {
+				return nil, ErrAPIKeyNotFound
+			}
+			if !key.Active(time.Now()) {
+				return nil, ErrAPIKeyExpired
+			}
+			t, err := r.repo.GetByResourceID(ctx, key.TenantID)
+			if err != nil {
+				return nil, err
+			}
+			resolved := &cachedTenant{Tenant: t, ExpiresAt: key.ExpiresAt}
+			if perms := key.Permissions; len(perms.Scopes) > 0 || len(perms.Routes) > 0 || len(perms.Methods) > 0 {
+				resolved.Permissions = &perms
+			}
+			return resolved, nil
+		case !info.Legacy:
+			return nil, err
+		case !errors.Is(err, ErrAPIKeyNotFound):
+			r.logger.Warn("api key store lookup failed, falling back to tenant repository", zap.Error(err))
+		}
 	}
 
-	r.setCache(ctx, apiKey, tenantCtx)
-	return tenantCtx, nil
+	if !info.Legacy {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err := tenant.ValidateAPIKey(info.RawKey); err != nil {
+		return nil, err
+	}
+	t, err := r.repo.GetByAPIKey(ctx, info.RawKey)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedTenant{Tenant: t}, nil
 }
 
 // GetDefaultTenant returns the restrictive default tenant.
@@ -103,21 +349,40 @@ func (r *FirestoreTenantResolver) GetDefaultTenant(ctx context.Context) *tenant.
 }
 
 // Close releases resolver resources. Currently this is a no-op but it keeps the
-// surface area symmetrical with other infrastructure components.
+// surface area symmetrical with other infrastructure components; the
+// invalidation subscription ends with its context.
 func (r *FirestoreTenantResolver) Close() error {
 	return nil
 }
 
-func (r *FirestoreTenantResolver) cacheKey(apiKey string) string {
-	return fmt.Sprintf("%s:%s", cacheKeyPrefix, apiKey)
+func (r *FirestoreTenantResolver) cacheKey(keyHash string) string {
+	return fmt.Sprintf("%s:%s", cacheKeyPrefix, keyHash)
 }
 
-func (r *FirestoreTenantResolver) getFromCache(ctx context.Context, apiKey string) *tenant.Tenant {
+// tenantIndexKey is the set of a tenant's cached key hashes
+func (r *FirestoreTenantResolver) tenantIndexKey(tenantID string) string {
+	return fmt.Sprintf("%s:tenant:%s", cacheKeyPrefix, tenantID)
+}
+
+// setLocal caches a resolved key in process for localTTL, or until the key
+// expires if sooner, unless an invalidation happened since epoch
+func (r *FirestoreTenantResolver) setLocal(keyHash string, value *cachedTenant, epoch uint64) {
+	ttl := r.localTTL
+	if !value.ExpiresAt.IsZero() {
+		ttl = min(ttl, time.Until(value.ExpiresAt))
+	}
+	if ttl <= 0 || r.epoch.Load() != epoch {
+		return
+	}
+	r.local.add(keyHash, value, ttl)
+}
+
+func (r *FirestoreTenantResolver) getFromCache(ctx context.Context, keyHash string) *cachedTenant {
 	if r.cache == nil {
 		return nil
 	}
 
-	result, err := r.cache.Get(ctx, r.cacheKey(apiKey)).Result()
+	result, err := r.cache.Get(ctx, r.cacheKey(keyHash)).Result()
 	if err != nil {
 		if !errors.Is(err, redis.Nil) {
 			r.logger.Warn("tenant cache get failed", zap.Error(err))
@@ -129,28 +394,43 @@ func (r *FirestoreTenantResolver) getFromCache(ctx context.Context, apiKey strin
 		return nil
 	}
 
-	var cached tenant.Tenant
-	if err := json.Unmarshal([]byte(result), &cached); err != nil {
+	var cached cachedTenant
+	if err := json.Unmarshal([]byte(result), &cached); err != nil || cached.Tenant == nil {
 		r.logger.Warn("failed to unmarshal cached tenant", zap.Error(err))
-		_ = r.cache.Del(ctx, r.cacheKey(apiKey)).Err()
+		_ = r.cache.Del(ctx, r.cacheKey(keyHash)).Err()
 		return nil
 	}
 
 	return &cached
 }
 
-func (r *FirestoreTenantResolver) setCache(ctx context.Context, apiKey string, value *tenant.Tenant) {
-	if r.cache == nil || value == nil {
+// setCache caches a tenant for cacheTTL, or until the key expires if sooner
+func (r *FirestoreTenantResolver) setCache(ctx context.Context, keyHash string, value *cachedTenant) {
+	if r.cache == nil || value == nil || value.Tenant == nil {
 		return
 	}
 
+	ttl := r.cacheTTL
+	if !value.ExpiresAt.IsZero() {
+		ttl = min(ttl, time.Until(value.ExpiresAt))
+		if ttl <= 0 {
+			return
+		}
+	}
+
 	data, err := json.Marshal(value)
 	if err != nil {
 		r.logger.Warn("failed to marshal tenant for cache", zap.Error(err))
 		return
 	}
 
-	if err := r.cache.Set(ctx, r.cacheKey(apiKey), data, r.cacheTTL).Err(); err != nil {
+	// The tenant index lets InvalidateTenant find the tenant's cached keys
+	index := r.tenantIndexKey(value.Tenant.ResourceID)
+	pipe := r.cache.TxPipeline()
+	pipe.Set(ctx, r.cacheKey(keyHash), data, ttl)
+	pipe.SAdd(ctx, index, keyHash)
+	pipe.Expire(ctx, index, r.cacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
 		r.logger.Warn("tenant cache set failed", zap.Error(err))
 	}
 }
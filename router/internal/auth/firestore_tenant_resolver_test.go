@@ -0,0 +1,387 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+func activeTenant(id string) *tenant.Tenant {
+	return &tenant.Tenant{
+		ResourceID:   id,
+		Organization: tenant.Organization{ID: id, Status: tenant.StatusActive, Tier: tenant.TierPro},
+		Environment:  tenant.Environment{ResourceID: id, Status: tenant.StatusActive},
+	}
+}
+
+// tenantRepo is an in-memory tenant repository that loads tenants by ID
+type tenantRepo struct {
+	mu      sync.Mutex
+	tenants map[string]*tenant.Tenant
+}
+
+func newTenantRepo(ids ...string) *tenantRepo {
+	repo := &tenantRepo{tenants: make(map[string]*tenant.Tenant)}
+	for _, id := range ids {
+		repo.put(activeTenant(id))
+	}
+	return repo
+}
+
+func (r *tenantRepo) put(t *tenant.Tenant) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tenants[t.ResourceID] = t
+}
+
+func (r *tenantRepo) GetByResourceID(ctx context.Context, resourceID string) (*tenant.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tenants[resourceID]
+	if !ok {
+		return nil, tenant.ErrNotFound
+	}
+	copied := *t
+	return &copied, nil
+}
+
+func (r *tenantRepo) GetByAPIKey(ctx context.Context, apiKey string) (*tenant.Tenant, error) {
+	return nil, tenant.ErrNotFound
+}
+
+func (r *tenantRepo) Close() error {
+	return nil
+}
+
+func TestFirestoreTenantResolver_KeyStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	resolver := NewFirestoreTenantResolver(newTenantRepo("acme_prod"), store, nil, zap.NewNop())
+
+	raw, key, err := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+	if err != nil {
+		t.Fatalf("IssueAPIKey() error: %v", err)
+	}
+	if !strings.HasPrefix(raw, pkgauth.PrefixLive+key.ID+"_") || key.Hash == raw || strings.Contains(key.Hash, raw[len(raw)-16:]) {
+		t.Errorf("unexpected key %q / record %+v", raw, key)
+	}
+
+	got, err := resolver.ResolveTenant(ctx, raw)
+	if err != nil || got.ResourceID != "acme_prod" {
+		t.Fatalf("ResolveTenant() = %v, %v", got, err)
+	}
+
+	// A key with a known ID but the wrong secret is rejected
+	forged := raw[:len(raw)-4] + "0000"
+	if forged == raw {
+		forged = raw[:len(raw)-4] + "1111"
+	}
+	if _, err := resolver.ResolveTenant(ctx, forged); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("ResolveTenant(forged) error = %v, want ErrAPIKeyNotFound", err)
+	}
+	unknown, _ := pkgauth.GenerateAPIKey(true)
+	if _, err := resolver.ResolveTenant(ctx, unknown.RawKey); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("ResolveTenant(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func TestFirestoreTenantResolver_CurrentTenant(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	repo := newTenantRepo("acme_prod")
+	resolver := NewFirestoreTenantResolver(repo, store, nil, zap.NewNop())
+
+	// The key is resolved to the tenant's state at lookup, not at issue
+	raw, key, _ := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+	suspended := activeTenant("acme_prod")
+	suspended.Environment.Status = "suspended"
+	repo.put(suspended)
+	if _, err := resolver.ResolveTenant(ctx, raw); err == nil {
+		t.Error("ResolveTenant() succeeded for a tenant suspended after the key was issued")
+	}
+
+	stored, _ := store.Get(ctx, key.ID)
+	if stored.TenantID != "acme_prod" {
+		t.Errorf("stored TenantID = %q, want acme_prod", stored.TenantID)
+	}
+
+	// Keys of unknown tenants are rejected
+	orphan, _, _ := IssueAPIKey(ctx, store, "deleted_prod", true, time.Time{}, pkgauth.Permissions{})
+	if _, err := resolver.ResolveTenant(ctx, orphan); !errors.Is(err, tenant.ErrNotFound) {
+		t.Errorf("ResolveTenant(orphan) error = %v, want tenant.ErrNotFound", err)
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	resolver := NewFirestoreTenantResolver(newTenantRepo("acme_prod"), store, nil, zap.NewNop())
+
+	oldRaw, oldKey, _ := IssueAPIKey(ctx, store, "acme_prod", false, time.Time{}, pkgauth.Permissions{})
+	newRaw, newKey, err := RotateAPIKey(ctx, store, oldKey.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateAPIKey() error: %v", err)
+	}
+	if !strings.HasPrefix(newRaw, pkgauth.PrefixTest) || newKey.ID == oldKey.ID {
+		t.Errorf("unexpected rotated key %q", newRaw)
+	}
+
+	// Both keys work during the overlap window
+	for _, raw := range []string{oldRaw, newRaw} {
+		if _, err := resolver.ResolveTenant(ctx, raw); err != nil {
+			t.Errorf("ResolveTenant() during overlap error: %v", err)
+		}
+	}
+	keys, _ := store.List(ctx, "acme_prod")
+	if len(keys) != 2 || keys[0].ExpiresAt.IsZero() || !keys[1].ExpiresAt.IsZero() {
+		t.Errorf("List() = %+v, want the old key expiring and the new one not", keys)
+	}
+
+	// Once the window closes only the new key works. The in-process cache
+	// would have expired with the key; drop it here instead of waiting.
+	expired, _ := store.Get(ctx, oldKey.ID)
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	store.Put(ctx, expired)
+	resolver.InvalidateKey(ctx, expired.Hash)
+	if _, err := resolver.ResolveTenant(ctx, oldRaw); !errors.Is(err, ErrAPIKeyExpired) {
+		t.Errorf("ResolveTenant(old) error = %v, want ErrAPIKeyExpired", err)
+	}
+	if _, err := resolver.ResolveTenant(ctx, newRaw); err != nil {
+		t.Errorf("ResolveTenant(new) error: %v", err)
+	}
+	if _, _, err := RotateAPIKey(ctx, store, oldKey.ID, time.Hour); !errors.Is(err, ErrAPIKeyExpired) {
+		t.Errorf("RotateAPIKey(expired) error = %v, want ErrAPIKeyExpired", err)
+	}
+}
+
+func TestImportLegacyAPIKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	resolver := NewFirestoreTenantResolver(newTenantRepo("legacy_prod"), store, nil, zap.NewNop())
+
+	legacy := "apx_live_0123456789abcdef0123456789abcdef"
+	key, err := ImportLegacyAPIKey(ctx, store, legacy, "legacy_prod")
+	if err != nil {
+		t.Fatalf("ImportLegacyAPIKey() error: %v", err)
+	}
+	if key.Hash != pkgauth.HashAPIKey(legacy) || !key.Live {
+		t.Errorf("unexpected record %+v", key)
+	}
+
+	// Imported legacy keys resolve from the store, without the repository
+	got, err := resolver.ResolveTenant(ctx, legacy)
+	if err != nil || got.ResourceID != "legacy_prod" {
+		t.Fatalf("ResolveTenant() = %v, %v", got, err)
+	}
+
+	// and can be rotated to the new format
+	raw, _, err := RotateAPIKey(ctx, store, key.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("RotateAPIKey() error: %v", err)
+	}
+	if info, _ := pkgauth.ParseAPIKey(raw); info == nil || info.Legacy || !info.IsProduction {
+		t.Errorf("rotated key %q is not a live key with a key ID", raw)
+	}
+
+	if _, err := ImportLegacyAPIKey(ctx, store, raw, "legacy_prod"); err == nil {
+		t.Error("ImportLegacyAPIKey() accepted a key with a key ID")
+	}
+}
+
+// countingKeyStore counts Gets, which block until release is closed
+type countingKeyStore struct {
+	*MemoryAPIKeyStore
+	gets    atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *countingKeyStore) Get(ctx context.Context, id string) (*APIKeyRecord, error) {
+	if s.gets.Add(1) == 1 {
+		close(s.started)
+	}
+	<-s.release
+	return s.MemoryAPIKeyStore.Get(ctx, id)
+}
+
+func TestFirestoreTenantResolver_SingleLookup(t *testing.T) {
+	ctx := context.Background()
+	store := &countingKeyStore{MemoryAPIKeyStore: NewMemoryAPIKeyStore(), started: make(chan struct{}), release: make(chan struct{})}
+	resolver := NewFirestoreTenantResolver(newTenantRepo("acme_prod"), store, nil, zap.NewNop())
+
+	raw, _, _ := IssueAPIKey(ctx, store.MemoryAPIKeyStore, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := resolver.ResolveTenant(ctx, raw)
+			errs <- err
+		}()
+	}
+	<-store.started
+	time.Sleep(10 * time.Millisecond)
+	close(store.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("ResolveTenant() error: %v", err)
+		}
+	}
+	if got := store.gets.Load(); got != 1 {
+		t.Errorf("key store read %d times, want 1", got)
+	}
+}
+
+func TestFirestoreTenantResolver_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	repo := newTenantRepo("acme_prod")
+	resolver := NewFirestoreTenantResolver(repo, store, nil, zap.NewNop())
+
+	raw, key, _ := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+	other, _, _ := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+	for _, k := range []string{raw, other} {
+		if _, err := resolver.ResolveTenant(ctx, k); err != nil {
+			t.Fatalf("ResolveTenant() error: %v", err)
+		}
+	}
+
+	// A suspended tenant stays cached until it is invalidated
+	suspended := activeTenant("acme_prod")
+	suspended.Organization.Status = "suspended"
+	repo.put(suspended)
+	if _, err := resolver.ResolveTenant(ctx, other); err != nil {
+		t.Fatalf("ResolveTenant() from cache error: %v", err)
+	}
+	if err := resolver.InvalidateTenant(ctx, "acme_prod"); err != nil {
+		t.Fatalf("InvalidateTenant() error: %v", err)
+	}
+	if _, err := resolver.ResolveTenant(ctx, other); err == nil {
+		t.Error("ResolveTenant() succeeded for a suspended tenant after invalidation")
+	}
+
+	// A revoked key stops working immediately
+	repo.put(activeTenant("acme_prod"))
+	resolver.InvalidateTenant(ctx, "acme_prod")
+	if _, err := resolver.ResolveTenant(ctx, raw); err != nil {
+		t.Fatalf("ResolveTenant() error: %v", err)
+	}
+	if err := resolver.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() error: %v", err)
+	}
+	if _, err := resolver.ResolveTenant(ctx, raw); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("ResolveTenant(revoked) error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+// TestFirestoreTenantResolver_SuspendedTenantRejected suspends a tenant
+// serving requests and checks its next request is rejected once the tenant
+// is invalidated
+func TestFirestoreTenantResolver_SuspendedTenantRejected(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	repo := newTenantRepo("acme_prod")
+	resolver := NewFirestoreTenantResolver(repo, store, nil, zap.NewNop())
+	raw, _, _ := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+
+	handler := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), middleware.TenantContext(resolver, zap.NewNop()))
+	send := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+raw)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("request from an active tenant = %d, want 200", code)
+	}
+
+	suspended := activeTenant("acme_prod")
+	suspended.Organization.Status = "suspended"
+	repo.put(suspended)
+	if err := resolver.InvalidateTenant(ctx, "acme_prod"); err != nil {
+		t.Fatalf("InvalidateTenant() error: %v", err)
+	}
+	if code := send(); code == http.StatusOK {
+		t.Error("request from a suspended tenant succeeded after invalidation")
+	}
+}
+
+// blockingTenantRepo counts tenant loads; the first blocks, after reading
+// the tenant, until release is closed
+type blockingTenantRepo struct {
+	*tenantRepo
+	loads   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingTenantRepo) GetByResourceID(ctx context.Context, resourceID string) (*tenant.Tenant, error) {
+	t, err := r.tenantRepo.GetByResourceID(ctx, resourceID)
+	if r.loads.Add(1) == 1 {
+		close(r.started)
+		<-r.release
+	}
+	return t, err
+}
+
+// TestFirestoreTenantResolver_InvalidationDuringLookup checks that a lookup
+// started after an invalidation does not share the result of one started
+// before it
+func TestFirestoreTenantResolver_InvalidationDuringLookup(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	repo := &blockingTenantRepo{tenantRepo: newTenantRepo("acme_prod"), started: make(chan struct{}), release: make(chan struct{})}
+	resolver := NewFirestoreTenantResolver(repo, store, nil, zap.NewNop())
+	raw, _, _ := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, pkgauth.Permissions{})
+
+	// The first lookup reads the active tenant, then blocks
+	first := make(chan error, 1)
+	go func() {
+		_, err := resolver.ResolveTenant(ctx, raw)
+		first <- err
+	}()
+	<-repo.started
+
+	suspended := activeTenant("acme_prod")
+	suspended.Organization.Status = "suspended"
+	repo.put(suspended)
+	resolver.InvalidateTenant(ctx, "acme_prod")
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := resolver.ResolveTenant(ctx, raw)
+		second <- err
+	}()
+	select {
+	case err := <-second:
+		if err == nil {
+			t.Error("lookup after the invalidation returned the tenant read before it")
+		}
+	case <-time.After(time.Second):
+		t.Error("lookup after the invalidation waited for the one before it")
+	}
+	close(repo.release)
+	if err := <-first; err != nil {
+		t.Errorf("lookup before the invalidation error: %v", err)
+	}
+}
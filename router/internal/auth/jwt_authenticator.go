@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+// JWTAuthenticator implements middleware.JWTAuthenticator. It verifies JWT
+// bearer tokens against the key set named by the route's policy bundle and
+// maps the token's claims to a tenant. Key sets are shared by all bundles
+// using the same JWKS URI.
+type JWTAuthenticator struct {
+	logger *zap.Logger
+	cfg    pkgauth.RemoteKeySetConfig
+
+	mu      sync.Mutex
+	keySets map[string]pkgauth.KeySet
+}
+
+// NewJWTAuthenticator creates a JWT authenticator
+func NewJWTAuthenticator(cfg pkgauth.RemoteKeySetConfig, logger *zap.Logger) *JWTAuthenticator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &JWTAuthenticator{
+		logger:  logger,
+		cfg:     cfg,
+		keySets: make(map[string]pkgauth.KeySet),
+	}
+}
+
+// AuthenticateJWT verifies token and returns the tenant and claims it carries
+func (a *JWTAuthenticator) AuthenticateJWT(ctx context.Context, token string, p *policy.JWTAuth) (*tenant.Tenant, pkgauth.Claims, error) {
+	keys, err := a.keySet(p.JWKSURI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifier := pkgauth.NewJWTVerifier(keys, pkgauth.JWTConfig{
+		Issuer:    p.Issuer,
+		Audience:  p.Audience,
+		ClockSkew: p.ClockSkew,
+	})
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := tenantFromClaims(claims, p.Claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, claims, nil
+}
+
+// keySet returns the shared key set for a JWKS URI. file:// URIs are read
+// once; other URIs are fetched and cached by a RemoteKeySet.
+func (a *JWTAuthenticator) keySet(uri string) (pkgauth.KeySet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if keys, ok := a.keySets[uri]; ok {
+		return keys, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS URI: %w", err)
+	}
+
+	var keys pkgauth.KeySet
+	switch u.Scheme {
+	case "file":
+		if keys, err = pkgauth.LoadJWKSFile(u.Path); err != nil {
+			return nil, err
+		}
+	case "https", "http":
+		keys = pkgauth.NewRemoteKeySet(uri, a.cfg)
+	default:
+		return nil, fmt.Errorf("unsupported JWKS URI scheme %q", u.Scheme)
+	}
+
+	a.keySets[uri] = keys
+	a.logger.Info("JWKS key set registered", zap.String("jwks_uri", uri))
+	return keys, nil
+}
+
+// tenantFromClaims builds the tenant identified by a token. Only the tenant
+// claim is required; the organization defaults to the tenant and the tier to
+// free.
+func tenantFromClaims(claims pkgauth.Claims, m policy.ClaimMappings) (*tenant.Tenant, error) {
+	resourceID := claims.String(m.Tenant)
+	if resourceID == "" {
+		return nil, fmt.Errorf("token has no %q claim", m.Tenant)
+	}
+
+	orgID := claims.String(m.Organization)
+	if orgID == "" {
+		orgID = resourceID
+	}
+
+	tier := tenant.Tier(strings.ToLower(claims.String(m.Tier)))
+	switch tier {
+	case tenant.TierFree, tenant.TierPro, tenant.TierEnterprise:
+	default:
+		tier = tenant.TierFree
+	}
+
+	productID := claims.String(m.Product)
+	if productID == "" {
+		productID = "default"
+	}
+	envID := claims.String(m.Environment)
+	if envID == "" {
+		envID = "default"
+	}
+
+	return &tenant.Tenant{
+		Organization: tenant.Organization{
+			ID:     orgID,
+			Name:   orgID,
+			Tier:   tier,
+			Status: tenant.StatusActive,
+			Quotas: tenant.GetDefaultQuotas(tier),
+		},
+		Product: tenant.Product{
+			ID:     productID,
+			OrgID:  orgID,
+			Name:   productID,
+			Status: tenant.StatusActive,
+		},
+		Environment: tenant.Environment{
+			ID:         envID,
+			OrgID:      orgID,
+			ProductID:  productID,
+			ResourceID: resourceID,
+			Name:       envID,
+			Type:       tenant.EnvProduction,
+			Status:     tenant.StatusActive,
+		},
+		ResourceID: resourceID,
+	}, nil
+}
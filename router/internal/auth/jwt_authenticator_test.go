@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+// newJWKSFile writes a single Ed25519 key set and returns its file:// URI and
+// a function signing tokens with the key
+func newJWKSFile(t *testing.T) (string, func(claims map[string]interface{}) string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{"kty": "OKP", "crv": "Ed25519", "kid": "k1", "x": b64(pub)}},
+	})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o644); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+
+	sign := func(claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "kid": "k1"})
+		payload, _ := json.Marshal(claims)
+		signed := b64(header) + "." + b64(payload)
+		return signed + "." + b64(ed25519.Sign(priv, []byte(signed)))
+	}
+	return "file://" + path, sign
+}
+
+// apiKeyResolver accepts a single API key
+type apiKeyResolver struct{}
+
+func (apiKeyResolver) ResolveTenant(ctx context.Context, apiKey string) (*tenant.Tenant, error) {
+	if apiKey != "apx_test_0123456789abcdef0123456789abcdef" {
+		return nil, errors.New("unknown key")
+	}
+	return &tenant.Tenant{ResourceID: "key-tenant", Organization: tenant.Organization{Tier: tenant.TierPro}}, nil
+}
+
+func (apiKeyResolver) GetDefaultTenant(ctx context.Context) *tenant.Tenant {
+	return buildDefaultTenant()
+}
+
+func TestJWTAuthenticator_ClaimMapping(t *testing.T) {
+	uri, sign := newJWKSFile(t)
+	bundle := &policy.PolicyBundle{AuthConfig: map[string]interface{}{
+		"jwt": map[string]interface{}{
+			"jwksUri":  uri,
+			"issuer":   "https://idp.example.com",
+			"audience": []interface{}{"payments-api"},
+			"claims":   map[string]interface{}{"tenant": "https://apx.dev/tenant"},
+		},
+	}}
+	authPolicy, err := bundle.Auth()
+	if err != nil {
+		t.Fatalf("Auth() error: %v", err)
+	}
+
+	a := NewJWTAuthenticator(pkgauth.RemoteKeySetConfig{}, zap.NewNop())
+	token := sign(map[string]interface{}{
+		"iss":                    "https://idp.example.com",
+		"aud":                    "payments-api",
+		"exp":                    time.Now().Add(time.Hour).Unix(),
+		"https://apx.dev/tenant": "acme_payments_prod",
+		"org_id":                 "acme",
+		"tier":                   "Enterprise",
+	})
+	got, claims, err := a.AuthenticateJWT(context.Background(), token, authPolicy.JWT)
+	if err != nil {
+		t.Fatalf("AuthenticateJWT() error: %v", err)
+	}
+	if got.ResourceID != "acme_payments_prod" || got.Organization.ID != "acme" || got.Organization.Tier != tenant.TierEnterprise {
+		t.Errorf("unexpected tenant: %+v", got)
+	}
+	if claims.String("iss") != "https://idp.example.com" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// The tenant claim is required
+	token = sign(map[string]interface{}{
+		"iss": "https://idp.example.com",
+		"aud": "payments-api",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if _, _, err := a.AuthenticateJWT(context.Background(), token, authPolicy.JWT); err == nil {
+		t.Error("AuthenticateJWT() accepted a token without a tenant claim")
+	}
+}
+
+func TestTenantContextWithAuth_PerBundle(t *testing.T) {
+	uri, sign := newJWKSFile(t)
+	jwt := map[string]interface{}{"jwksUri": uri}
+	policies := map[string]*policy.PolicyBundle{
+		"/jwt":      {AuthConfig: map[string]interface{}{"jwt": jwt}},
+		"/both":     {AuthConfig: map[string]interface{}{"jwt": jwt, "apiKey": map[string]interface{}{}}},
+		"/optional": {AuthConfig: map[string]interface{}{"required": false}},
+	}
+
+	handler := middleware.TenantContextWithAuth(apiKeyResolver{}, middleware.AuthOptions{
+		JWT: NewJWTAuthenticator(pkgauth.RemoteKeySetConfig{}, zap.NewNop()),
+		Policy: func(r *http.Request) *policy.AuthPolicy {
+			bundle, ok := policies[r.URL.Path]
+			if !ok {
+				return nil
+			}
+			p, err := bundle.Auth()
+			if err != nil {
+				t.Fatalf("Auth() error: %v", err)
+			}
+			return p
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(middleware.GetTenantID(r.Context())))
+	}))
+
+	apiKey := "apx_test_0123456789abcdef0123456789abcdef"
+	token := sign(map[string]interface{}{
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"tenant_id": "jwt-tenant",
+	})
+	expired := sign(map[string]interface{}{
+		"exp":       time.Now().Add(-time.Hour).Unix(),
+		"tenant_id": "jwt-tenant",
+	})
+
+	tests := []struct {
+		path       string
+		credential string
+		wantStatus int
+		wantTenant string
+	}{
+		{"/plain", apiKey, http.StatusOK, "key-tenant"},
+		{"/plain", token, http.StatusUnauthorized, ""}, // no bundle: API keys only
+		{"/jwt", token, http.StatusOK, "jwt-tenant"},
+		{"/jwt", expired, http.StatusUnauthorized, ""},
+		{"/jwt", apiKey, http.StatusUnauthorized, ""},
+		{"/both", apiKey, http.StatusOK, "key-tenant"},
+		{"/both", token, http.StatusOK, "jwt-tenant"},
+		{"/optional", "", http.StatusOK, buildDefaultTenant().ResourceID},
+		{"/jwt", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.credential != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.credential)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus || (tt.wantTenant != "" && rr.Body.String() != tt.wantTenant) {
+			t.Errorf("%s with %.12q: got %d %q, want %d %q", tt.path, tt.credential, rr.Code, rr.Body.String(), tt.wantStatus, tt.wantTenant)
+		}
+	}
+}
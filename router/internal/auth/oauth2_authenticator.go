@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+// OAuth2Authenticator implements middleware.OAuth2Authenticator. It validates
+// opaque access tokens with the introspection endpoint named by the route's
+// policy bundle and maps the introspection response to a tenant.
+// Introspection clients, and so their caches, are shared by all bundles using
+// the same endpoint and client credentials.
+type OAuth2Authenticator struct {
+	logger *zap.Logger
+	cfg    pkgauth.IntrospectionConfig
+
+	mu            sync.Mutex
+	introspectors map[string]*pkgauth.Introspector
+}
+
+// NewOAuth2Authenticator creates an OAuth2 authenticator. cfg supplies the
+// HTTP client and cache defaults; endpoints and credentials come from the
+// policy bundles.
+func NewOAuth2Authenticator(cfg pkgauth.IntrospectionConfig, logger *zap.Logger) *OAuth2Authenticator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &OAuth2Authenticator{
+		logger:        logger,
+		cfg:           cfg,
+		introspectors: make(map[string]*pkgauth.Introspector),
+	}
+}
+
+// AuthenticateOAuth2 introspects token and returns the tenant and claims it
+// carries
+func (a *OAuth2Authenticator) AuthenticateOAuth2(ctx context.Context, token string, p *policy.OAuth2Auth) (*tenant.Tenant, pkgauth.Claims, error) {
+	introspector, err := a.introspector(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := introspector.Introspect(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := tenantFromClaims(claims, p.Claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, claims, nil
+}
+
+// introspector returns the shared introspection client for a bundle's
+// endpoint and credentials
+func (a *OAuth2Authenticator) introspector(p *policy.OAuth2Auth) (*pkgauth.Introspector, error) {
+	key := p.IntrospectionURI + "|" + p.ClientID + "|" + p.ClientSecretRef + "|" + p.CacheTTL.String()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if i, ok := a.introspectors[key]; ok {
+		return i, nil
+	}
+
+	// A secret the router cannot read is its own misconfiguration, not the
+	// client's invalid token
+	secret, err := resolveSecret(p.ClientSecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", pkgauth.ErrIntrospectionUnavailable, err)
+	}
+
+	cfg := a.cfg
+	cfg.Endpoint = p.IntrospectionURI
+	cfg.ClientID = p.ClientID
+	cfg.ClientSecret = secret
+	if p.CacheTTL > 0 {
+		cfg.CacheTTL = p.CacheTTL
+	}
+
+	i := pkgauth.NewIntrospector(cfg)
+	a.introspectors[key] = i
+	a.logger.Info("introspection endpoint registered",
+		zap.String("introspection_uri", p.IntrospectionURI),
+		zap.String("client_id", p.ClientID))
+	return i, nil
+}
+
+// resolveSecret reads a client secret reference: env:NAME reads an
+// environment variable and file:PATH a mounted secret file
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case ref == "":
+		return "", nil
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("client secret environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read client secret: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return "", fmt.Errorf("unsupported client secret reference %q (use env:NAME or file:PATH)", ref)
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"go.uber.org/zap"
+)
+
+func TestPermissions_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAPIKeyStore()
+	resolver := NewFirestoreTenantResolver(newTenantRepo("acme_prod"), store, nil, zap.NewNop())
+
+	issue := func(perms pkgauth.Permissions) string {
+		raw, _, err := IssueAPIKey(ctx, store, "acme_prod", true, time.Time{}, perms)
+		if err != nil {
+			t.Fatalf("IssueAPIKey() error: %v", err)
+		}
+		return raw
+	}
+	unrestricted := issue(pkgauth.Permissions{})
+	readOnly := issue(pkgauth.Permissions{Methods: []string{"GET", "HEAD"}})
+	payments := issue(pkgauth.Permissions{Scopes: []string{"payments:read"}, Routes: []string{"/v1/payments/**"}})
+	admin := issue(pkgauth.Permissions{Scopes: []string{"admin"}})
+
+	var gotScopes []string
+	handler := middleware.Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotScopes = middleware.GetScopes(r.Context())
+		}),
+		middleware.TenantContext(resolver, zap.NewNop()),
+		middleware.Permissions(func(r *http.Request) []string {
+			if strings.HasPrefix(r.URL.Path, "/v1/admin") {
+				return []string{"admin"}
+			}
+			return nil
+		}, zap.NewNop()),
+	)
+
+	tests := []struct {
+		name        string
+		key         string
+		method      string
+		path        string
+		wantStatus  int
+		wantMissing []string
+	}{
+		{"unrestricted key", unrestricted, http.MethodPost, "/v1/orders", http.StatusOK, nil},
+		{"unrestricted key, admin route", unrestricted, http.MethodGet, "/v1/admin/users", http.StatusForbidden, []string{"admin"}},
+		{"read-only key, GET", readOnly, http.MethodGet, "/v1/orders", http.StatusOK, nil},
+		{"read-only key, POST", readOnly, http.MethodPost, "/v1/orders", http.StatusForbidden, nil},
+		{"payments key, payments route", payments, http.MethodPost, "/v1/payments/42/refunds", http.StatusOK, nil},
+		{"payments key, other route", payments, http.MethodGet, "/v1/orders", http.StatusForbidden, nil},
+		{"admin key, admin route", admin, http.MethodDelete, "/v1/admin/users/7", http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusForbidden {
+				return
+			}
+
+			var body middleware.ForbiddenResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != "forbidden" || body.Message == "" {
+				t.Fatalf("unexpected 403 body %s", rec.Body)
+			}
+			if !slices.Equal(body.MissingScopes, tt.wantMissing) {
+				t.Errorf("missing_scopes = %v, want %v", body.MissingScopes, tt.wantMissing)
+			}
+		})
+	}
+
+	// Key scopes are available to later middleware and OPA input
+	req := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	req.Header.Set("Authorization", "Bearer "+payments)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !slices.Equal(gotScopes, []string{"payments:read"}) {
+		t.Errorf("GetScopes() = %v", gotScopes)
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/lru"
+)
+
+const (
+	defaultLocalCacheSize = 10000
+	defaultLocalCacheTTL  = 30 * time.Second
+)
+
+// tenantLRU is the in-process cache of resolved keys in front of Redis,
+// keyed by API key hash. Entries are also indexed by tenant so that all of a tenant's keys
+// can be dropped when it is invalidated.
+type tenantLRU struct {
+	mu       sync.Mutex // Guards byTenant, which the cache updates as it drops keys
+	cache    *lru.Cache[*cachedTenant]
+	byTenant map[string]map[string]struct{}
+	now      func() time.Time
+}
+
+func newTenantLRU(capacity int) *tenantLRU {
+	c := &tenantLRU{
+		byTenant: make(map[string]map[string]struct{}),
+		now:      time.Now,
+	}
+	c.cache = lru.New(capacity, c.unindex)
+	return c
+}
+
+// get returns the cached resolved key for a key hash
+func (c *tenantLRU) get(keyHash string) (*cachedTenant, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache.Get(keyHash, c.now())
+}
+
+// add caches a resolved key for ttl, evicting the least recently used entry
+// when the cache is full
+func (c *tenantLRU) add(keyHash string, v *cachedTenant, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache.Add(keyHash, v, c.now().Add(ttl))
+	keys, ok := c.byTenant[v.Tenant.ResourceID]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.byTenant[v.Tenant.ResourceID] = keys
+	}
+	keys[keyHash] = struct{}{}
+}
+
+// removeKey drops a key hash
+func (c *tenantLRU) removeKey(keyHash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Remove(keyHash)
+}
+
+// removeTenant drops every key of a tenant
+func (c *tenantLRU) removeTenant(tenantID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for keyHash := range c.byTenant[tenantID] {
+		c.cache.Remove(keyHash)
+	}
+}
+
+// clear drops every entry
+func (c *tenantLRU) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache.Clear()
+	c.byTenant = make(map[string]map[string]struct{})
+}
+
+func (c *tenantLRU) len() int {
+	return c.cache.Len()
+}
+
+// unindex drops a key the cache removed from the tenant index. The cache
+// calls it while c.mu is held.
+func (c *tenantLRU) unindex(keyHash string, v *cachedTenant) {
+	tenantID := v.Tenant.ResourceID
+	if keys := c.byTenant[tenantID]; keys != nil {
+		delete(keys, keyHash)
+		if len(keys) == 0 {
+			delete(c.byTenant, tenantID)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTenantLRU(t *testing.T) {
+	now := time.Now()
+	c := newTenantLRU(2)
+	c.now = func() time.Time { return now }
+
+	c.add("a", &cachedTenant{Tenant: activeTenant("acme")}, time.Minute)
+	c.add("b", &cachedTenant{Tenant: activeTenant("acme")}, time.Minute)
+	c.get("a")
+	c.add("c", &cachedTenant{Tenant: activeTenant("globex")}, time.Minute)
+
+	// b was least recently used
+	if _, ok := c.get("b"); ok {
+		t.Error("get(b) hit after eviction")
+	}
+	if got, ok := c.get("a"); !ok || got.Tenant.ResourceID != "acme" {
+		t.Errorf("get(a) = %v, %v", got, ok)
+	}
+
+	c.removeTenant("acme")
+	if _, ok := c.get("a"); ok || c.len() != 1 {
+		t.Errorf("removeTenant(acme) left %d entries", c.len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("c"); ok || c.len() != 0 {
+		t.Error("get(c) hit after expiry")
+	}
+}
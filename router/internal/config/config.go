@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds router configuration
@@ -13,6 +15,16 @@ type Config struct {
 	Environment string // dev, staging, production
 	PublicURL   string // Public-facing URL for status/stream endpoints
 
+	// Proxies (load balancers) whose X-Forwarded-For header is trusted
+	TrustedProxies []netip.Prefix
+
+	// TLS (plain HTTP when TLSCertFile is empty)
+	TLSCertFile        string
+	TLSKeyFile         string
+	TLSClientAuth      string // none, optional, required
+	TLSClientCAFile    string // CA bundle verifying client certificates at the handshake
+	IdentitySigningKey string // HMAC key for the X-Apx-Client-Identity header
+
 	// GCP Project
 	ProjectID string
 	Region    string
@@ -21,6 +33,10 @@ type Config struct {
 	PolicyStoreType string // firestore, gcs, local
 	PolicyBucketName string
 	FirestoreCollection string
+	PolicyDir string // PolicyBundle files for the local store
+
+	// Routes
+	RoutesFile string // apx/v1 manifest (Product, Route, PolicyBundle documents)
 
 	// Pub/Sub
 	PubSubTopic string
@@ -31,6 +47,10 @@ type Config struct {
 	RedisPassword string
 	RedisDB       int
 
+	// Rate limiting while Redis is unavailable: open, closed, or local (each
+	// router enforces its share of the limits in memory)
+	RateLimitFailurePolicy string
+
 	// Observability
 	OTELEndpoint string
 	OTELInsecure bool
@@ -49,12 +69,21 @@ func Load() (*Config, error) {
 		Environment: getEnv("ENVIRONMENT", "dev"),
 		PublicURL:   getEnv("PUBLIC_URL", ""),
 
+		TLSCertFile:        getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:         getEnv("TLS_KEY_FILE", ""),
+		TLSClientAuth:      getEnv("TLS_CLIENT_AUTH", "none"),
+		TLSClientCAFile:    getEnv("TLS_CLIENT_CA_FILE", ""),
+		IdentitySigningKey: getEnv("IDENTITY_SIGNING_KEY", ""),
+
 		ProjectID: getEnv("GCP_PROJECT_ID", ""),
 		Region:    getEnv("GCP_REGION", "us-central1"),
 
 		PolicyStoreType:     getEnv("POLICY_STORE_TYPE", "firestore"),
 		PolicyBucketName:    getEnv("POLICY_BUCKET", "apx-policy-artifacts"),
 		FirestoreCollection: getEnv("FIRESTORE_COLLECTION", "policies"),
+		PolicyDir:           getEnv("POLICY_DIR", "/etc/apx/policies"),
+
+		RoutesFile: getEnv("ROUTES_FILE", ""),
 
 		PubSubTopic:     getEnv("PUBSUB_TOPIC", "apx-requests"),
 		PubSubProjectID: getEnv("PUBSUB_PROJECT_ID", ""),
@@ -63,6 +92,8 @@ func Load() (*Config, error) {
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 		RedisDB:       getEnvAsInt("REDIS_DB", 0),
 
+		RateLimitFailurePolicy: getEnv("RATE_LIMIT_FAILURE_POLICY", "local"),
+
 		OTELEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317"),
 		OTELInsecure: getEnvAsBool("OTEL_INSECURE", true),
 		LogLevel:     getEnv("LOG_LEVEL", "info"),
@@ -72,6 +103,12 @@ func Load() (*Config, error) {
 		EnableCache:  getEnvAsBool("ENABLE_CACHE", true),
 	}
 
+	trustedProxies, err := parsePrefixes(getEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	cfg.TrustedProxies = trustedProxies
+
 	// Set default PubSub project to main project if not specified
 	if cfg.PubSubProjectID == "" {
 		cfg.PubSubProjectID = cfg.ProjectID
@@ -82,9 +119,53 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("GCP_PROJECT_ID is required")
 	}
 
+	switch cfg.TLSClientAuth {
+	case "none", "optional", "required":
+	default:
+		return nil, fmt.Errorf("TLS_CLIENT_AUTH must be none, optional or required")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSClientAuth != "none" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("TLS_CLIENT_AUTH requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	switch cfg.RateLimitFailurePolicy {
+	case "open", "closed", "local":
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_FAILURE_POLICY must be open, closed or local")
+	}
+
 	return cfg, nil
 }
 
+// parsePrefixes parses a comma-separated list of CIDRs; a bare address is a
+// single-address prefix
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 // Helper functions for environment variables
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -2,9 +2,14 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
@@ -12,30 +17,52 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Defaults for the dynamic loader
+const (
+	DefaultReloadInterval = 60 * time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+
+	// reloadBackoffBase is the delay before the first retry after a failure
+	reloadBackoffBase = time.Second
+)
+
 // DynamicLoader manages dynamic route configuration reloading
 type DynamicLoader struct {
 	controlAPIURL string
 	tenantID      string
 	client        *http.Client
 	currentConfig *RoutesConfig
+	etag          string // ETag of currentConfig, sent as If-None-Match
 	mu            sync.RWMutex
 	logger        *zap.Logger
 	onChange      func([]RouteConfig) error
+
+	interval     time.Duration
+	maxBackoff   time.Duration
+	snapshotPath string
 }
 
 // DynamicLoaderConfig holds configuration for the dynamic loader
 type DynamicLoaderConfig struct {
-	ControlAPIURL string
-	TenantID      string
-	ReloadInterval time.Duration
-	OnChange      func([]RouteConfig) error
-	Logger        *zap.Logger
+	ControlAPIURL  string
+	TenantID       string
+	ReloadInterval time.Duration // Time between fetches (default 60s)
+	MaxBackoff     time.Duration // Upper bound of the retry delay after failures (default 5m)
+	SnapshotPath   string        // Last-known-good routes are kept here (disabled if empty)
+	OnChange       func([]RouteConfig) error
+	Logger         *zap.Logger
 }
 
 // NewDynamicLoader creates a new dynamic configuration loader
 func NewDynamicLoader(cfg DynamicLoaderConfig) *DynamicLoader {
 	if cfg.ReloadInterval == 0 {
-		cfg.ReloadInterval = 60 * time.Second // Default to 60 seconds
+		cfg.ReloadInterval = DefaultReloadInterval
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
 	}
 
 	return &DynamicLoader{
@@ -47,32 +74,46 @@ func NewDynamicLoader(cfg DynamicLoaderConfig) *DynamicLoader {
 		currentConfig: &RoutesConfig{Routes: []RouteConfig{}},
 		logger:        cfg.Logger,
 		onChange:      cfg.OnChange,
+		interval:      cfg.ReloadInterval,
+		maxBackoff:    cfg.MaxBackoff,
+		snapshotPath:  cfg.SnapshotPath,
 	}
 }
 
-// Start begins the dynamic reloading loop
+// Start begins the dynamic reloading loop. Routes from the last-known-good
+// snapshot are applied first, so the router serves them even if the control
+// API is unreachable at boot. Failed fetches are retried with jittered
+// exponential backoff.
 func (d *DynamicLoader) Start(ctx context.Context) error {
-	// Do initial load
-	if err := d.reload(ctx); err != nil {
-		d.logger.Warn("initial config load failed, continuing with empty config",
+	if err := d.loadSnapshot(); err != nil {
+		d.logger.Warn("failed to load routes snapshot",
+			zap.String("path", d.snapshotPath),
 			zap.Error(err))
 	}
 
-	// Start periodic reload
-	ticker := time.NewTicker(60 * time.Second)
-	defer ticker.Stop()
-
 	d.logger.Info("dynamic config loader started",
 		zap.String("control_api_url", d.controlAPIURL),
-		zap.Duration("reload_interval", 60*time.Second))
+		zap.Duration("reload_interval", d.interval))
+
+	failures := 0
+	timer := time.NewTimer(0) // initial load
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
+			next := d.interval
 			if err := d.reload(ctx); err != nil {
+				failures++
+				next = d.backoff(failures)
 				d.logger.Error("failed to reload config",
-					zap.Error(err))
+					zap.Error(err),
+					zap.Int("consecutive_failures", failures),
+					zap.Duration("retry_in", next))
+			} else {
+				failures = 0
 			}
+			timer.Reset(next)
 		case <-ctx.Done():
 			d.logger.Info("dynamic config loader stopped")
 			return ctx.Err()
@@ -80,6 +121,21 @@ func (d *DynamicLoader) Start(ctx context.Context) error {
 	}
 }
 
+// backoff returns the delay before the next fetch after the given number of
+// consecutive failures: exponential from one second up to the max backoff,
+// with half of it jittered so routers do not retry in lockstep
+func (d *DynamicLoader) backoff(failures int) time.Duration {
+	ceiling := reloadBackoffBase
+	for i := 1; i < failures && ceiling < d.maxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > d.maxBackoff {
+		ceiling = d.maxBackoff
+	}
+	half := ceiling / 2
+	return half + time.Duration(rand.Int64N(int64(ceiling-half)+1))
+}
+
 // reload fetches the latest configuration from control-API
 func (d *DynamicLoader) reload(ctx context.Context) error {
 	// If no control API URL or tenant ID, skip reloading
@@ -100,6 +156,14 @@ func (d *DynamicLoader) reload(ctx context.Context) error {
 	// Set Accept header for YAML response
 	req.Header.Set("Accept", "application/x-yaml")
 
+	// Only fetch the routes again if they changed since the last fetch
+	d.mu.RLock()
+	etag := d.etag
+	d.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
 	// Make request
 	resp, err := d.client.Do(req)
 	if err != nil {
@@ -107,6 +171,11 @@ func (d *DynamicLoader) reload(ctx context.Context) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		d.logger.Debug("config not modified, skipping reload")
+		return nil
+	}
+
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
@@ -119,60 +188,74 @@ func (d *DynamicLoader) reload(ctx context.Context) error {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	// Parse YAML
-	var newConfig RoutesConfig
-	if err := yaml.Unmarshal(body, &newConfig); err != nil {
-		return fmt.Errorf("failed to parse YAML config: %w", err)
+	newConfig, err := parseRoutes(body)
+	if err != nil {
+		return err
 	}
 
-	// Validate config
-	for i := range newConfig.Routes {
-		route := &newConfig.Routes[i]
-
-		// Default mode to async
-		if route.Mode == "" {
-			route.Mode = "async"
-		}
-
-		// Validate mode
-		if route.Mode != "sync" && route.Mode != "async" {
-			return fmt.Errorf("invalid mode '%s' for route %s", route.Mode, route.Path)
-		}
+	changed, err := d.apply(newConfig, resp.Header.Get("ETag"))
+	if err != nil {
+		return err
+	}
+	if changed {
+		d.saveSnapshot(body)
+	}
+	return nil
+}
 
-		// Default methods if not specified
-		if len(route.Methods) == 0 {
-			route.Methods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+// parseRoutes parses and validates a routes document
+func parseRoutes(data []byte) (*RoutesConfig, error) {
+	var cfg RoutesConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML config: %w", err)
+	}
+	for i := range cfg.Routes {
+		if err := NormalizeRoute(&cfg.Routes[i]); err != nil {
+			return nil, err
 		}
 	}
+	return &cfg, nil
+}
 
+// apply makes newConfig the current configuration and notifies the onChange
+// callback if the routes changed. The ETag is only recorded once the routes
+// have been applied, so a failed callback is retried with a full fetch.
+func (d *DynamicLoader) apply(newConfig *RoutesConfig, etag string) (bool, error) {
 	// Check if config has changed
 	d.mu.RLock()
-	hasChanged := !d.configEquals(d.currentConfig.Routes, newConfig.Routes)
+	added, removed, modified := diffRoutes(d.currentConfig.Routes, newConfig.Routes)
+	hasChanged := !routesEqual(d.currentConfig.Routes, newConfig.Routes)
 	d.mu.RUnlock()
 
 	if !hasChanged {
 		d.logger.Debug("config unchanged, skipping reload")
-		return nil
+		d.mu.Lock()
+		d.etag = etag
+		d.mu.Unlock()
+		return false, nil
 	}
 
-	// Config has changed, update it
-	d.mu.Lock()
-	d.currentConfig = &newConfig
-	d.mu.Unlock()
-
-	d.logger.Info("config reloaded",
-		zap.Int("route_count", len(newConfig.Routes)),
-		zap.Bool("changed", hasChanged))
-
 	// Notify onChange callback if provided
 	if d.onChange != nil {
 		if err := d.onChange(newConfig.Routes); err != nil {
 			d.logger.Error("onChange callback failed",
 				zap.Error(err))
-			return fmt.Errorf("onChange callback failed: %w", err)
+			return false, fmt.Errorf("onChange callback failed: %w", err)
 		}
 	}
 
+	// Config has changed, update it
+	d.mu.Lock()
+	d.currentConfig = newConfig
+	d.etag = etag
+	d.mu.Unlock()
+
+	d.logger.Info("config reloaded",
+		zap.Int("route_count", len(newConfig.Routes)),
+		zap.Strings("added", added),
+		zap.Strings("removed", removed),
+		zap.Strings("modified", modified))
+
 	// Log individual routes
 	for _, route := range newConfig.Routes {
 		d.logger.Debug("route loaded",
@@ -182,9 +265,69 @@ func (d *DynamicLoader) reload(ctx context.Context) error {
 			zap.String("path_strip", route.PathStrip))
 	}
 
+	return true, nil
+}
+
+// loadSnapshot applies the last-known-good routes saved by a previous run
+func (d *DynamicLoader) loadSnapshot() error {
+	if d.snapshotPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(d.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg, err := parseRoutes(data)
+	if err != nil {
+		return err
+	}
+	if _, err := d.apply(cfg, ""); err != nil {
+		return err
+	}
+
+	d.logger.Info("applied last-known-good routes snapshot",
+		zap.String("path", d.snapshotPath),
+		zap.Int("route_count", len(cfg.Routes)))
 	return nil
 }
 
+// saveSnapshot persists routes that were applied successfully. The file is
+// replaced atomically so a crash never leaves a partial snapshot behind.
+func (d *DynamicLoader) saveSnapshot(data []byte) {
+	if d.snapshotPath == "" {
+		return
+	}
+
+	err := func() error {
+		dir := filepath.Dir(d.snapshotPath)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(dir, filepath.Base(d.snapshotPath)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), d.snapshotPath)
+	}()
+	if err != nil {
+		d.logger.Warn("failed to save routes snapshot",
+			zap.String("path", d.snapshotPath),
+			zap.Error(err))
+	}
+}
+
 // GetConfig returns the current configuration (thread-safe)
 func (d *DynamicLoader) GetConfig() []RouteConfig {
 	d.mu.RLock()
@@ -196,35 +339,46 @@ func (d *DynamicLoader) GetConfig() []RouteConfig {
 	return routes
 }
 
-// configEquals checks if two route configs are equal
-func (d *DynamicLoader) configEquals(a, b []RouteConfig) bool {
-	if len(a) != len(b) {
-		return false
+// routesEqual reports whether two normalized route lists are identical,
+// field by field and in the same order (order decides between equally
+// specific routes)
+func routesEqual(a, b []RouteConfig) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
 	}
+	return reflect.DeepEqual(a, b)
+}
 
-	// Create maps for comparison (order-independent)
-	aMap := make(map[string]RouteConfig)
-	for _, route := range a {
-		key := fmt.Sprintf("%s:%s:%s", route.Path, route.Backend, route.Mode)
-		aMap[key] = route
+// diffRoutes lists the routes added, removed and modified between two route
+// lists, identified by name, or by host and path for unnamed routes
+func diffRoutes(old, updated []RouteConfig) (added, removed, modified []string) {
+	key := func(rc RouteConfig) string {
+		if rc.Name != "" {
+			return rc.Name
+		}
+		return rc.Host + rc.Path
 	}
 
-	bMap := make(map[string]RouteConfig)
-	for _, route := range b {
-		key := fmt.Sprintf("%s:%s:%s", route.Path, route.Backend, route.Mode)
-		bMap[key] = route
+	before := make(map[string]RouteConfig, len(old))
+	for _, rc := range old {
+		before[key(rc)] = rc
 	}
-
-	// Compare maps
-	if len(aMap) != len(bMap) {
-		return false
+	seen := make(map[string]bool, len(updated))
+	for _, rc := range updated {
+		k := key(rc)
+		seen[k] = true
+		prev, ok := before[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case !reflect.DeepEqual(prev, rc):
+			modified = append(modified, k)
+		}
 	}
-
-	for key := range aMap {
-		if _, exists := bMap[key]; !exists {
-			return false
+	for _, rc := range old {
+		if k := key(rc); !seen[k] {
+			removed = append(removed, k)
 		}
 	}
-
-	return true
+	return added, removed, modified
 }
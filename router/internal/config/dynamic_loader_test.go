@@ -0,0 +1,173 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// controlAPI serves a routes document with an ETag, answering 304 when the
+// client already has it
+type controlAPI struct {
+	mu       sync.Mutex
+	body     string
+	etag     string
+	requests int
+	notMod   int
+}
+
+func (c *controlAPI) set(body, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.body, c.etag = body, etag
+}
+
+func (c *controlAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	if r.Header.Get("If-None-Match") == c.etag {
+		c.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", c.etag)
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write([]byte(c.body))
+}
+
+const ordersRoutes = `
+routes:
+  - path: /orders/**
+    backend: http://orders:8080
+    mode: sync
+    methods: [GET]
+`
+
+func TestDynamicLoader_ConditionalFetch(t *testing.T) {
+	api := &controlAPI{}
+	api.set(ordersRoutes, `"v1"`)
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	var changes [][]RouteConfig
+	d := NewDynamicLoader(DynamicLoaderConfig{
+		ControlAPIURL: srv.URL,
+		TenantID:      "t1",
+		Logger:        zap.NewNop(),
+		OnChange: func(routes []RouteConfig) error {
+			changes = append(changes, routes)
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := d.reload(ctx); err != nil {
+			t.Fatalf("reload() error: %v", err)
+		}
+	}
+	if len(changes) != 1 || api.notMod != 1 {
+		t.Errorf("got %d changes and %d not-modified responses, want 1 and 1", len(changes), api.notMod)
+	}
+
+	// Changing only the methods is a change
+	api.set(`
+routes:
+  - path: /orders/**
+    backend: http://orders:8080
+    mode: sync
+    methods: [GET, POST]
+`, `"v2"`)
+	if err := d.reload(ctx); err != nil {
+		t.Fatalf("reload() error: %v", err)
+	}
+	if len(changes) != 2 || len(d.GetConfig()[0].Methods) != 2 {
+		t.Fatalf("methods change not applied: %d changes, config %+v", len(changes), d.GetConfig())
+	}
+
+	// So is changing only the path strip
+	api.set(`
+routes:
+  - path: /orders/**
+    backend: http://orders:8080
+    mode: sync
+    methods: [GET, POST]
+    path_strip: /orders
+`, `"v3"`)
+	if err := d.reload(ctx); err != nil {
+		t.Fatalf("reload() error: %v", err)
+	}
+	if len(changes) != 3 || d.GetConfig()[0].PathStrip != "/orders" {
+		t.Errorf("path strip change not applied: %d changes, config %+v", len(changes), d.GetConfig())
+	}
+}
+
+func TestDynamicLoader_SnapshotColdStart(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "routes.yaml")
+
+	// A first run fetches the routes and persists them
+	api := &controlAPI{}
+	api.set(ordersRoutes, `"v1"`)
+	srv := httptest.NewServer(api)
+	d := NewDynamicLoader(DynamicLoaderConfig{
+		ControlAPIURL: srv.URL,
+		TenantID:      "t1",
+		SnapshotPath:  snapshot,
+		Logger:        zap.NewNop(),
+	})
+	if err := d.reload(context.Background()); err != nil {
+		t.Fatalf("reload() error: %v", err)
+	}
+	srv.Close()
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+
+	// A restart while control-API is down serves the snapshot
+	var applied []RouteConfig
+	d = NewDynamicLoader(DynamicLoaderConfig{
+		ControlAPIURL:  srv.URL,
+		TenantID:       "t1",
+		ReloadInterval: time.Hour,
+		SnapshotPath:   snapshot,
+		Logger:         zap.NewNop(),
+		OnChange: func(routes []RouteConfig) error {
+			applied = routes
+			return nil
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	d.Start(ctx)
+
+	if len(applied) != 1 || applied[0].Backend != "http://orders:8080" {
+		t.Errorf("applied routes = %+v, want the snapshot", applied)
+	}
+}
+
+func TestDynamicLoader_Backoff(t *testing.T) {
+	d := NewDynamicLoader(DynamicLoaderConfig{MaxBackoff: 10 * time.Second})
+	tests := []struct {
+		failures int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, 5 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := d.backoff(tt.failures); got < tt.min || got > tt.max {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]", tt.failures, got, tt.min, tt.max)
+			}
+		}
+	}
+}
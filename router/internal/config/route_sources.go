@@ -0,0 +1,38 @@
+package config
+
+import "sync"
+
+// Route sources
+const (
+	RouteSourceLocal      = "local"       // ROUTES_CONFIG and ROUTES_FILE
+	RouteSourceControlAPI = "control-api" // DynamicLoader
+)
+
+// RouteSources keeps the latest routes of each source, so a reload of one
+// source keeps the routes of the others
+type RouteSources struct {
+	mu      sync.Mutex
+	order   []string
+	sources map[string][]RouteConfig
+}
+
+// NewRouteSources creates an empty set of sources. Merged routes list the
+// sources' routes in the given order.
+func NewRouteSources(order ...string) *RouteSources {
+	return &RouteSources{order: order, sources: make(map[string][]RouteConfig)}
+}
+
+// Update replaces the routes of a source and applies the merged routes of
+// all sources. Updates are serialized, so the last routes applied always
+// hold every source's latest routes.
+func (s *RouteSources) Update(source string, routes []RouteConfig, apply func([]RouteConfig)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources[source] = routes
+	var merged []RouteConfig
+	for _, name := range s.order {
+		merged = append(merged, s.sources[name]...)
+	}
+	apply(merged)
+}
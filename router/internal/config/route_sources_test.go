@@ -0,0 +1,44 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func routePaths(routes []RouteConfig) []string {
+	var paths []string
+	for _, r := range routes {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+// TestRouteSources checks that reloading one source keeps the other's routes
+func TestRouteSources(t *testing.T) {
+	sources := NewRouteSources(RouteSourceLocal, RouteSourceControlAPI)
+	var applied []string
+	apply := func(routes []RouteConfig) {
+		applied = routePaths(routes)
+	}
+
+	sources.Update(RouteSourceLocal, []RouteConfig{{Path: "/v1/orders"}, {Path: "/v1/users"}}, apply)
+	if want := []string{"/v1/orders", "/v1/users"}; !slices.Equal(applied, want) {
+		t.Errorf("after local load: %v, want %v", applied, want)
+	}
+
+	sources.Update(RouteSourceControlAPI, []RouteConfig{{Path: "/v1/payments"}}, apply)
+	if want := []string{"/v1/orders", "/v1/users", "/v1/payments"}; !slices.Equal(applied, want) {
+		t.Errorf("after control-API change: %v, want %v", applied, want)
+	}
+
+	// A file reload replaces only the local routes
+	sources.Update(RouteSourceLocal, []RouteConfig{{Path: "/v2/orders"}}, apply)
+	if want := []string{"/v2/orders", "/v1/payments"}; !slices.Equal(applied, want) {
+		t.Errorf("after local reload: %v, want %v", applied, want)
+	}
+
+	sources.Update(RouteSourceControlAPI, nil, apply)
+	if want := []string{"/v2/orders"}; !slices.Equal(applied, want) {
+		t.Errorf("after control-API removal: %v, want %v", applied, want)
+	}
+}
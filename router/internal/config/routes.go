@@ -2,19 +2,161 @@ package config
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // RouteConfig represents a single route configuration
 type RouteConfig struct {
+	Name      string   `yaml:"name"` // Optional route name (metadata.name for apx/v1 routes)
 	Path      string   `yaml:"path"`
 	Backend   string   `yaml:"backend"`
-	Mode      string   `yaml:"mode"` // "sync" or "async"
+	Mode      string   `yaml:"mode"` // "sync", "grpc" or "async"
 	Methods   []string `yaml:"methods"`
 	PathStrip string   `yaml:"path_strip"` // Prefix to strip before proxying
+
+	// Optional match criteria (all must match for the route to be selected)
+	Host        string            `yaml:"host"`         // Exact host or wildcard (*.example.com)
+	Headers     map[string]string `yaml:"headers"`      // Required header values ("*" = any value)
+	QueryParams map[string]string `yaml:"query_params"` // Required query parameter values ("*" = any value)
+
+	// Product and policy bundle the route belongs to
+	Product      string `yaml:"product"`
+	PolicyBundle string `yaml:"policy_bundle"` // name@version
+
+	// Scopes the API key or token must hold to call the route
+	Scopes []string `yaml:"scopes"`
+
+	// Cost of each request in rate limit and quota units (default 1)
+	Cost CostConfig `yaml:"cost"`
+
+	// Rate limit and quota headers sent to clients: x-ratelimit (default),
+	// ietf or both. Set from the route's product in apx/v1 manifests.
+	RateLimitHeaders string `yaml:"rate_limit_headers"`
+
+	// Overall backend timeout in milliseconds, including retries. Defaults to
+	// the tenant tier timeout; a tier timeout also caps longer route timeouts.
+	TimeoutMs int `yaml:"timeout_ms"`
+
+	// Backend retry policy (sync routes)
+	Retries RetryConfig `yaml:"retries"`
+
+	// Backend circuit breaker (sync routes)
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// Backend pool (sync routes). Without upstreams the route has a single
+	// endpoint, Backend.
+	Pool             string                 `yaml:"pool"` // Pool name; keys the circuit breaker when set
+	Upstreams        []UpstreamConfig       `yaml:"upstreams"`
+	LoadBalancing    string                 `yaml:"load_balancing"` // round-robin, least-connections, weighted, consistent-hash
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier_detection"`
+	HealthCheck      HealthCheckConfig      `yaml:"health_check"`
+}
+
+// CostConfig prices a route's requests, for routes such as batch or LLM
+// endpoints that cost more than one request
+type CostConfig struct {
+	Weight         int64  `yaml:"weight"`          // Units per request (default 1)
+	BodyBytes      int64  `yaml:"body_bytes"`      // Adds a unit per this many request body bytes
+	ResponseHeader string `yaml:"response_header"` // Backend-reported cost, charged to quotas and usage
+}
+
+// UpstreamConfig is a single endpoint of a backend pool
+type UpstreamConfig struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"` // Relative weight for weighted and consistent-hash balancing (default 1)
+}
+
+// OutlierDetectionConfig controls passive ejection of failing pool endpoints
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int `yaml:"consecutive_failures"` // Failures before an endpoint is ejected (default 5)
+	EjectionTimeMs      int `yaml:"ejection_time_ms"`     // How long an endpoint stays ejected (default 30s)
+}
+
+// HealthCheckConfig controls active health probes of pool endpoints.
+// Probes are disabled unless Path is set.
+type HealthCheckConfig struct {
+	Path               string `yaml:"path"`
+	IntervalMs         int    `yaml:"interval_ms"`         // default 10s
+	TimeoutMs          int    `yaml:"timeout_ms"`          // default 2s
+	UnhealthyThreshold int    `yaml:"unhealthy_threshold"` // Failed probes before marking unhealthy (default 2)
+	HealthyThreshold   int    `yaml:"healthy_threshold"`   // Successful probes before marking healthy (default 2)
+}
+
+// Load balancing strategies
+const (
+	LoadBalancingRoundRobin       = "round-robin"
+	LoadBalancingLeastConnections = "least-connections"
+	LoadBalancingWeighted         = "weighted"
+	LoadBalancingConsistentHash   = "consistent-hash"
+)
+
+// Rate limit header formats
+const (
+	RateLimitHeadersLegacy = "x-ratelimit" // X-RateLimit-* and X-Quota-*
+	RateLimitHeadersIETF   = "ietf"        // RateLimit and RateLimit-Policy
+	RateLimitHeadersBoth   = "both"
+)
+
+// CircuitBreakerConfig controls the circuit breaker guarding a route's backend
+type CircuitBreakerConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	ErrorThreshold int           `yaml:"error_threshold"` // Consecutive failures before the circuit opens
+	Timeout        time.Duration `yaml:"timeout"`         // Time to wait before probing the backend again
+}
+
+// RetryConfig controls how failed backend requests are retried
+type RetryConfig struct {
+	MaxAttempts        int      `yaml:"max_attempts"`         // Total attempts including the first (0 or 1 = no retries)
+	RetryOn            []string `yaml:"retry_on"`             // 5xx, timeout, connection-failure
+	PerTryTimeoutMs    int      `yaml:"per_try_timeout_ms"`   // Timeout for each attempt (0 = overall timeout only)
+	BackoffBaseMs      int      `yaml:"backoff_base_ms"`      // Initial backoff before the first retry
+	BackoffMaxMs       int      `yaml:"backoff_max_ms"`       // Upper bound for the backoff
+	RetryNonIdempotent bool     `yaml:"retry_non_idempotent"` // Also retry POST/PATCH requests
+}
+
+// Retry conditions
+const (
+	RetryOn5xx               = "5xx"
+	RetryOnTimeout           = "timeout"
+	RetryOnConnectionFailure = "connection-failure"
+)
+
+const (
+	// DefaultTimeout applies when neither the route nor the tenant tier sets a timeout
+	DefaultTimeout = 30 * time.Second
+
+	// MaxTimeoutMs is the longest route timeout allowed by the Route CRD
+	MaxTimeoutMs = 600000
+)
+
+// TierTimeouts are the backend timeouts of each tenant tier; they match the
+// worker tier limits in workers/cpu-pool/limits.go
+var TierTimeouts = map[string]time.Duration{
+	"free":       30 * time.Second,
+	"pro":        60 * time.Second,
+	"enterprise": 120 * time.Second,
+}
+
+// Timeout resolves the backend timeout of the route for a tenant tier
+func (rc RouteConfig) Timeout(tier string) time.Duration {
+	tierTimeout, ok := TierTimeouts[strings.ToLower(tier)]
+	if rc.TimeoutMs <= 0 {
+		if ok {
+			return tierTimeout
+		}
+		return DefaultTimeout
+	}
+
+	timeout := time.Duration(rc.TimeoutMs) * time.Millisecond
+	if ok && tierTimeout < timeout {
+		return tierTimeout
+	}
+	return timeout
 }
 
 // RoutesConfig represents all route configurations
@@ -41,25 +183,140 @@ func LoadRoutes(filename string) ([]RouteConfig, error) {
 
 	// Validate and set defaults
 	for i := range cfg.Routes {
-		route := &cfg.Routes[i]
+		if err := NormalizeRoute(&cfg.Routes[i]); err != nil {
+			return nil, err
+		}
+	}
 
-		// Default mode to async
-		if route.Mode == "" {
-			route.Mode = "async"
+	return cfg.Routes, nil
+}
+
+// NormalizeRoute applies defaults to a route and validates it
+func NormalizeRoute(route *RouteConfig) error {
+	// Default mode to async
+	if route.Mode == "" {
+		route.Mode = "async"
+	}
+
+	// Validate mode
+	if route.Mode != "sync" && route.Mode != "grpc" && route.Mode != "async" {
+		return fmt.Errorf("invalid mode '%s' for route %s (must be 'sync', 'grpc' or 'async')", route.Mode, route.Path)
+	}
+
+	// Default methods to all if not specified; gRPC calls are always POSTs,
+	// plus the CORS preflights of browser gRPC-Web clients
+	if len(route.Methods) == 0 {
+		route.Methods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+		if route.Mode == "grpc" {
+			route.Methods = []string{"POST", "OPTIONS"}
 		}
+	}
+
+	// Hosts are case-insensitive; wildcards are only allowed as a leading label
+	route.Host = strings.ToLower(strings.TrimSpace(route.Host))
+	if strings.Contains(route.Host, "*") {
+		if !strings.HasPrefix(route.Host, "*.") || strings.Count(route.Host, "*") != 1 {
+			return fmt.Errorf("invalid host '%s' for route %s (wildcards must be of the form *.example.com)", route.Host, route.Path)
+		}
+	}
 
-		// Validate mode
-		if route.Mode != "sync" && route.Mode != "async" {
-			return nil, fmt.Errorf("invalid mode '%s' for route %s (must be 'sync' or 'async')", route.Mode, route.Path)
+	if route.TimeoutMs < 0 || route.TimeoutMs > MaxTimeoutMs {
+		return fmt.Errorf("invalid timeout_ms %d for route %s (must be between 0 and %d)", route.TimeoutMs, route.Path, MaxTimeoutMs)
+	}
+
+	// Validate retry policy
+	if route.Retries.MaxAttempts < 0 || route.Retries.PerTryTimeoutMs < 0 ||
+		route.Retries.BackoffBaseMs < 0 || route.Retries.BackoffMaxMs < 0 {
+		return fmt.Errorf("invalid retries for route %s (values must not be negative)", route.Path)
+	}
+	if route.Retries.MaxAttempts > 1 && len(route.Retries.RetryOn) == 0 {
+		route.Retries.RetryOn = []string{RetryOn5xx, RetryOnTimeout}
+	}
+	if route.Mode == "grpc" && route.Retries.MaxAttempts > 1 {
+		return fmt.Errorf("invalid retries for route %s (grpc routes stream request bodies and are not retried)", route.Path)
+	}
+	for _, cond := range route.Retries.RetryOn {
+		if cond != RetryOn5xx && cond != RetryOnTimeout && cond != RetryOnConnectionFailure {
+			return fmt.Errorf("invalid retry condition '%s' for route %s (must be '5xx', 'timeout' or 'connection-failure')", cond, route.Path)
 		}
+	}
 
-		// Default methods to all if not specified
-		if len(route.Methods) == 0 {
-			route.Methods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+	// Circuit breaker defaults match the Route CRD
+	if route.CircuitBreaker.Enabled {
+		if route.CircuitBreaker.ErrorThreshold < 0 || route.CircuitBreaker.Timeout < 0 {
+			return fmt.Errorf("invalid circuit breaker for route %s (values must not be negative)", route.Path)
+		}
+		if route.CircuitBreaker.ErrorThreshold == 0 {
+			route.CircuitBreaker.ErrorThreshold = 50
+		}
+		if route.CircuitBreaker.Timeout == 0 {
+			route.CircuitBreaker.Timeout = 30 * time.Second
 		}
 	}
 
-	return cfg.Routes, nil
+	if route.RateLimitHeaders == "" {
+		route.RateLimitHeaders = RateLimitHeadersLegacy
+	}
+	switch route.RateLimitHeaders {
+	case RateLimitHeadersLegacy, RateLimitHeadersIETF, RateLimitHeadersBoth:
+	default:
+		return fmt.Errorf("invalid rate_limit_headers '%s' for route %s (must be 'x-ratelimit', 'ietf' or 'both')", route.RateLimitHeaders, route.Path)
+	}
+
+	// Backend pool defaults
+	if route.LoadBalancing == "" {
+		route.LoadBalancing = LoadBalancingRoundRobin
+	}
+	switch route.LoadBalancing {
+	case LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingWeighted, LoadBalancingConsistentHash:
+	default:
+		return fmt.Errorf("invalid load_balancing '%s' for route %s", route.LoadBalancing, route.Path)
+	}
+	for i := range route.Upstreams {
+		if route.Upstreams[i].URL == "" {
+			return fmt.Errorf("upstream %d of route %s has no url", i, route.Path)
+		}
+		if route.Upstreams[i].Weight < 0 {
+			return fmt.Errorf("upstream %s of route %s has a negative weight", route.Upstreams[i].URL, route.Path)
+		}
+		if route.Upstreams[i].Weight == 0 {
+			route.Upstreams[i].Weight = 1
+		}
+	}
+	if route.OutlierDetection.ConsecutiveFailures == 0 {
+		route.OutlierDetection.ConsecutiveFailures = 5
+	}
+	if route.OutlierDetection.EjectionTimeMs == 0 {
+		route.OutlierDetection.EjectionTimeMs = 30000
+	}
+	if route.HealthCheck.Path != "" {
+		if !strings.HasPrefix(route.HealthCheck.Path, "/") {
+			return fmt.Errorf("invalid health check path '%s' for route %s (must start with /)", route.HealthCheck.Path, route.Path)
+		}
+		if route.HealthCheck.IntervalMs == 0 {
+			route.HealthCheck.IntervalMs = 10000
+		}
+		if route.HealthCheck.TimeoutMs == 0 {
+			route.HealthCheck.TimeoutMs = 2000
+		}
+		if route.HealthCheck.UnhealthyThreshold == 0 {
+			route.HealthCheck.UnhealthyThreshold = 2
+		}
+		if route.HealthCheck.HealthyThreshold == 0 {
+			route.HealthCheck.HealthyThreshold = 2
+		}
+	}
+
+	// Canonicalize header names so lookups are case-insensitive
+	if len(route.Headers) > 0 {
+		headers := make(map[string]string, len(route.Headers))
+		for name, value := range route.Headers {
+			headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = value
+		}
+		route.Headers = headers
+	}
+
+	return nil
 }
 
 // LoadRoutesFromEnv loads routes from environment variable ROUTES_CONFIG
@@ -98,10 +355,10 @@ func LoadRoutesFromEnv() []RouteConfig {
 		mode := "async" // default
 
 		// Check if the last : is for mode (not part of URL like https://)
-		// Mode should be "sync" or "async", so check if what follows is a valid mode
+		// Mode should be "sync", "grpc" or "async", so check if what follows is a valid mode
 		if lastColon > 0 && lastColon < len(backendModeStr)-1 {
 			potentialMode := strings.TrimSpace(backendModeStr[lastColon+1:])
-			if potentialMode == "sync" || potentialMode == "async" {
+			if potentialMode == "sync" || potentialMode == "grpc" || potentialMode == "async" {
 				backend = strings.TrimSpace(backendModeStr[:lastColon])
 				mode = potentialMode
 			}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+)
+
+// TLSConfig returns the server TLS configuration, or nil when the router
+// serves plain HTTP. Client certificates are requested per TLSClientAuth and
+// verified at the handshake only when TLSClientCAFile is set; routes with
+// their own CA bundle verify the chain in the auth middleware instead.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if c.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.TLSClientCAFile != "" {
+		if tlsCfg.ClientCAs, err = pkgauth.LoadCertPool(c.TLSClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case c.TLSClientAuth == "optional" && tlsCfg.ClientCAs != nil:
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case c.TLSClientAuth == "optional":
+		tlsCfg.ClientAuth = tls.RequestClientCert
+	case c.TLSClientAuth == "required" && tlsCfg.ClientCAs != nil:
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case c.TLSClientAuth == "required":
+		tlsCfg.ClientAuth = tls.RequireAnyClientCert
+	}
+	return tlsCfg, nil
+}
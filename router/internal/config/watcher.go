@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// DefaultWatchDebounce is how long the watcher waits for a burst of file
+// events (editors often write, chmod and rename in a row) to settle
+const DefaultWatchDebounce = 250 * time.Millisecond
+
+// FileWatcher reloads local configuration when its files change or when the
+// process receives SIGHUP
+type FileWatcher struct {
+	name     string
+	paths    []string
+	debounce time.Duration
+	onReload func() error
+	logger   *zap.Logger
+}
+
+// FileWatcherConfig holds configuration for a file watcher
+type FileWatcherConfig struct {
+	Name     string   // Source name used in logs and metrics, e.g. "routes"
+	Paths    []string // Files or directories to watch
+	Debounce time.Duration
+	// OnReload loads, validates and swaps in the configuration. An error
+	// means the configuration was rejected and the previous one kept.
+	OnReload func() error
+	Logger   *zap.Logger
+}
+
+// NewFileWatcher creates a new file watcher
+func NewFileWatcher(cfg FileWatcherConfig) *FileWatcher {
+	if cfg.Debounce == 0 {
+		cfg.Debounce = DefaultWatchDebounce
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+
+	paths := make([]string, len(cfg.Paths))
+	for i, p := range cfg.Paths {
+		paths[i] = filepath.Clean(p)
+	}
+
+	return &FileWatcher{
+		name:     cfg.Name,
+		paths:    paths,
+		debounce: cfg.Debounce,
+		onReload: cfg.OnReload,
+		logger:   cfg.Logger,
+	}
+}
+
+// Start watches the configured paths until ctx is done
+func (w *FileWatcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Files are watched through their directory: editors and Kubernetes
+	// ConfigMap updates replace files rather than writing them in place
+	for _, path := range w.paths {
+		dir := path
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	w.logger.Info("watching local config for changes",
+		zap.String("source", w.name),
+		zap.Strings("paths", w.paths))
+
+	debounce := time.NewTimer(0)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+	defer debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if w.relevant(event) {
+				debounce.Reset(w.debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Warn("file watcher error",
+				zap.String("source", w.name),
+				zap.Error(err))
+		case <-debounce.C:
+			w.reload("file_change")
+		case <-hup:
+			w.reload("sighup")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// relevant reports whether a file event concerns one of the watched paths
+func (w *FileWatcher) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	for _, path := range w.paths {
+		if name == path || filepath.Dir(name) == path {
+			return true
+		}
+		// Kubernetes swaps a mounted ConfigMap by renaming its ..data symlink
+		if filepath.Dir(name) == filepath.Dir(path) && strings.HasPrefix(filepath.Base(name), "..data") {
+			return true
+		}
+	}
+	return false
+}
+
+// reload applies the configuration, keeping the previous one if it is rejected
+func (w *FileWatcher) reload(trigger string) {
+	start := time.Now()
+	if err := w.onReload(); err != nil {
+		metrics.ConfigReloads.WithLabelValues(w.name, "rejected").Inc()
+		w.logger.Error("config reload rejected, keeping previous config",
+			zap.String("source", w.name),
+			zap.String("trigger", trigger),
+			zap.Error(err))
+		return
+	}
+	metrics.ConfigReloads.WithLabelValues(w.name, "applied").Inc()
+	w.logger.Info("config reloaded",
+		zap.String("source", w.name),
+		zap.String("trigger", trigger),
+		zap.Duration("duration", time.Since(start)))
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// startWatcher runs a watcher on path and returns a channel receiving one
+// value per reload
+func startWatcher(t *testing.T, name, path string, onReload func() error) <-chan struct{} {
+	t.Helper()
+	core, logs := observer.New(zap.InfoLevel)
+	reloads := make(chan struct{}, 10)
+	w := NewFileWatcher(FileWatcherConfig{
+		Name:     name,
+		Paths:    []string{path},
+		Debounce: 10 * time.Millisecond,
+		Logger:   zap.New(core),
+		OnReload: func() error {
+			defer func() { reloads <- struct{}{} }()
+			return onReload()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go w.Start(ctx)
+
+	// Wait until the watches and the signal handler are set up
+	deadline := time.Now().Add(2 * time.Second)
+	for logs.FilterMessage("watching local config for changes").Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return reloads
+}
+
+func waitReload(t *testing.T, reloads <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-reloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reload")
+	}
+}
+
+func TestFileWatcher_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "routes.yaml")
+	os.WriteFile(file, []byte("routes: []\n"), 0o644)
+	rejected := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("test-change", "rejected"))
+
+	var reject atomic.Bool
+	reloads := startWatcher(t, "test-change", file, func() error {
+		if reject.Load() {
+			return errors.New("invalid routes")
+		}
+		return nil
+	})
+
+	// Writes to other files in the directory are ignored
+	os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x"), 0o644)
+
+	// Editors often replace the file instead of writing it in place
+	tmp := filepath.Join(dir, "routes.yaml.tmp")
+	os.WriteFile(tmp, []byte("routes: [{}]\n"), 0o644)
+	os.Rename(tmp, file)
+	waitReload(t, reloads)
+
+	reject.Store(true)
+	os.WriteFile(file, []byte("routes: {\n"), 0o644)
+	waitReload(t, reloads)
+	if got := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("test-change", "rejected")); got != rejected+1 {
+		t.Errorf("rejected reloads = %v, want %v", got, rejected+1)
+	}
+
+	select {
+	case <-reloads:
+		t.Error("unexpected extra reload")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFileWatcher_ReloadsOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	applied := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("test-sighup", "applied"))
+	reloads := startWatcher(t, "test-sighup", dir, func() error { return nil })
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	waitReload(t, reloads)
+	if got := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("test-sighup", "applied")); got != applied+1 {
+		t.Errorf("applied reloads = %v, want %v", got, applied+1)
+	}
+}
@@ -0,0 +1,455 @@
+// Package crd loads apx/v1 Product, Route and PolicyBundle manifests.
+//
+// Manifests are multi-document YAML files in the format described by the
+// schemas in configs/crds. Every document is validated against its schema and
+// compiled into the router's runtime structures (config.RouteConfig and
+// policy.PolicyBundle), so a single manifest file is a complete gateway
+// configuration.
+package crd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/config"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	policy.RegisterManifestLoader(loadPolicyBundles)
+}
+
+// FieldError is a single problem found in a manifest
+type FieldError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string // dotted field path, e.g. spec.backend.timeoutMs
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	if e.Path != "" {
+		return fmt.Sprintf("%s: %s: %s", loc, e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", loc, e.Message)
+}
+
+// ErrorList collects every problem found while loading a manifest
+type ErrorList []*FieldError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (l *ErrorList) add(file string, node *yaml.Node, path, msg string) {
+	e := &FieldError{File: file, Path: path, Message: msg}
+	if node != nil {
+		e.Line, e.Column = node.Line, node.Column
+	}
+	*l = append(*l, e)
+}
+
+// Manifest is a loaded set of apx/v1 documents together with the runtime
+// structures compiled from them
+type Manifest struct {
+	Products []*Product
+	Routes   []*Route
+	Bundles  []*PolicyBundle
+
+	// Compiled runtime configuration
+	RouteConfigs  []config.RouteConfig
+	PolicyBundles []*policy.PolicyBundle
+}
+
+// Product returns the named product, if the manifest defines it
+func (m *Manifest) Product(name string) (*Product, bool) {
+	for _, p := range m.Products {
+		if p.Metadata.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// LoadFile reads, validates and compiles a manifest file
+func LoadFile(filename string) (*Manifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return Load(filename, data)
+}
+
+// Load validates and compiles manifest data. The name is used in error
+// messages. On failure the returned error is an ErrorList containing every
+// problem found, each with its file and line number.
+func Load(name string, data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	var errs ErrorList
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			errs = append(errs, syntaxError(name, err))
+			return nil, errs
+		}
+		m.addDocument(name, &doc, &errs)
+	}
+
+	if len(errs) == 0 {
+		m.checkDuplicates(&errs)
+	}
+	if len(errs) == 0 {
+		m.compile(&errs)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return m, nil
+}
+
+// loadPolicyBundles loads a manifest found in the policy directory, which
+// may only hold PolicyBundle documents
+func loadPolicyBundles(name string, data []byte) ([]*policy.PolicyBundle, error) {
+	m, err := Load(name, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Products) > 0 || len(m.Routes) > 0 {
+		return nil, fmt.Errorf("%s: only %s documents are allowed in the policy directory", name, KindPolicyBundle)
+	}
+	return m.PolicyBundles, nil
+}
+
+// addDocument validates a single YAML document and decodes it by kind
+func (m *Manifest) addDocument(file string, doc *yaml.Node, errs *ErrorList) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+		return // empty document, e.g. comments before the first ---
+	}
+	if root.Kind != yaml.MappingNode {
+		errs.add(file, root, "", "document must be an object")
+		return
+	}
+
+	kindNode := mappingValue(root, "kind")
+	if kindNode == nil {
+		errs.add(file, root, "", `missing required field "kind"`)
+		return
+	}
+	schema, ok, err := schemaFor(kindNode.Value)
+	if err != nil {
+		errs.add(file, kindNode, "kind", err.Error())
+		return
+	}
+	if !ok {
+		errs.add(file, kindNode, "kind", fmt.Sprintf("unsupported kind %q (expected %s, %s or %s)",
+			kindNode.Value, KindProduct, KindRoute, KindPolicyBundle))
+		return
+	}
+
+	before := len(*errs)
+	schema.validate(file, "", root, errs)
+	if len(*errs) > before {
+		return
+	}
+
+	source := Location{File: file, Line: root.Line}
+	var decodeErr error
+	switch kindNode.Value {
+	case KindProduct:
+		p := &Product{Source: source}
+		if decodeErr = root.Decode(p); decodeErr == nil {
+			m.Products = append(m.Products, p)
+		}
+	case KindRoute:
+		r := &Route{Source: source}
+		if decodeErr = root.Decode(r); decodeErr == nil {
+			m.Routes = append(m.Routes, r)
+		}
+	case KindPolicyBundle:
+		b := &PolicyBundle{Source: source}
+		if decodeErr = root.Decode(b); decodeErr == nil {
+			b.hash, decodeErr = documentHash(root)
+			m.Bundles = append(m.Bundles, b)
+		}
+	}
+	if decodeErr != nil {
+		errs.add(file, root, "", decodeErr.Error())
+	}
+}
+
+// checkDuplicates rejects documents that are defined more than once
+func (m *Manifest) checkDuplicates(errs *ErrorList) {
+	seen := make(map[string]Location)
+	check := func(key string, loc Location) {
+		if first, ok := seen[key]; ok {
+			*errs = append(*errs, &FieldError{
+				File: loc.File, Line: loc.Line, Column: 1,
+				Message: fmt.Sprintf("duplicate %s (first defined at %s:%d)", key, first.File, first.Line),
+			})
+			return
+		}
+		seen[key] = loc
+	}
+
+	for _, p := range m.Products {
+		check(fmt.Sprintf("%s %q", KindProduct, p.Metadata.Name), p.Source)
+	}
+	for _, r := range m.Routes {
+		check(fmt.Sprintf("%s %q", KindRoute, r.Metadata.Name), r.Source)
+	}
+	for _, b := range m.Bundles {
+		check(fmt.Sprintf("%s %q", KindPolicyBundle, b.Ref()), b.Source)
+	}
+}
+
+// compile converts the documents into runtime route and policy structures
+func (m *Manifest) compile(errs *ErrorList) {
+	for _, r := range m.Routes {
+		rc, err := r.RouteConfig()
+		if err != nil {
+			*errs = append(*errs, &FieldError{
+				File: r.Source.File, Line: r.Source.Line, Column: 1,
+				Message: fmt.Sprintf("route %q: %v", r.Metadata.Name, err),
+			})
+			continue
+		}
+		// Clients of a product get the same rate limit headers on all of
+		// its routes
+		if p, ok := m.Product(rc.Product); ok && p.Spec.RateLimitHeaders != "" {
+			rc.RateLimitHeaders = p.Spec.RateLimitHeaders
+		}
+		m.RouteConfigs = append(m.RouteConfigs, rc)
+	}
+
+	bundles := make(map[string]*policy.PolicyBundle, len(m.Bundles))
+	for _, b := range m.Bundles {
+		pb := b.PolicyBundle()
+		if _, err := pb.Auth(); err != nil {
+			*errs = append(*errs, &FieldError{
+				File: b.Source.File, Line: b.Source.Line, Column: 1,
+				Message: fmt.Sprintf("policy bundle %q: %v", b.Ref(), err),
+			})
+			continue
+		}
+		bundles[b.Ref()] = pb
+		m.PolicyBundles = append(m.PolicyBundles, pb)
+	}
+
+	// A route canary shifts a share of traffic from the route's bundle to
+	// another version of the same bundle
+	for _, r := range m.Routes {
+		canary := r.Spec.Canary
+		if !canary.Enabled || canary.PolicyBundleRef == "" {
+			continue
+		}
+		stable, ok := bundles[r.Spec.PolicyBundleRef]
+		if !ok {
+			continue
+		}
+		if pb, ok := bundles[canary.PolicyBundleRef]; ok && pb.Name == stable.Name {
+			pb.CanaryPercentage = canary.Weight
+			pb.StableVersion = stable.Version
+		}
+	}
+}
+
+// RouteConfig compiles the route into a runtime route configuration.
+// Routes with upstreams are proxied synchronously; routes with only a
+// worker pool are queued for async processing.
+func (r *Route) RouteConfig() (config.RouteConfig, error) {
+	match := r.Spec.Match
+	backend := r.Spec.Backend
+
+	rc := config.RouteConfig{
+		Name:         r.Metadata.Name,
+		Path:         match.Path,
+		Methods:      match.Methods,
+		Host:         match.Host,
+		Headers:      match.Headers,
+		QueryParams:  match.QueryParams,
+		Product:      r.Metadata.Labels["product"],
+		PolicyBundle: r.Spec.PolicyBundleRef,
+		Scopes:       r.Spec.Scopes,
+		Cost: config.CostConfig{
+			Weight:         r.Spec.Cost.Weight,
+			BodyBytes:      r.Spec.Cost.BodyBytes,
+			ResponseHeader: r.Spec.Cost.ResponseHeader,
+		},
+		TimeoutMs: backend.TimeoutMs,
+		Retries: config.RetryConfig{
+			MaxAttempts:        backend.Retries.MaxAttempts,
+			RetryOn:            backend.Retries.RetryOn,
+			PerTryTimeoutMs:    backend.Retries.PerTryTimeoutMs,
+			BackoffBaseMs:      backend.Retries.BackoffBaseMs,
+			BackoffMaxMs:       backend.Retries.BackoffMaxMs,
+			RetryNonIdempotent: backend.Retries.RetryNonIdempotent,
+		},
+	}
+
+	// Circuit breakers are enabled by default
+	if cb := r.Spec.CircuitBreaker; cb.Enabled == nil || *cb.Enabled {
+		rc.CircuitBreaker.Enabled = true
+		rc.CircuitBreaker.ErrorThreshold = cb.ErrorThreshold
+		if cb.Timeout != "" {
+			timeout, err := time.ParseDuration(cb.Timeout)
+			if err != nil {
+				return rc, fmt.Errorf("invalid circuitBreaker.timeout %q: %w", cb.Timeout, err)
+			}
+			rc.CircuitBreaker.Timeout = timeout
+		}
+	}
+
+	// Schema defaults
+	if rc.Path == "" {
+		rc.Path = "/**"
+	}
+	if len(rc.Methods) == 0 {
+		rc.Methods = []string{"GET", "POST"}
+	}
+	if !strings.HasPrefix(rc.Path, "/") {
+		return rc, fmt.Errorf("match.path %q must start with /", rc.Path)
+	}
+	if rc.Cost.Weight < 0 || rc.Cost.BodyBytes < 0 {
+		return rc, fmt.Errorf("cost.weight and cost.bodyBytes must not be negative")
+	}
+
+	if backend.Upstream != "" && len(backend.Upstreams) > 0 {
+		return rc, fmt.Errorf("backend.upstream and backend.upstreams are mutually exclusive")
+	}
+	if backend.Upstream != "" || len(backend.Upstreams) > 0 {
+		rc.Mode = "sync"
+		if backend.Protocol == "grpc" {
+			rc.Mode = "grpc"
+		}
+		rc.Backend = backend.Upstream
+		rc.PathStrip = backend.PathStrip
+		rc.LoadBalancing = backend.LoadBalancing
+		for _, u := range backend.Upstreams {
+			rc.Upstreams = append(rc.Upstreams, config.UpstreamConfig{URL: u.URL, Weight: u.Weight})
+		}
+		rc.HealthCheck = config.HealthCheckConfig{
+			Path:               backend.HealthCheck.Path,
+			IntervalMs:         backend.HealthCheck.IntervalMs,
+			TimeoutMs:          backend.HealthCheck.TimeoutMs,
+			UnhealthyThreshold: backend.HealthCheck.UnhealthyThreshold,
+			HealthyThreshold:   backend.HealthCheck.HealthyThreshold,
+		}
+		rc.OutlierDetection = config.OutlierDetectionConfig{
+			ConsecutiveFailures: backend.OutlierDetection.ConsecutiveFailures,
+			EjectionTimeMs:      backend.OutlierDetection.EjectionTimeMs,
+		}
+	} else {
+		rc.Mode = "async"
+		if backend.PathStrip != "" {
+			return rc, fmt.Errorf("backend.pathStrip requires backend.upstream")
+		}
+		if backend.Protocol == "grpc" {
+			return rc, fmt.Errorf("backend.protocol grpc requires backend.upstream")
+		}
+	}
+
+	if err := config.NormalizeRoute(&rc); err != nil {
+		return rc, err
+	}
+	return rc, nil
+}
+
+// PolicyBundle compiles the bundle into the structure served by the policy
+// store. Bundles are loaded as stable versions (100% of traffic) unless a
+// route canary references them.
+func (b *PolicyBundle) PolicyBundle() *policy.PolicyBundle {
+	compat := b.Metadata.Compat
+	if compat == "" {
+		compat = "backward"
+	}
+
+	transforms := make([]policy.Transform, 0, len(b.Spec.Transforms))
+	for _, t := range b.Spec.Transforms {
+		phase := t.Phase
+		if phase == "" {
+			phase = "post-auth"
+		}
+		transforms = append(transforms, policy.Transform{Wasm: t.Wasm, Phase: phase, Config: t.Config})
+	}
+
+	return &policy.PolicyBundle{
+		Name:             b.Metadata.Name,
+		Version:          b.Metadata.Version,
+		Hash:             b.hash,
+		Compat:           compat,
+		CanaryPercentage: 100,
+		AuthConfig:       b.Spec.Auth,
+		AuthzRego:        b.Spec.Authorization.Rego,
+		Quotas:           b.Spec.Quotas,
+		RateLimit:        b.Spec.RateLimit,
+		Transforms:       transforms,
+		Observability:    b.Spec.Observability,
+		Security:         b.Spec.Security,
+		Cache:            b.Spec.Cache,
+	}
+}
+
+// mappingValue returns the value node for key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// documentHash returns a content hash of a document, independent of comments
+// and formatting
+func documentHash(node *yaml.Node) (string, error) {
+	var content interface{}
+	if err := node.Decode(&content); err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// syntaxError converts a YAML parse error into a FieldError with its line number
+func syntaxError(file string, err error) *FieldError {
+	e := &FieldError{File: file, Message: err.Error()}
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Column = 1
+	}
+	return e
+}
@@ -0,0 +1,352 @@
+package crd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const samplesDir = "../../../configs/samples"
+
+func TestLoadFile_PaymentsSample(t *testing.T) {
+	m, err := LoadFile(filepath.Join(samplesDir, "payments-api.yaml"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	if len(m.Products) != 1 || len(m.Routes) != 3 || len(m.Bundles) != 1 {
+		t.Fatalf("got %d products, %d routes, %d bundles; want 1, 3, 1",
+			len(m.Products), len(m.Routes), len(m.Bundles))
+	}
+
+	product, ok := m.Product("payments")
+	if !ok {
+		t.Fatal("expected payments product")
+	}
+	if plan, ok := product.Plan("pro"); !ok || plan.RateLimit.RPS != 200 || plan.Quota.Monthly != 2000000 {
+		t.Errorf("unexpected pro plan: %+v", plan)
+	}
+
+	rc := m.RouteConfigs[0]
+	if rc.Name != "pay-create" || rc.Path != "/v1/payments" || rc.Host != "api.example.com" {
+		t.Errorf("unexpected route: %+v", rc)
+	}
+	if rc.Mode != "async" || len(rc.Methods) != 1 || rc.Methods[0] != "POST" {
+		t.Errorf("expected async POST route, got mode=%s methods=%v", rc.Mode, rc.Methods)
+	}
+	if rc.Product != "payments" || rc.PolicyBundle != "pb-pay-v1@1.2.0" {
+		t.Errorf("unexpected product/bundle: %s %s", rc.Product, rc.PolicyBundle)
+	}
+	if rc.Retries.MaxAttempts != 2 || len(rc.Retries.RetryOn) != 2 {
+		t.Errorf("unexpected retries: %+v", rc.Retries)
+	}
+	if !rc.CircuitBreaker.Enabled || rc.CircuitBreaker.ErrorThreshold != 10 || rc.CircuitBreaker.Timeout != time.Minute {
+		t.Errorf("unexpected circuit breaker: %+v", rc.CircuitBreaker)
+	}
+
+	pb := m.PolicyBundles[0]
+	if pb.Name != "pb-pay-v1" || pb.Version != "1.2.0" || pb.CanaryPercentage != 100 {
+		t.Errorf("unexpected bundle: %s@%s (%d%%)", pb.Name, pb.Version, pb.CanaryPercentage)
+	}
+	if !strings.HasPrefix(pb.Hash, "sha256:") || !strings.Contains(pb.AuthzRego, "package apx.authz") {
+		t.Errorf("bundle hash or rego not compiled: %q", pb.Hash)
+	}
+	if pb.Quotas["perTenant"].(map[string]interface{})["limit"] != 10000 {
+		t.Errorf("unexpected quotas: %v", pb.Quotas)
+	}
+}
+
+func TestLoadFile_UpstreamRoute(t *testing.T) {
+	m, err := LoadFile(filepath.Join(samplesDir, "apigee-mock-proxy.yaml"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	rc := m.RouteConfigs[0]
+	if rc.Mode != "sync" || rc.Backend != "https://mocktarget.apigee.net" || rc.PathStrip != "/mock" {
+		t.Errorf("expected sync upstream route, got %+v", rc)
+	}
+}
+
+func TestLoad_UpstreamPool(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: Route
+metadata: {name: orders}
+spec:
+  match: {path: /orders/**}
+  backend:
+    pool: orders
+    upstreams:
+      - url: http://orders-a:8080
+        weight: 3
+      - url: http://orders-b:8080
+    loadBalancing: weighted
+    healthCheck: {path: /healthz, intervalMs: 5000}
+    outlierDetection: {consecutiveFailures: 3}
+`)
+
+	m, err := Load("pool.yaml", data)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	rc := m.RouteConfigs[0]
+	if rc.Mode != "sync" || rc.LoadBalancing != "weighted" || len(rc.Upstreams) != 2 {
+		t.Fatalf("expected sync weighted pool route, got %+v", rc)
+	}
+	if rc.Upstreams[0].Weight != 3 || rc.Upstreams[1].Weight != 1 {
+		t.Errorf("unexpected upstream weights: %+v", rc.Upstreams)
+	}
+	if rc.HealthCheck.Path != "/healthz" || rc.HealthCheck.IntervalMs != 5000 || rc.HealthCheck.TimeoutMs != 2000 {
+		t.Errorf("unexpected health check: %+v", rc.HealthCheck)
+	}
+	if rc.OutlierDetection.ConsecutiveFailures != 3 || rc.OutlierDetection.EjectionTimeMs != 30000 {
+		t.Errorf("unexpected outlier detection: %+v", rc.OutlierDetection)
+	}
+
+	both := bytes.Replace(data, []byte("    upstreams:"), []byte("    upstream: http://orders:8080\n    upstreams:"), 1)
+	if _, err := Load("pool.yaml", both); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("expected upstream/upstreams conflict, got %v", err)
+	}
+}
+
+func TestLoad_GRPCProtocol(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: Route
+metadata: {name: orders-grpc}
+spec:
+  match: {path: /orders.v1.Orders/*, methods: [POST]}
+  backend:
+    pool: orders
+    upstream: http://orders:9090
+    protocol: grpc
+`)
+
+	m, err := Load("grpc.yaml", data)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if rc := m.RouteConfigs[0]; rc.Mode != "grpc" || rc.Backend != "http://orders:9090" {
+		t.Errorf("expected grpc route to http://orders:9090, got %+v", rc)
+	}
+
+	queued := bytes.Replace(data, []byte("    upstream: http://orders:9090\n"), nil, 1)
+	if _, err := Load("grpc.yaml", queued); err == nil || !strings.Contains(err.Error(), "requires backend.upstream") {
+		t.Errorf("expected grpc without upstream to be rejected, got %v", err)
+	}
+}
+
+func TestLoad_ReportsErrorsWithLineNumbers(t *testing.T) {
+	data := []byte(`---
+apiVersion: apx/v1
+kind: Route
+metadata:
+  name: Bad_Name
+spec:
+  match:
+    path: /v1/**
+    methods: [GET, FETCH]
+  backend:
+    pool: cpu
+    timeoutMs: 50
+---
+apiVersion: apx/v1
+kind: Gateway
+metadata:
+  name: gw
+`)
+
+	_, err := Load("bad.yaml", data)
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected ErrorList, got %v", err)
+	}
+
+	want := []string{
+		"bad.yaml:5:9: metadata.name:",
+		"bad.yaml:9:20: spec.match.methods[1]:",
+		"bad.yaml:12:16: spec.backend.timeoutMs: value 50 must be >= 100",
+		`bad.yaml:15:7: kind: unsupported kind "Gateway"`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), err)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(list[i].Error(), prefix) {
+			t.Errorf("error %d = %q, want prefix %q", i, list[i].Error(), prefix)
+		}
+	}
+}
+
+func TestLoad_MissingRequiredAndDuplicates(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: PolicyBundle
+metadata:
+  name: pb
+  version: 1.0.0
+spec: {}
+---
+apiVersion: apx/v1
+kind: PolicyBundle
+metadata:
+  name: pb
+  version: 1.0.0
+spec: {}
+---
+apiVersion: apx/v1
+kind: Route
+metadata:
+  name: r
+spec:
+  match:
+    path: /x
+`)
+
+	_, err := Load("dup.yaml", data)
+	if err == nil || !strings.Contains(err.Error(), `dup.yaml:20:3: spec: missing required field "backend"`) {
+		t.Fatalf("expected missing backend error, got %v", err)
+	}
+
+	_, err = Load("dup.yaml", data[:bytes.Index(data, []byte("---\napiVersion: apx/v1\nkind: Route"))])
+	if err == nil || !strings.Contains(err.Error(), `dup.yaml:8:1: duplicate PolicyBundle "pb@1.0.0" (first defined at dup.yaml:1)`) {
+		t.Fatalf("expected duplicate bundle error, got %v", err)
+	}
+}
+
+func TestLoad_RouteCanary(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: PolicyBundle
+metadata: {name: pb, version: 1.0.0}
+spec: {}
+---
+apiVersion: apx/v1
+kind: PolicyBundle
+metadata: {name: pb, version: 1.1.0}
+spec: {}
+---
+apiVersion: apx/v1
+kind: Route
+metadata: {name: r}
+spec:
+  match: {path: /x}
+  backend: {pool: cpu}
+  policyBundleRef: pb@1.0.0
+  canary: {enabled: true, weight: 5, policyBundleRef: pb@1.1.0}
+`)
+
+	m, err := Load("canary.yaml", data)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	canary := m.PolicyBundles[1]
+	if canary.CanaryPercentage != 5 || canary.StableVersion != "1.0.0" {
+		t.Errorf("canary = %d%% of %s, want 5%% of 1.0.0", canary.CanaryPercentage, canary.StableVersion)
+	}
+	if m.PolicyBundles[0].CanaryPercentage != 100 {
+		t.Errorf("stable bundle should serve 100%%, got %d", m.PolicyBundles[0].CanaryPercentage)
+	}
+}
+
+func TestLoad_RouteScopes(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: Route
+metadata: {name: admin}
+spec:
+  match: {path: /v1/admin/**}
+  backend: {pool: cpu}
+  scopes: [admin, audit:read]
+`)
+
+	m, err := Load("scopes.yaml", data)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if scopes := m.RouteConfigs[0].Scopes; len(scopes) != 2 || scopes[0] != "admin" || scopes[1] != "audit:read" {
+		t.Errorf("scopes = %v, want [admin audit:read]", scopes)
+	}
+}
+
+func TestLoad_RouteCost(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: Route
+metadata: {name: completions}
+spec:
+  match: {path: /v1/completions}
+  backend: {pool: gpu}
+  cost: {weight: 10, bodyBytes: 4096, responseHeader: X-APX-Cost}
+`)
+
+	m, err := Load("cost.yaml", data)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cost := m.RouteConfigs[0].Cost; cost.Weight != 10 || cost.BodyBytes != 4096 || cost.ResponseHeader != "X-APX-Cost" {
+		t.Errorf("cost = %+v", cost)
+	}
+
+	if _, err := Load("cost.yaml", bytes.Replace(data, []byte("weight: 10"), []byte("weight: 0"), 1)); err == nil {
+		t.Error("Load accepted cost.weight 0")
+	}
+}
+
+func TestLoad_ProductRateLimitHeaders(t *testing.T) {
+	data := []byte(`apiVersion: apx/v1
+kind: Product
+metadata: {name: payments}
+spec:
+  plans:
+    - {name: free, rateLimit: {rps: 10}}
+  rateLimitHeaders: ietf
+---
+apiVersion: apx/v1
+kind: Route
+metadata: {name: charges, labels: {product: payments}}
+spec:
+  match: {path: /v1/charges}
+  backend: {pool: payments}
+---
+apiVersion: apx/v1
+kind: Route
+metadata: {name: status}
+spec:
+  match: {path: /status}
+  backend: {pool: payments}
+`)
+
+	m, err := Load("headers.yaml", data)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := m.RouteConfigs[0].RateLimitHeaders; got != "ietf" {
+		t.Errorf("product route RateLimitHeaders = %q, want ietf", got)
+	}
+	if got := m.RouteConfigs[1].RateLimitHeaders; got != "x-ratelimit" {
+		t.Errorf("unlabelled route RateLimitHeaders = %q, want x-ratelimit", got)
+	}
+
+	if _, err := Load("headers.yaml", bytes.Replace(data, []byte("rateLimitHeaders: ietf"), []byte("rateLimitHeaders: rfc"), 1)); err == nil {
+		t.Error("Load accepted rateLimitHeaders rfc")
+	}
+}
+
+// TestBundledSchemasInSync guards against the embedded copies drifting from configs/crds
+func TestBundledSchemasInSync(t *testing.T) {
+	entries, err := schemaFS.ReadDir("schemas")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	for _, entry := range entries {
+		source, err := os.ReadFile(filepath.Join("../../../configs/crds", entry.Name()))
+		if err != nil {
+			t.Skipf("configs/crds not available: %v", err)
+		}
+		bundled, _ := schemaFS.ReadFile("schemas/" + entry.Name())
+		if !bytes.Equal(source, bundled) {
+			t.Errorf("schemas/%s differs from configs/crds/%s", entry.Name(), entry.Name())
+		}
+	}
+}
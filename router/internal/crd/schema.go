@@ -0,0 +1,271 @@
+package crd
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schemas are copies of configs/crds (the Docker build context only includes router/)
+//
+//go:embed schemas/*.schema.yaml
+var schemaFS embed.FS
+
+// Schema is the subset of JSON Schema used by the apx/v1 CRD definitions
+type Schema struct {
+	Type                 string             `yaml:"type"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	AdditionalProperties *Schema            `yaml:"additionalProperties"`
+	Items                *Schema            `yaml:"items"`
+	Enum                 []string           `yaml:"enum"`
+	Pattern              string             `yaml:"pattern"`
+	Format               string             `yaml:"format"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MinItems             *int               `yaml:"minItems"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaDocument is the apx/v1 Schema wrapper around a CRD definition
+type schemaDocument struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Schema *Schema `yaml:"schema"`
+	} `yaml:"spec"`
+}
+
+var (
+	schemasOnce sync.Once
+	schemas     map[string]*Schema
+	schemasErr  error
+)
+
+// schemaFor returns the bundled schema for a document kind
+func schemaFor(kind string) (*Schema, bool, error) {
+	schemasOnce.Do(func() {
+		schemas, schemasErr = loadSchemas()
+	})
+	if schemasErr != nil {
+		return nil, false, schemasErr
+	}
+	s, ok := schemas[kind]
+	return s, ok, nil
+}
+
+// loadSchemas parses and compiles the embedded CRD schemas, keyed by kind
+func loadSchemas() (map[string]*Schema, error) {
+	entries, err := schemaFS.ReadDir("schemas")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundled schemas: %w", err)
+	}
+
+	result := make(map[string]*Schema, len(entries))
+	for _, entry := range entries {
+		data, err := schemaFS.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema %s: %w", entry.Name(), err)
+		}
+
+		var doc schemaDocument
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse schema %s: %w", entry.Name(), err)
+		}
+		if doc.Metadata.Name == "" || doc.Spec.Schema == nil {
+			return nil, fmt.Errorf("schema %s is missing metadata.name or spec.schema", entry.Name())
+		}
+		if err := doc.Spec.Schema.compile(); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", entry.Name(), err)
+		}
+		result[doc.Metadata.Name] = doc.Spec.Schema
+	}
+
+	return result, nil
+}
+
+// compile pre-compiles regular expressions throughout the schema tree
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if err := s.AdditionalProperties.compile(); err != nil {
+		return err
+	}
+	return s.Items.compile()
+}
+
+// validate checks a YAML node against the schema, appending one FieldError
+// per violation so that a single run reports every problem in the document
+func (s *Schema) validate(file, path string, node *yaml.Node, errs *ErrorList) {
+	if s == nil || node == nil {
+		return
+	}
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	fail := func(n *yaml.Node, format string, args ...interface{}) {
+		errs.add(file, n, path, fmt.Sprintf(format, args...))
+	}
+
+	switch s.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			fail(node, "expected object, got %s", describe(node))
+			return
+		}
+		s.validateObject(file, path, node, errs)
+		return
+
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			fail(node, "expected array, got %s", describe(node))
+			return
+		}
+		if s.MinItems != nil && len(node.Content) < *s.MinItems {
+			fail(node, "must have at least %d item(s)", *s.MinItems)
+		}
+		for i, item := range node.Content {
+			s.Items.validate(file, fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+		return
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		if s.Type != "" {
+			fail(node, "expected %s, got %s", s.Type, describe(node))
+		}
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		if node.Tag != "!!str" {
+			fail(node, "expected string, got %s", describe(node))
+			return
+		}
+	case "integer":
+		if node.Tag != "!!int" {
+			fail(node, "expected integer, got %s", describe(node))
+			return
+		}
+	case "number":
+		if node.Tag != "!!int" && node.Tag != "!!float" {
+			fail(node, "expected number, got %s", describe(node))
+			return
+		}
+	case "boolean":
+		if node.Tag != "!!bool" {
+			fail(node, "expected boolean, got %s", describe(node))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !containsString(s.Enum, node.Value) {
+		fail(node, "value %q must be one of [%s]", node.Value, strings.Join(s.Enum, ", "))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(node.Value) {
+		fail(node, "value %q does not match pattern %s", node.Value, s.Pattern)
+	}
+	if s.Format == "uri" {
+		if u, err := url.Parse(node.Value); err != nil || u.Scheme == "" || u.Host == "" {
+			fail(node, "value %q is not an absolute URI", node.Value)
+		}
+	}
+	if s.Minimum != nil || s.Maximum != nil {
+		v, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil || math.IsNaN(v) {
+			fail(node, "value %q is not a number", node.Value)
+			return
+		}
+		if s.Minimum != nil && v < *s.Minimum {
+			fail(node, "value %s must be >= %v", node.Value, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail(node, "value %s must be <= %v", node.Value, *s.Maximum)
+		}
+	}
+}
+
+// validateObject checks required keys and validates each property
+func (s *Schema) validateObject(file, path string, node *yaml.Node, errs *ErrorList) {
+	present := make(map[string]bool, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		present[key.Value] = true
+
+		child := joinPath(path, key.Value)
+		if prop, ok := s.Properties[key.Value]; ok {
+			prop.validate(file, child, value, errs)
+		} else if s.AdditionalProperties != nil {
+			s.AdditionalProperties.validate(file, child, value, errs)
+		}
+	}
+
+	for _, name := range s.Required {
+		if !present[name] {
+			errs.add(file, node, path, fmt.Sprintf("missing required field %q", name))
+		}
+	}
+}
+
+// describe names the YAML type of a node for error messages
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.Tag {
+	case "!!str":
+		return "string"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return node.Tag
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func containsString(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
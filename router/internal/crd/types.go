@@ -0,0 +1,223 @@
+package crd
+
+// APIVersion is the only manifest API version understood by the loader
+const APIVersion = "apx/v1"
+
+// Document kinds
+const (
+	KindProduct      = "Product"
+	KindRoute        = "Route"
+	KindPolicyBundle = "PolicyBundle"
+)
+
+// Location identifies where a document was defined
+type Location struct {
+	File string
+	Line int
+}
+
+// ObjectMeta is the metadata block shared by all apx/v1 documents
+type ObjectMeta struct {
+	Name           string            `yaml:"name"`
+	Version        string            `yaml:"version"`
+	Compat         string            `yaml:"compat"`
+	Labels         map[string]string `yaml:"labels"`
+	RegionAffinity []string          `yaml:"regionAffinity"`
+}
+
+// Product is an apx/v1 Product document
+type Product struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   ObjectMeta  `yaml:"metadata"`
+	Spec       ProductSpec `yaml:"spec"`
+
+	Source Location `yaml:"-"`
+}
+
+// ProductSpec describes the plans and authentication of a product
+type ProductSpec struct {
+	Description      string                `yaml:"description"`
+	Plans            []Plan                `yaml:"plans"`
+	Authentication   ProductAuthentication `yaml:"authentication"`
+	RateLimitHeaders string                `yaml:"rateLimitHeaders"` // x-ratelimit, ietf or both
+}
+
+// Plan is a product plan (tier)
+type Plan struct {
+	Name        string        `yaml:"name"`
+	RateLimit   PlanRateLimit `yaml:"rateLimit"`
+	Quota       PlanQuota     `yaml:"quota"`
+	Concurrency int           `yaml:"concurrency"`
+	Isolation   string        `yaml:"isolation"`
+	Residency   string        `yaml:"residency"`
+	Features    []string      `yaml:"features"`
+}
+
+// PlanRateLimit is the request rate allowed by a plan
+type PlanRateLimit struct {
+	RPS    int    `yaml:"rps"`
+	Burst  int    `yaml:"burst"`
+	Window string `yaml:"window"`
+}
+
+// PlanQuota is the request quota allowed by a plan
+type PlanQuota struct {
+	Daily   int64 `yaml:"daily"`
+	Monthly int64 `yaml:"monthly"`
+}
+
+// ProductAuthentication lists the authentication methods accepted by a product
+type ProductAuthentication struct {
+	Required *bool    `yaml:"required"`
+	Methods  []string `yaml:"methods"`
+}
+
+// Plan returns the named plan, if the product defines it
+func (p *Product) Plan(name string) (*Plan, bool) {
+	for i := range p.Spec.Plans {
+		if p.Spec.Plans[i].Name == name {
+			return &p.Spec.Plans[i], true
+		}
+	}
+	return nil, false
+}
+
+// Route is an apx/v1 Route document
+type Route struct {
+	APIVersion string     `yaml:"apiVersion"`
+	Kind       string     `yaml:"kind"`
+	Metadata   ObjectMeta `yaml:"metadata"`
+	Spec       RouteSpec  `yaml:"spec"`
+
+	Source Location `yaml:"-"`
+}
+
+// RouteSpec maps matching requests to a backend
+type RouteSpec struct {
+	Match           RouteMatch     `yaml:"match"`
+	Backend         RouteBackend   `yaml:"backend"`
+	PolicyBundleRef string         `yaml:"policyBundleRef"`
+	Scopes          []string       `yaml:"scopes"` // Required of API keys and tokens
+	Cost            RouteCost      `yaml:"cost"`
+	Canary          RouteCanary    `yaml:"canary"`
+	CircuitBreaker  CircuitBreaker `yaml:"circuitBreaker"`
+}
+
+// RouteCost prices a route's requests in rate limit and quota units
+type RouteCost struct {
+	Weight         int64  `yaml:"weight"`
+	BodyBytes      int64  `yaml:"bodyBytes"`
+	ResponseHeader string `yaml:"responseHeader"`
+}
+
+// RouteMatch holds the request matching criteria of a route
+type RouteMatch struct {
+	Host        string            `yaml:"host"`
+	Path        string            `yaml:"path"`
+	Methods     []string          `yaml:"methods"`
+	Headers     map[string]string `yaml:"headers"`
+	QueryParams map[string]string `yaml:"queryParams"`
+}
+
+// RouteBackend describes where matching requests are sent
+type RouteBackend struct {
+	Pool             string                `yaml:"pool"`
+	Upstream         string                `yaml:"upstream"`
+	Upstreams        []RouteUpstream       `yaml:"upstreams"`
+	Protocol         string                `yaml:"protocol"` // http (default) or grpc
+	PathStrip        string                `yaml:"pathStrip"`
+	TimeoutMs        int                   `yaml:"timeoutMs"`
+	Retries          RouteRetries          `yaml:"retries"`
+	LoadBalancing    string                `yaml:"loadBalancing"`
+	HealthCheck      RouteHealthCheck      `yaml:"healthCheck"`
+	OutlierDetection RouteOutlierDetection `yaml:"outlierDetection"`
+}
+
+// RouteUpstream is one load-balanced upstream endpoint
+type RouteUpstream struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// RouteHealthCheck configures active health probes of the upstreams
+type RouteHealthCheck struct {
+	Path               string `yaml:"path"`
+	IntervalMs         int    `yaml:"intervalMs"`
+	TimeoutMs          int    `yaml:"timeoutMs"`
+	UnhealthyThreshold int    `yaml:"unhealthyThreshold"`
+	HealthyThreshold   int    `yaml:"healthyThreshold"`
+}
+
+// RouteOutlierDetection configures passive ejection of failing upstreams
+type RouteOutlierDetection struct {
+	ConsecutiveFailures int `yaml:"consecutiveFailures"`
+	EjectionTimeMs      int `yaml:"ejectionTimeMs"`
+}
+
+// RouteRetries is the retry policy of a route backend
+type RouteRetries struct {
+	MaxAttempts        int      `yaml:"maxAttempts"`
+	RetryOn            []string `yaml:"retryOn"`
+	PerTryTimeoutMs    int      `yaml:"perTryTimeoutMs"`
+	BackoffBaseMs      int      `yaml:"backoffBaseMs"`
+	BackoffMaxMs       int      `yaml:"backoffMaxMs"`
+	RetryNonIdempotent bool     `yaml:"retryNonIdempotent"`
+}
+
+// RouteCanary sends a share of the route's traffic to another policy bundle
+type RouteCanary struct {
+	Enabled         bool   `yaml:"enabled"`
+	Weight          int    `yaml:"weight"`
+	PolicyBundleRef string `yaml:"policyBundleRef"`
+}
+
+// CircuitBreaker is the circuit breaker configuration of a route
+type CircuitBreaker struct {
+	Enabled        *bool  `yaml:"enabled"`
+	ErrorThreshold int    `yaml:"errorThreshold"`
+	Timeout        string `yaml:"timeout"`
+}
+
+// PolicyBundle is an apx/v1 PolicyBundle document
+type PolicyBundle struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   ObjectMeta       `yaml:"metadata"`
+	Spec       PolicyBundleSpec `yaml:"spec"`
+
+	Source Location `yaml:"-"`
+	hash   string
+}
+
+// PolicyBundleSpec holds the policies of a bundle. Sections without runtime
+// structure are kept as generic maps, matching policy.PolicyBundle.
+type PolicyBundleSpec struct {
+	Auth          map[string]interface{} `yaml:"auth"`
+	Authorization Authorization          `yaml:"authorization"`
+	Quotas        map[string]interface{} `yaml:"quotas"`
+	RateLimit     map[string]interface{} `yaml:"rateLimit"`
+	Transforms    []Transform            `yaml:"transforms"`
+	Observability map[string]interface{} `yaml:"observability"`
+	Security      map[string]interface{} `yaml:"security"`
+	Cache         map[string]interface{} `yaml:"cache"`
+}
+
+// Authorization holds the bundle's OPA policy
+type Authorization struct {
+	Rego         string `yaml:"rego"`
+	RegoRef      string `yaml:"regoRef"`
+	DefaultAllow bool   `yaml:"defaultAllow"`
+}
+
+// Transform is a WASM transform applied by the bundle
+type Transform struct {
+	Wasm   string                 `yaml:"wasm"`
+	Phase  string                 `yaml:"phase"`
+	Config map[string]interface{} `yaml:"config"`
+}
+
+// Ref returns the bundle reference (name@version)
+func (b *PolicyBundle) Ref() string {
+	return b.Metadata.Name + "@" + b.Metadata.Version
+}
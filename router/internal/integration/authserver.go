@@ -0,0 +1,189 @@
+package integration
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MockAuthorizationServer is a stand-in OAuth2 authorization server. Clients
+// obtain opaque access tokens with the client credentials grant at /token;
+// resource servers validate them at /introspect (RFC 7662).
+type MockAuthorizationServer struct {
+	Server *httptest.Server
+
+	mu      sync.Mutex
+	clients map[string]*mockOAuthClient // client_id -> client
+	tokens  map[string]map[string]interface{}
+
+	introspections atomic.Int32
+	unavailable    atomic.Bool
+}
+
+type mockOAuthClient struct {
+	secret string
+	claims map[string]interface{}
+}
+
+// NewMockAuthorizationServer starts a stand-in authorization server
+func NewMockAuthorizationServer() *MockAuthorizationServer {
+	as := &MockAuthorizationServer{
+		clients: make(map[string]*mockOAuthClient),
+		tokens:  make(map[string]map[string]interface{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", as.handleToken)
+	mux.HandleFunc("/introspect", as.handleIntrospect)
+	as.Server = httptest.NewServer(mux)
+	return as
+}
+
+// RegisterClient adds a client. claims are added to the introspection
+// response of every token issued to it (e.g. tenant_id and scope).
+func (as *MockAuthorizationServer) RegisterClient(clientID, secret string, claims map[string]interface{}) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.clients[clientID] = &mockOAuthClient{secret: secret, claims: claims}
+}
+
+// IssueToken performs a client credentials grant and returns the access token
+func (as *MockAuthorizationServer) IssueToken(clientID, secret string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, as.Server.URL+"/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, secret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.AccessToken, nil
+}
+
+// Revoke invalidates a token
+func (as *MockAuthorizationServer) Revoke(token string) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	delete(as.tokens, token)
+}
+
+// SetUnavailable makes the introspection endpoint answer 503
+func (as *MockAuthorizationServer) SetUnavailable(unavailable bool) {
+	as.unavailable.Store(unavailable)
+}
+
+// Introspections returns the number of introspection requests served
+func (as *MockAuthorizationServer) Introspections() int {
+	return int(as.introspections.Load())
+}
+
+// IntrospectionURL returns the introspection endpoint
+func (as *MockAuthorizationServer) IntrospectionURL() string {
+	return as.Server.URL + "/introspect"
+}
+
+// Close shuts the server down
+func (as *MockAuthorizationServer) Close() {
+	as.Server.Close()
+}
+
+// authenticate checks the client credentials of a request
+func (as *MockAuthorizationServer) authenticate(r *http.Request) (string, *mockOAuthClient, bool) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		return "", nil, false
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	client, ok := as.clients[clientID]
+	if !ok || client.secret != secret {
+		return "", nil, false
+	}
+	return clientID, client, true
+}
+
+func (as *MockAuthorizationServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.FormValue("grant_type") != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	clientID, client, ok := as.authenticate(r)
+	if !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+	exp := time.Now().Add(time.Hour)
+
+	claims := map[string]interface{}{
+		"active":    true,
+		"client_id": clientID,
+		"sub":       clientID,
+		"exp":       exp.Unix(),
+	}
+	for k, v := range client.claims {
+		claims[k] = v
+	}
+
+	as.mu.Lock()
+	as.tokens[token] = claims
+	as.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(time.Hour.Seconds()),
+		"scope":        claims["scope"],
+	})
+}
+
+func (as *MockAuthorizationServer) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	as.introspections.Add(1)
+
+	if as.unavailable.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if _, _, ok := as.authenticate(r); !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	as.mu.Lock()
+	claims, ok := as.tokens[r.FormValue("token")]
+	as.mu.Unlock()
+	if !ok {
+		claims = map[string]interface{}{"active": false}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claims)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
@@ -0,0 +1,178 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/auth"
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// noKeysResolver rejects every API key
+type noKeysResolver struct{}
+
+func (noKeysResolver) ResolveTenant(ctx context.Context, apiKey string) (*tenant.Tenant, error) {
+	return nil, pkgauth.ErrInvalidToken
+}
+
+func (noKeysResolver) GetDefaultTenant(ctx context.Context) *tenant.Tenant {
+	return &tenant.Tenant{ResourceID: "default"}
+}
+
+// newOAuth2Router serves a route whose policy bundle accepts OAuth2 access
+// tokens introspected at as. The backend echoes the tenant and scopes.
+func newOAuth2Router(t *testing.T, as *MockAuthorizationServer) *httptest.Server {
+	t.Helper()
+	t.Setenv("APX_INTROSPECTION_SECRET", "router-secret")
+	as.RegisterClient("apx-router", "router-secret", nil)
+
+	bundle := &policy.PolicyBundle{AuthConfig: map[string]interface{}{
+		"oauth2": map[string]interface{}{
+			"introspectionUri": as.IntrospectionURL(),
+			"clientId":         "apx-router",
+			"clientSecretRef":  "env:APX_INTROSPECTION_SECRET",
+		},
+	}}
+	authPolicy, err := bundle.Auth()
+	require.NoError(t, err)
+
+	handler := middleware.TenantContextWithAuth(noKeysResolver{}, middleware.AuthOptions{
+		OAuth2: auth.NewOAuth2Authenticator(pkgauth.IntrospectionConfig{}, zap.NewNop()),
+		Policy: func(r *http.Request) *policy.AuthPolicy { return authPolicy },
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tenant": middleware.GetTenantID(r.Context()),
+			"scopes": middleware.GetScopes(r.Context()),
+		})
+	}))
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func callWithToken(t *testing.T, url, token string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+// TestOAuth2ClientCredentials tests a partner calling the router with a token
+// from the client credentials grant
+func TestOAuth2ClientCredentials(t *testing.T) {
+	as := NewMockAuthorizationServer()
+	defer as.Close()
+	router := newOAuth2Router(t, as)
+
+	as.RegisterClient("partner-1", "partner-secret", map[string]interface{}{
+		"tenant_id": "acme_payments_prod",
+		"tier":      "pro",
+		"scope":     "payments:read payments:write",
+	})
+	token, err := as.IssueToken("partner-1", "partner-secret")
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	status, body := callWithToken(t, router.URL+"/payments", token)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "acme_payments_prod", body["tenant"])
+	assert.Equal(t, []interface{}{"payments:read", "payments:write"}, body["scopes"])
+
+	// Later requests are served from the introspection cache
+	for i := 0; i < 3; i++ {
+		status, _ = callWithToken(t, router.URL+"/payments", token)
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.Equal(t, 1, as.Introspections())
+}
+
+// TestOAuth2InactiveTokens tests that inactive tokens are rejected and the
+// rejection is cached
+func TestOAuth2InactiveTokens(t *testing.T) {
+	as := NewMockAuthorizationServer()
+	defer as.Close()
+	router := newOAuth2Router(t, as)
+
+	for i := 0; i < 3; i++ {
+		status, body := callWithToken(t, router.URL+"/payments", "unknown-opaque-token")
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, "unauthorized", body["error"])
+	}
+	assert.Equal(t, 1, as.Introspections(), "inactive tokens should be negatively cached")
+
+	// A token without the tenant claim is active but cannot be mapped
+	as.RegisterClient("no-tenant", "secret", map[string]interface{}{"scope": "payments:read"})
+	token, err := as.IssueToken("no-tenant", "secret")
+	require.NoError(t, err)
+	status, _ := callWithToken(t, router.URL+"/payments", token)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// API keys are not accepted by an OAuth2-only route
+	status, _ = callWithToken(t, router.URL+"/payments", "apx_test_"+strings.Repeat("0", 32))
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+// TestOAuth2IntrospectionUnavailable tests that an unreachable authorization
+// server is reported as 503 and not cached
+func TestOAuth2IntrospectionUnavailable(t *testing.T) {
+	as := NewMockAuthorizationServer()
+	defer as.Close()
+	router := newOAuth2Router(t, as)
+
+	as.RegisterClient("partner-1", "partner-secret", map[string]interface{}{"tenant_id": "acme_payments_prod"})
+	token, err := as.IssueToken("partner-1", "partner-secret")
+	require.NoError(t, err)
+
+	as.SetUnavailable(true)
+	status, body := callWithToken(t, router.URL+"/payments", token)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "service_unavailable", body["error"])
+
+	as.SetUnavailable(false)
+	status, _ = callWithToken(t, router.URL+"/payments", token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, as.Introspections())
+}
+
+// TestOAuth2SecretUnavailable tests that a client secret the router cannot
+// read is reported as 503, not as an invalid token
+func TestOAuth2SecretUnavailable(t *testing.T) {
+	as := NewMockAuthorizationServer()
+	defer as.Close()
+	router := newOAuth2Router(t, as)
+
+	as.RegisterClient("partner-1", "partner-secret", map[string]interface{}{"tenant_id": "acme_payments_prod"})
+	token, err := as.IssueToken("partner-1", "partner-secret")
+	require.NoError(t, err)
+
+	os.Unsetenv("APX_INTROSPECTION_SECRET")
+	status, body := callWithToken(t, router.URL+"/payments", token)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "service_unavailable", body["error"])
+	assert.Equal(t, 0, as.Introspections())
+
+	// The secret is read again once it is available
+	t.Setenv("APX_INTROSPECTION_SECRET", "router-secret")
+	status, _ = callWithToken(t, router.URL+"/payments", token)
+	assert.Equal(t, http.StatusOK, status)
+}
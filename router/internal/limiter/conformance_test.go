@@ -0,0 +1,160 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// step is a request made after advancing the clock by advance
+type step struct {
+	advance       time.Duration
+	n             int64
+	wantAllowed   bool
+	wantRemaining int64
+	wantRetry     time.Duration
+}
+
+// allowed is a step that allows n requests, leaving remaining
+func allowed(advance time.Duration, n, remaining int64) step {
+	return step{advance, n, true, remaining, 0}
+}
+
+// denied is a step that denies a request until retry
+func denied(advance time.Duration, remaining int64, retry time.Duration) step {
+	return step{advance, 1, false, remaining, retry}
+}
+
+// conformance lists, for 10 requests per second, how each algorithm handles
+// bursts
+var conformance = map[Algorithm][]step{
+	// A full burst, then nothing until the window ends; right after, a second
+	// full burst passes
+	FixedWindow: {
+		allowed(0, 1, 9),
+		allowed(0, 9, 0),
+		denied(0, 0, time.Second),
+		denied(999*time.Millisecond, 0, time.Millisecond),
+		allowed(time.Millisecond, 10, 0),
+		denied(0, 0, time.Second),
+	},
+
+	// Never more than 10 in any second: requests are allowed again as the
+	// oldest leave the window
+	SlidingWindowLog: {
+		allowed(0, 5, 5),
+		allowed(500*time.Millisecond, 5, 0),
+		denied(499*time.Millisecond, 0, time.Millisecond),
+		allowed(time.Millisecond, 5, 0),
+		denied(0, 0, 500*time.Millisecond),
+		allowed(500*time.Millisecond, 1, 4),
+	},
+
+	// The previous window's count decays over the current one, so a burst
+	// at the end of a window holds back the start of the next
+	SlidingWindowCounter: {
+		allowed(0, 10, 0),
+		denied(0, 0, 1100*time.Millisecond),
+		denied(time.Second, 0, 100*time.Millisecond),
+		allowed(100*time.Millisecond, 1, 0),
+		allowed(400*time.Millisecond, 4, 0),
+		denied(0, 0, 100*time.Millisecond),
+		allowed(1500*time.Millisecond, 10, 0),
+	},
+
+	// A burst of 10, then one request per 100ms
+	GCRA: {
+		allowed(0, 10, 0),
+		denied(0, 0, 100*time.Millisecond),
+		denied(50*time.Millisecond, 0, 50*time.Millisecond),
+		allowed(50*time.Millisecond, 1, 0),
+		allowed(250*time.Millisecond, 1, 1),
+		allowed(1650*time.Millisecond, 10, 0),
+		denied(0, 0, 100*time.Millisecond),
+	},
+}
+
+// testConformance runs the conformance steps against a limiter created
+// with a fake clock
+func testConformance(t *testing.T, newLimiter func(now func() time.Time) Limiter) {
+	ctx := context.Background()
+	for alg, steps := range conformance {
+		t.Run(string(alg), func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			l := newLimiter(func() time.Time { return now })
+			limit := Limit{Requests: 10, Window: time.Second, Algorithm: alg}
+			key := fmt.Sprintf("conformance:%d", time.Now().UnixNano())
+
+			for i, s := range steps {
+				now = now.Add(s.advance)
+				peek, err := l.Peek(ctx, key, limit, s.n)
+				if err != nil {
+					t.Fatalf("step %d: peek: %v", i, err)
+				}
+				res, err := l.Allow(ctx, key, limit, s.n)
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if *peek != *res {
+					t.Fatalf("step %d: peek %+v, allow %+v", i, peek, res)
+				}
+				if res.Allowed != s.wantAllowed || res.Remaining != s.wantRemaining || res.RetryAfter != s.wantRetry {
+					t.Fatalf("step %d: allowed=%v remaining=%d retry=%v, want %v %d %v",
+						i, res.Allowed, res.Remaining, res.RetryAfter, s.wantAllowed, s.wantRemaining, s.wantRetry)
+				}
+				if res.Limit != 10 || res.ResetAt.Before(now) {
+					t.Fatalf("step %d: limit=%d reset=%v", i, res.Limit, res.ResetAt.Sub(now))
+				}
+			}
+
+			// Keys are limited separately
+			if res, err := l.Allow(ctx, key+":other", limit, 10); err != nil || !res.Allowed {
+				t.Errorf("other key: %+v, %v", res, err)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter_Conformance(t *testing.T) {
+	testConformance(t, func(now func() time.Time) Limiter {
+		l := NewMemoryLimiter()
+		l.now = now
+		return l
+	})
+}
+
+func TestMemoryLimiter_Sweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+
+	for _, alg := range []Algorithm{FixedWindow, SlidingWindowLog, SlidingWindowCounter, GCRA} {
+		l.Allow(ctx, "k", Limit{Requests: 10, Window: time.Second, Algorithm: alg}, 1)
+	}
+	now = now.Add(2 * time.Minute)
+	l.Allow(ctx, "k", Limit{Requests: 10, Window: time.Second}, 1)
+	if len(l.states) != 1 {
+		t.Errorf("states = %d, want 1", len(l.states))
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := map[string]Algorithm{
+		"":                   SlidingWindowCounter,
+		"sliding-window":     SlidingWindowCounter,
+		"token-bucket":       GCRA,
+		"fixed-window":       FixedWindow,
+		"sliding-window-log": SlidingWindowLog,
+		"gcra":               GCRA,
+	}
+	for s, want := range tests {
+		if got, err := ParseAlgorithm(s); err != nil || got != want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v; want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseAlgorithm("leaky"); err == nil {
+		t.Error("ParseAlgorithm(leaky) succeeded")
+	}
+}
@@ -0,0 +1,248 @@
+package limiter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// FailurePolicy decides how limits are enforced while Redis is unavailable
+type FailurePolicy string
+
+// Failure policies
+const (
+	FailOpen   FailurePolicy = "open"   // Allow every request
+	FailClosed FailurePolicy = "closed" // Reject every request
+	FailLocal  FailurePolicy = "local"  // Enforce each router's share of the limits in memory
+)
+
+// ParseFailurePolicy parses a failure policy name
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch p := FailurePolicy(s); p {
+	case FailOpen, FailClosed, FailLocal:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown rate limit failure policy %q (want open, closed or local)", s)
+}
+
+// ErrUnavailable is returned while Redis is unavailable and the failure
+// policy is closed
+var ErrUnavailable = errors.New("rate limiting unavailable")
+
+// RedisDown reports whether err, returned by a Redis call made with ctx,
+// means Redis is unreachable. The caller's own context ending (e.g. a
+// client disconnecting) and error replies from a running Redis do not.
+func RedisDown(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+// RetryInterval is how long clients rejected by the closed policy should
+// wait: Redis is probed this often
+const RetryInterval = probeInterval
+
+const (
+	// probeInterval is how often Redis is probed and routers heartbeat
+	probeInterval = 5 * time.Second
+
+	// peersKey is the sorted set of router heartbeats
+	peersKey = "apx:rl:routers"
+)
+
+// Failover tracks whether Redis is available and applies the failure
+// policy while it isn't. Routers heartbeat in Redis so that, in local mode,
+// each enforces its share of a limit: limit / routers last seen.
+type Failover struct {
+	policy     FailurePolicy
+	client     *redis.Client
+	local      *MemoryLimiter
+	instanceID string
+	logger     *zap.Logger
+
+	degraded atomic.Bool
+	peers    atomic.Int64
+}
+
+// NewFailover creates a failover for the limiters using client. Run must
+// be started to detect when Redis recovers.
+func NewFailover(client *redis.Client, policy FailurePolicy, logger *zap.Logger) *Failover {
+	f := &Failover{
+		policy:     policy,
+		client:     client,
+		local:      NewMemoryLimiter(),
+		instanceID: instanceID(),
+		logger:     logger,
+	}
+	f.peers.Store(1)
+	return f
+}
+
+// Policy returns the failure policy
+func (f *Failover) Policy() FailurePolicy {
+	return f.policy
+}
+
+// Degraded reports whether Redis is unavailable
+func (f *Failover) Degraded() bool {
+	return f.degraded.Load()
+}
+
+// Peers returns the number of routers last seen sharing the limits
+func (f *Failover) Peers() int64 {
+	return f.peers.Load()
+}
+
+// MarkDown records a Redis failure (see RedisDown). Until Run sees Redis recover, limits
+// are enforced by the failure policy without calling Redis.
+func (f *Failover) MarkDown(err error) {
+	if f.degraded.CompareAndSwap(false, true) {
+		metrics.RateLimitDegraded.Set(1)
+		f.logger.Error("rate limiting degraded: Redis unavailable",
+			zap.Error(err),
+			zap.String("failure_policy", string(f.policy)),
+			zap.Int64("peers", f.Peers()))
+	}
+}
+
+// Local counts n requests against this router's share of limit. Shares
+// are rounded up, so a fleet together allows at least the limit.
+func (f *Failover) Local(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	result, err := f.local.Allow(ctx, key, f.share(limit), n)
+	if err == nil {
+		metrics.RateLimitDegradedDecisions.WithLabelValues(string(f.policy), strconv.FormatBool(result.Allowed)).Inc()
+	}
+	return result, err
+}
+
+// share returns this router's share of limit
+func (f *Failover) share(limit Limit) Limit {
+	peers := f.Peers()
+	limit.Requests = max((limit.Requests+peers-1)/peers, 1)
+	return limit
+}
+
+// Decided records a request allowed or rejected outright by the open or
+// closed policy
+func (f *Failover) Decided(allowed bool) {
+	metrics.RateLimitDegradedDecisions.WithLabelValues(string(f.policy), strconv.FormatBool(allowed)).Inc()
+}
+
+// Run probes Redis and heartbeats until ctx is done. When Redis recovers,
+// the local counts are dropped and limits are enforced by Redis again.
+func (f *Failover) Run(ctx context.Context) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+
+	for {
+		f.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe heartbeats and counts the routers seen in the last three intervals
+func (f *Failover) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, probeInterval)
+	defer cancel()
+
+	now := time.Now()
+	var count *redis.IntCmd
+	_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, peersKey, redis.Z{Score: float64(now.Unix()), Member: f.instanceID})
+		pipe.ZRemRangeByScore(ctx, peersKey, "-inf", strconv.FormatInt(now.Add(-3*probeInterval).Unix(), 10))
+		count = pipe.ZCard(ctx, peersKey)
+		pipe.Expire(ctx, peersKey, 3*probeInterval)
+		return nil
+	})
+	if err != nil {
+		if RedisDown(ctx, err) {
+			f.MarkDown(err)
+		}
+		return
+	}
+
+	f.peers.Store(max(count.Val(), 1))
+	metrics.RateLimitPeers.Set(float64(f.Peers()))
+
+	if f.degraded.CompareAndSwap(true, false) {
+		f.local.reset()
+		metrics.RateLimitDegraded.Set(0)
+		f.logger.Info("rate limiting recovered: Redis available",
+			zap.Int64("peers", f.Peers()))
+	}
+}
+
+// Wrap returns a limiter that uses l while Redis is available and applies
+// the failure policy while it isn't
+func (f *Failover) Wrap(l Limiter) Limiter {
+	return &failoverLimiter{primary: l, failover: f}
+}
+
+type failoverLimiter struct {
+	primary  Limiter
+	failover *Failover
+}
+
+func (l *failoverLimiter) Allow(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.check(ctx, key, limit, n, false)
+}
+
+// Peek records no degraded decisions; the Allow that follows it does
+func (l *failoverLimiter) Peek(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.check(ctx, key, limit, n, true)
+}
+
+func (l *failoverLimiter) check(ctx context.Context, key string, limit Limit, n int64, peek bool) (*Result, error) {
+	if !l.failover.Degraded() {
+		check := l.primary.Allow
+		if peek {
+			check = l.primary.Peek
+		}
+		result, err := check(ctx, key, limit, n)
+		if !RedisDown(ctx, err) {
+			return result, err
+		}
+		l.failover.MarkDown(err)
+	}
+
+	switch l.failover.policy {
+	case FailLocal:
+		if peek {
+			return l.failover.local.Peek(ctx, key, l.failover.share(limit), n)
+		}
+		return l.failover.Local(ctx, key, limit, n)
+	case FailClosed:
+		l.failover.Decided(false)
+		return nil, ErrUnavailable
+	default:
+		if !peek {
+			l.failover.Decided(true)
+		}
+		return &Result{Allowed: true, Limit: limit.Requests, Remaining: limit.Requests, ResetAt: time.Now().Add(limit.Window)}, nil
+	}
+}
+
+// instanceID identifies this router in heartbeats: its hostname (the pod
+// name) and a random suffix, so routers sharing a host are counted apart
+func instanceID() string {
+	host, _ := os.Hostname()
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return host + "-" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,140 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// downLimiter fails like a limiter whose Redis is unreachable
+type downLimiter struct{ calls int }
+
+func (l *downLimiter) Allow(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	l.calls++
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+func (l *downLimiter) Peek(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.Allow(ctx, key, limit, n)
+}
+
+func newTestFailover(t *testing.T, policy FailurePolicy) *Failover {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return NewFailover(client, policy, zap.NewNop())
+}
+
+func TestFailover_Local(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFailover(t, FailLocal)
+	f.peers.Store(4)
+	primary := &downLimiter{}
+	l := f.Wrap(primary)
+	limit := Limit{Requests: 10, Window: time.Minute, Algorithm: FixedWindow}
+
+	// Each of the 4 routers allows its share, rounded up
+	for i := 0; i < 3; i++ {
+		res, err := l.Allow(ctx, "k", limit, 1)
+		if err != nil || !res.Allowed || res.Limit != 3 {
+			t.Fatalf("request %d: %+v, %v", i, res, err)
+		}
+	}
+	if res, _ := l.Allow(ctx, "k", limit, 1); res.Allowed {
+		t.Error("request over the local share allowed")
+	}
+
+	// Once degraded, Redis isn't called until it recovers
+	if !f.Degraded() || primary.calls != 1 {
+		t.Errorf("degraded = %v, primary calls = %d", f.Degraded(), primary.calls)
+	}
+}
+
+func TestFailover_OpenAndClosed(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	open := newTestFailover(t, FailOpen).Wrap(&downLimiter{})
+	for i := 0; i < 3; i++ {
+		if res, err := open.Allow(ctx, "k", limit, 1); err != nil || !res.Allowed {
+			t.Fatalf("open: %+v, %v", res, err)
+		}
+	}
+
+	closed := newTestFailover(t, FailClosed).Wrap(&downLimiter{})
+	if _, err := closed.Allow(ctx, "k", limit, 1); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("closed: err = %v, want ErrUnavailable", err)
+	}
+}
+
+// errLimiter fails every call with err
+type errLimiter struct{ err error }
+
+// replyError is an error reply from a running Redis
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+func (replyError) RedisError()     {}
+
+func (l *errLimiter) Allow(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return nil, l.err
+}
+
+func (l *errLimiter) Peek(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return nil, l.err
+}
+
+// TestFailover_RequestErrors checks that only errors reaching Redis mark it
+// down, not a request's own context ending or an error reply
+func TestFailover_RequestErrors(t *testing.T) {
+	limit := Limit{Requests: 10, Window: time.Minute}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		degraded bool
+	}{
+		{"client disconnected", cancelled, context.Canceled, false},
+		{"request deadline", context.Background(), context.DeadlineExceeded, false},
+		{"pool closed", context.Background(), redis.ErrClosed, true},
+		{"error reply", context.Background(), replyError("ERR Error running script"), false},
+		{"connection refused", context.Background(), errors.New("dial tcp: connection refused"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFailover(t, FailLocal)
+			_, err := f.Wrap(&errLimiter{err: tt.err}).Allow(tt.ctx, "k", limit, 1)
+			if f.Degraded() != tt.degraded {
+				t.Errorf("degraded = %v, want %v", f.Degraded(), tt.degraded)
+			}
+			if !tt.degraded && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFailover_ProbeMarksDown(t *testing.T) {
+	f := newTestFailover(t, FailLocal)
+	f.probe(context.Background())
+	if !f.Degraded() || f.Peers() != 1 {
+		t.Errorf("degraded = %v, peers = %d", f.Degraded(), f.Peers())
+	}
+}
+
+func TestParseFailurePolicy(t *testing.T) {
+	for _, s := range []string{"open", "closed", "local"} {
+		if p, err := ParseFailurePolicy(s); err != nil || string(p) != s {
+			t.Errorf("ParseFailurePolicy(%q) = %q, %v", s, p, err)
+		}
+	}
+	if _, err := ParseFailurePolicy("fail-open"); err == nil {
+		t.Error("ParseFailurePolicy(fail-open) succeeded")
+	}
+}
@@ -0,0 +1,83 @@
+// Package limiter implements the request limits configured by policy
+// bundles. Unlike the tenant tier limiter, limits are passed per call, so any
+// key (an API key, a client IP, a tenant and route) can be limited, with the
+// algorithm its bundle selects.
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Algorithm is a rate limiting algorithm
+type Algorithm string
+
+// Rate limiting algorithms
+const (
+	// FixedWindow counts requests in consecutive windows starting at a key's
+	// first request. Up to twice the limit can pass around a window boundary.
+	FixedWindow Algorithm = "fixed-window"
+
+	// SlidingWindowLog records each request and allows at most the limit in
+	// any window. Memory grows with the limit.
+	SlidingWindowLog Algorithm = "sliding-window-log"
+
+	// SlidingWindowCounter estimates the requests in the sliding window from
+	// the current and previous fixed window counts
+	SlidingWindowCounter Algorithm = "sliding-window-counter"
+
+	// GCRA (generic cell rate algorithm) allows a burst of the limit, then
+	// spaces requests evenly, like a token bucket refilled continuously
+	GCRA Algorithm = "gcra"
+)
+
+// DefaultAlgorithm is used for limits that do not name an algorithm
+const DefaultAlgorithm = SlidingWindowCounter
+
+// ParseAlgorithm parses a policy bundle's rateLimit.algorithm. The bundle
+// schema's sliding-window is the sliding window counter, and token-bucket
+// is GCRA, which behaves as a token bucket holding the limit.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch s {
+	case "", "sliding-window":
+		return DefaultAlgorithm, nil
+	case "token-bucket":
+		return GCRA, nil
+	case string(FixedWindow), string(SlidingWindowLog), string(SlidingWindowCounter), string(GCRA):
+		return Algorithm(s), nil
+	}
+	return "", fmt.Errorf("unknown rate limit algorithm %q", s)
+}
+
+// Limit allows Requests per Window
+type Limit struct {
+	Requests  int64
+	Window    time.Duration
+	Algorithm Algorithm // DefaultAlgorithm when empty
+}
+
+func (l Limit) algorithm() Algorithm {
+	if l.Algorithm == "" {
+		return DefaultAlgorithm
+	}
+	return l.Algorithm
+}
+
+// Result is the outcome of a limit check
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	ResetAt    time.Time     // When the full limit is available again
+	RetryAfter time.Duration // Until the request would be allowed; zero when allowed
+}
+
+// Limiter checks and records requests against a limit. Denied requests are
+// not counted.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit, n int64) (*Result, error)
+
+	// Peek returns what Allow would, without counting the requests
+	Peek(ctx context.Context, key string, limit Limit, n int64) (*Result, error)
+}
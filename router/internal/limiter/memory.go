@@ -0,0 +1,240 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired state is dropped
+const sweepInterval = time.Minute
+
+// MemoryLimiter is an in-process limiter, for single-instance deployments
+// and tests
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	states    map[string]*state
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// state is a key's limiter state; each algorithm uses some of the fields
+type state struct {
+	start time.Time   // Fixed window and sliding window counter: current window
+	count int64       // Requests in the current window
+	prev  int64       // Sliding window counter: requests in the previous window
+	hits  []time.Time // Sliding window log: times of requests in the window
+	tat   time.Time   // GCRA: theoretical arrival time
+
+	reset time.Time // When the state no longer limits anything
+}
+
+// NewMemoryLimiter creates an in-process limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{states: make(map[string]*state), now: time.Now}
+}
+
+// Allow counts n requests against key's limit
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.check(key, limit, n, false)
+}
+
+// Peek checks n requests against key's limit without counting them
+func (l *MemoryLimiter) Peek(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.check(key, limit, n, true)
+}
+
+// check runs the limit's algorithm, on a copy of the key's state for a peek
+func (l *MemoryLimiter) check(key string, limit Limit, n int64, peek bool) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	alg := limit.algorithm()
+	key = string(alg) + ":" + key
+	s, ok := l.states[key]
+	switch {
+	case peek && ok:
+		cp := *s
+		cp.hits = slices.Clone(s.hits)
+		s = &cp
+	case peek || !ok:
+		s = &state{}
+		if !peek {
+			l.states[key] = s
+		}
+	}
+
+	var result *Result
+	switch alg {
+	case FixedWindow:
+		result = s.fixedWindow(now, limit, n)
+	case SlidingWindowLog:
+		result = s.slidingWindowLog(now, limit, n)
+	case SlidingWindowCounter:
+		result = s.slidingWindowCounter(now, limit, n)
+	case GCRA:
+		result = s.gcra(now, limit, n)
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", alg)
+	}
+	s.reset = result.ResetAt
+	return result, nil
+}
+
+func (s *state) fixedWindow(now time.Time, limit Limit, n int64) *Result {
+	if s.start.IsZero() || !now.Before(s.start.Add(limit.Window)) {
+		s.start, s.count = now, 0
+	}
+	end := s.start.Add(limit.Window)
+
+	result := &Result{Limit: limit.Requests, ResetAt: end}
+	if s.count+n > limit.Requests {
+		result.Remaining = max(limit.Requests-s.count, 0)
+		result.RetryAfter = end.Sub(now)
+		return result
+	}
+
+	s.count += n
+	result.Allowed = true
+	result.Remaining = limit.Requests - s.count
+	return result
+}
+
+func (s *state) slidingWindowLog(now time.Time, limit Limit, n int64) *Result {
+	expired := 0
+	for expired < len(s.hits) && !now.Before(s.hits[expired].Add(limit.Window)) {
+		expired++
+	}
+	s.hits = s.hits[expired:]
+	count := int64(len(s.hits))
+
+	result := &Result{Limit: limit.Requests, ResetAt: now}
+	if count > 0 {
+		result.ResetAt = s.hits[count-1].Add(limit.Window)
+	}
+	if count+n > limit.Requests {
+		// Wait until enough of the oldest requests leave the window
+		result.Remaining = max(limit.Requests-count, 0)
+		result.RetryAfter = limit.Window
+		if i := count + n - limit.Requests - 1; i < count {
+			result.RetryAfter = s.hits[i].Add(limit.Window).Sub(now)
+		}
+		return result
+	}
+
+	for range n {
+		s.hits = append(s.hits, now)
+	}
+	result.Allowed = true
+	result.Remaining = limit.Requests - count - n
+	result.ResetAt = now.Add(limit.Window)
+	return result
+}
+
+func (s *state) slidingWindowCounter(now time.Time, limit Limit, n int64) *Result {
+	if s.start.IsZero() {
+		s.start = now
+	}
+	if elapsed := now.Sub(s.start); elapsed >= limit.Window {
+		periods := elapsed / limit.Window
+		if periods == 1 {
+			s.prev = s.count
+		} else {
+			s.prev = 0
+		}
+		s.count = 0
+		s.start = s.start.Add(periods * limit.Window)
+	}
+
+	elapsed := now.Sub(s.start)
+	window, requests := float64(limit.Window), float64(limit.Requests)
+	weighted := float64(s.prev) * float64(limit.Window-elapsed) / window
+
+	result := &Result{Limit: limit.Requests, ResetAt: s.start.Add(limit.Window)}
+	if weighted+float64(s.count+n) > requests {
+		result.Remaining = max(int64(math.Floor(requests-weighted-float64(s.count))), 0)
+
+		// Wait until the previous window's share has decayed enough, or for
+		// the next window if the current one alone is over the limit
+		var retryAt time.Time
+		switch {
+		case s.count+n <= limit.Requests:
+			share := (requests - float64(s.count+n)) / float64(s.prev)
+			retryAt = s.start.Add(time.Duration(math.Ceil(window * (1 - share))))
+		case n <= limit.Requests:
+			share := (requests - float64(n)) / float64(s.count)
+			retryAt = s.start.Add(limit.Window + time.Duration(math.Ceil(window*(1-share))))
+		default:
+			retryAt = now.Add(limit.Window)
+		}
+		result.RetryAfter = retryAt.Sub(now)
+		if s.count > 0 {
+			result.ResetAt = s.start.Add(2 * limit.Window)
+		}
+		return result
+	}
+
+	s.count += n
+	result.Allowed = true
+	result.Remaining = max(int64(math.Floor(requests-weighted-float64(s.count))), 0)
+	result.ResetAt = s.start.Add(2 * limit.Window)
+	return result
+}
+
+func (s *state) gcra(now time.Time, limit Limit, n int64) *Result {
+	interval := max(limit.Window/time.Duration(limit.Requests), 1)
+	tat := s.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	// Remaining is how many more intervals fit before the TAT is a full
+	// window ahead of now
+	remaining := func(tat time.Time) int64 {
+		return max(int64(now.Add(limit.Window).Sub(tat)/interval), 0)
+	}
+
+	newTAT := tat.Add(time.Duration(n) * interval)
+	if allowAt := newTAT.Add(-limit.Window); now.Before(allowAt) {
+		return &Result{
+			Limit:      limit.Requests,
+			Remaining:  remaining(tat),
+			ResetAt:    tat,
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+
+	s.tat = newTAT
+	return &Result{
+		Allowed:   true,
+		Limit:     limit.Requests,
+		Remaining: remaining(newTAT),
+		ResetAt:   newTAT,
+	}
+}
+
+// reset drops all state
+func (l *MemoryLimiter) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.states)
+}
+
+// sweep drops expired state at most once per sweepInterval
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, s := range l.states {
+		if !now.Before(s.reset) {
+			delete(l.states, key)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultKeyPrefix prefixes the Redis keys of RedisLimiter
+const DefaultKeyPrefix = "apx:rl:"
+
+// The scripts take ARGV now, limit, window, n and peek, with times in
+// microseconds. They are passed the router's clock rather than reading
+// Redis's, so they behave exactly like MemoryLimiter. Each returns
+// {allowed, remaining, µs until reset, µs until retry} and expires its key
+// once it no longer limits anything. With peek set to 1 the requests are
+// not counted.
+
+// fixedWindowScript keeps the window start and count in a hash
+var fixedWindowScript = redis.NewScript(`
+local now, limit, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+
+local state = redis.call("HMGET", KEYS[1], "start", "count")
+local start, count = tonumber(state[1]), tonumber(state[2]) or 0
+if not start or now >= start + window then
+	start, count = now, 0
+end
+local reset = start + window - now
+
+if count + n > limit then
+	return {0, math.max(limit - count, 0), reset, reset}
+end
+
+count = count + n
+if ARGV[5] ~= "1" then
+	redis.call("HSET", KEYS[1], "start", start, "count", count)
+	redis.call("PEXPIRE", KEYS[1], math.ceil(reset / 1000))
+end
+return {1, limit - count, reset, 0}
+`)
+
+// slidingWindowLogScript keeps the time of each request in a sorted set
+var slidingWindowLogScript = redis.NewScript(`
+local now, limit, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+
+if count + n > limit then
+	local retry = window
+	local i = count + n - limit - 1
+	if i < count then
+		retry = tonumber(redis.call("ZRANGE", KEYS[1], i, i, "WITHSCORES")[2]) + window - now
+	end
+	local reset = 0
+	if count > 0 then
+		reset = tonumber(redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")[2]) + window - now
+	end
+	return {0, math.max(limit - count, 0), reset, retry}
+end
+
+if ARGV[5] ~= "1" then
+	for i = 1, n do
+		redis.call("ZADD", KEYS[1], now, ARGV[1] .. ":" .. (count + i))
+	end
+	redis.call("PEXPIRE", KEYS[1], math.ceil(window / 1000))
+end
+return {1, limit - count - n, window, 0}
+`)
+
+// slidingWindowCounterScript keeps the current window start and the
+// current and previous window counts in a hash
+var slidingWindowCounterScript = redis.NewScript(`
+local now, limit, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+
+local state = redis.call("HMGET", KEYS[1], "start", "count", "prev")
+local start, count, prev = tonumber(state[1]) or now, tonumber(state[2]) or 0, tonumber(state[3]) or 0
+if now - start >= window then
+	local periods = math.floor((now - start) / window)
+	if periods == 1 then
+		prev = count
+	else
+		prev = 0
+	end
+	count = 0
+	start = start + periods * window
+end
+
+local elapsed = now - start
+local weighted = prev * (window - elapsed) / window
+
+if weighted + count + n > limit then
+	local retry
+	if count + n <= limit then
+		retry = start + math.ceil(window * (1 - (limit - count - n) / prev)) - now
+	elseif n <= limit then
+		retry = start + window + math.ceil(window * (1 - (limit - n) / count)) - now
+	else
+		retry = window
+	end
+	local reset = start + window - now
+	if count > 0 then
+		reset = reset + window
+	end
+	return {0, math.max(math.floor(limit - weighted - count), 0), reset, retry}
+end
+
+count = count + n
+local reset = start + 2 * window - now
+if ARGV[5] ~= "1" then
+	redis.call("HSET", KEYS[1], "start", start, "count", count, "prev", prev)
+	redis.call("PEXPIRE", KEYS[1], math.ceil(reset / 1000))
+end
+return {1, math.max(math.floor(limit - weighted - count), 0), reset, 0}
+`)
+
+// gcraScript keeps the theoretical arrival time
+var gcraScript = redis.NewScript(`
+local now, limit, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local interval = math.max(math.floor(window / limit), 1)
+
+local tat = math.max(tonumber(redis.call("GET", KEYS[1])) or now, now)
+local new_tat = tat + n * interval
+local allow_at = new_tat - window
+
+if now < allow_at then
+	return {0, math.max(math.floor((now + window - tat) / interval), 0), tat - now, allow_at - now}
+end
+
+if ARGV[5] ~= "1" then
+	redis.call("SET", KEYS[1], new_tat, "PX", math.max(math.ceil((new_tat - now) / 1000), 1))
+end
+return {1, math.max(math.floor((now + window - new_tat) / interval), 0), new_tat - now, 0}
+`)
+
+var scripts = map[Algorithm]*redis.Script{
+	FixedWindow:          fixedWindowScript,
+	SlidingWindowLog:     slidingWindowLogScript,
+	SlidingWindowCounter: slidingWindowCounterScript,
+	GCRA:                 gcraScript,
+}
+
+// RedisLimiter is a limiter shared by all routers through Redis. Each check
+// is a single Lua script, so concurrent requests can't overshoot a limit.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisLimiter creates a Redis-backed limiter. Keys are prefixed with
+// prefix, or DefaultKeyPrefix when empty.
+func NewRedisLimiter(client *redis.Client, prefix string) *RedisLimiter {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return &RedisLimiter{client: client, prefix: prefix, now: time.Now}
+}
+
+// Allow counts n requests against key's limit
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.check(ctx, key, limit, n, false)
+}
+
+// Peek checks n requests against key's limit without counting them
+func (l *RedisLimiter) Peek(ctx context.Context, key string, limit Limit, n int64) (*Result, error) {
+	return l.check(ctx, key, limit, n, true)
+}
+
+func (l *RedisLimiter) check(ctx context.Context, key string, limit Limit, n int64, peek bool) (*Result, error) {
+	alg := limit.algorithm()
+	script, ok := scripts[alg]
+	if !ok {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", alg)
+	}
+
+	now := l.now()
+	values, err := script.Run(ctx, l.client, []string{l.prefix + string(alg) + ":" + key},
+		strconv.FormatInt(now.UnixMicro(), 10), limit.Requests, limit.Window.Microseconds(), n, peek).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("rate limit check failed: %w", err)
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Requests,
+		Remaining:  values[1],
+		ResetAt:    now.Add(time.Duration(values[2]) * time.Microsecond),
+		RetryAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,72 @@
+//go:build integration
+
+package limiter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// TestRedisLimiter_Conformance runs against the Redis at REDIS_ADDR (DB 1)
+func TestRedisLimiter_Conformance(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD"), DB: 1})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available:", err)
+	}
+	defer func() {
+		keys, _ := client.Keys(ctx, "apx:rl:test:*").Result()
+		if len(keys) > 0 {
+			client.Del(ctx, keys...)
+		}
+	}()
+
+	testConformance(t, func(now func() time.Time) Limiter {
+		l := NewRedisLimiter(client, "apx:rl:test:")
+		l.now = now
+		return l
+	})
+}
+
+// TestFailover_Recovery runs against the Redis at REDIS_ADDR (DB 1)
+func TestFailover_Recovery(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD"), DB: 1})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available:", err)
+	}
+
+	f := NewFailover(client, FailLocal, zap.NewNop())
+	defer client.ZRem(ctx, peersKey, f.instanceID)
+
+	f.MarkDown(errors.New("connection reset"))
+	f.Local(ctx, "k", Limit{Requests: 10, Window: time.Minute}, 1)
+
+	// The probe sees Redis again: local counts are dropped and this router
+	// is counted among the peers
+	f.probe(ctx)
+	if f.Degraded() || f.Peers() < 1 || len(f.local.states) != 0 {
+		t.Errorf("degraded = %v, peers = %d, local states = %d", f.Degraded(), f.Peers(), len(f.local.states))
+	}
+	if score, err := client.ZScore(ctx, peersKey, f.instanceID).Result(); err != nil || score == 0 {
+		t.Errorf("heartbeat not recorded: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package lru provides the size-bounded, expiring in-process cache used in
+// front of slower lookups such as API key resolution and token
+// introspection.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache maps keys to values that expire at a given time. When it is full,
+// adding a key evicts the least recently used entry. The caller passes the
+// current time, so entries expire by the caller's clock. A Cache is safe for
+// concurrent use.
+type Cache[V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List               // Front is most recently used
+	items    map[string]*list.Element // key -> *entry
+	onRemove func(key string, value V)
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// New creates a cache holding up to capacity entries. onRemove, if not nil,
+// is called with the cache locked whenever an entry is evicted, expires or
+// is removed, e.g. to maintain a secondary index; it must not call the cache.
+func New[V any](capacity int, onRemove func(key string, value V)) *Cache[V] {
+	return &Cache[V]{
+		capacity: max(capacity, 1),
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		onRemove: onRemove,
+	}
+}
+
+// Get returns the value cached for key, unless it has expired by now
+func (c *Cache[V]) Get(key string, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*entry[V])
+	if !now.Before(e.expires) {
+		c.removeElement(el)
+		var zero V
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Add caches value for key until expires, evicting the least recently used
+// entry when the cache is full
+func (c *Cache[V]) Add(key string, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	if c.ll.Len() >= c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+	c.items[key] = c.ll.PushFront(&entry[V]{key: key, value: value, expires: expires})
+}
+
+// Remove drops key
+func (c *Cache[V]) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Clear drops every entry, without calling onRemove
+func (c *Cache[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len returns the number of entries, including expired ones not dropped yet
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache[V]) removeElement(el *list.Element) {
+	e := el.Value.(*entry[V])
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	if c.onRemove != nil {
+		c.onRemove(e.key, e.value)
+	}
+}
@@ -0,0 +1,40 @@
+package lru
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	var removed []string
+	c := New(2, func(key string, value int) {
+		removed = append(removed, key)
+	})
+
+	c.Add("a", 1, now.Add(time.Minute))
+	c.Add("b", 2, now.Add(time.Minute))
+	c.Get("a", now)
+	c.Add("c", 3, now.Add(2*time.Minute))
+
+	// b was least recently used
+	if _, ok := c.Get("b", now); ok {
+		t.Error("Get(b) hit after eviction")
+	}
+	if v, ok := c.Get("a", now); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v; want 1, true", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("a", now); ok {
+		t.Error("Get(a) hit after expiry")
+	}
+	c.Remove("c")
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", c.Len())
+	}
+	if want := []string{"b", "a", "c"}; !slices.Equal(removed, want) {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+}
@@ -61,3 +61,174 @@ var (
 		[]string{"tenant_tier", "allowed"},
 	)
 )
+
+var (
+	// CircuitBreakerState reports the state of each route's backend circuit
+	// breaker (1 for the current state, 0 for the others)
+	CircuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apx_circuit_breaker_state",
+			Help: "Circuit breaker state per route and backend (closed, open, half_open)",
+		},
+		[]string{"route", "backend", "state"},
+	)
+
+	// CircuitBreakerTrips tracks how often each route's backend circuit breaker opened
+	CircuitBreakerTrips = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_circuit_breaker_trips_total",
+			Help: "Total number of times a backend circuit breaker opened",
+		},
+		[]string{"route", "backend"},
+	)
+
+	// CircuitBreakerRejections tracks requests rejected by an open circuit breaker
+	CircuitBreakerRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_circuit_breaker_rejections_total",
+			Help: "Total number of requests rejected by an open circuit breaker",
+		},
+		[]string{"route", "backend"},
+	)
+)
+
+var (
+	// BackendEndpointHealthy reports the active health check result of each
+	// backend pool endpoint (1 healthy, 0 unhealthy)
+	BackendEndpointHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "apx_backend_endpoint_healthy",
+			Help: "Active health check state of backend pool endpoints",
+		},
+		[]string{"pool", "endpoint"},
+	)
+
+	// BackendEndpointEjections tracks passive ejections of failing pool endpoints
+	BackendEndpointEjections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_backend_endpoint_ejections_total",
+			Help: "Total number of times a backend pool endpoint was ejected after consecutive failures",
+		},
+		[]string{"pool", "endpoint"},
+	)
+
+	// GRPCRequests tracks proxied gRPC and gRPC-Web calls by route and gRPC
+	// status
+	GRPCRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_grpc_requests_total",
+			Help: "Total number of proxied gRPC calls",
+		},
+		[]string{"route", "code", "tenant_tier"},
+	)
+
+	// UpgradeSessions tracks proxied connection upgrades (e.g. WebSocket) by
+	// backend handshake status
+	UpgradeSessions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_upgrade_sessions_total",
+			Help: "Total number of proxied connection upgrade requests",
+		},
+		[]string{"protocol", "status"},
+	)
+
+	// UpgradeBytes tracks bytes relayed over upgraded connections
+	UpgradeBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_upgrade_bytes_total",
+			Help: "Total bytes relayed over upgraded connections",
+		},
+		[]string{"protocol", "direction"},
+	)
+
+	// UpgradeSessionDuration tracks how long upgraded connections stay open
+	UpgradeSessionDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "apx_upgrade_session_duration_seconds",
+			Help:    "Duration of upgraded connections in seconds",
+			Buckets: []float64{1, 5, 15, 60, 300, 900, 3600, 14400},
+		},
+		[]string{"protocol"},
+	)
+
+	// RouteGeneration is the generation of the route table serving requests
+	RouteGeneration = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "apx_route_generation",
+			Help: "Generation of the live route table",
+		},
+	)
+
+	// RouteGenerationRoutes is the number of routes in the live generation
+	RouteGenerationRoutes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "apx_route_generation_routes",
+			Help: "Number of routes in the live route table",
+		},
+	)
+
+	// RouteSwaps tracks route table swaps
+	RouteSwaps = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "apx_route_swaps_total",
+			Help: "Total number of route table swaps",
+		},
+	)
+
+	// RouteGenerationsDraining is the number of replaced route tables still
+	// serving in-flight requests
+	RouteGenerationsDraining = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "apx_route_generations_draining",
+			Help: "Number of replaced route table generations with requests in flight",
+		},
+	)
+
+	// RouteDrainDuration tracks how long replaced route tables take to drain
+	RouteDrainDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "apx_route_drain_duration_seconds",
+			Help:    "Time from a route table swap until the replaced generation drained",
+			Buckets: []float64{.01, .1, 1, 5, 15, 30, 60, 300, 900, 3600},
+		},
+	)
+
+	// ConfigReloads tracks reloads of local routes and policy files
+	ConfigReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_config_reloads_total",
+			Help: "Total number of local configuration reloads by source and result",
+		},
+		[]string{"source", "result"},
+	)
+)
+
+var (
+	// RateLimitDegraded is 1 while Redis is unavailable and rate limits are
+	// enforced by the failure policy
+	RateLimitDegraded = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "apx_ratelimit_degraded",
+			Help: "Whether rate limiting is degraded because Redis is unavailable (1) or not (0)",
+		},
+	)
+
+	// RateLimitDegradedDecisions tracks rate limit decisions made by the
+	// failure policy while degraded
+	RateLimitDegradedDecisions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "apx_ratelimit_degraded_decisions_total",
+			Help: "Total number of rate limit checks decided by the failure policy while Redis is unavailable",
+		},
+		[]string{"policy", "allowed"},
+	)
+
+	// RateLimitPeers is the number of routers sharing the rate limits, as
+	// last seen in Redis
+	RateLimitPeers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "apx_ratelimit_peers",
+			Help: "Number of routers sharing rate limits, used to size local limits while degraded",
+		},
+	)
+)
@@ -1,6 +1,9 @@
 package middleware
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 // Middleware is a function that wraps an http.Handler
 type Middleware func(http.Handler) http.Handler
@@ -14,3 +17,13 @@ func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
 	}
 	return handler
 }
+
+// firstPass marks the request under key and reports whether it was not
+// marked yet. Requests for async routes pass through the middleware chain a
+// second time, and limits, quotas and usage must only be charged once.
+func firstPass(r *http.Request, key contextKey) (*http.Request, bool) {
+	if r.Context().Value(key) != nil {
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), key, true)), true
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For is
+// only believed when the request came from a trusted proxy: the client is
+// the right-most forwarded address that is not itself a trusted proxy, so
+// addresses a client prepends to the header are ignored.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	remote := remoteAddr(r)
+	if !remote.IsValid() || !isTrusted(remote, trustedProxies) {
+		return remote
+	}
+
+	forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	hops := strings.Split(forwarded, ",")
+	for _, hop := range slices.Backward(hops) {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hop))
+		if err != nil {
+			// A malformed entry: the addresses to its left can't be trusted
+			break
+		}
+		addr = addr.Unmap()
+		if !isTrusted(addr, trustedProxies) {
+			return addr
+		}
+		remote = addr
+	}
+	return remote
+}
+
+// remoteAddr parses the request's peer address
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	return slices.ContainsFunc(trustedProxies, func(p netip.Prefix) bool {
+		return p.Contains(addr)
+	})
+}
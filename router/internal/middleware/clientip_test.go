@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer's header ignored", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left-most entry", "10.0.0.1:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:5000", []string{"198.51.100.1, 10.0.0.3", "10.0.0.2"}, "198.51.100.1"},
+		{"malformed entry", "10.0.0.1:5000", []string{"198.51.100.1, junk, 10.0.0.2"}, "10.0.0.2"},
+		{"only proxies", "10.0.0.1:5000", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"no header from proxy", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"IPv6", "[2001:db8::1]:5000", []string{"2001:db8:ffff::1, 2001:db9::7"}, "2001:db9::7"},
+		{"IPv4-mapped", "[::ffff:10.0.0.1]:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(req, trusted).String(); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
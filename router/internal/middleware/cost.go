@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// requestCostKey holds the *requestCost of a request
+const requestCostKey contextKey = "apx.request_cost"
+
+// CostModel prices a route's requests in rate limit and quota units, for
+// routes such as batch or LLM endpoints that cost more than one request
+type CostModel struct {
+	Weight         int64  // Units per request (default 1)
+	BodyBytes      int64  // Adds a unit per BodyBytes of request body; 0 disables
+	ResponseHeader string // Response header the backend reports the actual cost in
+}
+
+// CostModelFunc returns the cost model of the route serving r, or nil if
+// its requests cost 1
+type CostModelFunc func(r *http.Request) *CostModel
+
+// requestCost is shared by the middleware through the request context
+type requestCost struct {
+	estimated int64
+	reported  int64
+	hasReport bool
+}
+
+// Cost prices requests with their route's cost model. Rate limits and the
+// quota check charge the estimate, from the weight and body size, before
+// the request is forwarded. When the backend reports the actual cost in
+// the model's response header, the quota and usage are charged that
+// instead; the header is not passed on to the client.
+func Cost(models CostModelFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Priced on the first pass through the chain
+			if _, ok := r.Context().Value(requestCostKey).(*requestCost); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var model *CostModel
+			if models != nil {
+				model = models(r)
+			}
+			if model == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cost := &requestCost{estimated: max(model.Weight, 1)}
+			if model.BodyBytes > 0 && r.ContentLength > 0 {
+				cost.estimated += (r.ContentLength + model.BodyBytes - 1) / model.BodyBytes
+			}
+			r = r.WithContext(context.WithValue(r.Context(), requestCostKey, cost))
+
+			if model.ResponseHeader != "" {
+				w = &costWriter{ResponseWriter: w, header: model.ResponseHeader, cost: cost}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetRequestCost returns the estimated cost of the request, charged by rate
+// limits before it is forwarded: 1 on routes without a cost model
+func GetRequestCost(ctx context.Context) int64 {
+	if cost, ok := ctx.Value(requestCostKey).(*requestCost); ok {
+		return cost.estimated
+	}
+	return 1
+}
+
+// GetChargedCost returns the cost charged to quotas and usage once the
+// response has been written: the cost reported by the backend if it
+// reported one, otherwise the estimate
+func GetChargedCost(ctx context.Context) int64 {
+	cost, ok := ctx.Value(requestCostKey).(*requestCost)
+	if !ok {
+		return 1
+	}
+	if cost.hasReport {
+		return cost.reported
+	}
+	return cost.estimated
+}
+
+// costWriter reads and removes the backend's cost header
+type costWriter struct {
+	http.ResponseWriter
+	header      string
+	cost        *requestCost
+	wroteHeader bool
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *costWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// PrepareHeader reads and removes the cost header once the final response
+// starts; see proxy.HeaderPreparer
+func (cw *costWriter) PrepareHeader(code int) {
+	// Informational responses (e.g. 103 Early Hints) precede the final one
+	if !cw.wroteHeader && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		cw.wroteHeader = true
+		h := cw.Header()
+		if v := h.Get(cw.header); v != "" {
+			if reported, err := strconv.ParseInt(v, 10, 64); err == nil && reported >= 0 {
+				cw.cost.reported, cw.cost.hasReport = reported, true
+			}
+			h.Del(cw.header)
+		}
+	}
+}
+
+func (cw *costWriter) WriteHeader(code int) {
+	cw.PrepareHeader(code)
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *costWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCost_Estimate tests the estimated cost from the weight and body size
+func TestCost_Estimate(t *testing.T) {
+	tests := []struct {
+		name  string
+		model *CostModel
+		body  string
+		want  int64
+	}{
+		{"no model", nil, "", 1},
+		{"default weight", &CostModel{}, "", 1},
+		{"weight", &CostModel{Weight: 5}, "", 5},
+		{"body below unit", &CostModel{BodyBytes: 10}, "abc", 2},
+		{"body rounds up", &CostModel{Weight: 2, BodyBytes: 10}, strings.Repeat("x", 21), 5},
+		{"body ignored", &CostModel{Weight: 3}, strings.Repeat("x", 100), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var estimated, charged int64
+			handler := Cost(func(r *http.Request) *CostModel {
+				return tt.model
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				estimated = GetRequestCost(r.Context())
+				w.WriteHeader(http.StatusOK)
+				charged = GetChargedCost(r.Context())
+			}))
+
+			req := httptest.NewRequest("POST", "/v1/batch", strings.NewReader(tt.body))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.want, estimated)
+			assert.Equal(t, tt.want, charged)
+		})
+	}
+}
+
+// TestCost_ReportedCost tests that the backend's reported cost is charged
+// and stripped from the response
+func TestCost_ReportedCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		reported string
+		want     int64
+	}{
+		{"reported", "42", 42},
+		{"reported zero", "0", 0},
+		{"not reported", "", 3},
+		{"invalid", "lots", 3},
+		{"negative", "-1", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var charged int64
+			model := &CostModel{Weight: 3, ResponseHeader: "X-Backend-Cost"}
+			handler := Cost(func(r *http.Request) *CostModel {
+				return model
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.reported != "" {
+					w.Header().Set("X-Backend-Cost", tt.reported)
+				}
+				w.Write([]byte("ok"))
+				charged = GetChargedCost(r.Context())
+			}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/completions", nil))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.want, charged)
+			assert.Empty(t, rr.Header().Get("X-Backend-Cost"))
+		})
+	}
+}
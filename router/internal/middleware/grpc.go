@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/stratus-meridian/apx/router/pkg/proxy"
+	"google.golang.org/grpc/codes"
+)
+
+// grpcCallKey holds the *GRPCCall of a gRPC or gRPC-Web request
+const grpcCallKey contextKey = "apx.grpc_call"
+
+// GRPCCall is filled in by the handler that proxies a gRPC call. gRPC calls
+// are answered with HTTP 200 whatever their outcome, so metrics, logs and
+// usage events are labeled from the call's gRPC status instead.
+type GRPCCall struct {
+	Service string     // Fully qualified service name, e.g. orders.v1.Orders
+	Method  string     // Method name, e.g. GetOrder
+	Route   string     // Path pattern of the route that proxied the call
+	Code    codes.Code // gRPC status; only meaningful once Done is set
+	Message string     // gRPC status message
+	Done    bool       // Set by the handler once the call's status is known
+}
+
+// HTTPStatus returns the HTTP status used to label the call
+func (c *GRPCCall) HTTPStatus() int {
+	return proxy.HTTPStatusFromGRPCCode(c.Code)
+}
+
+// GetGRPCCall returns the gRPC call tracked for the request, or nil if the
+// request is not a gRPC call
+func GetGRPCCall(ctx context.Context) *GRPCCall {
+	call, _ := ctx.Value(grpcCallKey).(*GRPCCall)
+	return call
+}
+
+// trackGRPCCall returns the call tracked for a gRPC request, adding one to
+// the request context if no outer middleware has done so yet
+func trackGRPCCall(r *http.Request) (*GRPCCall, *http.Request) {
+	if call := GetGRPCCall(r.Context()); call != nil {
+		return call, r
+	}
+	if !proxy.IsGRPCRequest(r) && !proxy.IsGRPCWebRequest(r) {
+		return nil, r
+	}
+
+	// gRPC paths are /package.Service/Method, possibly behind a route prefix
+	call := &GRPCCall{}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) >= 2 {
+		call.Service, call.Method = parts[len(parts)-2], parts[len(parts)-1]
+	}
+	return call, r.WithContext(context.WithValue(r.Context(), grpcCallKey, call))
+}
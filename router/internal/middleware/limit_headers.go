@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/stratus-meridian/apx-private/control/pkg/ratelimit"
+)
+
+// limitHeadersKey holds the *limitHeaders of a request
+const limitHeadersKey contextKey = "apx.limit_headers"
+
+// LimitHeaderFormat selects the rate limit and quota headers sent to clients
+type LimitHeaderFormat string
+
+// Limit header formats
+const (
+	LimitHeadersLegacy LimitHeaderFormat = "x-ratelimit" // X-RateLimit-* and X-Quota-*
+	LimitHeadersIETF   LimitHeaderFormat = "ietf"        // RateLimit and RateLimit-Policy
+	LimitHeadersBoth   LimitHeaderFormat = "both"
+)
+
+// quotaWindow is the window reported for monthly quotas
+const quotaWindow = 30 * 24 * time.Hour
+
+// LimitHeaderFormatFunc returns the header format of the product serving r
+type LimitHeaderFormatFunc func(r *http.Request) LimitHeaderFormat
+
+// limitHeaders collects the limits checked for a request. The headers are
+// written from it when the response starts, so the rate limit and quota
+// middlewares send one consistent set in the product's format.
+type limitHeaders struct {
+	format   LimitHeaderFormat
+	policies []RateLimitPolicy // In check order
+	rate     *RateLimitHeaders // Reported by X-RateLimit-*
+	quota    *ratelimit.QuotaStatus
+}
+
+// LimitHeaders writes the rate limit and quota headers of each request in
+// the format of its product. It must run before the quota and rate limit
+// middlewares, which record their limits for it; without it they write
+// the X-RateLimit-* and X-Quota-* headers themselves.
+func LimitHeaders(formats LimitHeaderFormatFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Collected on the first pass through the chain
+			if getLimitHeaders(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			lh := &limitHeaders{format: LimitHeadersLegacy}
+			if formats != nil {
+				if format := formats(r); format != "" {
+					lh.format = format
+				}
+			}
+			r = r.WithContext(context.WithValue(r.Context(), limitHeadersKey, lh))
+			next.ServeHTTP(&limitHeaderWriter{ResponseWriter: w, headers: lh}, r)
+		})
+	}
+}
+
+// getLimitHeaders returns the request's header collector, if LimitHeaders
+// installed one
+func getLimitHeaders(ctx context.Context) *limitHeaders {
+	lh, _ := ctx.Value(limitHeadersKey).(*limitHeaders)
+	return lh
+}
+
+// addPolicy records a limit checked for the request
+func (lh *limitHeaders) addPolicy(p RateLimitPolicy) {
+	lh.policies = append(lh.policies, p)
+}
+
+// setQuota records the tenant's quota. Unlimited quotas have no IETF policy.
+func (lh *limitHeaders) setQuota(status *ratelimit.QuotaStatus) {
+	lh.quota = status
+	if status.Limit < 0 {
+		return
+	}
+	p := RateLimitPolicy{Name: "quota", Quota: status.Limit, Window: quotaWindow, Remaining: status.Remaining}
+	if !status.ResetAt.IsZero() {
+		p.Reset = time.Until(status.ResetAt)
+	}
+	lh.addPolicy(p)
+}
+
+// write sets the collected limits on the response headers
+func (lh *limitHeaders) write(h http.Header) {
+	if lh.format != LimitHeadersIETF {
+		if lh.rate != nil {
+			h.Set("X-RateLimit-Limit", strconv.FormatInt(lh.rate.Limit, 10))
+			h.Set("X-RateLimit-Remaining", strconv.FormatInt(lh.rate.Remaining, 10))
+			h.Set("X-RateLimit-Reset", strconv.FormatInt(lh.rate.Reset, 10))
+		}
+		if lh.quota != nil {
+			setQuotaHeaders(h, lh.quota)
+		}
+	}
+	if lh.format != LimitHeadersLegacy && len(lh.policies) > 0 {
+		h.Set("RateLimit-Policy", FormatRateLimitPolicy(lh.policies))
+		h.Set("RateLimit", FormatRateLimit(lh.policies))
+	}
+}
+
+// limitHeaderWriter writes the collected headers with the final response
+type limitHeaderWriter struct {
+	http.ResponseWriter
+	headers     *limitHeaders
+	wroteHeader bool
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (lw *limitHeaderWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// PrepareHeader writes the collected headers once the final response
+// starts; see proxy.HeaderPreparer
+func (lw *limitHeaderWriter) PrepareHeader(code int) {
+	// Informational responses (e.g. 103 Early Hints) precede the final one
+	if !lw.wroteHeader && (code >= http.StatusOK || code == http.StatusSwitchingProtocols) {
+		lw.wroteHeader = true
+		lw.headers.write(lw.Header())
+	}
+}
+
+func (lw *limitHeaderWriter) WriteHeader(code int) {
+	lw.PrepareHeader(code)
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *limitHeaderWriter) Write(b []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	return lw.ResponseWriter.Write(b)
+}
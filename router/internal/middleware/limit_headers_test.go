@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx-private/control/pkg/ratelimit"
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/limiter"
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	"github.com/stratus-meridian/apx/router/pkg/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// limitHeadersHandler chains LimitHeaders, a stand-in for the quota
+// middleware and the rate limit middleware with a per-key limit of 2
+func limitHeadersHandler(t *testing.T, format LimitHeaderFormat) http.Handler {
+	t.Helper()
+	bundle := &policy.PolicyBundle{Quotas: map[string]interface{}{
+		"perKey": map[string]interface{}{"window": "10s", "limit": 2},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	quota := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			getLimitHeaders(r.Context()).setQuota(&ratelimit.QuotaStatus{
+				Limit:     10000,
+				Used:      1000,
+				Remaining: 9000,
+				ResetAt:   time.Now().Add(24 * time.Hour),
+			})
+			next.ServeHTTP(w, r)
+		})
+	}
+	rateLimit := RateLimitWithOptions(&mockLimiter{}, RateLimitOptions{
+		Limiter: limiter.NewMemoryLimiter(),
+		Limits: func(r *http.Request) *RouteRateLimits {
+			return &RouteRateLimits{Rules: rules}
+		},
+	}, zap.NewNop())
+
+	return Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), LimitHeaders(func(r *http.Request) LimitHeaderFormat {
+		return format
+	}), quota, rateLimit)
+}
+
+func sendLimitHeadersRequest(handler http.Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/v1/orders", nil)
+	ctx := context.WithValue(req.Context(), TenantContextKey, createTestTenantForRateLimit(tenant.TierPro))
+	ctx = context.WithValue(ctx, CredentialIDKey, "key:ci")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+	return rr
+}
+
+// TestLimitHeaders_Legacy tests that the default format keeps the
+// X-RateLimit-* and X-Quota-* headers
+func TestLimitHeaders_Legacy(t *testing.T) {
+	rr := sendLimitHeadersRequest(limitHeadersHandler(t, ""))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "9000", rr.Header().Get("X-Quota-Remaining"))
+	assert.Empty(t, rr.Header().Get("RateLimit"))
+	assert.Empty(t, rr.Header().Get("RateLimit-Policy"))
+}
+
+// TestLimitHeaders_IETF tests that the quota and all checked rate limits are
+// merged into one set of IETF headers
+func TestLimitHeaders_IETF(t *testing.T) {
+	rr := sendLimitHeadersRequest(limitHeadersHandler(t, LimitHeadersIETF))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("X-RateLimit-Limit"))
+	assert.Empty(t, rr.Header().Get("X-Quota-Limit"))
+
+	policies, err := ParseIETFRateLimitHeaders(rr.Header())
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	assert.Equal(t, "quota", policies[0].Name)
+	assert.Equal(t, int64(10000), policies[0].Quota)
+	assert.Equal(t, int64(9000), policies[0].Remaining)
+	assert.Equal(t, "key", policies[1].Name)
+	assert.Equal(t, int64(2), policies[1].Quota)
+	assert.Equal(t, 10*time.Second, policies[1].Window)
+	assert.Equal(t, int64(1), policies[1].Remaining)
+	assert.Equal(t, "tier", policies[2].Name)
+	assert.Equal(t, int64(100), policies[2].Quota)
+	assert.Equal(t, time.Minute, policies[2].Window)
+	assert.Equal(t, int64(99), policies[2].Remaining)
+}
+
+// TestLimitHeaders_Both tests that both header sets can be sent, including
+// on 429 responses
+func TestLimitHeaders_Both(t *testing.T) {
+	handler := limitHeadersHandler(t, LimitHeadersBoth)
+	sendLimitHeadersRequest(handler)
+	sendLimitHeadersRequest(handler)
+	rr := sendLimitHeadersRequest(handler)
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "9000", rr.Header().Get("X-Quota-Remaining"))
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	policies, err := ParseIETFRateLimitHeaders(rr.Header())
+	require.NoError(t, err)
+	require.Len(t, policies, 2) // The tier limit isn't checked once a key is denied
+	assert.Equal(t, "key", policies[1].Name)
+	assert.Equal(t, int64(0), policies[1].Remaining)
+}
+
+// TestLimitHeaders_Upgrade tests that the 101 of a proxied connection
+// upgrade, written on the hijacked connection, carries the limit headers
+// and not the backend's cost header
+func TestLimitHeaders_Upgrade(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("backend hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\nX-Backend-Cost: 7\r\n\r\n")
+		brw.Flush()
+	}))
+	defer backend.Close()
+
+	charged := make(chan int64, 1)
+	client := proxy.NewClient(nil, zap.NewNop())
+	quota := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			getLimitHeaders(r.Context()).setQuota(&ratelimit.QuotaStatus{Limit: 10000, Remaining: 9000})
+			next.ServeHTTP(w, r)
+		})
+	}
+	front := httptest.NewServer(Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := client.ProxyUpgrade(r.Context(), w, r, backend.URL, "", time.Second); err != nil {
+			t.Errorf("ProxyUpgrade() error: %v", err)
+		}
+		charged <- GetChargedCost(r.Context())
+	}), LimitHeaders(func(r *http.Request) LimitHeaderFormat {
+		return LimitHeadersBoth
+	}), Cost(func(r *http.Request) *CostModel {
+		return &CostModel{ResponseHeader: "X-Backend-Cost"}
+	}), quota))
+	defer front.Close()
+
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/socket", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	require.NoError(t, req.Write(conn))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "9000", resp.Header.Get("X-Quota-Remaining"))
+	assert.Equal(t, `"quota";q=10000;w=2592000`, resp.Header.Get("RateLimit-Policy"))
+	assert.Empty(t, resp.Header.Get("X-Backend-Cost"))
+	assert.Equal(t, int64(7), <-charged)
+}
@@ -12,6 +12,7 @@ func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			call, r := trackGRPCCall(r)
 
 			// Extract headers from context (added by previous middleware)
 			requestID := GetRequestID(r.Context())
@@ -24,7 +25,7 @@ func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 
 			// Log request with all propagated headers
-			logger.Info("http request",
+			fields := []zap.Field{
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.Duration("duration", time.Since(start)),
@@ -33,7 +34,16 @@ func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 				zap.String("tenant_tier", tenantTier),
 				zap.String("policy_version", policyVersion),
 				zap.String("region", region),
-			)
+			}
+			if call != nil && call.Done {
+				fields = append(fields,
+					zap.String("grpc_service", call.Service),
+					zap.String("grpc_method", call.Method),
+					zap.String("grpc_status", call.Code.String()),
+					zap.String("grpc_message", call.Message),
+				)
+			}
+			logger.Info("http request", fields...)
 		})
 	}
 }
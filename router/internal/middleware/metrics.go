@@ -13,6 +13,7 @@ func Metrics() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			call, r := trackGRPCCall(r)
 
 			// Wrap response writer to capture status code
 			wrapped := &metricsResponseWriter{
@@ -32,11 +33,23 @@ func Metrics() func(http.Handler) http.Handler {
 				tenantTier = "unknown"
 			}
 
+			// gRPC calls are labeled with their gRPC status. Clients choose
+			// the service and method, so calls are counted by route.
+			statusCode := wrapped.statusCode
+			if call != nil && call.Done {
+				statusCode = call.HTTPStatus()
+				metrics.GRPCRequests.WithLabelValues(
+					call.Route,
+					call.Code.String(),
+					tenantTier,
+				).Inc()
+			}
+
 			// Record metrics
 			metrics.RequestsTotal.WithLabelValues(
 				r.Method,
 				r.URL.Path,
-				strconv.Itoa(wrapped.statusCode),
+				strconv.Itoa(statusCode),
 				tenantTier,
 			).Inc()
 
@@ -55,6 +68,12 @@ type metricsResponseWriter struct {
 	statusCode int
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController, so
+// handlers behind this middleware can flush and hijack the connection
+func (rw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *metricsResponseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
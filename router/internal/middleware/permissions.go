@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"github.com/stratus-meridian/apx/router/pkg/proxy"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// RequiredScopesFunc returns the scopes a credential must hold to call the
+// route serving r, or nil if the route requires none
+type RequiredScopesFunc func(r *http.Request) []string
+
+// ForbiddenResponse is the body of a 403 returned by Permissions
+type ForbiddenResponse struct {
+	Error          string   `json:"error"`
+	Message        string   `json:"message"`
+	RequiredScopes []string `json:"required_scopes,omitempty"`
+	MissingScopes  []string `json:"missing_scopes,omitempty"`
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+	AllowedRoutes  []string `json:"allowed_routes,omitempty"`
+}
+
+// Permissions enforces API key method and route allowlists and the scopes
+// required by the route. It runs after TenantContextWithAuth: scopes come
+// from the API key or the JWT/OAuth2 token the request was authenticated
+// with. Denied requests get a 403 naming what is missing.
+func Permissions(requiredScopes RequiredScopesFunc, logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if perms, ok := GetPermissions(ctx); ok {
+				if !perms.AllowsMethod(r.Method) {
+					writeForbidden(w, r, logger, ForbiddenResponse{
+						Message:        "API key does not allow " + r.Method + " requests",
+						AllowedMethods: perms.Methods,
+					})
+					return
+				}
+				if !perms.AllowsPath(r.URL.Path) {
+					writeForbidden(w, r, logger, ForbiddenResponse{
+						Message:       "API key does not allow this route",
+						AllowedRoutes: perms.Routes,
+					})
+					return
+				}
+			}
+
+			var required []string
+			if requiredScopes != nil {
+				required = requiredScopes(r)
+			}
+			if missing := pkgauth.MissingScopes(GetScopes(ctx), required); len(missing) > 0 {
+				writeForbidden(w, r, logger, ForbiddenResponse{
+					Message:        "Missing required scope: " + strings.Join(missing, ", "),
+					RequiredScopes: required,
+					MissingScopes:  missing,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeForbidden rejects a request the credential is not permitted to make.
+// gRPC clients get a PERMISSION_DENIED status instead of the JSON error.
+func writeForbidden(w http.ResponseWriter, r *http.Request, logger *zap.Logger, resp ForbiddenResponse) {
+	logger.Warn("request not permitted",
+		zap.String("tenant_id", GetTenantID(r.Context())),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("reason", resp.Message))
+
+	if proxy.IsGRPCRequest(r) || proxy.IsGRPCWebRequest(r) {
+		proxy.WriteGRPCError(w, r, codes.PermissionDenied, resp.Message)
+		return
+	}
+
+	resp.Error = "forbidden"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -12,11 +12,17 @@ import (
 )
 
 // QuotaMiddleware enforces monthly quotas per tenant and surfaces HTTP 402 responses.
+// Requests are charged their cost (see Cost): a request is refused when its
+// estimated cost exceeds the remaining quota, and is charged the cost the
+// backend reports, if any, once it has been served.
 type QuotaMiddleware struct {
 	enforcer *ratelimit.QuotaEnforcer
 	logger   *zap.Logger
 }
 
+// quotaCheckedKey marks requests whose quota was already checked
+const quotaCheckedKey contextKey = "apx.quota_checked"
+
 // NewQuotaMiddleware constructs the quota enforcement middleware.
 func NewQuotaMiddleware(enforcer *ratelimit.QuotaEnforcer, logger *zap.Logger) *QuotaMiddleware {
 	if logger == nil {
@@ -32,7 +38,8 @@ func NewQuotaMiddleware(enforcer *ratelimit.QuotaEnforcer, logger *zap.Logger) *
 func (m *QuotaMiddleware) Handler() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if m.enforcer == nil {
+			r, first := firstPass(r, quotaCheckedKey)
+			if m.enforcer == nil || !first {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -53,6 +60,24 @@ func (m *QuotaMiddleware) Handler() Middleware {
 				return
 			}
 
+			// Expensive requests need enough quota left for their cost
+			if allowed && status != nil && status.Limit >= 0 && status.Remaining < GetRequestCost(r.Context()) {
+				allowed = false
+			}
+
+			// With LimitHeaders the quota headers go out with the response,
+			// showing the quota left once the request's estimate is charged
+			lh := getLimitHeaders(r.Context())
+			if lh != nil && status != nil {
+				reported := *status
+				if allowed && reported.Limit >= 0 {
+					cost := GetRequestCost(r.Context())
+					reported.Used += cost
+					reported.Remaining = max(reported.Remaining-cost, 0)
+				}
+				lh.setQuota(&reported)
+			}
+
 			if !allowed {
 				m.sendPaymentRequired(w, tenantCtx, status)
 				return
@@ -60,7 +85,7 @@ func (m *QuotaMiddleware) Handler() Middleware {
 
 			next.ServeHTTP(w, r)
 
-			if updatedStatus, err := m.enforcer.IncrementQuota(r.Context(), tenantCtx.ResourceID, tier, 1); err != nil {
+			if updatedStatus, err := m.enforcer.IncrementQuota(r.Context(), tenantCtx.ResourceID, tier, GetChargedCost(r.Context())); err != nil {
 				m.logger.Warn("failed to increment quota",
 					zap.Error(err),
 					zap.String("tenant_id", tenantCtx.ResourceID))
@@ -68,7 +93,9 @@ func (m *QuotaMiddleware) Handler() Middleware {
 				status = updatedStatus
 			}
 
-			m.writeQuotaHeaders(w, status)
+			if lh == nil {
+				m.writeQuotaHeaders(w, status)
+			}
 		})
 	}
 }
@@ -92,17 +119,21 @@ func (m *QuotaMiddleware) writeQuotaHeaders(w http.ResponseWriter, status *ratel
 	if status == nil {
 		return
 	}
+	setQuotaHeaders(w.Header(), status)
+}
 
+// setQuotaHeaders sets the X-Quota-* headers of a quota status
+func setQuotaHeaders(h http.Header, status *ratelimit.QuotaStatus) {
 	if status.Limit >= 0 {
-		w.Header().Set("X-Quota-Limit", strconv.FormatInt(status.Limit, 10))
-		w.Header().Set("X-Quota-Remaining", strconv.FormatInt(status.Remaining, 10))
+		h.Set("X-Quota-Limit", strconv.FormatInt(status.Limit, 10))
+		h.Set("X-Quota-Remaining", strconv.FormatInt(status.Remaining, 10))
 	} else {
-		w.Header().Set("X-Quota-Limit", "unlimited")
-		w.Header().Set("X-Quota-Remaining", "unlimited")
+		h.Set("X-Quota-Limit", "unlimited")
+		h.Set("X-Quota-Remaining", "unlimited")
 	}
 
-	w.Header().Set("X-Quota-Used", strconv.FormatInt(status.Used, 10))
+	h.Set("X-Quota-Used", strconv.FormatInt(status.Used, 10))
 	if !status.ResetAt.IsZero() {
-		w.Header().Set("X-Quota-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
+		h.Set("X-Quota-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
 	}
 }
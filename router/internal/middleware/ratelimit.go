@@ -1,12 +1,19 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/stratus-meridian/apx-private/control/pkg/ratelimit"
+	"github.com/stratus-meridian/apx/router/internal/limiter"
+	"github.com/stratus-meridian/apx/router/internal/policy"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -25,18 +32,62 @@ import (
 //  6. Logs rate limit events for monitoring
 //
 // Headers added to all responses:
-//   X-RateLimit-Limit: Maximum requests per minute
-//   X-RateLimit-Remaining: Tokens remaining in bucket
-//   X-RateLimit-Reset: Unix timestamp when bucket refills
+//
+//	X-RateLimit-Limit: Maximum requests per minute
+//	X-RateLimit-Remaining: Tokens remaining in bucket
+//	X-RateLimit-Reset: Unix timestamp when bucket refills
 //
 // Headers added to 429 responses:
-//   Retry-After: Seconds to wait before retrying
+//
+//	Retry-After: Seconds to wait before retrying
+//
+// With RateLimitOptions, the limits of the route's policy bundle (per API
+// key, client IP, route, tenant and route...) are checked before the tier
+// limit, and charged once the tier limit allows the request. The headers
+// report whichever limit is closest to running out.
 type RateLimitMiddleware struct {
 	limiter ratelimit.Limiter
+	opts    RateLimitOptions
 	logger  *zap.Logger
 	tracer  trace.Tracer
 }
 
+// RateLimitOptions configures the policy bundle rate limits checked in
+// addition to the tenant tier limit
+type RateLimitOptions struct {
+	// Limiter counts requests against bundle limits
+	Limiter limiter.Limiter
+
+	// Limits returns the rate limits of the route serving r, or nil
+	Limits func(r *http.Request) *RouteRateLimits
+
+	// TrustedProxies are the proxies whose X-Forwarded-For header is used
+	// to find the client IP of per-IP limits
+	TrustedProxies []netip.Prefix
+
+	// Failover applies the failure policy to the tier limit while Redis is
+	// unavailable; without one, tier limit errors fail open. Wrap Limiter
+	// with the same failover to cover bundle limits.
+	Failover *limiter.Failover
+}
+
+// RouteRateLimits are the rate limits of a route's policy bundle
+type RouteRateLimits struct {
+	Bundle string // Counters are kept per bundle
+	Route  string // Route name or path, for limits by route
+	Rules  []policy.RateLimitRule
+}
+
+// ruleResult is the outcome of a bundle rate limit
+type ruleResult struct {
+	rule policy.RateLimitRule
+	key  string // Counter key
+	*limiter.Result
+}
+
+// rateLimitedKey marks requests whose rate limits were already charged
+const rateLimitedKey contextKey = "apx.rate_limited"
+
 // NewRateLimitMiddleware creates a new rate limit middleware
 func NewRateLimitMiddleware(limiter ratelimit.Limiter, logger *zap.Logger) *RateLimitMiddleware {
 	return &RateLimitMiddleware{
@@ -50,6 +101,11 @@ func NewRateLimitMiddleware(limiter ratelimit.Limiter, logger *zap.Logger) *Rate
 func (m *RateLimitMiddleware) Handler() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, first := firstPass(r, rateLimitedKey)
+			if !first {
+				next.ServeHTTP(w, r)
+				return
+			}
 			ctx := r.Context()
 
 			// Start span for rate limit check
@@ -73,17 +129,40 @@ func (m *RateLimitMiddleware) Handler() Middleware {
 			// Get tenant tier and resource ID
 			tier := string(tenant.Organization.Tier)
 			resourceID := tenant.ResourceID
+			cost := GetRequestCost(ctx)
 
 			span.SetAttributes(
 				attribute.String("tenant.resource_id", resourceID),
 				attribute.String("tenant.tier", tier),
+				attribute.Int64("rate_limit.cost", cost),
 			)
 
 			// Get rate limit configuration for tenant tier
 			config := ratelimit.GetTenantConfigForTier(resourceID, tier)
 
+			// Check the bundle's limits first, most specific first: a key
+			// over its own limit is rejected before it draws on the limits
+			// it shares with the tenant's other keys. They are charged once
+			// the tier limit allows the request too.
+			checked, denied, err := m.checkRules(ctx, r, resourceID, cost)
+			if err != nil {
+				// Redis is down and the failure policy is closed
+				span.RecordError(err)
+				m.sendUnavailable(w)
+				return
+			}
+			if denied != nil {
+				m.denyRule(ctx, span, w, r, tier, resourceID, denied)
+				return
+			}
+
 			// Check and consume token from rate limiter
-			result, err := m.limiter.Consume(ctx, resourceID, 1)
+			result, err := m.consume(ctx, resourceID, config, cost)
+			if errors.Is(err, limiter.ErrUnavailable) {
+				span.RecordError(err)
+				m.sendUnavailable(w)
+				return
+			}
 			if err != nil {
 				// Log error but allow request (fail open behavior)
 				span.RecordError(err)
@@ -91,29 +170,29 @@ func (m *RateLimitMiddleware) Handler() Middleware {
 					zap.Error(err),
 					zap.String("resource_id", resourceID),
 					zap.String("tier", tier))
-
-				// Add rate limit headers with current config
-				m.addRateLimitHeaders(w, config.RequestsPerMinute, config.BurstLimit, time.Now().Add(time.Minute))
-
-				// Allow request to proceed
-				next.ServeHTTP(w, r.WithContext(ctx))
-				return
+				result = nil
 			}
 
 			duration := time.Since(startTime)
 
-			// Add rate limit headers to response
-			m.addRateLimitHeaders(w, result.Limit, result.Remaining, result.ResetAt)
-
-			span.SetAttributes(
-				attribute.Bool("rate_limit.allowed", result.Allowed),
-				attribute.Int64("rate_limit.remaining", result.Remaining),
-				attribute.Int64("rate_limit.limit", result.Limit),
-				attribute.Int64("rate_limit.quota_remaining", result.QuotaRemaining),
-			)
+			if result != nil {
+				span.SetAttributes(
+					attribute.Bool("rate_limit.allowed", result.Allowed),
+					attribute.Int64("rate_limit.remaining", result.Remaining),
+					attribute.Int64("rate_limit.limit", result.Limit),
+					attribute.Int64("rate_limit.quota_remaining", result.QuotaRemaining),
+				)
+			}
 
 			// Check if rate limit exceeded
-			if !result.Allowed {
+			if result != nil && !result.Allowed {
+				// The bundle limits were checked but not charged
+				for _, c := range checked {
+					recordRulePolicy(ctx, c)
+				}
+				recordTierPolicy(ctx, result)
+				m.addRateLimitHeaders(ctx, w, result.Limit, result.Remaining, result.ResetAt)
+
 				// Add Retry-After header (seconds until reset)
 				retryAfter := result.RetryAfter
 				if retryAfter <= 0 {
@@ -140,13 +219,40 @@ func (m *RateLimitMiddleware) Handler() Middleware {
 				return
 			}
 
+			tightest, denied, err := m.chargeRules(ctx, resourceID, checked, cost)
+			if err != nil {
+				span.RecordError(err)
+				m.sendUnavailable(w)
+				return
+			}
+			if denied != nil {
+				m.denyRule(ctx, span, w, r, tier, resourceID, denied)
+				return
+			}
+			if result != nil {
+				recordTierPolicy(ctx, result)
+			}
+
+			// Add rate limit headers to response, for the tier limit unless
+			// a bundle limit is closer to running out
+			switch {
+			case tightest != nil && (result == nil || tightest.Remaining < result.Remaining):
+				m.addRateLimitHeaders(ctx, w, tightest.Limit, tightest.Remaining, tightest.ResetAt)
+			case result != nil:
+				m.addRateLimitHeaders(ctx, w, result.Limit, result.Remaining, result.ResetAt)
+			default:
+				m.addRateLimitHeaders(ctx, w, config.RequestsPerMinute, config.BurstLimit, time.Now().Add(time.Minute))
+			}
+
 			// Log successful rate limit check (at debug level to reduce noise)
-			m.logger.Debug("rate limit check passed",
-				zap.String("resource_id", resourceID),
-				zap.String("tier", tier),
-				zap.Int64("remaining", result.Remaining),
-				zap.Int64("limit", result.Limit),
-				zap.Duration("check_duration", duration))
+			if result != nil {
+				m.logger.Debug("rate limit check passed",
+					zap.String("resource_id", resourceID),
+					zap.String("tier", tier),
+					zap.Int64("remaining", result.Remaining),
+					zap.Int64("limit", result.Limit),
+					zap.Duration("check_duration", duration))
+			}
 
 			// Request allowed, proceed to next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -154,8 +260,220 @@ func (m *RateLimitMiddleware) Handler() Middleware {
 	}
 }
 
-// addRateLimitHeaders adds standard rate limit headers to the response
-func (m *RateLimitMiddleware) addRateLimitHeaders(w http.ResponseWriter, limit, remaining int64, resetAt time.Time) {
+// consume takes the request's cost in tokens from the tenant's tier bucket.
+// While Redis is unavailable, the failover's policy decides instead: local
+// mode counts the request against this router's share of the tier limit.
+func (m *RateLimitMiddleware) consume(ctx context.Context, resourceID string, config *ratelimit.TenantConfig, cost int64) (*ratelimit.Result, error) {
+	f := m.opts.Failover
+	if f == nil {
+		return m.limiter.Consume(ctx, resourceID, cost)
+	}
+	if !f.Degraded() {
+		result, err := m.limiter.Consume(ctx, resourceID, cost)
+		if !limiter.RedisDown(ctx, err) {
+			return result, err
+		}
+		f.MarkDown(err)
+	}
+
+	switch f.Policy() {
+	case limiter.FailLocal:
+		local, err := f.Local(ctx, "tier:"+resourceID, limiter.Limit{
+			Requests:  config.RequestsPerMinute,
+			Window:    time.Minute,
+			Algorithm: limiter.GCRA,
+		}, cost)
+		if err != nil {
+			return nil, err
+		}
+		return &ratelimit.Result{
+			Allowed:        local.Allowed,
+			Remaining:      local.Remaining,
+			Limit:          local.Limit,
+			ResetAt:        local.ResetAt,
+			RetryAfter:     int64(math.Ceil(local.RetryAfter.Seconds())),
+			QuotaRemaining: -1,
+		}, nil
+	case limiter.FailClosed:
+		f.Decided(false)
+		return nil, limiter.ErrUnavailable
+	default:
+		f.Decided(true)
+		return &ratelimit.Result{
+			Allowed:        true,
+			Remaining:      config.BurstLimit,
+			Limit:          config.RequestsPerMinute,
+			ResetAt:        time.Now().Add(time.Minute),
+			QuotaRemaining: -1,
+		}, nil
+	}
+}
+
+// checkRules checks the request's cost against the bundle limits of its
+// route without counting it, stopping at the first limit that denies it.
+// It returns the limits that allow it, to be charged by chargeRules, and the
+// denying limit if any. Limits whose dimensions the request lacks (e.g. a
+// per-key limit on an anonymous request) are skipped. Limiter errors fail
+// open, except ErrUnavailable.
+func (m *RateLimitMiddleware) checkRules(ctx context.Context, r *http.Request, tenantID string, cost int64) (checked []*ruleResult, denied *ruleResult, err error) {
+	if m.opts.Limiter == nil || m.opts.Limits == nil {
+		return nil, nil, nil
+	}
+	limits := m.opts.Limits(r)
+	if limits == nil {
+		return nil, nil, nil
+	}
+
+	// Check every limit before counting the request against any, so a
+	// request denied by one limit doesn't use up the others
+	for _, rule := range limits.Rules {
+		key, ok := m.ruleKey(ctx, r, limits, rule, tenantID)
+		if !ok {
+			continue
+		}
+
+		result, err := m.opts.Limiter.Peek(ctx, key, ruleLimit(rule), cost)
+		if errors.Is(err, limiter.ErrUnavailable) {
+			return nil, nil, err
+		}
+		if err != nil {
+			m.logger.Error("rate limit check error",
+				zap.Error(err),
+				zap.String("resource_id", tenantID),
+				zap.String("rule", rule.Name))
+			continue
+		}
+		current := &ruleResult{rule: rule, key: key, Result: result}
+		if !result.Allowed {
+			for _, c := range checked {
+				recordRulePolicy(ctx, c)
+			}
+			recordRulePolicy(ctx, current)
+			return nil, current, nil
+		}
+		checked = append(checked, current)
+	}
+	return checked, nil, nil
+}
+
+// chargeRules counts the request's cost against the bundle limits that
+// checkRules found allow it. It returns the limit with the fewest requests
+// remaining, and the limit that denies the request if a concurrent request
+// used it up since the check.
+func (m *RateLimitMiddleware) chargeRules(ctx context.Context, tenantID string, checked []*ruleResult, cost int64) (tightest, denied *ruleResult, err error) {
+	for _, c := range checked {
+		rule := c.rule
+		result, err := m.opts.Limiter.Allow(ctx, c.key, ruleLimit(rule), cost)
+		if errors.Is(err, limiter.ErrUnavailable) {
+			return nil, nil, err
+		}
+		if err != nil {
+			m.logger.Error("rate limit check error",
+				zap.Error(err),
+				zap.String("resource_id", tenantID),
+				zap.String("rule", rule.Name))
+			continue
+		}
+		current := &ruleResult{rule: rule, key: c.key, Result: result}
+		recordRulePolicy(ctx, current)
+		if !result.Allowed {
+			return tightest, current, nil
+		}
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = current
+		}
+	}
+	return tightest, nil, nil
+}
+
+// denyRule rejects a request over one of its bundle limits
+func (m *RateLimitMiddleware) denyRule(ctx context.Context, span trace.Span, w http.ResponseWriter, r *http.Request, tier, resourceID string, denied *ruleResult) {
+	retryAfter := max(int64(math.Ceil(denied.RetryAfter.Seconds())), 1)
+	m.addRateLimitHeaders(ctx, w, denied.Limit, denied.Remaining, denied.ResetAt)
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+
+	span.SetAttributes(
+		attribute.Bool("rate_limit.allowed", false),
+		attribute.String("rate_limit.rule", denied.rule.Name),
+	)
+	m.logger.Warn("rate limit exceeded",
+		zap.String("resource_id", resourceID),
+		zap.String("tier", tier),
+		zap.String("rule", denied.rule.Name),
+		zap.String("credential_id", GetCredentialID(ctx)),
+		zap.Int64("limit", denied.Limit),
+		zap.Time("reset_at", denied.ResetAt),
+		zap.Int64("retry_after", retryAfter),
+		zap.String("path", r.URL.Path),
+		zap.String("method", r.Method))
+
+	m.sendRuleLimitError(w, tier, denied, retryAfter)
+}
+
+// ruleLimit returns the limiter limit of a bundle rule
+func ruleLimit(rule policy.RateLimitRule) limiter.Limit {
+	return limiter.Limit{Requests: rule.Limit, Window: rule.Window, Algorithm: rule.Algorithm}
+}
+
+// recordRulePolicy records a checked rule for the IETF limit headers
+func recordRulePolicy(ctx context.Context, res *ruleResult) {
+	if lh := getLimitHeaders(ctx); lh != nil {
+		lh.addPolicy(RateLimitPolicy{
+			Name:      res.rule.Name,
+			Quota:     res.rule.Limit,
+			Window:    res.rule.Window,
+			Remaining: res.Remaining,
+			Reset:     time.Until(res.ResetAt),
+		})
+	}
+}
+
+// recordTierPolicy records the tier limit for the IETF limit headers
+func recordTierPolicy(ctx context.Context, result *ratelimit.Result) {
+	if lh := getLimitHeaders(ctx); lh != nil {
+		lh.addPolicy(RateLimitPolicy{
+			Name:      "tier",
+			Quota:     result.Limit,
+			Window:    time.Minute,
+			Remaining: result.Remaining,
+			Reset:     time.Until(result.ResetAt),
+		})
+	}
+}
+
+// ruleKey builds the counter key of a rule from the request's values of the
+// rule's dimensions, e.g. payments@1.0.0|tenant+route|tenant=acme|route=orders
+func (m *RateLimitMiddleware) ruleKey(ctx context.Context, r *http.Request, limits *RouteRateLimits, rule policy.RateLimitRule, tenantID string) (string, bool) {
+	parts := []string{limits.Bundle, rule.Name}
+	for _, d := range rule.Dimensions {
+		var value string
+		switch d {
+		case policy.DimensionTenant:
+			value = tenantID
+		case policy.DimensionKey:
+			value = GetCredentialID(ctx)
+		case policy.DimensionIP:
+			if ip := ClientIP(r, m.opts.TrustedProxies); ip.IsValid() {
+				value = ip.String()
+			}
+		case policy.DimensionRoute:
+			value = limits.Route
+		}
+		if value == "" {
+			return "", false
+		}
+		parts = append(parts, string(d)+"="+value)
+	}
+	return strings.Join(parts, "|"), true
+}
+
+// addRateLimitHeaders adds standard rate limit headers to the response, or
+// leaves them to LimitHeaders when it collects the request's limits
+func (m *RateLimitMiddleware) addRateLimitHeaders(ctx context.Context, w http.ResponseWriter, limit, remaining int64, resetAt time.Time) {
+	if lh := getLimitHeaders(ctx); lh != nil {
+		lh.rate = &RateLimitHeaders{Limit: limit, Remaining: remaining, Reset: resetAt.Unix()}
+		return
+	}
 	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", resetAt.Unix()))
@@ -167,12 +485,12 @@ func (m *RateLimitMiddleware) sendRateLimitError(w http.ResponseWriter, tier str
 	w.WriteHeader(http.StatusTooManyRequests)
 
 	response := map[string]interface{}{
-		"error":   "rate_limit_exceeded",
-		"message": fmt.Sprintf("Rate limit of %d requests per minute exceeded", result.Limit),
-		"tier":    tier,
-		"limit":   result.Limit,
-		"remaining": result.Remaining,
-		"reset_at": result.ResetAt.Format(time.RFC3339),
+		"error":       "rate_limit_exceeded",
+		"message":     fmt.Sprintf("Rate limit of %d requests per minute exceeded", result.Limit),
+		"tier":        tier,
+		"limit":       result.Limit,
+		"remaining":   result.Remaining,
+		"reset_at":    result.ResetAt.Format(time.RFC3339),
 		"retry_after": result.RetryAfter,
 	}
 
@@ -186,6 +504,47 @@ func (m *RateLimitMiddleware) sendRateLimitError(w http.ResponseWriter, tier str
 	}
 }
 
+// sendRuleLimitError sends a 429 Too Many Requests response naming the
+// bundle limit that was exceeded
+func (m *RateLimitMiddleware) sendRuleLimitError(w http.ResponseWriter, tier string, denied *ruleResult, retryAfter int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	response := map[string]interface{}{
+		"error":       "rate_limit_exceeded",
+		"message":     fmt.Sprintf("Rate limit %s of %d requests per %s exceeded", denied.rule.Name, denied.Limit, formatWindow(denied.rule.Window)),
+		"tier":        tier,
+		"limit_name":  denied.rule.Name,
+		"limit":       denied.Limit,
+		"remaining":   denied.Remaining,
+		"reset_at":    denied.ResetAt.Format(time.RFC3339),
+		"retry_after": retryAfter,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		m.logger.Error("failed to encode rate limit error response", zap.Error(err))
+	}
+}
+
+// formatWindow formats a limit window as in policy bundles, e.g. 1m or 90s
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", int64(d.Seconds()))
+	}
+}
+
+// sendUnavailable rejects a request while Redis is unavailable and the
+// failure policy is closed
+func (m *RateLimitMiddleware) sendUnavailable(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int64(limiter.RetryInterval.Seconds())))
+	m.sendError(w, http.StatusServiceUnavailable, "rate_limit_unavailable", "Rate limiting is temporarily unavailable")
+}
+
 // sendError sends a JSON error response
 func (m *RateLimitMiddleware) sendError(w http.ResponseWriter, statusCode int, errorCode, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -209,3 +568,11 @@ func RateLimit(limiter ratelimit.Limiter, logger *zap.Logger) Middleware {
 	middleware := NewRateLimitMiddleware(limiter, logger)
 	return middleware.Handler()
 }
+
+// RateLimitWithOptions is like RateLimit, but also enforces the rate limits
+// of each route's policy bundle
+func RateLimitWithOptions(tierLimiter ratelimit.Limiter, opts RateLimitOptions, logger *zap.Logger) Middleware {
+	middleware := NewRateLimitMiddleware(tierLimiter, logger)
+	middleware.opts = opts
+	return middleware.Handler()
+}
@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -103,3 +107,339 @@ func SetRateLimitHeaders(w http.ResponseWriter, limit, remaining int64, resetAt
 func SetRetryAfter(w http.ResponseWriter, seconds int64) {
 	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
 }
+
+// RateLimitPolicy is one limit of the IETF RateLimit-Policy and RateLimit
+// headers (draft-ietf-httpapi-ratelimit-headers), e.g. the tier's per-minute
+// limit or the monthly quota
+type RateLimitPolicy struct {
+	Name      string
+	Quota     int64         // q: units allowed per window
+	Window    time.Duration // w
+	Remaining int64         // r: units left in the current window
+	Reset     time.Duration // t: time until the quota is available again
+}
+
+// FormatRateLimitPolicy encodes the RateLimit-Policy header value, e.g.
+// "tier";q=100;w=60, "quota";q=10000;w=2592000
+func FormatRateLimitPolicy(policies []RateLimitPolicy) string {
+	items := make([]string, 0, len(policies))
+	for _, p := range policies {
+		item := sfString(p.Name) + ";q=" + strconv.FormatInt(max(p.Quota, 0), 10)
+		if p.Window > 0 {
+			item += ";w=" + strconv.FormatInt(seconds(p.Window), 10)
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, ", ")
+}
+
+// FormatRateLimit encodes the RateLimit header value, e.g.
+// "tier";r=50;t=30, "quota";r=9000;t=86400
+func FormatRateLimit(policies []RateLimitPolicy) string {
+	items := make([]string, 0, len(policies))
+	for _, p := range policies {
+		items = append(items, sfString(p.Name)+
+			";r="+strconv.FormatInt(max(p.Remaining, 0), 10)+
+			";t="+strconv.FormatInt(seconds(p.Reset), 10))
+	}
+	return strings.Join(items, ", ")
+}
+
+// SetIETFRateLimitHeaders sets the RateLimit-Policy and RateLimit headers on
+// an HTTP response
+func SetIETFRateLimitHeaders(w http.ResponseWriter, policies []RateLimitPolicy) {
+	if len(policies) == 0 {
+		return
+	}
+	w.Header().Set("RateLimit-Policy", FormatRateLimitPolicy(policies))
+	w.Header().Set("RateLimit", FormatRateLimit(policies))
+}
+
+// ParseIETFRateLimitHeaders extracts the policies of the RateLimit-Policy
+// and RateLimit headers from an HTTP response, joining the two by policy
+// name. Unknown parameters, such as partition keys, are ignored.
+func ParseIETFRateLimitHeaders(headers http.Header) ([]RateLimitPolicy, error) {
+	policyItems, err := parseSFList(strings.Join(headers.Values("RateLimit-Policy"), ", "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RateLimit-Policy header: %w", err)
+	}
+	limitItems, err := parseSFList(strings.Join(headers.Values("RateLimit"), ", "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RateLimit header: %w", err)
+	}
+	if len(policyItems) == 0 && len(limitItems) == 0 {
+		return nil, fmt.Errorf("header not found: RateLimit")
+	}
+
+	var policies []RateLimitPolicy
+	index := make(map[string]int)
+	policy := func(name string) *RateLimitPolicy {
+		i, ok := index[name]
+		if !ok {
+			i = len(policies)
+			index[name] = i
+			policies = append(policies, RateLimitPolicy{Name: name})
+		}
+		return &policies[i]
+	}
+
+	for _, item := range policyItems {
+		q, ok := item.integer("q")
+		if !ok {
+			return nil, fmt.Errorf("invalid RateLimit-Policy header: policy %q has no quota", item.name)
+		}
+		p := policy(item.name)
+		p.Quota = q
+		if w, ok := item.integer("w"); ok {
+			p.Window = time.Duration(w) * time.Second
+		}
+	}
+	for _, item := range limitItems {
+		r, ok := item.integer("r")
+		if !ok {
+			return nil, fmt.Errorf("invalid RateLimit header: policy %q has no remaining quota", item.name)
+		}
+		p := policy(item.name)
+		p.Remaining = r
+		if t, ok := item.integer("t"); ok {
+			p.Reset = time.Duration(t) * time.Second
+		}
+	}
+	return policies, nil
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int64 {
+	return max(int64(math.Ceil(d.Seconds())), 0)
+}
+
+// sfString encodes a structured field string (RFC 8941), replacing
+// characters it cannot hold
+func sfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			b.WriteByte('_')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// sfItem is a member of a structured field list whose value is a string or
+// token, with its parameters
+type sfItem struct {
+	name   string
+	params map[string]interface{}
+}
+
+// integer returns the item's non-negative integer parameter
+func (it sfItem) integer(key string) (int64, bool) {
+	v, ok := it.params[key].(int64)
+	return v, ok && v >= 0
+}
+
+// sfParser parses the subset of RFC 8941 structured field lists used by the
+// RateLimit headers: lists of strings or tokens with parameters. Inner
+// lists are not supported.
+type sfParser struct {
+	s string
+	i int
+}
+
+// parseSFList parses a structured field list; an empty value is an empty list
+func parseSFList(s string) ([]sfItem, error) {
+	p := &sfParser{s: s}
+	p.skip(" \t")
+	var items []sfItem
+	for p.i < len(p.s) {
+		item, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		p.skip(" \t")
+		if p.i == len(p.s) {
+			break
+		}
+		if p.s[p.i] != ',' {
+			return nil, fmt.Errorf("expected ',' at offset %d", p.i)
+		}
+		p.i++
+		p.skip(" \t")
+		if p.i == len(p.s) {
+			return nil, errors.New("trailing comma")
+		}
+	}
+	return items, nil
+}
+
+func (p *sfParser) skip(chars string) {
+	for p.i < len(p.s) && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *sfParser) item() (sfItem, error) {
+	start := p.i
+	v, err := p.bareItem()
+	if err != nil {
+		return sfItem{}, err
+	}
+	name, ok := v.(string)
+	if !ok {
+		return sfItem{}, fmt.Errorf("list member at offset %d is not a string or token", start)
+	}
+
+	params := make(map[string]interface{})
+	for p.i < len(p.s) && p.s[p.i] == ';' {
+		p.i++
+		p.skip(" ")
+		key, err := p.key()
+		if err != nil {
+			return sfItem{}, err
+		}
+		var value interface{} = true
+		if p.i < len(p.s) && p.s[p.i] == '=' {
+			p.i++
+			if value, err = p.bareItem(); err != nil {
+				return sfItem{}, err
+			}
+		}
+		params[key] = value
+	}
+	return sfItem{name: name, params: params}, nil
+}
+
+func (p *sfParser) bareItem() (interface{}, error) {
+	if p.i == len(p.s) {
+		return nil, errors.New("unexpected end of value")
+	}
+	switch c := p.s[p.i]; {
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.string()
+	case c == ':':
+		return p.byteSequence()
+	case c == '?':
+		return p.boolean()
+	case c == '*' || isAlpha(c):
+		return p.token(), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, p.i)
+	}
+}
+
+// number parses an integer (int64) or a decimal (float64)
+func (p *sfParser) number() (interface{}, error) {
+	start := p.i
+	if p.s[p.i] == '-' {
+		p.i++
+	}
+	decimal := false
+	for p.i < len(p.s) && (isDigit(p.s[p.i]) || (p.s[p.i] == '.' && !decimal)) {
+		decimal = decimal || p.s[p.i] == '.'
+		p.i++
+	}
+	if decimal {
+		f, err := strconv.ParseFloat(p.s[start:p.i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decimal at offset %d", start)
+		}
+		return f, nil
+	}
+	n, err := strconv.ParseInt(p.s[start:p.i], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer at offset %d", start)
+	}
+	return n, nil
+}
+
+func (p *sfParser) string() (string, error) {
+	start := p.i
+	p.i++ // opening quote
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\':
+			if p.i == len(p.s) || (p.s[p.i] != '"' && p.s[p.i] != '\\') {
+				return "", fmt.Errorf("invalid escape in string at offset %d", start)
+			}
+			b.WriteByte(p.s[p.i])
+			p.i++
+		case c < 0x20 || c > 0x7e:
+			return "", fmt.Errorf("invalid character in string at offset %d", start)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func (p *sfParser) byteSequence() ([]byte, error) {
+	start := p.i
+	end := strings.IndexByte(p.s[p.i+1:], ':')
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated byte sequence at offset %d", start)
+	}
+	b, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+	if err != nil {
+		return nil, fmt.Errorf("invalid byte sequence at offset %d", start)
+	}
+	p.i += end + 2
+	return b, nil
+}
+
+func (p *sfParser) boolean() (bool, error) {
+	if p.i+1 < len(p.s) && (p.s[p.i+1] == '0' || p.s[p.i+1] == '1') {
+		p.i += 2
+		return p.s[p.i-1] == '1', nil
+	}
+	return false, fmt.Errorf("invalid boolean at offset %d", p.i)
+}
+
+func (p *sfParser) token() string {
+	start := p.i
+	p.i++
+	for p.i < len(p.s) && (isTChar(p.s[p.i]) || p.s[p.i] == ':' || p.s[p.i] == '/') {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	if p.i == len(p.s) || !(p.s[p.i] == '*' || (p.s[p.i] >= 'a' && p.s[p.i] <= 'z')) {
+		return "", fmt.Errorf("invalid parameter key at offset %d", start)
+	}
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if !((c >= 'a' && c <= 'z') || isDigit(c) || strings.IndexByte("_-.*", c) >= 0) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isAlpha(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+func isTChar(c byte) bool {
+	return isDigit(c) || isAlpha(c) || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
@@ -334,3 +334,121 @@ func TestRateLimitHeaders_Integration(t *testing.T) {
 	assert.False(t, parsed.IsExceeded())
 	assert.Equal(t, 5.0, parsed.PercentageUsed())
 }
+
+// TestSetIETFRateLimitHeaders tests encoding of the IETF headers
+func TestSetIETFRateLimitHeaders(t *testing.T) {
+	rr := httptest.NewRecorder()
+	SetIETFRateLimitHeaders(rr, []RateLimitPolicy{
+		{Name: "tier", Quota: 100, Window: time.Minute, Remaining: 50, Reset: 29500 * time.Millisecond},
+		{Name: `per "key"`, Quota: 10, Window: 10 * time.Second, Remaining: -1, Reset: -time.Second},
+	})
+
+	assert.Equal(t, `"tier";q=100;w=60, "per \"key\"";q=10;w=10`, rr.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, `"tier";r=50;t=30, "per \"key\"";r=0;t=0`, rr.Header().Get("RateLimit"))
+
+	// No limits, no headers
+	rr = httptest.NewRecorder()
+	SetIETFRateLimitHeaders(rr, nil)
+	assert.Empty(t, rr.Header().Get("RateLimit"))
+}
+
+// TestParseIETFRateLimitHeaders tests parsing of the IETF headers
+func TestParseIETFRateLimitHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     http.Header
+		expected    []RateLimitPolicy
+		expectError bool
+	}{
+		{
+			name: "policies and limits",
+			headers: http.Header{
+				"Ratelimit-Policy": []string{`"tier";q=100;w=60, "quota";q=10000;w=2592000`},
+				"Ratelimit":        []string{`"tier";r=50;t=30, "quota";r=9000;t=86400`},
+			},
+			expected: []RateLimitPolicy{
+				{Name: "tier", Quota: 100, Window: time.Minute, Remaining: 50, Reset: 30 * time.Second},
+				{Name: "quota", Quota: 10000, Window: 720 * time.Hour, Remaining: 9000, Reset: 24 * time.Hour},
+			},
+		},
+		{
+			name: "token names, unknown parameters and split lines",
+			headers: http.Header{
+				"Ratelimit-Policy": []string{`burst;q=100;w=60;qu="requests"`, `day;q=1000;w=86400;pk=:Y2xpZW50:`},
+				"Ratelimit":        []string{`day;r=900;t=3600;pk=:Y2xpZW50:;x`},
+			},
+			expected: []RateLimitPolicy{
+				{Name: "burst", Quota: 100, Window: time.Minute},
+				{Name: "day", Quota: 1000, Window: 24 * time.Hour, Remaining: 900, Reset: time.Hour},
+			},
+		},
+		{
+			name: "limit without policy",
+			headers: http.Header{
+				"Ratelimit": []string{`"default";r=0;t=5`},
+			},
+			expected: []RateLimitPolicy{
+				{Name: "default", Reset: 5 * time.Second},
+			},
+		},
+		{
+			name:        "missing headers",
+			headers:     http.Header{},
+			expectError: true,
+		},
+		{
+			name:        "policy without quota",
+			headers:     http.Header{"Ratelimit-Policy": []string{`"tier";w=60`}},
+			expectError: true,
+		},
+		{
+			name:        "negative remaining",
+			headers:     http.Header{"Ratelimit": []string{`"tier";r=-1`}},
+			expectError: true,
+		},
+		{
+			name:        "unterminated string",
+			headers:     http.Header{"Ratelimit": []string{`"tier;r=1`}},
+			expectError: true,
+		},
+		{
+			name:        "trailing comma",
+			headers:     http.Header{"Ratelimit": []string{`"tier";r=1,`}},
+			expectError: true,
+		},
+		{
+			name:        "integer member",
+			headers:     http.Header{"Ratelimit": []string{`5;r=1`}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseIETFRateLimitHeaders(tt.headers)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestIETFRateLimitHeaders_RoundTrip tests that encoded headers parse back
+func TestIETFRateLimitHeaders_RoundTrip(t *testing.T) {
+	policies := []RateLimitPolicy{
+		{Name: "tier", Quota: 6000, Window: time.Minute, Remaining: 5999, Reset: 10 * time.Second},
+		{Name: "checkout-ip", Quota: 5, Window: 10 * time.Second, Remaining: 0, Reset: 2 * time.Second},
+	}
+
+	rr := httptest.NewRecorder()
+	SetIETFRateLimitHeaders(rr, policies)
+
+	parsed, err := ParseIETFRateLimitHeaders(rr.Header())
+	require.NoError(t, err)
+	assert.Equal(t, policies, parsed)
+}
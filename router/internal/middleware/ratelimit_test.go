@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/stratus-meridian/apx-private/control/pkg/ratelimit"
 	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/limiter"
+	"github.com/stratus-meridian/apx/router/internal/policy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -662,3 +666,367 @@ func TestRateLimitMiddleware_PerformanceUnder5ms(t *testing.T) {
 	// With mock limiter, middleware overhead should be well under 5ms
 	assert.Less(t, avgDuration, 5*time.Millisecond, "middleware overhead should be less than 5ms")
 }
+
+// TestRateLimitMiddleware_BundleLimits tests that a noisy key is stopped by
+// its own limit without using up the tenant limit its other keys share
+func TestRateLimitMiddleware_BundleLimits(t *testing.T) {
+	bundle := &policy.PolicyBundle{Name: "orders", Quotas: map[string]interface{}{
+		"perTenant": map[string]interface{}{"window": "1m", "limit": 4},
+		"perKey":    map[string]interface{}{"window": "1m", "limit": 2},
+		"perIP":     map[string]interface{}{"window": "1m", "limit": 3},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	handler := RateLimitWithOptions(&mockLimiter{}, RateLimitOptions{
+		Limiter:        limiter.NewMemoryLimiter(),
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		Limits: func(r *http.Request) *RouteRateLimits {
+			return &RouteRateLimits{Bundle: bundle.Name, Route: "orders", Rules: rules}
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tenant := createTestTenantForRateLimit(tenant.TierPro)
+	send := func(credentialID, clientIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/orders", nil)
+		req.RemoteAddr = "10.0.0.2:41000"
+		req.Header.Set("X-Forwarded-For", clientIP+", 10.0.0.1")
+		ctx := context.WithValue(req.Context(), TenantContextKey, tenant)
+		ctx = context.WithValue(ctx, CredentialIDKey, credentialID)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	// Headers report the limit closest to running out: the key's, not the
+	// tier's 99 remaining
+	rr := send("key:ci", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("X-RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, send("key:ci", "203.0.113.8").Code)
+	for i := 0; i < 3; i++ {
+		rr = send("key:ci", "203.0.113.9")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	}
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "key", response["limit_name"])
+	assert.Equal(t, "Rate limit key of 2 requests per 1m exceeded", response["message"])
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	// Denied requests were not counted against the tenant
+	assert.Equal(t, http.StatusOK, send("key:prod", "198.51.100.1").Code)
+	assert.Equal(t, http.StatusOK, send("key:prod", "198.51.100.2").Code)
+
+	// The tenant limit still caps all keys together
+	rr = send("key:batch", "198.51.100.3")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "tenant", response["limit_name"])
+}
+
+// TestRateLimitMiddleware_PerIPLimit tests that per-IP limits count the
+// client behind trusted proxies, and skip the limits of absent dimensions
+func TestRateLimitMiddleware_PerIPLimit(t *testing.T) {
+	bundle := &policy.PolicyBundle{Quotas: map[string]interface{}{
+		"perIP":  map[string]interface{}{"window": "1m", "limit": 1},
+		"perKey": map[string]interface{}{"window": "1m", "limit": 1},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	handler := RateLimitWithOptions(&mockLimiter{}, RateLimitOptions{
+		Limiter:        limiter.NewMemoryLimiter(),
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		Limits: func(r *http.Request) *RouteRateLimits {
+			return &RouteRateLimits{Rules: rules}
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tenant := createTestTenantForRateLimit(tenant.TierFree)
+	send := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/public", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		ctx := context.WithValue(req.Context(), TenantContextKey, tenant)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	// Anonymous requests have no key, so only the per-IP limit applies
+	assert.Equal(t, http.StatusOK, send("10.1.2.3:5000", "203.0.113.7"))
+	assert.Equal(t, http.StatusOK, send("10.1.2.3:5000", "203.0.113.8"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.9.9.9:5000", "203.0.113.7"))
+
+	// A client that isn't a trusted proxy can't pick its IP
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:5000", "203.0.113.9"))
+	assert.Equal(t, http.StatusTooManyRequests, send("192.0.2.1:5000", "203.0.113.10"))
+}
+
+// TestRateLimitMiddleware_DeniedNotCharged tests that a request denied by a
+// later limit is not counted against the earlier limits that allowed it
+func TestRateLimitMiddleware_DeniedNotCharged(t *testing.T) {
+	bundle := &policy.PolicyBundle{Quotas: map[string]interface{}{
+		"perKey": map[string]interface{}{"window": "1m", "limit": 2},
+		"perIP":  map[string]interface{}{"window": "1m", "limit": 1},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	handler := RateLimitWithOptions(&mockLimiter{}, RateLimitOptions{
+		Limiter: limiter.NewMemoryLimiter(),
+		Limits: func(r *http.Request) *RouteRateLimits {
+			return &RouteRateLimits{Rules: rules}
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tenant := createTestTenantForRateLimit(tenant.TierPro)
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/v1/orders", nil)
+		req.RemoteAddr = remoteAddr
+		ctx := context.WithValue(req.Context(), TenantContextKey, tenant)
+		ctx = context.WithValue(ctx, CredentialIDKey, "key:ci")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("203.0.113.7:5000"))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.7:5000"))
+	}
+
+	// The key has used 1 of its 2 requests despite the denied ones
+	assert.Equal(t, http.StatusOK, send("203.0.113.8:5000"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.9:5000"))
+}
+
+// TestRateLimitMiddleware_Cost tests that requests consume their cost from
+// the tier and bundle limits
+func TestRateLimitMiddleware_Cost(t *testing.T) {
+	bundle := &policy.PolicyBundle{Quotas: map[string]interface{}{
+		"perTenant": map[string]interface{}{"window": "1m", "limit": 10},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	var consumed []int64
+	tierLimiter := &mockLimiter{
+		consumeFunc: func(ctx context.Context, tenantID string, tokens int64) (*ratelimit.Result, error) {
+			consumed = append(consumed, tokens)
+			return &ratelimit.Result{Allowed: true, Remaining: 90, Limit: 100, ResetAt: time.Now().Add(time.Minute)}, nil
+		},
+	}
+	handler := Cost(func(r *http.Request) *CostModel {
+		return &CostModel{Weight: 4}
+	})(RateLimitWithOptions(tierLimiter, RateLimitOptions{
+		Limiter: limiter.NewMemoryLimiter(),
+		Limits: func(r *http.Request) *RouteRateLimits {
+			return &RouteRateLimits{Rules: rules}
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tenant := createTestTenantForRateLimit(tenant.TierPro)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/batch", nil)
+		ctx := context.WithValue(req.Context(), TenantContextKey, tenant)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := send()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, send().Code)
+
+	// 2 units left can't pay for a request costing 4, and the denied
+	// request isn't charged to the tier
+	assert.Equal(t, http.StatusTooManyRequests, send().Code)
+	assert.Equal(t, []int64{4, 4}, consumed)
+}
+
+// TestRateLimitMiddleware_TierDeniedNotCharged tests that a request denied
+// by the tier limit is not counted against the bundle limits
+func TestRateLimitMiddleware_TierDeniedNotCharged(t *testing.T) {
+	bundle := &policy.PolicyBundle{Quotas: map[string]interface{}{
+		"perTenant": map[string]interface{}{"window": "1m", "limit": 2},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	tierAllows := false
+	tierLimiter := &mockLimiter{
+		consumeFunc: func(ctx context.Context, tenantID string, tokens int64) (*ratelimit.Result, error) {
+			return &ratelimit.Result{Allowed: tierAllows, Remaining: 0, Limit: 100, ResetAt: time.Now().Add(time.Minute)}, nil
+		},
+	}
+	handler := RateLimitWithOptions(tierLimiter, RateLimitOptions{
+		Limiter: limiter.NewMemoryLimiter(),
+		Limits: func(r *http.Request) *RouteRateLimits {
+			return &RouteRateLimits{Rules: rules}
+		},
+	}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tenant := createTestTenantForRateLimit(tenant.TierPro)
+	send := func() int {
+		req := httptest.NewRequest("GET", "/v1/orders", nil)
+		ctx := context.WithValue(req.Context(), TenantContextKey, tenant)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, send())
+	}
+
+	// The tenant still has both of its bundle requests
+	tierAllows = true
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, http.StatusTooManyRequests, send())
+}
+
+// TestRateLimitMiddleware_AsyncChain tests that a request passing through
+// the middleware chain twice, as async routes do, is priced, rate limited
+// and tracked once
+func TestRateLimitMiddleware_AsyncChain(t *testing.T) {
+	bundle := &policy.PolicyBundle{Quotas: map[string]interface{}{
+		"perTenant": map[string]interface{}{"window": "1m", "limit": 10},
+	}}
+	rules, err := bundle.RateLimits()
+	require.NoError(t, err)
+
+	var consumed []int64
+	tierLimiter := &mockLimiter{
+		consumeFunc: func(ctx context.Context, tenantID string, tokens int64) (*ratelimit.Result, error) {
+			consumed = append(consumed, tokens)
+			return &ratelimit.Result{Allowed: true, Remaining: 90, Limit: 100, ResetAt: time.Now().Add(time.Minute)}, nil
+		},
+	}
+	events := make(chanTracker, 2)
+	chain := []Middleware{
+		Cost(func(r *http.Request) *CostModel {
+			return &CostModel{Weight: 4}
+		}),
+		RateLimitWithOptions(tierLimiter, RateLimitOptions{
+			Limiter: limiter.NewMemoryLimiter(),
+			Limits: func(r *http.Request) *RouteRateLimits {
+				return &RouteRateLimits{Rules: rules}
+			},
+		}, zap.NewNop()),
+		UsageTracker(events, zap.NewNop()),
+	}
+	asyncHandler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}), chain...)
+	handler := Chain(asyncHandler, chain...)
+
+	req := httptest.NewRequest("POST", "/v1/jobs", nil)
+	ctx := context.WithValue(req.Context(), TenantContextKey, createTestTenantForRateLimit(tenant.TierPro))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, []int64{4}, consumed)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, int64(4), ev.RequestCount)
+	case <-time.After(time.Second):
+		t.Fatal("usage event not tracked")
+	}
+	select {
+	case <-events:
+		t.Error("usage tracked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestRateLimitMiddleware_FailurePolicy tests the tier limit while Redis is
+// unavailable
+func TestRateLimitMiddleware_FailurePolicy(t *testing.T) {
+	redisDown := &mockLimiter{
+		consumeFunc: func(ctx context.Context, tenantID string, tokens int64) (*ratelimit.Result, error) {
+			return nil, fmt.Errorf("redis connection failed")
+		},
+	}
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+
+	tenant := createTestTenantForRateLimit(tenant.TierFree)
+	newHandler := func(policy limiter.FailurePolicy) http.Handler {
+		failover := limiter.NewFailover(client, policy, zap.NewNop())
+		return RateLimitWithOptions(redisDown, RateLimitOptions{Failover: failover}, zap.NewNop())(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+	}
+	send := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/test", nil)
+		ctx := context.WithValue(req.Context(), TenantContextKey, tenant)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	// Local: this router enforces the tier's 60 requests per minute alone
+	local := newHandler(limiter.FailLocal)
+	for i := 0; i < 60; i++ {
+		require.Equal(t, http.StatusOK, send(local).Code, "request %d", i)
+	}
+	rr := send(local)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	// Closed: requests are rejected until Redis recovers
+	rr = send(newHandler(limiter.FailClosed))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "5", rr.Header().Get("Retry-After"))
+
+	// Open: requests are allowed
+	open := newHandler(limiter.FailOpen)
+	for i := 0; i < 100; i++ {
+		require.Equal(t, http.StatusOK, send(open).Code)
+	}
+}
+
+// TestRateLimitMiddleware_ClientDisconnect tests that a request cancelled by
+// its client doesn't mark Redis as down for every other request
+func TestRateLimitMiddleware_ClientDisconnect(t *testing.T) {
+	cancelled := &mockLimiter{
+		consumeFunc: func(ctx context.Context, tenantID string, tokens int64) (*ratelimit.Result, error) {
+			return nil, ctx.Err()
+		},
+	}
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+
+	failover := limiter.NewFailover(client, limiter.FailClosed, zap.NewNop())
+	handler := RateLimitWithOptions(cancelled, RateLimitOptions{Failover: failover}, zap.NewNop())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	ctx, cancel := context.WithCancel(context.WithValue(req.Context(), TenantContextKey, createTestTenantForRateLimit(tenant.TierFree)))
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	assert.False(t, failover.Degraded())
+}
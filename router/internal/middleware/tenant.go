@@ -1,19 +1,32 @@
 package middleware
 
 import (
+	"cmp"
 	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx/router/internal/policy"
 	pkgauth "github.com/stratus-meridian/apx/router/pkg/auth"
+	"github.com/stratus-meridian/apx/router/pkg/proxy"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
 )
 
 const (
 	TenantIDKey      contextKey = "tenant_id"
 	TenantTierKey    contextKey = "tenant_tier"
 	TenantContextKey contextKey = "apx.tenant"
+	TokenClaimsKey   contextKey = "apx.token_claims"
+	ScopesKey        contextKey = "apx.scopes"
+	PermissionsKey   contextKey = "apx.permissions"
+	ClientCertKey    contextKey = "apx.client_cert"
+	CredentialIDKey  contextKey = "apx.credential_id"
 )
 
 // TenantResolver is the interface for resolving tenants from API keys
@@ -22,44 +35,216 @@ type TenantResolver interface {
 	GetDefaultTenant(ctx context.Context) *tenant.Tenant
 }
 
+// APIKeyResolver is implemented by tenant resolvers whose keys carry scopes
+// and route/method allowlists. Permissions are nil for unrestricted keys.
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, apiKey string) (*tenant.Tenant, *pkgauth.Permissions, error)
+}
+
+// JWTAuthenticator resolves tenants from JWT bearer tokens
+type JWTAuthenticator interface {
+	AuthenticateJWT(ctx context.Context, token string, p *policy.JWTAuth) (*tenant.Tenant, pkgauth.Claims, error)
+}
+
+// OAuth2Authenticator resolves tenants from opaque OAuth2 access tokens
+type OAuth2Authenticator interface {
+	AuthenticateOAuth2(ctx context.Context, token string, p *policy.OAuth2Auth) (*tenant.Tenant, pkgauth.Claims, error)
+}
+
+// CertificateAuthenticator resolves tenants from client certificates. verified
+// reports whether the TLS server already verified the chain.
+type CertificateAuthenticator interface {
+	AuthenticateCertificate(ctx context.Context, chain []*x509.Certificate, verified bool, p *policy.MTLSAuth) (*tenant.Tenant, *pkgauth.CertificateIdentity, error)
+}
+
+// AuthPolicyFunc returns the authentication policy of the route serving r,
+// or nil if the route has none (APX API keys only)
+type AuthPolicyFunc func(r *http.Request) *policy.AuthPolicy
+
+// AuthOptions configures the credentials TenantContextWithAuth accepts
+// besides APX API keys
+type AuthOptions struct {
+	Policy       AuthPolicyFunc
+	JWT          JWTAuthenticator
+	OAuth2       OAuth2Authenticator
+	Certificates CertificateAuthenticator
+
+	// IdentitySigner signs the X-Apx-Client-Identity header forwarded for
+	// certificate-authenticated requests; the header is omitted when nil
+	IdentitySigner *pkgauth.IdentitySigner
+}
+
 // TenantContext extracts tenant information from API keys (secure resolution)
 // SECURITY: This middleware does NOT trust client-supplied X-Tenant-* headers.
 // Tenant context is resolved exclusively from validated API keys.
 func TenantContext(resolver TenantResolver, logger *zap.Logger) Middleware {
+	return TenantContextWithAuth(resolver, AuthOptions{}, logger)
+}
+
+// TenantContextWithAuth resolves the tenant from the credentials accepted by
+// the route's policy bundle: APX API keys, JWT bearer tokens, OAuth2 access
+// tokens, client certificates or a combination. Routes without an auth policy accept API keys
+// only, like TenantContext. Token claims, scopes and API key permissions are
+// added to the request context.
+func TenantContextWithAuth(resolver TenantResolver, opts AuthOptions, logger *zap.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
+
+			// The async fallback runs the chain a second time; the tenant
+			// was resolved (and a query parameter key stripped) on the first
+			if t, ok := ctx.Value(TenantContextKey).(*tenant.Tenant); ok && t != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
 			var tenantCtx *tenant.Tenant
 
-			// Extract API key from Authorization header
-			apiKey, err := pkgauth.ExtractAPIKey(r)
-			if err == nil && apiKey != "" {
-				// Resolve tenant from API key
-				tenantCtx, err = resolver.ResolveTenant(ctx, apiKey)
+			// Only the router asserts client identities to backends
+			r.Header.Del(pkgauth.IdentityHeader)
+
+			var authPolicy *policy.AuthPolicy
+			if opts.Policy != nil {
+				authPolicy = opts.Policy(r)
+			}
+			acceptsJWT := authPolicy != nil && authPolicy.JWT != nil && opts.JWT != nil
+			acceptsOAuth2 := authPolicy != nil && authPolicy.OAuth2 != nil && opts.OAuth2 != nil
+			acceptsMTLS := authPolicy != nil && authPolicy.MTLS != nil && opts.Certificates != nil
+			hasClientCert := r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+
+			// Extract the bearer credential from the Authorization header, or
+			// the API key from the header or query parameter the route allows
+			apiKey, err := extractCredential(r, authPolicy)
+			switch {
+			case acceptsMTLS && hasClientCert:
+				var id *pkgauth.CertificateIdentity
+				tenantCtx, id, err = opts.Certificates.AuthenticateCertificate(ctx, r.TLS.PeerCertificates, len(r.TLS.VerifiedChains) > 0, authPolicy.MTLS)
 				if err != nil {
-					// Invalid or not found API key -> return 401 Unauthorized
-					logger.Warn("failed to resolve tenant from API key",
+					logger.Warn("failed to authenticate client certificate",
 						zap.Error(err),
 						zap.String("path", r.URL.Path))
 
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusUnauthorized)
-					w.Write([]byte(`{"error":"unauthorized","message":"Invalid or expired API key"}`))
+					writeUnauthorized(w, r, "Invalid client certificate")
 					return
 				}
+				ctx = context.WithValue(ctx, ClientCertKey, id)
+				ctx = withCredentialID(ctx, "cert", id.Fingerprint)
+
+				if opts.IdentitySigner != nil {
+					r.Header.Set(pkgauth.IdentityHeader, opts.IdentitySigner.Sign(pkgauth.Identity{
+						Subject:     id.Name(),
+						Tenant:      tenantCtx.ResourceID,
+						Fingerprint: id.Fingerprint,
+					}))
+				}
+
+				logger.Debug("tenant resolved from client certificate",
+					zap.String("tenant_id", tenantCtx.ResourceID),
+					zap.String("identity", id.Name()))
+
+			case acceptsMTLS && authPolicy.MTLS.RequireClientCert:
+				logger.Warn("missing client certificate",
+					zap.String("path", r.URL.Path))
+
+				writeUnauthorized(w, r, "Client certificate required")
+				return
+
+			case err != nil || apiKey == "":
+				if authPolicy != nil && !authPolicy.Required {
+					// Anonymous access is allowed on this route
+					tenantCtx = resolver.GetDefaultTenant(ctx)
+					break
+				}
 
-					logger.Debug("tenant resolved from API key",
-						zap.String("tenant_id", tenantCtx.ResourceID),
-						zap.String("tier", string(tenantCtx.Organization.Tier)),
-						zap.String("org_id", tenantCtx.Organization.ID))
-			} else {
 				// No API key provided -> return 401 Unauthorized
 				logger.Warn("missing API key for tenant context",
 					zap.String("path", r.URL.Path))
 
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"unauthorized","message":"API key required"}`))
+				if acceptsJWT || acceptsOAuth2 {
+					writeUnauthorized(w, r, "API key or bearer token required")
+				} else {
+					writeUnauthorized(w, r, "API key required")
+				}
+				return
+
+			case acceptsJWT && pkgauth.IsJWT(apiKey):
+				var claims pkgauth.Claims
+				tenantCtx, claims, err = opts.JWT.AuthenticateJWT(ctx, apiKey, authPolicy.JWT)
+				if err != nil {
+					logger.Warn("failed to authenticate JWT",
+						zap.Error(err),
+						zap.String("path", r.URL.Path))
+
+					writeUnauthorized(w, r, "Invalid or expired token")
+					return
+				}
+				ctx = withTokenClaims(ctx, claims)
+				ctx = withCredentialID(ctx, "jwt", claims.String("sub"))
+
+				logger.Debug("tenant resolved from JWT",
+					zap.String("tenant_id", tenantCtx.ResourceID),
+					zap.String("subject", claims.String("sub")))
+
+			case acceptsOAuth2 && !strings.HasPrefix(apiKey, "apx_"):
+				var claims pkgauth.Claims
+				tenantCtx, claims, err = opts.OAuth2.AuthenticateOAuth2(ctx, apiKey, authPolicy.OAuth2)
+				if errors.Is(err, pkgauth.ErrIntrospectionUnavailable) {
+					logger.Error("token introspection unavailable",
+						zap.Error(err),
+						zap.String("path", r.URL.Path))
+
+					writeAuthUnavailable(w, r)
+					return
+				}
+				if err != nil {
+					logger.Warn("failed to authenticate OAuth2 token",
+						zap.Error(err),
+						zap.String("path", r.URL.Path))
+
+					writeUnauthorized(w, r, "Invalid or expired token")
+					return
+				}
+				ctx = withTokenClaims(ctx, claims)
+				ctx = withCredentialID(ctx, "oauth2", cmp.Or(claims.String("client_id"), claims.String("sub")))
+
+				logger.Debug("tenant resolved from OAuth2 token",
+					zap.String("tenant_id", tenantCtx.ResourceID),
+					zap.String("client_id", claims.String("client_id")))
+
+			case authPolicy.AcceptsAPIKey():
+				// Resolve tenant (and the key's permissions) from API key
+				var perms *pkgauth.Permissions
+				if keys, ok := resolver.(APIKeyResolver); ok {
+					tenantCtx, perms, err = keys.ResolveAPIKey(ctx, apiKey)
+				} else {
+					tenantCtx, err = resolver.ResolveTenant(ctx, apiKey)
+				}
+				if err != nil {
+					// Invalid or not found API key -> return 401 Unauthorized
+					logger.Warn("failed to resolve tenant from API key",
+						zap.Error(err),
+						zap.String("path", r.URL.Path))
+
+					writeUnauthorized(w, r, "Invalid or expired API key")
+					return
+				}
+				if perms != nil {
+					ctx = context.WithValue(ctx, PermissionsKey, perms)
+					ctx = context.WithValue(ctx, ScopesKey, perms.Scopes)
+				}
+				if info, err := pkgauth.ParseAPIKey(apiKey); err == nil {
+					ctx = withCredentialID(ctx, "key", info.KeyID)
+				}
+
+				logger.Debug("tenant resolved from API key",
+					zap.String("tenant_id", tenantCtx.ResourceID),
+					zap.String("tier", string(tenantCtx.Organization.Tier)),
+					zap.String("org_id", tenantCtx.Organization.ID))
+
+			default:
+				logger.Warn("credential not accepted by route",
+					zap.String("path", r.URL.Path))
+
+				writeUnauthorized(w, r, "Bearer token required")
 				return
 			}
 
@@ -77,6 +262,124 @@ func TenantContext(resolver TenantResolver, logger *zap.Logger) Middleware {
 	}
 }
 
+// extractCredential reads the request's bearer credential or API key. Keys
+// are read from a custom header or query parameter only on routes whose
+// policy allows it. The query parameter is removed from the request URL, so
+// the key does not reach backends or access logs.
+func extractCredential(r *http.Request, p *policy.AuthPolicy) (string, error) {
+	if p == nil || p.APIKey == nil {
+		return pkgauth.ExtractAPIKey(r)
+	}
+
+	key, _, err := pkgauth.ExtractAPIKeyFrom(r, p.APIKey.Header, p.APIKey.QueryParam)
+	if p.APIKey.QueryParam != "" {
+		stripQueryParam(r, p.APIKey.QueryParam)
+	}
+	return key, err
+}
+
+// stripQueryParam removes every value of a query parameter from the request
+// URL, leaving the other parameters untouched
+func stripQueryParam(r *http.Request, name string) {
+	if r.URL.RawQuery == "" {
+		return
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil && unescaped == name {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	r.URL.RawQuery = strings.Join(kept, "&")
+	r.RequestURI = r.URL.RequestURI()
+}
+
+// writeUnauthorized rejects a request without a valid API key. gRPC clients
+// get an UNAUTHENTICATED status instead of the JSON error.
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	if proxy.IsGRPCRequest(r) || proxy.IsGRPCWebRequest(r) {
+		proxy.WriteGRPCError(w, r, codes.Unauthenticated, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   "unauthorized",
+		"message": message,
+	})
+}
+
+// writeAuthUnavailable rejects a request whose token could not be checked
+// because the authorization server is unreachable
+func writeAuthUnavailable(w http.ResponseWriter, r *http.Request) {
+	const message = "Token introspection unavailable"
+	if proxy.IsGRPCRequest(r) || proxy.IsGRPCWebRequest(r) {
+		proxy.WriteGRPCError(w, r, codes.Unavailable, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   "service_unavailable",
+		"message": message,
+	})
+}
+
+// withTokenClaims adds a token's claims and scopes to ctx
+func withTokenClaims(ctx context.Context, claims pkgauth.Claims) context.Context {
+	ctx = context.WithValue(ctx, TokenClaimsKey, claims)
+	return context.WithValue(ctx, ScopesKey, claims.Scopes())
+}
+
+// withCredentialID records which credential authenticated the request, e.g.
+// key:<key ID>, so limits can be applied per key rather than per tenant
+func withCredentialID(ctx context.Context, kind, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, CredentialIDKey, kind+":"+id)
+}
+
+// GetCredentialID returns the ID of the API key, token subject or client
+// certificate the request was authenticated with, or "" for anonymous
+// requests
+func GetCredentialID(ctx context.Context) string {
+	id, _ := ctx.Value(CredentialIDKey).(string)
+	return id
+}
+
+// GetTokenClaims returns the claims of the JWT or OAuth2 access token the
+// request was authenticated with, if any
+func GetTokenClaims(ctx context.Context) (pkgauth.Claims, bool) {
+	claims, ok := ctx.Value(TokenClaimsKey).(pkgauth.Claims)
+	return claims, ok
+}
+
+// GetClientCertificate returns the identity of the client certificate the
+// request was authenticated with, if any
+func GetClientCertificate(ctx context.Context) (*pkgauth.CertificateIdentity, bool) {
+	id, ok := ctx.Value(ClientCertKey).(*pkgauth.CertificateIdentity)
+	return id, ok
+}
+
+// GetScopes returns the scopes granted to the request's token or API key
+func GetScopes(ctx context.Context) []string {
+	scopes, _ := ctx.Value(ScopesKey).([]string)
+	return scopes
+}
+
+// GetPermissions returns the scopes and allowlists of the request's API key,
+// if the key is restricted
+func GetPermissions(ctx context.Context) (*pkgauth.Permissions, bool) {
+	perms, ok := ctx.Value(PermissionsKey).(*pkgauth.Permissions)
+	return perms, ok
+}
+
 // GetTenantID retrieves tenant ID from request context
 func GetTenantID(ctx context.Context) string {
 	if tenantID, ok := ctx.Value(TenantIDKey).(string); ok {
@@ -20,6 +20,28 @@ var defaultUsageRegion = func() string {
 	return "us-central1"
 }()
 
+// usageTrackedKey marks requests whose usage is already tracked
+const usageTrackedKey contextKey = "apx.usage_tracked"
+
+// upgradeSessionKey holds the *UpgradeSession of a connection upgrade request
+const upgradeSessionKey contextKey = "apx.upgrade_session"
+
+// UpgradeSession is filled in by the handler that proxies a connection
+// upgrade (e.g. WebSocket), so the session is accounted once it closes
+// rather than as a plain request
+type UpgradeSession struct {
+	StatusCode int   // Handshake status; 101 once upgraded
+	BytesIn    int64 // Bytes relayed from the client to the backend
+	BytesOut   int64 // Bytes relayed from the backend to the client
+}
+
+// GetUpgradeSession returns the upgrade session tracked for the request, or
+// nil if usage tracking is disabled or the request is not an upgrade
+func GetUpgradeSession(ctx context.Context) *UpgradeSession {
+	session, _ := ctx.Value(upgradeSessionKey).(*UpgradeSession)
+	return session
+}
+
 // UsageTracker creates middleware that records request metadata via the shared usage tracker.
 func UsageTracker(tracker usage.UsageTracker, logger *zap.Logger) Middleware {
 	if tracker == nil {
@@ -31,9 +53,23 @@ func UsageTracker(tracker usage.UsageTracker, logger *zap.Logger) Middleware {
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, first := firstPass(r, usageTrackedKey)
+			if !first {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			recorder := newResponseRecorder(w)
 			start := time.Now()
 
+			call, r := trackGRPCCall(r)
+
+			var session *UpgradeSession
+			if r.Header.Get("Upgrade") != "" {
+				session = &UpgradeSession{}
+				r = r.WithContext(context.WithValue(r.Context(), upgradeSessionKey, session))
+			}
+
 			next.ServeHTTP(recorder, r)
 
 			tenantCtx, ok := GetTenant(r.Context())
@@ -50,7 +86,7 @@ func UsageTracker(tracker usage.UsageTracker, logger *zap.Logger) Middleware {
 				ProductID:     tenantCtx.Product.ID,
 				EnvironmentID: tenantCtx.Environment.ID,
 				Tier:          string(tenantCtx.Organization.Tier),
-				RequestCount:  1,
+				RequestCount:  GetChargedCost(r.Context()),
 				Endpoint:      r.URL.Path,
 				Method:        r.Method,
 				StatusCode:    recorder.statusCode,
@@ -60,6 +96,18 @@ func UsageTracker(tracker usage.UsageTracker, logger *zap.Logger) Middleware {
 				Version:       headerOrDefault(r, "X-APX-Version", "v1"),
 			}
 
+			if call != nil && call.Done {
+				event.StatusCode = call.HTTPStatus()
+			}
+
+			// Hijacked connections bypass the recorder; the response time
+			// is the duration of the whole session
+			if session != nil && session.StatusCode != 0 {
+				event.StatusCode = session.StatusCode
+				event.BytesIn = session.BytesIn
+				event.BytesOut = session.BytesOut
+			}
+
 			go func(ev usage.UsageEvent) {
 				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
@@ -95,6 +143,12 @@ func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
 	}
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController, so
+// handlers behind this middleware can flush and hijack the connection
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseRecorder) WriteHeader(code int) {
 	if !rw.written {
 		rw.statusCode = code
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx-private/control/tenant"
+	"github.com/stratus-meridian/apx-private/control/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// chanTracker sends each tracked event to a channel
+type chanTracker chan usage.UsageEvent
+
+func (c chanTracker) TrackRequest(ctx context.Context, ev usage.UsageEvent) error {
+	c <- ev
+	return nil
+}
+
+// TestUsageTracker_UpgradeSession tests that the bytes relayed over an
+// upgraded connection are recorded in its usage event
+func TestUsageTracker_UpgradeSession(t *testing.T) {
+	events := make(chanTracker, 1)
+	handler := UsageTracker(events, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := GetUpgradeSession(r.Context())
+		require.NotNil(t, session)
+		session.StatusCode = http.StatusSwitchingProtocols
+		session.BytesIn, session.BytesOut = 120, 4096
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/stream", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	ctx := context.WithValue(req.Context(), TenantContextKey, createTestTenantForRateLimit(tenant.TierPro))
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, http.StatusSwitchingProtocols, ev.StatusCode)
+		assert.Equal(t, int64(120), ev.BytesIn)
+		assert.Equal(t, int64(4096), ev.BytesOut)
+	case <-time.After(time.Second):
+		t.Fatal("usage event not tracked")
+	}
+}
@@ -0,0 +1,215 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuthPolicy is the typed form of a bundle's auth section
+type AuthPolicy struct {
+	Required bool // Requests without credentials are rejected (default true)
+	JWT      *JWTAuth
+	OAuth2   *OAuth2Auth
+	MTLS     *MTLSAuth
+	APIKey   *APIKeyAuth // APX API keys are accepted
+}
+
+// APIKeyAuth configures where APX API keys are read from besides the
+// Authorization header
+type APIKeyAuth struct {
+	Header     string // Header carrying the key (default X-API-Key)
+	QueryParam string // Query parameter carrying the key; unset: not accepted
+}
+
+// DefaultAPIKeyHeader is the API key header of bundles that do not name one
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// JWTAuth configures JWT bearer authentication
+type JWTAuth struct {
+	JWKSURI   string // https:// endpoint, or file:// for a local key set
+	Issuer    string
+	Audience  []string
+	ClockSkew time.Duration
+	Claims    ClaimMappings
+}
+
+// OAuth2Auth configures opaque OAuth2 access tokens validated by RFC 7662
+// token introspection
+type OAuth2Auth struct {
+	IntrospectionURI string
+	ClientID         string // Client credentials the router introspects with
+	ClientSecretRef  string // env:NAME or file:PATH
+	CacheTTL         time.Duration
+	Claims           ClaimMappings
+}
+
+// MTLSAuth configures client certificate authentication
+type MTLSAuth struct {
+	TrustStore        string // CA bundle file; empty uses the server's TLS_CLIENT_CA_FILE
+	RequireClientCert bool   // Requests without a certificate are rejected (default true)
+	Identities        []CertificateMapping
+}
+
+// CertificateMapping maps certificates to a tenant
+type CertificateMapping struct {
+	Identity     string // SPIFFE ID, SAN, CN or subject DN; a trailing * matches a prefix
+	Tenant       string
+	Organization string
+	Tier         string
+}
+
+// ClaimMappings names the token claims that identify the tenant
+type ClaimMappings struct {
+	Tenant       string // Tenant resource ID (default "tenant_id")
+	Organization string // Organization ID (default "org_id", falls back to the tenant)
+	Tier         string // Tenant tier (default "tier", falls back to free)
+	Product      string // Product ID (default "product_id")
+	Environment  string // Environment ID (default "environment_id")
+}
+
+// Default claim names
+const (
+	DefaultTenantClaim       = "tenant_id"
+	DefaultOrganizationClaim = "org_id"
+	DefaultTierClaim         = "tier"
+	DefaultProductClaim      = "product_id"
+	DefaultEnvironmentClaim  = "environment_id"
+)
+
+// AcceptsAPIKey reports whether APX API keys are accepted. A nil policy
+// accepts them, as does a policy that configures no other method.
+func (p *AuthPolicy) AcceptsAPIKey() bool {
+	return p == nil || p.APIKey != nil || (p.JWT == nil && p.OAuth2 == nil && p.MTLS == nil)
+}
+
+// Auth returns the bundle's authentication policy, or nil if the bundle
+// has no auth section
+func (b *PolicyBundle) Auth() (*AuthPolicy, error) {
+	if len(b.AuthConfig) == 0 {
+		return nil, nil
+	}
+
+	p := &AuthPolicy{Required: true}
+	if v, ok := b.AuthConfig["required"].(bool); ok {
+		p.Required = v
+	}
+	if apiKey, ok := b.AuthConfig["apiKey"].(map[string]interface{}); ok {
+		p.APIKey = &APIKeyAuth{
+			Header:     stringOr(apiKey, "header", DefaultAPIKeyHeader),
+			QueryParam: stringValue(apiKey, "queryParam"),
+		}
+	}
+
+	if jwt, ok := b.AuthConfig["jwt"].(map[string]interface{}); ok {
+		j := &JWTAuth{
+			JWKSURI: stringValue(jwt, "jwksUri"),
+			Issuer:  stringValue(jwt, "issuer"),
+		}
+		if j.JWKSURI == "" {
+			return nil, fmt.Errorf("auth.jwt.jwksUri is required")
+		}
+
+		switch aud := jwt["audience"].(type) {
+		case string:
+			j.Audience = []string{aud}
+		case []interface{}:
+			for _, a := range aud {
+				if s, ok := a.(string); ok {
+					j.Audience = append(j.Audience, s)
+				}
+			}
+		case []string:
+			j.Audience = aud
+		}
+
+		if skew := stringValue(jwt, "clockSkew"); skew != "" {
+			d, err := time.ParseDuration(skew)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("auth.jwt.clockSkew: invalid duration %q", skew)
+			}
+			j.ClockSkew = d
+		}
+
+		claims, _ := jwt["claims"].(map[string]interface{})
+		j.Claims = claimMappings(claims)
+		p.JWT = j
+	}
+
+	if oauth2, ok := b.AuthConfig["oauth2"].(map[string]interface{}); ok {
+		o := &OAuth2Auth{
+			IntrospectionURI: stringValue(oauth2, "introspectionUri"),
+			ClientID:         stringValue(oauth2, "clientId"),
+			ClientSecretRef:  stringValue(oauth2, "clientSecretRef"),
+		}
+		if o.IntrospectionURI == "" {
+			return nil, fmt.Errorf("auth.oauth2.introspectionUri is required")
+		}
+
+		if ttl := stringValue(oauth2, "cacheTtl"); ttl != "" {
+			d, err := time.ParseDuration(ttl)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("auth.oauth2.cacheTtl: invalid duration %q", ttl)
+			}
+			o.CacheTTL = d
+		}
+
+		claims, _ := oauth2["claims"].(map[string]interface{})
+		o.Claims = claimMappings(claims)
+		p.OAuth2 = o
+	}
+
+	if mtls, ok := b.AuthConfig["mtls"].(map[string]interface{}); ok {
+		m := &MTLSAuth{
+			TrustStore:        strings.TrimPrefix(stringValue(mtls, "trustStore"), "file://"),
+			RequireClientCert: true,
+		}
+		if v, ok := mtls["requireClientCert"].(bool); ok {
+			m.RequireClientCert = v
+		}
+
+		identities, _ := mtls["identities"].([]interface{})
+		for i, item := range identities {
+			entry, _ := item.(map[string]interface{})
+			mapping := CertificateMapping{
+				Identity:     stringValue(entry, "identity"),
+				Tenant:       stringValue(entry, "tenant"),
+				Organization: stringValue(entry, "organization"),
+				Tier:         stringValue(entry, "tier"),
+			}
+			if mapping.Identity == "" || mapping.Tenant == "" {
+				return nil, fmt.Errorf("auth.mtls.identities[%d]: identity and tenant are required", i)
+			}
+			m.Identities = append(m.Identities, mapping)
+		}
+		if len(m.Identities) == 0 {
+			return nil, fmt.Errorf("auth.mtls.identities: at least one certificate mapping is required")
+		}
+		p.MTLS = m
+	}
+
+	return p, nil
+}
+
+// claimMappings applies the default claim names to a claims section
+func claimMappings(claims map[string]interface{}) ClaimMappings {
+	return ClaimMappings{
+		Tenant:       stringOr(claims, "tenant", DefaultTenantClaim),
+		Organization: stringOr(claims, "organization", DefaultOrganizationClaim),
+		Tier:         stringOr(claims, "tier", DefaultTierClaim),
+		Product:      stringOr(claims, "product", DefaultProductClaim),
+		Environment:  stringOr(claims, "environment", DefaultEnvironmentClaim),
+	}
+}
+
+func stringValue(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func stringOr(m map[string]interface{}, key, def string) string {
+	if s := stringValue(m, key); s != "" {
+		return s
+	}
+	return def
+}
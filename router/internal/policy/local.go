@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestLoader compiles the PolicyBundle documents of an apx/v1 manifest
+type ManifestLoader func(name string, data []byte) ([]*PolicyBundle, error)
+
+// manifestLoader is registered by the crd package, which imports this one
+var manifestLoader ManifestLoader
+
+// RegisterManifestLoader sets the loader used for apx/v1 manifests in the
+// policy directory
+func RegisterManifestLoader(fn ManifestLoader) {
+	manifestLoader = fn
+}
+
+// LoadBundles reads PolicyBundle files (*.json, *.yaml, *.yml) from dir. A
+// file is either an apx/v1 manifest of PolicyBundle documents or one compiled
+// bundle with the same fields as the Firestore documents. All files must be
+// valid, or none are returned.
+func LoadBundles(dir string) ([]*PolicyBundle, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy directory: %w", err)
+	}
+
+	var (
+		bundles []*PolicyBundle
+		errs    []error
+		seen    = make(map[string]string) // ref -> file
+	)
+	for _, entry := range entries {
+		// Skip hidden files, e.g. editor swap files and ConfigMap internals
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		file := filepath.Join(dir, entry.Name())
+		loaded, err := loadBundleFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, bundle := range loaded {
+			ref := fmt.Sprintf("%s@%s", bundle.Name, bundle.Version)
+			if other, ok := seen[ref]; ok {
+				errs = append(errs, fmt.Errorf("%s: duplicate policy bundle %s (also in %s)", file, ref, other))
+				continue
+			}
+			seen[ref] = file
+			bundles = append(bundles, bundle)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Name+"@"+bundles[i].Version < bundles[j].Name+"@"+bundles[j].Version
+	})
+	return bundles, nil
+}
+
+// loadBundleFile parses and validates the bundles of a single file. Errors
+// include the file name.
+func loadBundleFile(file string) ([]*PolicyBundle, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is converted to JSON so both formats use the json field names
+	raw := data
+	if ext := filepath.Ext(file); ext == ".yaml" || ext == ".yml" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: invalid YAML: %w", file, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%s: invalid YAML: %w", file, err)
+		}
+	}
+
+	var header struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%s: invalid policy bundle: %w", file, err)
+	}
+	if header.APIVersion != "" {
+		return loadManifest(file, raw, header.APIVersion)
+	}
+
+	var bundle PolicyBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%s: invalid policy bundle: %w", file, err)
+	}
+	if err := validateBundle(&bundle); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return []*PolicyBundle{&bundle}, nil
+}
+
+// loadManifest compiles the PolicyBundle documents of a manifest file. The
+// manifest loader reports errors with their file and line.
+func loadManifest(file string, data []byte, apiVersion string) ([]*PolicyBundle, error) {
+	if manifestLoader == nil {
+		return nil, fmt.Errorf("%s: %s manifests are not supported", file, apiVersion)
+	}
+	bundles, err := manifestLoader(file, data)
+	if err != nil {
+		return nil, err
+	}
+	for _, bundle := range bundles {
+		if err := validateBundle(bundle); err != nil {
+			return nil, fmt.Errorf("%s: %s@%s: %w", file, bundle.Name, bundle.Version, err)
+		}
+	}
+	return bundles, nil
+}
+
+// validateBundle checks the fields the policy store relies on
+func validateBundle(bundle *PolicyBundle) error {
+	switch {
+	case bundle.Name == "":
+		return fmt.Errorf("name is required")
+	case bundle.Version == "":
+		return fmt.Errorf("version is required")
+	case bundle.CanaryPercentage < 0 || bundle.CanaryPercentage > 100:
+		return fmt.Errorf("canary_percentage must be between 0 and 100")
+	}
+	_, err := bundle.Auth()
+	return err
+}
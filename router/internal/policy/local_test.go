@@ -0,0 +1,150 @@
+package policy_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stratus-meridian/apx/router/internal/config"
+	_ "github.com/stratus-meridian/apx/router/internal/crd" // registers the manifest loader
+	"github.com/stratus-meridian/apx/router/internal/policy"
+	"go.uber.org/zap"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestLoadBundles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "payments.json", `{"name": "payments", "version": "v1", "canary_percentage": 100, "rate_limit": {"rps": 10}}`)
+	writeFile(t, dir, "orders.yaml", "name: orders\nversion: v2\ncanary_percentage: 20\nstable_version: v1\n")
+	writeFile(t, dir, "README.md", "not a bundle")
+	writeFile(t, dir, ".payments.json.swp", "garbage")
+
+	bundles, err := policy.LoadBundles(dir)
+	if err != nil {
+		t.Fatalf("policy.LoadBundles() error: %v", err)
+	}
+	if len(bundles) != 2 {
+		t.Fatalf("got %d bundles, want 2", len(bundles))
+	}
+	if b := bundles[0]; b.Name != "orders" || b.CanaryPercentage != 20 || b.StableVersion != "v1" {
+		t.Errorf("unexpected YAML bundle: %+v", b)
+	}
+	if b := bundles[1]; b.Name != "payments" || b.RateLimit["rps"] != float64(10) {
+		t.Errorf("unexpected JSON bundle: %+v", b)
+	}
+}
+
+func TestLoadBundles_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "payments.yaml", `apiVersion: apx/v1
+kind: PolicyBundle
+metadata:
+  name: payments
+  version: 1.2.0
+spec:
+  auth:
+    required: true
+    apiKey:
+      header: X-API-Key
+  rateLimit:
+    rps: 50
+---
+apiVersion: apx/v1
+kind: PolicyBundle
+metadata:
+  name: payments
+  version: 1.3.0
+  compat: breaking
+spec:
+  auth:
+    required: false
+`)
+	writeFile(t, dir, "orders.json", `{"name": "orders", "version": "v1", "canary_percentage": 100}`)
+
+	bundles, err := policy.LoadBundles(dir)
+	if err != nil {
+		t.Fatalf("LoadBundles() error: %v", err)
+	}
+	if len(bundles) != 3 {
+		t.Fatalf("got %d bundles, want 3", len(bundles))
+	}
+	if b := bundles[1]; b.Name != "payments" || b.Version != "1.2.0" || b.CanaryPercentage != 100 || b.Compat != "backward" || b.Hash == "" {
+		t.Errorf("unexpected manifest bundle: %+v", b)
+	}
+	if auth, err := bundles[1].Auth(); err != nil || !auth.Required || auth.APIKey == nil {
+		t.Errorf("unexpected manifest bundle auth: %+v, %v", auth, err)
+	}
+	if b := bundles[2]; b.Version != "1.3.0" || b.Compat != "breaking" {
+		t.Errorf("unexpected second manifest bundle: %+v", b)
+	}
+}
+
+func TestLoadBundles_RejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"syntax", map[string]string{"a.json": `{"name": "a",`}},
+		{"missing version", map[string]string{"a.yaml": "name: a\n"}},
+		{"canary out of range", map[string]string{"a.yaml": "name: a\nversion: v1\ncanary_percentage: 150\n"}},
+		{"manifest schema", map[string]string{"a.yaml": "apiVersion: apx/v1\nkind: PolicyBundle\nmetadata:\n  name: a\n"}},
+		{"manifest route", map[string]string{"a.yaml": "apiVersion: apx/v1\nkind: Route\nmetadata:\n  name: r\nspec:\n  match:\n    path: /v1/a\n  backend:\n    pool: default\n"}},
+		{"duplicate", map[string]string{
+			"a.yaml": "name: a\nversion: v1\n",
+			"b.json": `{"name": "a", "version": "v1"}`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, dir, name, content)
+			}
+			if bundles, err := policy.LoadBundles(dir); err == nil {
+				t.Errorf("policy.LoadBundles() = %d bundles, want an error", len(bundles))
+			}
+		})
+	}
+}
+
+func TestLocalStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "api.yaml", "name: api\nversion: v1\ncanary_percentage: 100\n")
+
+	ctx := context.Background()
+	store, err := policy.NewStore(ctx, &config.Config{PolicyStoreType: "local", PolicyDir: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("policy.NewStore() error: %v", err)
+	}
+	// A bundle from another source survives directory reloads
+	store.Replace("routes.yaml", []*policy.PolicyBundle{{Name: "manifest", Version: "v1", CanaryPercentage: 100}})
+
+	// A new version replaces the old one
+	os.Remove(filepath.Join(dir, "api.yaml"))
+	writeFile(t, dir, "api.yaml", "name: api\nversion: v2\ncanary_percentage: 100\n")
+	if err := store.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if _, ref, err := store.GetForRequest(ctx, "api", 0); err != nil || ref != "api@v2" {
+		t.Fatalf("GetForRequest() = %q, %v; want api@v2", ref, err)
+	}
+
+	// A bad edit is rejected and the loaded bundles kept
+	writeFile(t, dir, "broken.yaml", "name: broken\n")
+	if err := store.Reload(ctx); err == nil {
+		t.Fatal("Reload() accepted an invalid bundle")
+	}
+	if _, ref, err := store.GetForRequest(ctx, "api", 0); err != nil || ref != "api@v2" {
+		t.Errorf("GetForRequest() = %q, %v after a rejected reload; want api@v2", ref, err)
+	}
+	if _, err := store.Get(ctx, "manifest@v1"); err != nil {
+		t.Errorf("manifest bundle lost: %v", err)
+	}
+}
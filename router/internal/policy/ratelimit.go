@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/limiter"
+)
+
+// RateLimitDimension is a request attribute a rate limit is counted by
+type RateLimitDimension string
+
+// Rate limit dimensions
+const (
+	DimensionTenant RateLimitDimension = "tenant"
+	DimensionKey    RateLimitDimension = "key"   // API key, or the subject of a token or certificate
+	DimensionIP     RateLimitDimension = "ip"    // Client IP
+	DimensionRoute  RateLimitDimension = "route" // Route name, or path pattern for unnamed routes
+)
+
+// specificity orders dimensions: limits of a single key or client are
+// checked before the shared limits they draw from
+var specificity = map[RateLimitDimension]int{
+	DimensionKey:    8,
+	DimensionIP:     4,
+	DimensionRoute:  2,
+	DimensionTenant: 1,
+}
+
+// RateLimitRule allows Limit requests per Window for each distinct
+// combination of its dimensions' values
+type RateLimitRule struct {
+	Name       string
+	Dimensions []RateLimitDimension
+	Limit      int64
+	Window     time.Duration
+	Algorithm  limiter.Algorithm // The bundle's rateLimit.algorithm
+}
+
+// Has reports whether the rule counts by the dimension
+func (r RateLimitRule) Has(d RateLimitDimension) bool {
+	return slices.Contains(r.Dimensions, d)
+}
+
+// shorthandQuotas are the quotas sections limiting a fixed set of dimensions
+var shorthandQuotas = []struct {
+	key        string
+	dimensions []RateLimitDimension
+}{
+	{"perTenant", []RateLimitDimension{DimensionTenant}},
+	{"perKey", []RateLimitDimension{DimensionKey}},
+	{"perIP", []RateLimitDimension{DimensionIP}},
+	{"perRoute", []RateLimitDimension{DimensionRoute}},
+	{"perTenantRoute", []RateLimitDimension{DimensionTenant, DimensionRoute}},
+}
+
+// RateLimits returns the bundle's rate limits, most specific first: limits
+// by key or client IP come before the tenant and route limits they share.
+// A request is checked against every rule.
+func (b *PolicyBundle) RateLimits() ([]RateLimitRule, error) {
+	var rules []RateLimitRule
+
+	algorithm, err := limiter.ParseAlgorithm(stringValue(b.RateLimit, "algorithm"))
+	if err != nil {
+		return nil, fmt.Errorf("rateLimit.algorithm: %w", err)
+	}
+
+	for _, q := range shorthandQuotas {
+		section, ok := b.Quotas[q.key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rule, err := rateLimitRule("quotas."+q.key, section, q.dimensions)
+		if err != nil {
+			return nil, err
+		}
+		rule.Algorithm = algorithm
+		rules = append(rules, rule)
+	}
+
+	limits, _ := b.Quotas["limits"].([]interface{})
+	for i, item := range limits {
+		section, _ := item.(map[string]interface{})
+		path := fmt.Sprintf("quotas.limits[%d]", i)
+
+		var dimensions []RateLimitDimension
+		by, _ := section["by"].([]interface{})
+		for _, v := range by {
+			d := RateLimitDimension(fmt.Sprint(v))
+			if _, ok := specificity[d]; !ok {
+				return nil, fmt.Errorf("%s.by: unknown dimension %q", path, d)
+			}
+			if !slices.Contains(dimensions, d) {
+				dimensions = append(dimensions, d)
+			}
+		}
+		if len(dimensions) == 0 {
+			return nil, fmt.Errorf("%s.by: at least one dimension is required", path)
+		}
+
+		rule, err := rateLimitRule(path, section, dimensions)
+		if err != nil {
+			return nil, err
+		}
+		if name := stringValue(section, "name"); name != "" {
+			rule.Name = name
+		}
+		rule.Algorithm = algorithm
+		rules = append(rules, rule)
+	}
+
+	slices.SortStableFunc(rules, func(a, b RateLimitRule) int {
+		return cmp.Compare(ruleSpecificity(b), ruleSpecificity(a))
+	})
+	return rules, nil
+}
+
+// rateLimitRule parses the window and limit of a quotas section. Rules are
+// named after their dimensions, e.g. tenant+route.
+func rateLimitRule(path string, section map[string]interface{}, dimensions []RateLimitDimension) (RateLimitRule, error) {
+	rule := RateLimitRule{Dimensions: dimensions}
+
+	names := make([]string, len(dimensions))
+	for i, d := range dimensions {
+		names[i] = string(d)
+	}
+	rule.Name = strings.Join(names, "+")
+
+	window := stringValue(section, "window")
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return rule, fmt.Errorf("%s.window: invalid duration %q", path, window)
+	}
+	rule.Window = d
+
+	switch limit := section["limit"].(type) {
+	case int:
+		rule.Limit = int64(limit)
+	case int64:
+		rule.Limit = limit
+	case float64:
+		rule.Limit = int64(limit)
+	}
+	if rule.Limit < 1 {
+		return rule, fmt.Errorf("%s.limit: must be at least 1", path)
+	}
+
+	return rule, nil
+}
+
+func ruleSpecificity(r RateLimitRule) int {
+	total := 0
+	for _, d := range r.Dimensions {
+		total += specificity[d]
+	}
+	return total
+}
@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/limiter"
+)
+
+func TestRateLimits(t *testing.T) {
+	b := &PolicyBundle{RateLimit: map[string]interface{}{"algorithm": "token-bucket"}, Quotas: map[string]interface{}{
+		"perTenant":      map[string]interface{}{"window": "1h", "limit": float64(10000)},
+		"perTenantRoute": map[string]interface{}{"window": "1m", "limit": 600},
+		"perKey":         map[string]interface{}{"window": "60s", "limit": 100},
+		"limits": []interface{}{
+			map[string]interface{}{"name": "checkout-ip", "by": []interface{}{"route", "ip"}, "window": "10s", "limit": 5},
+		},
+	}}
+
+	rules, err := b.RateLimits()
+	if err != nil {
+		t.Fatalf("RateLimits() error: %v", err)
+	}
+
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+	if want := []string{"key", "checkout-ip", "tenant+route", "tenant"}; !slices.Equal(names, want) {
+		t.Errorf("rules = %v, want %v", names, want)
+	}
+	if r := rules[0]; r.Limit != 100 || r.Window != time.Minute || !r.Has(DimensionKey) {
+		t.Errorf("perKey rule = %+v", r)
+	}
+	if r := rules[3]; r.Limit != 10000 || r.Window != time.Hour || r.Algorithm != limiter.GCRA {
+		t.Errorf("perTenant rule = %+v", r)
+	}
+
+	invalid := []map[string]interface{}{
+		{"perIP": map[string]interface{}{"window": "soon", "limit": 5}},
+		{"perIP": map[string]interface{}{"window": "1m"}},
+		{"limits": []interface{}{map[string]interface{}{"by": []interface{}{"country"}, "window": "1m", "limit": 5}}},
+		{"limits": []interface{}{map[string]interface{}{"window": "1m", "limit": 5}}},
+	}
+	for _, quotas := range invalid {
+		if _, err := (&PolicyBundle{Quotas: quotas}).RateLimits(); err == nil {
+			t.Errorf("RateLimits(%v) succeeded", quotas)
+		}
+	}
+
+	b.RateLimit = map[string]interface{}{"algorithm": "leaky-bucket"}
+	if _, err := b.RateLimits(); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
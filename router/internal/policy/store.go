@@ -56,6 +56,9 @@ type Store struct {
 	cache map[string]*PolicyBundle
 	mu    sync.RWMutex
 
+	// Refs loaded from each local source (policy directory or manifest)
+	sources map[string][]string
+
 	// Ready state
 	ready bool
 }
@@ -65,8 +68,9 @@ func NewStore(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*Sto
 	s := &Store{
 		cfg:    cfg,
 		logger: logger,
-		cache:  make(map[string]*PolicyBundle),
-		ready:  false,
+		cache:   make(map[string]*PolicyBundle),
+		sources: make(map[string][]string),
+		ready:   false,
 	}
 
 	// Initialize Firestore client
@@ -80,6 +84,10 @@ func NewStore(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*Sto
 			zap.String("project", cfg.ProjectID),
 			zap.String("collection", cfg.FirestoreCollection),
 		)
+	} else if cfg.PolicyStoreType == "local" {
+		logger.Info("initialized local policy store",
+			zap.String("dir", cfg.PolicyDir),
+		)
 	}
 
 	// Load initial policies
@@ -89,8 +97,11 @@ func NewStore(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*Sto
 
 	s.ready = true
 
-	// Start background refresh (every 30s)
-	go s.refreshLoop(ctx)
+	// Start background refresh (every 30s). Local bundles are reloaded by
+	// the file watcher instead.
+	if cfg.PolicyStoreType == "firestore" {
+		go s.refreshLoop(ctx)
+	}
 
 	return s, nil
 }
@@ -203,13 +214,59 @@ func (s *Store) ListVersions(ctx context.Context, policyName string) ([]*PolicyB
 	return versions, nil
 }
 
+// Replace atomically swaps the bundles previously loaded from source (a
+// policy directory or manifest file) for bundles. Bundles from other sources
+// are kept.
+func (s *Store) Replace(source string, bundles []*PolicyBundle) {
+	refs := make([]string, 0, len(bundles))
+
+	s.mu.Lock()
+	for _, ref := range s.sources[source] {
+		delete(s.cache, ref)
+	}
+	for _, bundle := range bundles {
+		ref := fmt.Sprintf("%s@%s", bundle.Name, bundle.Version)
+		s.cache[ref] = bundle
+		refs = append(refs, ref)
+	}
+	if s.sources == nil {
+		s.sources = make(map[string][]string)
+	}
+	s.sources[source] = refs
+	s.mu.Unlock()
+
+	s.logger.Info("policy bundles replaced",
+		zap.String("source", source),
+		zap.Strings("refs", refs),
+	)
+}
+
+// Reload reloads all policies from the backing store. Local bundles are only
+// swapped in if every file in the policy directory is valid.
+func (s *Store) Reload(ctx context.Context) error {
+	return s.loadPolicies(ctx)
+}
+
 // IsReady returns true if store is ready to serve requests
 func (s *Store) IsReady() bool {
 	return s.ready
 }
 
-// loadPolicies loads all policies from Firestore into cache
+// loadPolicies loads all policies from Firestore or the local policy
+// directory into cache
 func (s *Store) loadPolicies(ctx context.Context) error {
+	if s.cfg.PolicyStoreType == "local" {
+		bundles, err := LoadBundles(s.cfg.PolicyDir)
+		if err != nil {
+			return err
+		}
+		s.Replace(s.cfg.PolicyDir, bundles)
+		s.logger.Info("loaded policies",
+			zap.String("dir", s.cfg.PolicyDir),
+			zap.Int("count", len(bundles)))
+		return nil
+	}
+
 	if s.cfg.PolicyStoreType != "firestore" {
 		s.logger.Warn("policy store type not firestore, skipping initial load")
 		return nil
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// RouteHolder serves requests from the live generation of routes and swaps
+// in new generations atomically, e.g. when routes are reloaded. Every
+// generation counts the requests it is serving; a replaced generation keeps
+// serving the requests that started on it, and its backends are closed once
+// the last of them finishes.
+type RouteHolder struct {
+	current atomic.Pointer[routeGeneration]
+	logger  *zap.Logger
+
+	mu   sync.Mutex // serializes swaps
+	next uint64     // id of the next generation
+}
+
+// routeGeneration is one immutable set of routes and their backend proxies
+type routeGeneration struct {
+	id        uint64
+	proxy     *SyncProxyMulti
+	inflight  atomic.Int64
+	retired   atomic.Bool
+	retiredAt time.Time
+	closeOnce sync.Once
+	logger    *zap.Logger
+}
+
+// NewRouteHolder creates a holder serving proxy as generation 1
+func NewRouteHolder(proxy *SyncProxyMulti, logger *zap.Logger) *RouteHolder {
+	h := &RouteHolder{logger: logger, next: 1}
+	h.Swap(proxy)
+	return h
+}
+
+// Swap makes proxy the live generation and returns its id. Requests already
+// being served by the previous generation finish on it; its backends are
+// closed once they have. Circuit breakers of routes that are not in proxy
+// are dropped.
+func (h *RouteHolder) Swap(proxy *SyncProxyMulti) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	gen := &routeGeneration{id: h.next, proxy: proxy, logger: h.logger}
+	h.next++
+
+	old := h.current.Swap(gen)
+	breakers.Retain(proxy.circuitBreakers())
+	metrics.RouteGeneration.Set(float64(gen.id))
+	metrics.RouteGenerationRoutes.Set(float64(len(proxy.Table().Routes())))
+
+	if old != nil {
+		metrics.RouteSwaps.Inc()
+		h.logger.Info("route table swapped",
+			zap.Uint64("generation", gen.id),
+			zap.Uint64("previous_generation", old.id),
+			zap.Int("routes", len(proxy.Table().Routes())),
+			zap.Int64("previous_in_flight", old.inflight.Load()),
+		)
+		old.retire()
+	}
+	return gen.id
+}
+
+// Generation returns the id of the live generation
+func (h *RouteHolder) Generation() uint64 {
+	return h.current.Load().id
+}
+
+// Table returns the route table of the live generation
+func (h *RouteHolder) Table() *RouteTable {
+	return h.current.Load().proxy.Table()
+}
+
+// acquire returns the live generation with the request counted against it.
+// Callers must release it when the request is done.
+func (h *RouteHolder) acquire() *routeGeneration {
+	for {
+		gen := h.current.Load()
+		gen.inflight.Add(1)
+		// A generation retired between the load and the increment may
+		// already be closed; the swap has published its successor by then
+		if !gen.retired.Load() {
+			return gen
+		}
+		gen.release()
+	}
+}
+
+// release ends a request on the generation, closing it if it was the last
+// request of a retired generation
+func (g *routeGeneration) release() {
+	if g.inflight.Add(-1) == 0 && g.retired.Load() {
+		g.close()
+	}
+}
+
+// retire marks a replaced generation; it is closed as soon as no request is
+// in flight on it
+func (g *routeGeneration) retire() {
+	g.retiredAt = time.Now()
+	metrics.RouteGenerationsDraining.Inc()
+	g.retired.Store(true)
+	if g.inflight.Load() == 0 {
+		g.close()
+	}
+}
+
+// close closes the generation's backends once
+func (g *routeGeneration) close() {
+	g.closeOnce.Do(func() {
+		drain := time.Since(g.retiredAt)
+		metrics.RouteGenerationsDraining.Dec()
+		metrics.RouteDrainDuration.Observe(drain.Seconds())
+		g.logger.Info("route generation drained",
+			zap.Uint64("generation", g.id),
+			zap.Duration("drain_duration", drain),
+		)
+		if err := g.proxy.Close(); err != nil {
+			g.logger.Warn("failed to close route generation",
+				zap.Uint64("generation", g.id),
+				zap.Error(err),
+			)
+		}
+	})
+}
+
+// HandleWithFallback serves each request from the live generation, see
+// SyncProxyMulti.HandleWithFallback. The generation stays open until the
+// request, including any streamed response or upgraded connection, is done.
+func (h *RouteHolder) HandleWithFallback(asyncHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gen := h.acquire()
+		defer gen.release()
+		gen.proxy.serve(w, r, asyncHandler)
+	}
+}
+
+// Close closes the live generation. Replaced generations close themselves
+// once drained.
+func (h *RouteHolder) Close() error {
+	return h.current.Load().proxy.Close()
+}
@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stratus-meridian/apx/router/internal/config"
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	"github.com/stratus-meridian/apx/router/pkg/proxy"
+	"go.uber.org/zap"
+)
+
+func syncRoutes(backend string) *SyncProxyMulti {
+	return NewSyncProxyMulti([]config.RouteConfig{
+		{Path: "/**", Backend: backend, Mode: "sync", Methods: []string{http.MethodGet}},
+	}, zap.NewNop())
+}
+
+func TestRouteHolder_SwapTakesEffect(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	a, b := newBackend("a"), newBackend("b")
+
+	h := NewRouteHolder(syncRoutes(a.URL), zap.NewNop())
+	defer h.Close()
+	// The handler is built once, like the server's handler chain
+	handler := h.HandleWithFallback(http.NotFoundHandler())
+
+	get := func() string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		return rr.Body.String()
+	}
+	if got := get(); got != "a" {
+		t.Fatalf("got %q before the swap, want a", got)
+	}
+
+	if gen := h.Swap(syncRoutes(b.URL)); gen != 2 || h.Generation() != 2 {
+		t.Errorf("generation = %d (%d), want 2", gen, h.Generation())
+	}
+	if got := get(); got != "b" {
+		t.Errorf("got %q after the swap, want b", got)
+	}
+}
+
+func TestRouteHolder_MatchRoute(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	a, b := newBackend("a"), newBackend("b")
+
+	h := NewRouteHolder(syncRoutes(a.URL), zap.NewNop())
+	defer h.Close()
+	first := h.Table().Routes()[0]
+
+	// Middlewares see the route matched when the request arrived, even if
+	// the routes are swapped while it is in the chain; the proxy matches
+	// again in the generation serving the request
+	var matched []*Route
+	swap := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for range 2 {
+				match, err := h.Match(r)
+				if err != nil {
+					t.Fatalf("Match() error: %v", err)
+				}
+				matched = append(matched, match.Route)
+				h.Swap(syncRoutes(b.URL))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := middleware.Chain(h.HandleWithFallback(http.NotFoundHandler()), h.MatchRoute(), swap)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if len(matched) != 2 || matched[0] != first || matched[1] != first {
+		t.Errorf("middlewares matched %v, want the first generation's route twice", matched)
+	}
+	if rr.Body.String() != "b" {
+		t.Errorf("got %q, want b from the live generation", rr.Body.String())
+	}
+}
+
+func TestRouteHolder_DrainsReplacedGeneration(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+
+	h := NewRouteHolder(syncRoutes(slow.URL), zap.NewNop())
+	defer h.Close()
+	handler := h.HandleWithFallback(http.NotFoundHandler())
+	draining := testutil.ToFloat64(metrics.RouteGenerationsDraining)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- rr
+	}()
+	<-started
+
+	old := h.current.Load()
+	h.Swap(syncRoutes("http://127.0.0.1:1"))
+	if got := testutil.ToFloat64(metrics.RouteGenerationsDraining); got != draining+1 {
+		t.Errorf("draining generations = %v, want %v while a request is in flight", got, draining+1)
+	}
+	if n := old.inflight.Load(); n != 1 {
+		t.Errorf("in-flight requests on the old generation = %d, want 1", n)
+	}
+
+	close(release)
+	if rr := <-done; rr.Body.String() != "slow" {
+		t.Errorf("in-flight request got %d %q, want it to finish on the old backend", rr.Code, rr.Body.String())
+	}
+	if got := testutil.ToFloat64(metrics.RouteGenerationsDraining); got != draining {
+		t.Errorf("draining generations = %v, want %v once drained", got, draining)
+	}
+}
+
+func TestRouteHolder_ConcurrentSwaps(t *testing.T) {
+	h := NewRouteHolder(NewSyncProxyMulti(nil, zap.NewNop()), zap.NewNop())
+	defer h.Close()
+	draining := testutil.ToFloat64(metrics.RouteGenerationsDraining)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				h.acquire().release()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		h.Swap(NewSyncProxyMulti(nil, zap.NewNop()))
+	}
+	close(stop)
+	wg.Wait()
+
+	// Every replaced generation has been closed exactly once
+	if got := testutil.ToFloat64(metrics.RouteGenerationsDraining); got != draining {
+		t.Errorf("draining generations = %v, want %v", got, draining)
+	}
+	if h.Generation() != 101 {
+		t.Errorf("generation = %d, want 101", h.Generation())
+	}
+}
+
+func TestRouteHolder_SwapKeepsLiveBreakers(t *testing.T) {
+	breakerRoutes := func(paths ...string) *SyncProxyMulti {
+		var routes []config.RouteConfig
+		for _, path := range paths {
+			routes = append(routes, config.RouteConfig{
+				Path:           path,
+				Backend:        "http://127.0.0.1:1",
+				Mode:           "sync",
+				CircuitBreaker: config.CircuitBreakerConfig{Enabled: true, ErrorThreshold: 1},
+			})
+		}
+		return NewSyncProxyMulti(routes, zap.NewNop())
+	}
+	breaker := func(h *RouteHolder, path string) *proxy.CircuitBreaker {
+		sp, ok := h.current.Load().proxy.GetProxy(path)
+		if !ok {
+			t.Fatalf("no proxy for %s", path)
+		}
+		return sp.breaker
+	}
+
+	h := NewRouteHolder(breakerRoutes("/orders/**", "/invoices/**"), zap.NewNop())
+	defer h.Close()
+	orders, invoices := breaker(h, "/orders/**"), breaker(h, "/invoices/**")
+	if orders == invoices {
+		t.Fatal("routes sharing a backend share a breaker")
+	}
+
+	// A reload keeps the breakers of the routes it keeps
+	h.Swap(breakerRoutes("/orders/**", "/invoices/**"))
+	if breaker(h, "/orders/**") != orders || breaker(h, "/invoices/**") != invoices {
+		t.Error("reload replaced the breakers of unchanged routes")
+	}
+
+	// A removed route's breaker is dropped, so re-adding it starts afresh
+	h.Swap(breakerRoutes("/orders/**"))
+	h.Swap(breakerRoutes("/orders/**", "/invoices/**"))
+	if breaker(h, "/orders/**") != orders {
+		t.Error("reload replaced the breaker of an unchanged route")
+	}
+	if breaker(h, "/invoices/**") == invoices {
+		t.Error("breaker of a removed route was kept")
+	}
+}
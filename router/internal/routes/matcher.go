@@ -3,12 +3,15 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/stratus-meridian/apx/router/internal/config"
 	"github.com/stratus-meridian/apx/router/internal/middleware"
 	"github.com/stratus-meridian/apx/router/pkg/status"
 	"go.uber.org/zap"
@@ -19,12 +22,15 @@ type RequestMessage struct {
 	RequestID     string            `json:"request_id"`
 	TenantID      string            `json:"tenant_id"`
 	TenantTier    string            `json:"tenant_tier"`
-	Route         string            `json:"route"`
+	Route         string            `json:"route"`                   // Request path
+	RoutePattern  string            `json:"route_pattern,omitempty"` // Path pattern of the matched route
 	Method        string            `json:"method"`
 	PolicyVersion string            `json:"policy_version"`
+	Scopes        []string          `json:"scopes,omitempty"` // Granted to the API key or token, for OPA policies
 	Headers       map[string]string `json:"headers"`
 	Body          json.RawMessage   `json:"body"`
 	ReceivedAt    time.Time         `json:"received_at"`
+	TimeoutMs     int               `json:"timeout_ms,omitempty"` // Route timeout; workers fall back to the tenant tier timeout
 }
 
 // Matcher handles route matching and message publishing
@@ -32,7 +38,8 @@ type Matcher struct {
 	topic       *pubsub.Topic
 	statusStore status.Store
 	logger      *zap.Logger
-	baseURL     string // Base URL for constructing status/stream URLs
+	baseURL     string                     // Base URL for constructing status/stream URLs
+	table       atomic.Pointer[RouteTable] // Route table used by MatchRoute (optional)
 }
 
 // NewMatcher creates a new route matcher
@@ -45,6 +52,11 @@ func NewMatcher(topic *pubsub.Topic, statusStore status.Store, logger *zap.Logge
 	}
 }
 
+// SetRouteTable sets the route table used to resolve async routes
+func (m *Matcher) SetRouteTable(table *RouteTable) {
+	m.table.Store(table)
+}
+
 // PublishRequest publishes a request to Pub/Sub with tenant isolation
 func (m *Matcher) PublishRequest(ctx context.Context, msg *RequestMessage) error {
 	// CRITICAL: Validate tenant_id is present
@@ -109,12 +121,57 @@ func (m *Matcher) PublishRequest(ctx context.Context, msg *RequestMessage) error
 	return nil
 }
 
-// MatchRoute determines which route a request should take
-// This is a placeholder - real implementation would check policy bundles
+// MatchRoute determines which route a request should take.
+// It returns the path pattern of the matching route from the route table.
+// Paths without a configured route are returned unchanged so that the
+// default async pipeline keeps working without any route configuration.
 func (m *Matcher) MatchRoute(ctx context.Context, path string, method string) (string, error) {
-	// TODO: Implement actual route matching based on policy bundles
-	// For now, return the path as the route
-	return path, nil
+	table := m.table.Load()
+	if table == nil {
+		return path, nil
+	}
+
+	match, err := table.Match(method, path)
+	if err != nil {
+		if errors.Is(err, ErrNoRoute) {
+			return path, nil
+		}
+		return "", err
+	}
+
+	return match.Route.Config.Path, nil
+}
+
+// MatchRequest is like MatchRoute but also evaluates host, header and query
+// parameter criteria against the full request
+func (m *Matcher) MatchRequest(r *http.Request) (string, error) {
+	rc, err := m.matchRequest(r)
+	if err != nil {
+		return "", err
+	}
+	if rc == nil {
+		return r.URL.Path, nil
+	}
+	return rc.Path, nil
+}
+
+// matchRequest returns the configuration of the route matching the request,
+// or nil if no route is configured for it
+func (m *Matcher) matchRequest(r *http.Request) (*config.RouteConfig, error) {
+	table := m.table.Load()
+	if table == nil {
+		return nil, nil
+	}
+
+	match, err := table.MatchRequest(r)
+	if err != nil {
+		if errors.Is(err, ErrNoRoute) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &match.Route.Config, nil
 }
 
 // PublishBatch publishes multiple requests in a batch for efficiency
@@ -208,14 +265,25 @@ func (m *Matcher) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	// Determine route (for now, just use the path)
-	route, err := m.MatchRoute(ctx, r.URL.Path, r.Method)
+	// Determine route from the route table
+	rc, err := m.matchRequest(r)
 	if err != nil {
+		var methodErr *MethodNotAllowedError
+		if errors.As(err, &methodErr) {
+			writeMethodNotAllowed(w, r, methodErr)
+			return
+		}
 		m.logger.Error("failed to match route", zap.Error(err))
 		http.Error(w, `{"error":"failed to match route"}`, http.StatusInternalServerError)
 		return
 	}
 
+	var pattern string
+	var timeoutMs int
+	if rc != nil {
+		pattern, timeoutMs = rc.Path, rc.TimeoutMs
+	}
+
 	// Extract policy version from context (set by PolicyVersionTag middleware)
 	policyVersion := r.Header.Get("X-Policy-Version")
 	if policyVersion == "" {
@@ -242,12 +310,15 @@ func (m *Matcher) Handle(w http.ResponseWriter, r *http.Request) {
 		RequestID:     requestID,
 		TenantID:      tenantID,
 		TenantTier:    tenantTier,
-		Route:         route,
+		Route:         r.URL.Path,
+		RoutePattern:  pattern,
 		Method:        r.Method,
 		PolicyVersion: policyVersion,
+		Scopes:        middleware.GetScopes(ctx),
 		Headers:       extractHeaders(r),
 		Body:          rawBody,
 		ReceivedAt:    time.Now(),
+		TimeoutMs:     timeoutMs,
 	}
 
 	// Create initial status record
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+)
+
+// requestMatchKey holds the *requestMatch of a request
+type requestMatchKey struct{}
+
+// requestMatch is the route matched for a request in one route table
+type requestMatch struct {
+	table *RouteTable
+	match *RouteMatch
+	err   error
+}
+
+// MatchRoute matches each request against the live routes once, so the
+// middlewares that depend on its route (auth policy, scopes, limits, cost)
+// and the proxy share one match. They read it through Match.
+func (h *RouteHolder) MatchRoute() middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Value(requestMatchKey{}).(*requestMatch); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			table := h.Table()
+			match, err := table.MatchRequest(r)
+			ctx := context.WithValue(r.Context(), requestMatchKey{}, &requestMatch{table: table, match: match, err: err})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Match returns the route MatchRoute matched for the request, or matches it
+// against the live routes if MatchRoute did not run
+func (h *RouteHolder) Match(r *http.Request) (*RouteMatch, error) {
+	if m, ok := r.Context().Value(requestMatchKey{}).(*requestMatch); ok {
+		return m.match, m.err
+	}
+	return h.Table().MatchRequest(r)
+}
+
+// matchRequest is MatchRequest, reusing the request's match from MatchRoute
+// if it was made in this table
+func (t *RouteTable) matchRequest(r *http.Request) (*RouteMatch, error) {
+	if m, ok := r.Context().Value(requestMatchKey{}).(*requestMatch); ok && m.table == t {
+		return m.match, m.err
+	}
+	return t.MatchRequest(r)
+}
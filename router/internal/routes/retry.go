@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/config"
+)
+
+const (
+	// Default backoff bounds when a route enables retries without specifying them
+	defaultBackoffBase = 25 * time.Millisecond
+	defaultBackoffMax  = 250 * time.Millisecond
+
+	// Request bodies larger than this are streamed once and never retried
+	maxRetryBodyBytes = 1 << 20
+
+	// Response bodies of failed attempts are drained up to this size so the
+	// connection can be reused
+	maxDrainBytes = 64 << 10
+
+	// AttemptsHeader reports how many backend attempts were made for a request
+	AttemptsHeader = "X-Apx-Upstream-Attempts"
+)
+
+// retryPolicy is the compiled retry configuration of a sync route
+type retryPolicy struct {
+	maxAttempts   int
+	retryOn       map[string]bool
+	perTryTimeout time.Duration
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+	nonIdempotent bool
+}
+
+func newRetryPolicy(cfg config.RetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxAttempts:   cfg.MaxAttempts,
+		retryOn:       make(map[string]bool, len(cfg.RetryOn)),
+		perTryTimeout: time.Duration(cfg.PerTryTimeoutMs) * time.Millisecond,
+		backoffBase:   time.Duration(cfg.BackoffBaseMs) * time.Millisecond,
+		backoffMax:    time.Duration(cfg.BackoffMaxMs) * time.Millisecond,
+		nonIdempotent: cfg.RetryNonIdempotent,
+	}
+	if p.maxAttempts < 1 {
+		p.maxAttempts = 1
+	}
+	for _, cond := range cfg.RetryOn {
+		p.retryOn[cond] = true
+	}
+	if p.backoffBase <= 0 {
+		p.backoffBase = defaultBackoffBase
+	}
+	if p.backoffMax <= 0 {
+		p.backoffMax = defaultBackoffMax
+	}
+	if p.backoffMax < p.backoffBase {
+		p.backoffMax = p.backoffBase
+	}
+	return p
+}
+
+// attemptsFor returns the number of attempts allowed for a request method.
+// Non-idempotent methods are only retried when the route opts in.
+func (p retryPolicy) attemptsFor(method string) int {
+	if !p.nonIdempotent && !isIdempotent(method) {
+		return 1
+	}
+	return p.maxAttempts
+}
+
+// backoff returns the delay before the given retry (1-based), using
+// exponential backoff with full jitter
+func (p retryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.backoffBase
+	for i := 1; i < retry && ceiling < p.backoffMax; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.backoffMax {
+		ceiling = p.backoffMax
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// retryReason classifies a failed attempt as one of the retry conditions.
+// It returns "" when the attempt succeeded or failed for another reason.
+func retryReason(resp *http.Response, err error, tryCtx context.Context) string {
+	if err != nil {
+		if isTimeout(err, tryCtx) {
+			return config.RetryOnTimeout
+		}
+		return config.RetryOnConnectionFailure
+	}
+	if resp.StatusCode >= 500 {
+		return config.RetryOn5xx
+	}
+	return ""
+}
+
+// isTimeout reports whether a failed backend request ran out of time, either
+// because ctx expired or because of a network timeout
+func isTimeout(err error, ctx context.Context) bool {
+	var netErr net.Error
+	return errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// isIdempotent reports whether a method is idempotent (RFC 9110 section 9.2.2)
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// bufferBody reads the request body into memory so it can be replayed on
+// retries. If the body exceeds limit, the request body is restored so it can
+// still be streamed once and ok is false.
+func bufferBody(r *http.Request, limit int64) (body []byte, ok bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	body, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false, nil
+	}
+	return body, true, nil
+}
+
+// withBody returns a shallow copy of r that reads the buffered body
+func withBody(r *http.Request, body []byte) *http.Request {
+	if body == nil {
+		return r
+	}
+	req := *r
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return &req
+}
+
+// drain discards and closes the body of a response that will not be returned
+func drain(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
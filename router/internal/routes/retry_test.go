@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/config"
+	"go.uber.org/zap"
+)
+
+// flakyBackend fails the first `failures` requests with the given status and
+// records every request body it receives
+func flakyBackend(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32, *[]string) {
+	t.Helper()
+	var calls atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls, &bodies
+}
+
+func retryRoute(backend string, retries config.RetryConfig) config.RouteConfig {
+	retries.BackoffBaseMs = 1
+	retries.BackoffMaxMs = 2
+	return config.RouteConfig{Path: "/**", Backend: backend, Mode: "sync", Retries: retries}
+}
+
+func TestSyncProxy_RetriesOn5xx(t *testing.T) {
+	srv, calls, _ := flakyBackend(t, 2, http.StatusServiceUnavailable)
+	sp := mustSyncProxy(t, retryRoute(srv.URL, config.RetryConfig{
+		MaxAttempts: 3,
+		RetryOn:     []string{config.RetryOn5xx},
+	}), zap.NewNop())
+	defer sp.Close()
+
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+		t.Fatalf("got %d %q, want 200 ok", rr.Code, rr.Body.String())
+	}
+	if calls.Load() != 3 || rr.Header().Get(AttemptsHeader) != "3" {
+		t.Errorf("backend calls = %d, %s = %q; want 3", calls.Load(), AttemptsHeader, rr.Header().Get(AttemptsHeader))
+	}
+}
+
+func TestSyncProxy_ReturnsLastResponseWhenAttemptsExhausted(t *testing.T) {
+	srv, calls, _ := flakyBackend(t, 10, http.StatusInternalServerError)
+	sp := mustSyncProxy(t, retryRoute(srv.URL, config.RetryConfig{
+		MaxAttempts: 2,
+		RetryOn:     []string{config.RetryOn5xx},
+	}), zap.NewNop())
+	defer sp.Close()
+
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if rr.Code != http.StatusInternalServerError || calls.Load() != 2 {
+		t.Errorf("got %d after %d calls, want 500 after 2", rr.Code, calls.Load())
+	}
+}
+
+func TestSyncProxy_NonIdempotentMethods(t *testing.T) {
+	t.Run("NotRetriedByDefault", func(t *testing.T) {
+		srv, calls, _ := flakyBackend(t, 1, http.StatusBadGateway)
+		sp := mustSyncProxy(t, retryRoute(srv.URL, config.RetryConfig{
+			MaxAttempts: 3,
+			RetryOn:     []string{config.RetryOn5xx},
+		}), zap.NewNop())
+		defer sp.Close()
+
+		rr := httptest.NewRecorder()
+		sp.Handle(rr, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`)))
+
+		if rr.Code != http.StatusBadGateway || calls.Load() != 1 {
+			t.Errorf("got %d after %d calls, want 502 after 1", rr.Code, calls.Load())
+		}
+		if rr.Header().Get(AttemptsHeader) != "1" {
+			t.Errorf("%s = %q, want 1", AttemptsHeader, rr.Header().Get(AttemptsHeader))
+		}
+	})
+
+	t.Run("RetriedWithReplayedBodyWhenEnabled", func(t *testing.T) {
+		srv, calls, bodies := flakyBackend(t, 1, http.StatusBadGateway)
+		sp := mustSyncProxy(t, retryRoute(srv.URL, config.RetryConfig{
+			MaxAttempts:        3,
+			RetryOn:            []string{config.RetryOn5xx},
+			RetryNonIdempotent: true,
+		}), zap.NewNop())
+		defer sp.Close()
+
+		rr := httptest.NewRecorder()
+		sp.Handle(rr, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`)))
+
+		if rr.Code != http.StatusOK || calls.Load() != 2 {
+			t.Fatalf("got %d after %d calls, want 200 after 2", rr.Code, calls.Load())
+		}
+		for i, body := range *bodies {
+			if body != `{"id":1}` {
+				t.Errorf("attempt %d body = %q, want replayed body", i+1, body)
+			}
+		}
+	})
+}
+
+func TestSyncProxy_PerTryTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	sp := mustSyncProxy(t, retryRoute(srv.URL, config.RetryConfig{
+		MaxAttempts:     2,
+		RetryOn:         []string{config.RetryOnTimeout},
+		PerTryTimeoutMs: 50,
+	}), zap.NewNop())
+	defer sp.Close()
+
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if rr.Code != http.StatusOK || rr.Header().Get(AttemptsHeader) != "2" {
+		t.Errorf("got %d with %s=%q, want 200 after 2 attempts", rr.Code, AttemptsHeader, rr.Header().Get(AttemptsHeader))
+	}
+}
+
+func TestSyncProxy_RetriesConnectionFailures(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	backend := srv.URL
+	srv.Close()
+
+	sp := mustSyncProxy(t, retryRoute(backend, config.RetryConfig{
+		MaxAttempts: 3,
+		RetryOn:     []string{config.RetryOnConnectionFailure},
+	}), zap.NewNop())
+	defer sp.Close()
+
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/down", nil))
+
+	if rr.Code != http.StatusBadGateway || rr.Header().Get(AttemptsHeader) != "3" {
+		t.Errorf("got %d with %s=%q, want 502 after 3 attempts", rr.Code, AttemptsHeader, rr.Header().Get(AttemptsHeader))
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := newRetryPolicy(config.RetryConfig{MaxAttempts: 5, BackoffBaseMs: 10, BackoffMaxMs: 40})
+
+	for retry, ceiling := range map[int]time.Duration{1: 10, 2: 20, 3: 40, 4: 40} {
+		for i := 0; i < 50; i++ {
+			if d := p.backoff(retry); d < 0 || d > ceiling*time.Millisecond {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v]", retry, d, ceiling*time.Millisecond)
+			}
+		}
+	}
+}
@@ -3,7 +3,13 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/stratus-meridian/apx/router/internal/config"
@@ -11,29 +17,120 @@ import (
 	"github.com/stratus-meridian/apx/router/pkg/proxy"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
 )
 
 // SyncProxy handles synchronous HTTP proxying to backends
 type SyncProxy struct {
 	client    *proxy.Client
 	logger    *zap.Logger
-	backend   string // Backend URL (e.g., https://mocktarget.apigee.net)
-	pathStrip string // Path prefix to strip before proxying
+	backend   string      // Backend URL or pool name (e.g., https://mocktarget.apigee.net)
+	pool      *proxy.Pool // Endpoints behind the backend
+	pathStrip string      // Path prefix to strip before proxying
+	route     config.RouteConfig
+	retry     retryPolicy
+	breaker   *proxy.CircuitBreaker // nil when the route disables it
 }
 
+// breakers is shared by all sync proxies so breaker state survives route
+// reloads; RouteHolder.Swap drops the breakers of removed routes
+var breakers = proxy.NewBreakerRegistry()
+
+// writeGrace is the time allowed after the route timeout to write the response
+const writeGrace = 5 * time.Second
+
 // NewSyncProxy creates a new synchronous proxy handler
 func NewSyncProxy(backend string, pathStrip string, logger *zap.Logger) *SyncProxy {
-	// Create proxy client with default config
+	// A single-endpoint round-robin pool cannot fail to build
+	sp, _ := NewSyncProxyForRoute(config.RouteConfig{Backend: backend, PathStrip: pathStrip}, logger)
+	return sp
+}
+
+// NewSyncProxyForRoute creates a synchronous proxy handler for a route,
+// including its backend pool, retry policy and circuit breaker
+func NewSyncProxyForRoute(rc config.RouteConfig, logger *zap.Logger) (*SyncProxy, error) {
+	key := backendKey(rc)
+
+	endpoints := make([]proxy.EndpointConfig, 0, len(rc.Upstreams))
+	for _, u := range rc.Upstreams {
+		endpoints = append(endpoints, proxy.EndpointConfig{URL: u.URL, Weight: u.Weight})
+	}
+	if len(endpoints) == 0 {
+		endpoints = append(endpoints, proxy.EndpointConfig{URL: rc.Backend, Weight: 1})
+	}
+
+	pool, err := proxy.NewPool(proxy.PoolConfig{
+		Name:      key,
+		Strategy:  rc.LoadBalancing,
+		Endpoints: endpoints,
+		Ejection: proxy.EjectionConfig{
+			ConsecutiveFailures: rc.OutlierDetection.ConsecutiveFailures,
+			EjectionTime:        time.Duration(rc.OutlierDetection.EjectionTimeMs) * time.Millisecond,
+		},
+		HealthCheck: proxy.HealthCheckConfig{
+			Path:               rc.HealthCheck.Path,
+			Interval:           time.Duration(rc.HealthCheck.IntervalMs) * time.Millisecond,
+			Timeout:            time.Duration(rc.HealthCheck.TimeoutMs) * time.Millisecond,
+			UnhealthyThreshold: rc.HealthCheck.UnhealthyThreshold,
+			HealthyThreshold:   rc.HealthCheck.HealthyThreshold,
+		},
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend pool for route %s: %w", rc.Path, err)
+	}
+
+	// Create proxy client with default config; the request context carries
+	// the route timeout, so the transport must not cut responses off sooner
 	cfg := proxy.DefaultConfig()
+	cfg.ResponseHeaderTimeout = 0
+	cfg.UnencryptedHTTP2 = rc.Mode == "grpc"
 	client := proxy.NewClient(cfg, logger)
 
-	return &SyncProxy{
+	sp := &SyncProxy{
 		client:    client,
 		logger:    logger,
-		backend:   backend,
-		pathStrip: pathStrip,
+		backend:   key,
+		pool:      pool,
+		pathStrip: rc.PathStrip,
+		route:     rc,
+		retry:     newRetryPolicy(rc.Retries),
+	}
+
+	if rc.CircuitBreaker.Enabled {
+		sp.breaker = breakers.Get(routeKey(rc), key, proxy.BreakerConfig{
+			ErrorThreshold: rc.CircuitBreaker.ErrorThreshold,
+			OpenTimeout:    rc.CircuitBreaker.Timeout,
+		})
 	}
+
+	return sp, nil
+}
+
+// routeKey identifies a route across reloads: by name, or by host and path
+// for unnamed routes
+func routeKey(rc config.RouteConfig) string {
+	if rc.Name != "" {
+		return rc.Name
+	}
+	return rc.Host + rc.Path
+}
+
+// backendKey identifies a route's backend for circuit breaking and metrics:
+// the pool name if set, otherwise the backend URL(s)
+func backendKey(rc config.RouteConfig) string {
+	if rc.Pool != "" {
+		return rc.Pool
+	}
+	if len(rc.Upstreams) > 0 {
+		urls := make([]string, len(rc.Upstreams))
+		for i, u := range rc.Upstreams {
+			urls[i] = u.URL
+		}
+		return strings.Join(urls, ",")
+	}
+	return rc.Backend
 }
 
 // Handle processes the request synchronously
@@ -48,6 +145,7 @@ func (sp *SyncProxy) Handle(w http.ResponseWriter, r *http.Request) {
 	// Get request metadata from context
 	requestID := middleware.GetRequestID(ctx)
 	tenantID := middleware.GetTenantID(ctx)
+	timeout := sp.route.Timeout(middleware.GetTenantTier(ctx))
 
 	span.SetAttributes(
 		attribute.String("request.id", requestID),
@@ -55,8 +153,21 @@ func (sp *SyncProxy) Handle(w http.ResponseWriter, r *http.Request) {
 		attribute.String("backend.url", sp.backend),
 		attribute.String("http.method", r.Method),
 		attribute.String("http.path", r.URL.Path),
+		attribute.Int64("backend.timeout_ms", timeout.Milliseconds()),
 	)
 
+	// gRPC-Web CORS preflights are plain HTTP requests, answered by the
+	// backend
+	if sp.route.Mode == "grpc" && r.Method != http.MethodOptions {
+		sp.handleGRPC(ctx, w, r, timeout)
+		return
+	}
+
+	if proxy.IsUpgradeRequest(r) {
+		sp.handleUpgrade(ctx, w, r, timeout)
+		return
+	}
+
 	sp.logger.Info("proxying request synchronously",
 		zap.String("request_id", requestID),
 		zap.String("tenant_id", tenantID),
@@ -65,23 +176,78 @@ func (sp *SyncProxy) Handle(w http.ResponseWriter, r *http.Request) {
 		zap.String("backend", sp.backend),
 	)
 
-	// Add timeout to context (30 seconds default)
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	// The route timeout covers all attempts, including backoff
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Update request context
-	r = r.WithContext(ctx)
+	// The server's write timeout is fixed at startup, but routes (and their
+	// timeouts) can be reloaded; leave time to write the response or the 504
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeGrace))
 
-	// Proxy the request (with path stripping if configured)
+	// Buffer the body so it can be replayed if the request may be retried
+	maxAttempts := sp.retry.attemptsFor(r.Method)
+	var body []byte
+	if maxAttempts > 1 {
+		buffered, ok, err := bufferBody(r, maxRetryBodyBytes)
+		if err != nil {
+			sp.logger.Warn("failed to read request body",
+				zap.String("request_id", requestID),
+				zap.Error(err),
+			)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":      "invalid_request",
+				"message":    "Failed to read request body",
+				"request_id": requestID,
+			})
+			return
+		}
+		if !ok {
+			maxAttempts = 1
+		}
+		body = buffered
+	}
+
+	// Proxy the request (with path stripping if configured), retrying
+	// according to the route's retry policy
 	startTime := time.Now()
-	resp, err := sp.client.ProxyRequestWithPathStrip(ctx, r, sp.backend, sp.pathStrip)
+	resp, attempts, err := sp.roundTrip(ctx, r, body, maxAttempts, requestID)
 	duration := time.Since(startTime)
 
+	span.SetAttributes(attribute.Int("proxy.attempts", attempts))
+	w.Header().Set(AttemptsHeader, strconv.Itoa(attempts))
+
+	var openErr *proxy.CircuitOpenError
+	if errors.As(err, &openErr) {
+		span.SetAttributes(attribute.String("circuit_breaker.state", proxy.StateOpen.String()))
+		sp.logger.Warn("backend circuit open, failing fast",
+			zap.String("request_id", requestID),
+			zap.String("backend", sp.backend),
+			zap.Duration("retry_after", openErr.RetryAfter),
+		)
+		writeCircuitOpen(w, requestID, openErr)
+		return
+	}
+
+	if err != nil && isTimeout(err, ctx) {
+		span.RecordError(err)
+		sp.logger.Error("backend request timed out",
+			zap.String("request_id", requestID),
+			zap.Error(err),
+			zap.Int("attempts", attempts),
+			zap.Duration("timeout", timeout),
+		)
+		writeGatewayTimeout(w, requestID, timeout)
+		return
+	}
+
 	if err != nil {
 		span.RecordError(err)
 		sp.logger.Error("backend request failed",
 			zap.String("request_id", requestID),
 			zap.Error(err),
+			zap.Int("attempts", attempts),
 			zap.Duration("duration", duration),
 		)
 
@@ -106,17 +272,26 @@ func (sp *SyncProxy) Handle(w http.ResponseWriter, r *http.Request) {
 	sp.logger.Info("backend response received",
 		zap.String("request_id", requestID),
 		zap.Int("status_code", resp.StatusCode),
+		zap.Int("attempts", attempts),
 		zap.Duration("duration", duration),
 	)
 
 	// Copy response from backend to client
 	err = proxy.CopyResponse(w, resp)
 	if err != nil {
+		// Response already started, can't change status
+		if r.Context().Err() != nil {
+			sp.logger.Info("client disconnected during response",
+				zap.String("request_id", requestID),
+				zap.Error(err),
+			)
+			return
+		}
+		span.RecordError(err)
 		sp.logger.Error("failed to copy response",
 			zap.String("request_id", requestID),
 			zap.Error(err),
 		)
-		// Response already started, can't change status
 		return
 	}
 
@@ -126,49 +301,440 @@ func (sp *SyncProxy) Handle(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// handleUpgrade proxies a connection upgrade (e.g. WebSocket). The handshake
+// has already passed the middleware chain (tenant auth, rate limiting) and is
+// bounded by the route timeout; the upgraded session is not. Upgrades are
+// never retried.
+func (sp *SyncProxy) handleUpgrade(ctx context.Context, w http.ResponseWriter, r *http.Request, timeout time.Duration) {
+	span := trace.SpanFromContext(ctx)
+	requestID := middleware.GetRequestID(ctx)
+	tenantID := middleware.GetTenantID(ctx)
+
+	var done func(proxy.Outcome)
+	if sp.breaker != nil {
+		var err error
+		if done, err = sp.breaker.Allow(); err != nil {
+			var openErr *proxy.CircuitOpenError
+			if errors.As(err, &openErr) {
+				writeCircuitOpen(w, requestID, openErr)
+			}
+			return
+		}
+	}
+
+	endpoint := sp.pool.Pick(tenantID, nil)
+	defer sp.pool.Release(endpoint)
+
+	sp.logger.Info("proxying upgrade request",
+		zap.String("request_id", requestID),
+		zap.String("tenant_id", tenantID),
+		zap.String("protocol", r.Header.Get("Upgrade")),
+		zap.String("path", r.URL.Path),
+		zap.String("endpoint", endpoint.URL),
+	)
+
+	stats, err := sp.client.ProxyUpgrade(ctx, w, r, endpoint.URL, sp.pathStrip, timeout)
+
+	outcome := proxy.OutcomeSuccess
+	if stats.StatusCode == 0 || stats.StatusCode >= 500 {
+		outcome = proxy.OutcomeFailure
+	}
+	sp.pool.Report(endpoint, outcome)
+	if done != nil {
+		done(outcome)
+	}
+
+	if session := middleware.GetUpgradeSession(ctx); session != nil {
+		session.StatusCode = stats.StatusCode
+		session.BytesIn, session.BytesOut = stats.BytesIn, stats.BytesOut
+	}
+
+	span.SetAttributes(
+		attribute.String("backend.endpoint", endpoint.URL),
+		attribute.String("upgrade.protocol", stats.Protocol),
+		attribute.Int("http.status_code", stats.StatusCode),
+		attribute.Int64("upgrade.bytes_in", stats.BytesIn),
+		attribute.Int64("upgrade.bytes_out", stats.BytesOut),
+	)
+
+	if err != nil {
+		span.RecordError(err)
+		sp.logger.Error("backend upgrade failed",
+			zap.String("request_id", requestID),
+			zap.Int("status_code", stats.StatusCode),
+			zap.Error(err),
+		)
+		if stats.StatusCode != 0 {
+			// Part of the response has been sent already
+			return
+		}
+		if errors.Is(err, proxy.ErrHandshakeTimeout) {
+			writeGatewayTimeout(w, requestID, timeout)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      "backend_error",
+			"message":    "Failed to reach backend service",
+			"request_id": requestID,
+		})
+		return
+	}
+
+	sp.logger.Info("upgrade session closed",
+		zap.String("request_id", requestID),
+		zap.Int("status_code", stats.StatusCode),
+		zap.Int64("bytes_in", stats.BytesIn),
+		zap.Int64("bytes_out", stats.BytesOut),
+		zap.Duration("duration", stats.Duration),
+	)
+}
+
+// handleGRPC proxies a gRPC or gRPC-Web call. The route timeout, shortened
+// by the client's grpc-timeout, bounds the whole call including streams;
+// calls are never retried. Failures are reported to the client as gRPC
+// statuses rather than HTTP errors.
+func (sp *SyncProxy) handleGRPC(ctx context.Context, w http.ResponseWriter, r *http.Request, timeout time.Duration) {
+	span := trace.SpanFromContext(ctx)
+	requestID := middleware.GetRequestID(ctx)
+	tenantID := middleware.GetTenantID(ctx)
+
+	if !proxy.IsGRPCRequest(r) && !proxy.IsGRPCWebRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      "unsupported_media_type",
+			"message":    "This route only accepts gRPC and gRPC-Web calls",
+			"request_id": requestID,
+		})
+		return
+	}
+
+	if clientTimeout, ok := proxy.GRPCTimeout(r.Header); ok && clientTimeout < timeout {
+		timeout = clientTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var done func(proxy.Outcome)
+	if sp.breaker != nil {
+		var err error
+		if done, err = sp.breaker.Allow(); err != nil {
+			var openErr *proxy.CircuitOpenError
+			if errors.As(err, &openErr) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+			}
+			proxy.WriteGRPCError(w, r, codes.Unavailable, "backend service is temporarily unavailable")
+			sp.recordGRPCCall(ctx, codes.Unavailable, "circuit open")
+			return
+		}
+	}
+
+	endpoint := sp.pool.Pick(tenantID, nil)
+	defer sp.pool.Release(endpoint)
+
+	sp.logger.Info("proxying grpc call",
+		zap.String("request_id", requestID),
+		zap.String("tenant_id", tenantID),
+		zap.String("path", r.URL.Path),
+		zap.String("endpoint", endpoint.URL),
+	)
+
+	startTime := time.Now()
+	result, err := sp.client.ProxyGRPC(ctx, w, r, endpoint.URL, sp.pathStrip)
+	duration := time.Since(startTime)
+
+	// Application errors are successes as far as the backend's health goes
+	outcome := proxy.OutcomeSuccess
+	switch {
+	case result.Code == codes.Canceled:
+		outcome = proxy.OutcomeIgnored
+	case result.StatusCode == 0, result.StatusCode >= 500,
+		result.Code == codes.Unavailable, result.Code == codes.DeadlineExceeded:
+		outcome = proxy.OutcomeFailure
+	}
+	sp.pool.Report(endpoint, outcome)
+	if done != nil {
+		done(outcome)
+	}
+
+	span.SetAttributes(
+		attribute.String("backend.endpoint", endpoint.URL),
+		attribute.Bool("rpc.grpc_web", result.Web),
+		attribute.Int("rpc.grpc.status_code", int(result.Code)),
+		attribute.Int64("backend.duration_ms", duration.Milliseconds()),
+	)
+
+	if err != nil {
+		span.RecordError(err)
+		sp.logger.Error("backend grpc call failed",
+			zap.String("request_id", requestID),
+			zap.String("grpc_status", result.Code.String()),
+			zap.Duration("duration", duration),
+			zap.Error(err),
+		)
+		if result.StatusCode == 0 {
+			proxy.WriteGRPCError(w, r, result.Code, "failed to reach backend service")
+		}
+		sp.recordGRPCCall(ctx, result.Code, err.Error())
+		return
+	}
+
+	sp.recordGRPCCall(ctx, result.Code, result.Message)
+	sp.logger.Info("grpc call completed",
+		zap.String("request_id", requestID),
+		zap.String("grpc_status", result.Code.String()),
+		zap.Duration("duration", duration),
+	)
+}
+
+// recordGRPCCall hands the outcome of a gRPC call to the middleware chain
+func (sp *SyncProxy) recordGRPCCall(ctx context.Context, code codes.Code, message string) {
+	if call := middleware.GetGRPCCall(ctx); call != nil {
+		call.Route = sp.route.Path
+		call.Code, call.Message, call.Done = code, message, true
+	}
+}
+
+// roundTrip sends the request to the backend up to maxAttempts times, backing
+// off between attempts. The returned response body stays valid until it is
+// closed, even when a per-try timeout applies. It also returns the number of
+// attempts made.
+func (sp *SyncProxy) roundTrip(ctx context.Context, r *http.Request, body []byte, maxAttempts int, requestID string) (*http.Response, int, error) {
+	span := trace.SpanFromContext(ctx)
+
+	// Consistent hashing keeps a tenant on the same endpoint
+	tenantID := middleware.GetTenantID(ctx)
+
+	var previous *proxy.Endpoint
+	for attempt := 1; ; attempt++ {
+		tryCtx, cancelTry := ctx, context.CancelFunc(func() {})
+		if sp.retry.perTryTimeout > 0 {
+			tryCtx, cancelTry = context.WithTimeout(ctx, sp.retry.perTryTimeout)
+		}
+
+		var done func(proxy.Outcome)
+		if sp.breaker != nil {
+			var err error
+			if done, err = sp.breaker.Allow(); err != nil {
+				cancelTry()
+				return nil, attempt - 1, err
+			}
+		}
+
+		endpoint := sp.pool.Pick(tenantID, previous)
+		previous = endpoint
+		resp, err := sp.client.ProxyRequestWithPathStrip(tryCtx, withBody(r, body), endpoint.URL, sp.pathStrip)
+
+		reason := retryReason(resp, err, tryCtx)
+		outcome := breakerOutcome(ctx, reason)
+		sp.pool.Report(endpoint, outcome)
+		if done != nil {
+			done(outcome)
+		}
+		if reason == "" || !sp.retry.retryOn[reason] || attempt >= maxAttempts || ctx.Err() != nil {
+			span.SetAttributes(attribute.String("backend.endpoint", endpoint.URL))
+			if resp != nil {
+				// Keep the per-try context and the endpoint's in-flight count
+				// until the body has been read
+				respBody := resp.Body
+				var once sync.Once
+				resp.Body = readCloser{respBody, closerFunc(func() (err error) {
+					once.Do(func() {
+						defer sp.pool.Release(endpoint)
+						defer cancelTry()
+						err = respBody.Close()
+					})
+					return err
+				})}
+			} else {
+				sp.pool.Release(endpoint)
+				cancelTry()
+			}
+			return resp, attempt, err
+		}
+
+		delay := sp.retry.backoff(attempt)
+		fields := []zap.Field{
+			zap.String("request_id", requestID),
+			zap.String("endpoint", endpoint.URL),
+			zap.Int("attempt", attempt),
+			zap.String("reason", reason),
+			zap.Duration("backoff", delay),
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		} else {
+			fields = append(fields, zap.Int("status_code", resp.StatusCode))
+		}
+		sp.logger.Warn("retrying backend request", fields...)
+		span.AddEvent("proxy.retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("endpoint", endpoint.URL),
+			attribute.String("reason", reason),
+			attribute.Int64("backoff_ms", delay.Milliseconds()),
+		))
+
+		drain(resp)
+		sp.pool.Release(endpoint)
+		cancelTry()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		}
+	}
+}
+
+// breakerOutcome maps an attempt's retry classification onto a circuit
+// breaker outcome. Attempts abandoned by the client do not count.
+func breakerOutcome(ctx context.Context, reason string) proxy.Outcome {
+	switch {
+	case reason == "":
+		return proxy.OutcomeSuccess
+	case errors.Is(ctx.Err(), context.Canceled):
+		return proxy.OutcomeIgnored
+	default:
+		return proxy.OutcomeFailure
+	}
+}
+
+// writeCircuitOpen writes the 503 returned while a backend's circuit is open
+func writeCircuitOpen(w http.ResponseWriter, requestID string, openErr *proxy.CircuitOpenError) {
+	retryAfter := int(math.Ceil(openErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":       "circuit_open",
+		"message":     "Backend service is temporarily unavailable",
+		"retry_after": retryAfter,
+		"request_id":  requestID,
+	})
+}
+
+// writeGatewayTimeout writes the 504 returned when the backend does not
+// respond within the route timeout
+func writeGatewayTimeout(w http.ResponseWriter, requestID string, timeout time.Duration) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "gateway_timeout",
+		"message":    "Backend service did not respond in time",
+		"timeout_ms": timeout.Milliseconds(),
+		"request_id": requestID,
+	})
+}
+
 // Close cleans up resources
 func (sp *SyncProxy) Close() error {
+	sp.pool.Close()
 	return sp.client.Close()
 }
 
 // SyncProxyMulti handles multiple backend routes
 type SyncProxyMulti struct {
-	routes map[string]*SyncProxy // path -> proxy
-	logger *zap.Logger
+	table   *RouteTable
+	proxies map[*Route]*SyncProxy // sync route -> proxy
+	logger  *zap.Logger
 }
 
-// NewSyncProxyMulti creates a multi-route proxy
+// NewSyncProxyMulti creates a multi-route proxy.
+// All routes are compiled into the route table so that method filtering and
+// precedence apply uniformly; only sync and grpc routes get a backend proxy.
+// Routes with invalid path patterns are logged and skipped.
 func NewSyncProxyMulti(routes []config.RouteConfig, logger *zap.Logger) *SyncProxyMulti {
-	proxies := make(map[string]*SyncProxy)
+	table := newRouteTable()
+	proxies := make(map[*Route]*SyncProxy)
 
-	for _, route := range routes {
-		if route.Mode == "sync" {
-			proxy := NewSyncProxy(route.Backend, route.PathStrip, logger)
-			proxies[route.Path] = proxy
+	for _, rc := range routes {
+		var sp *SyncProxy
+		if rc.Mode == "sync" || rc.Mode == "grpc" {
+			var err error
+			if sp, err = NewSyncProxyForRoute(rc, logger); err != nil {
+				logger.Error("skipping invalid route",
+					zap.String("path", rc.Path),
+					zap.Error(err),
+				)
+				continue
+			}
+		}
+
+		route, err := table.Add(rc)
+		if err != nil {
+			logger.Error("skipping invalid route",
+				zap.String("path", rc.Path),
+				zap.Error(err),
+			)
+			if sp != nil {
+				sp.Close()
+			}
+			continue
+		}
+
+		if sp != nil {
+			proxies[route] = sp
 			logger.Info("registered sync route",
-				zap.String("path", route.Path),
-				zap.String("backend", route.Backend),
-				zap.String("path_strip", route.PathStrip),
+				zap.String("path", rc.Path),
+				zap.String("mode", rc.Mode),
+				zap.String("host", rc.Host),
+				zap.String("backend", sp.backend),
+				zap.Int("endpoints", len(sp.pool.Endpoints())),
+				zap.String("load_balancing", rc.LoadBalancing),
+				zap.String("path_strip", rc.PathStrip),
+				zap.Strings("methods", rc.Methods),
+				zap.Int("max_attempts", rc.Retries.MaxAttempts),
 			)
 		}
 	}
 
 	return &SyncProxyMulti{
-		routes: proxies,
-		logger: logger,
+		table:   table,
+		proxies: proxies,
+		logger:  logger,
 	}
 }
 
-// GetProxy returns the proxy for a given path
+// Table returns the route table backing this proxy
+func (spm *SyncProxyMulti) Table() *RouteTable {
+	return spm.table
+}
+
+// circuitBreakers returns the circuit breakers of the routes
+func (spm *SyncProxyMulti) circuitBreakers() []*proxy.CircuitBreaker {
+	var cbs []*proxy.CircuitBreaker
+	for _, sp := range spm.proxies {
+		if sp.breaker != nil {
+			cbs = append(cbs, sp.breaker)
+		}
+	}
+	return cbs
+}
+
+// GetProxy returns the proxy for a given route path pattern
 func (spm *SyncProxyMulti) GetProxy(path string) (*SyncProxy, bool) {
-	proxy, ok := spm.routes[path]
-	return proxy, ok
+	for _, route := range spm.table.Routes() {
+		if route.Config.Path == path {
+			if proxy, ok := spm.proxies[route]; ok {
+				return proxy, true
+			}
+		}
+	}
+	return nil, false
 }
 
 // Close cleans up all proxies
 func (spm *SyncProxyMulti) Close() error {
 	var lastErr error
-	for _, proxy := range spm.routes {
+	for _, proxy := range spm.proxies {
 		if err := proxy.Close(); err != nil {
 			lastErr = err
 		}
@@ -176,30 +742,52 @@ func (spm *SyncProxyMulti) Close() error {
 	return lastErr
 }
 
-// HandleWithFallback tries sync proxy first, falls back to async
+// HandleWithFallback tries sync proxy first, falls back to async.
+// Requests are resolved through the route table: sync and grpc routes are
+// proxied directly, async routes and unmatched requests go to asyncHandler, and
+// requests that match only routes with other methods get a 405. Host, header
+// and query criteria take part in route selection.
 func (spm *SyncProxyMulti) HandleWithFallback(asyncHandler http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Try to find a sync proxy for this path
-		// Look for exact match or prefix match
-		for path, proxy := range spm.routes {
-			if r.URL.Path == path || matchesPrefix(r.URL.Path, path) {
-				// Handle synchronously
-				proxy.Handle(w, r)
-				return
-			}
+		spm.serve(w, r, asyncHandler)
+	}
+}
+
+// serve resolves a request through the route table, see HandleWithFallback
+func (spm *SyncProxyMulti) serve(w http.ResponseWriter, r *http.Request, asyncHandler http.Handler) {
+	match, err := spm.table.matchRequest(r)
+	if err != nil {
+		var methodErr *MethodNotAllowedError
+		if errors.As(err, &methodErr) {
+			writeMethodNotAllowed(w, r, methodErr)
+			return
 		}
 
-		// Fall back to async handler
+		// No configured route, fall back to async handler
 		asyncHandler.ServeHTTP(w, r)
+		return
 	}
-}
 
-// matchesPrefix checks if reqPath matches routePath pattern
-// Supports wildcards like /mock/** matching /mock/anything
-func matchesPrefix(reqPath, routePath string) bool {
-	if len(routePath) > 2 && routePath[len(routePath)-2:] == "**" {
-		prefix := routePath[:len(routePath)-2]
-		return len(reqPath) >= len(prefix) && reqPath[:len(prefix)] == prefix
+	if proxy, ok := spm.proxies[match.Route]; ok {
+		// Handle synchronously
+		proxy.Handle(w, r)
+		return
 	}
-	return reqPath == routePath
+
+	// Fall back to async handler
+	asyncHandler.ServeHTTP(w, r)
+}
+
+// writeMethodNotAllowed writes a 405 response listing the allowed methods
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, err *MethodNotAllowedError) {
+	w.Header().Set("Allow", strings.Join(err.Allowed, ", "))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "method_not_allowed",
+		"message":    fmt.Sprintf("Method %s is not allowed for this route", r.Method),
+		"allowed":    err.Allowed,
+		"path":       r.URL.Path,
+		"request_id": middleware.GetRequestID(r.Context()),
+	})
 }
@@ -0,0 +1,308 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stratus-meridian/apx/router/internal/config"
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"github.com/stratus-meridian/apx/router/internal/middleware"
+	"github.com/stratus-meridian/apx/router/pkg/proxy"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func mustSyncProxy(t *testing.T, rc config.RouteConfig, logger *zap.Logger) *SyncProxy {
+	t.Helper()
+	sp, err := NewSyncProxyForRoute(rc, logger)
+	if err != nil {
+		t.Fatalf("NewSyncProxyForRoute() error: %v", err)
+	}
+	return sp
+}
+
+func TestSyncProxy_CircuitBreakerFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sp := mustSyncProxy(t, config.RouteConfig{
+		Path:    "/**",
+		Backend: srv.URL,
+		Mode:    "sync",
+		CircuitBreaker: config.CircuitBreakerConfig{
+			Enabled:        true,
+			ErrorThreshold: 2,
+			Timeout:        90 * time.Second,
+		},
+	}, zap.NewNop())
+	defer sp.Close()
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("request %d: got %d, want backend 500", i+1, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503 once the circuit is open", rr.Code)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("backend calls = %d, want 2 (open circuit must not reach the backend)", calls.Load())
+	}
+	if rr.Header().Get("Retry-After") != "90" {
+		t.Errorf("Retry-After = %q, want 90", rr.Header().Get("Retry-After"))
+	}
+	if rr.Header().Get(AttemptsHeader) != "0" {
+		t.Errorf("%s = %q, want 0", AttemptsHeader, rr.Header().Get(AttemptsHeader))
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if body["error"] != "circuit_open" || body["retry_after"] != float64(90) {
+		t.Errorf("unexpected body: %v", body)
+	}
+}
+
+func TestSyncProxy_RetriesOnAnotherUpstream(t *testing.T) {
+	var downCalls atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer up.Close()
+
+	rc := config.RouteConfig{
+		Path:      "/**",
+		Mode:      "sync",
+		Upstreams: []config.UpstreamConfig{{URL: down.URL}, {URL: up.URL}},
+		Retries: config.RetryConfig{
+			MaxAttempts:   2,
+			BackoffBaseMs: 1,
+			BackoffMaxMs:  2,
+		},
+		OutlierDetection: config.OutlierDetectionConfig{ConsecutiveFailures: 1},
+	}
+	if err := config.NormalizeRoute(&rc); err != nil {
+		t.Fatalf("NormalizeRoute() error: %v", err)
+	}
+	sp := mustSyncProxy(t, rc, zap.NewNop())
+	defer sp.Close()
+
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		sp.Handle(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+			t.Fatalf("request %d: got %d %q, want 200 ok", i+1, rr.Code, rr.Body.String())
+		}
+	}
+
+	// The failing upstream is ejected after its first failure
+	if downCalls.Load() != 1 {
+		t.Errorf("failing upstream calls = %d, want 1", downCalls.Load())
+	}
+	if !strings.Contains(sp.backend, up.URL) {
+		t.Errorf("backend key = %q, want it to name the upstreams", sp.backend)
+	}
+}
+
+func TestNewSyncProxyForRoute_InvalidPool(t *testing.T) {
+	_, err := NewSyncProxyForRoute(config.RouteConfig{
+		Path:          "/**",
+		Backend:       "http://backend.test",
+		LoadBalancing: "random",
+	}, zap.NewNop())
+	if err == nil {
+		t.Fatal("expected an error for an unknown load balancing strategy")
+	}
+}
+
+func TestSyncProxy_TimeoutReturns504(t *testing.T) {
+	deadlines := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadlines <- r.Header.Get(proxy.DeadlineHeader)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	// The free tier caps the route timeout
+	prev := config.TierTimeouts["free"]
+	config.TierTimeouts["free"] = 50 * time.Millisecond
+	t.Cleanup(func() { config.TierTimeouts["free"] = prev })
+
+	sp := mustSyncProxy(t, config.RouteConfig{Path: "/**", Backend: srv.URL, Mode: "sync", TimeoutMs: 5000}, zap.NewNop())
+	defer sp.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set(proxy.DeadlineHeader, "999999")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.TenantTierKey, "free"))
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("got %d, want 504", rr.Code)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if body["error"] != "gateway_timeout" || body["timeout_ms"] != float64(50) {
+		t.Errorf("unexpected body: %v", body)
+	}
+
+	if ms, err := strconv.Atoi(<-deadlines); err != nil || ms <= 0 || ms > 50 {
+		t.Errorf("%s = %d (%v), want the remaining budget of at most 50ms", proxy.DeadlineHeader, ms, err)
+	}
+}
+
+func TestRouteConfig_Timeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeoutMs int
+		tier      string
+		want      time.Duration
+	}{
+		{"tier default", 0, "pro", 60 * time.Second},
+		{"global default", 0, "", config.DefaultTimeout},
+		{"route timeout below tier", 5000, "enterprise", 5 * time.Second},
+		{"route timeout capped by tier", 90000, "free", 30 * time.Second},
+		{"route timeout without tier", 90000, "", 90 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (config.RouteConfig{TimeoutMs: tt.timeoutMs}).Timeout(tt.tier); got != tt.want {
+				t.Errorf("Timeout(%q) = %v, want %v", tt.tier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncProxy_GRPCRoute(t *testing.T) {
+	// Nothing listens on the backend port
+	rc := config.RouteConfig{Path: "/orders.v1.Orders/*", Backend: "http://127.0.0.1:1", Mode: "grpc"}
+	if err := config.NormalizeRoute(&rc); err != nil {
+		t.Fatalf("NormalizeRoute() error: %v", err)
+	}
+	if strings.Join(rc.Methods, ",") != "POST,OPTIONS" {
+		t.Errorf("Methods = %v, want POST and OPTIONS", rc.Methods)
+	}
+	sp := mustSyncProxy(t, rc, zap.NewNop())
+	defer sp.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	handler := middleware.Chain(http.HandlerFunc(sp.Handle), middleware.Metrics(), middleware.Logging(zap.New(core)))
+	calls := metrics.GRPCRequests.WithLabelValues("/orders.v1.Orders/*", "Unavailable", "free")
+	before := testutil.ToFloat64(calls)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders.v1.Orders/GetOrder", nil)
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Grpc-Status") != "14" {
+		t.Fatalf("got %d grpc-status %q, want 200 with UNAVAILABLE", rr.Code, rr.Header().Get("Grpc-Status"))
+	}
+	entries := logs.FilterMessage("http request").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d request logs, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["grpc_status"] != "Unavailable" || fields["grpc_service"] != "orders.v1.Orders" || fields["grpc_method"] != "GetOrder" {
+		t.Errorf("unexpected grpc log fields: %v", fields)
+	}
+	// Calls are counted by route, whatever method the client named
+	if got := testutil.ToFloat64(calls) - before; got != 1 {
+		t.Errorf("apx_grpc_requests_total for the route rose by %v, want 1", got)
+	}
+
+	// Plain HTTP requests are not proxied to gRPC backends
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/orders.v1.Orders/GetOrder", strings.NewReader("{}")))
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("got %d, want 415 for a non-gRPC request", rr.Code)
+	}
+}
+
+// TestSyncProxy_GRPCPreflight tests that CORS preflights of gRPC-Web clients
+// are forwarded to the backend
+func TestSyncProxy_GRPCPreflight(t *testing.T) {
+	// gRPC backends are reached over h2c
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Origin", "https://app.example.com")
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+
+	rc := config.RouteConfig{Path: "/orders.v1.Orders/*", Backend: backend.URL, Mode: "grpc"}
+	if err := config.NormalizeRoute(&rc); err != nil {
+		t.Fatalf("NormalizeRoute() error: %v", err)
+	}
+	sp := mustSyncProxy(t, rc, zap.NewNop())
+	defer sp.Close()
+
+	req := httptest.NewRequest(http.MethodOptions, "/orders.v1.Orders/GetOrder", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	sp.Handle(rr, req)
+
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("got %d %v, want the backend's 204 preflight response", rr.Code, rr.Header())
+	}
+}
+
+// TestSyncProxy_WriteDeadline tests that a route timeout longer than the
+// server's write timeout is not cut short by it
+func TestSyncProxy_WriteDeadline(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	sp := mustSyncProxy(t, config.RouteConfig{Path: "/**", Backend: backend.URL, Mode: "sync", TimeoutMs: 2000}, zap.NewNop())
+	defer sp.Close()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(sp.Handle))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/slow")
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "done" {
+		t.Errorf("got %d %q, want 200 \"done\"", resp.StatusCode, body)
+	}
+}
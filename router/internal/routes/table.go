@@ -0,0 +1,422 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/stratus-meridian/apx/router/internal/config"
+)
+
+// ErrNoRoute is returned when no configured route matches the request path
+var ErrNoRoute = errors.New("no route matches request")
+
+// MethodNotAllowedError is returned when one or more routes match the request
+// path but none of them accept the request method
+type MethodNotAllowedError struct {
+	Method  string
+	Path    string
+	Allowed []string
+}
+
+func (e *MethodNotAllowedError) Error() string {
+	return fmt.Sprintf("method %s not allowed for %s (allowed: %s)",
+		e.Method, e.Path, strings.Join(e.Allowed, ", "))
+}
+
+// Route is a compiled route table entry
+type Route struct {
+	Config config.RouteConfig
+
+	methods map[string]bool // empty means all methods
+	params  map[int]string  // segment index -> {param} name
+}
+
+// AllowsMethod reports whether the route accepts the given HTTP method.
+// Routes that accept GET also accept HEAD.
+func (rt *Route) AllowsMethod(method string) bool {
+	if len(rt.methods) == 0 {
+		return true
+	}
+	method = strings.ToUpper(method)
+	return rt.methods[method] || method == http.MethodHead && rt.methods[http.MethodGet]
+}
+
+// MatchesCriteria reports whether the request satisfies the route's header
+// and query parameter requirements. Host matching is handled by the table.
+func (rt *Route) MatchesCriteria(r *http.Request) bool {
+	for name, want := range rt.Config.Headers {
+		values := r.Header.Values(name)
+		if !matchesAnyValue(values, want) {
+			return false
+		}
+	}
+
+	if len(rt.Config.QueryParams) > 0 {
+		query := r.URL.Query()
+		for name, want := range rt.Config.QueryParams {
+			if !matchesAnyValue(query[name], want) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// hasCriteria reports whether the route constrains anything besides path and method
+func (rt *Route) hasCriteria() bool {
+	return rt.Config.Host != "" || len(rt.Config.Headers) > 0 || len(rt.Config.QueryParams) > 0
+}
+
+// specificity ranks routes sharing the same path pattern; routes with more
+// header and query constraints are tried first
+func (rt *Route) specificity() int {
+	return len(rt.Config.Headers) + len(rt.Config.QueryParams)
+}
+
+// matchesAnyValue reports whether one of values satisfies want ("*" = present)
+func matchesAnyValue(values []string, want string) bool {
+	for _, v := range values {
+		if want == "*" || v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteMatch is the result of a successful route lookup
+type RouteMatch struct {
+	Route  *Route
+	Params map[string]string
+}
+
+// routeNode is a single path segment in the route trie
+type routeNode struct {
+	static map[string]*routeNode
+	param  *routeNode
+	exact  []*Route // routes whose pattern ends at this node
+	glob   []*Route // routes whose pattern ends with /** below this node
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{static: make(map[string]*routeNode)}
+}
+
+// insertCandidate adds a route to a candidate list, keeping more specific routes first
+// and preserving configuration order among equally specific routes
+func insertCandidate(candidates []*Route, route *Route) []*Route {
+	i := len(candidates)
+	for i > 0 && candidates[i-1].specificity() < route.specificity() {
+		i--
+	}
+	candidates = append(candidates, nil)
+	copy(candidates[i+1:], candidates[i:])
+	candidates[i] = route
+	return candidates
+}
+
+// wildcardHost is the trie for a *.example.com host pattern
+type wildcardHost struct {
+	suffix string // ".example.com"
+	root   *routeNode
+}
+
+// RouteTable is a segment trie over the configured routes.
+//
+// Patterns support exact segments, {param} segments and a trailing ** glob
+// that matches zero or more remaining segments. Lookups are deterministic:
+// at every segment a static match beats a {param} match, which beats a glob,
+// so the most specific (longest) pattern always wins. Routes registered with
+// the same pattern are tried by descending header/query specificity, then in
+// configuration order.
+//
+// Routes with a host are kept in separate tries. A request is matched against
+// the exact host first, then wildcard hosts (longest suffix first), and
+// finally the routes without a host constraint.
+type RouteTable struct {
+	root      *routeNode            // routes without a host constraint
+	hosts     map[string]*routeNode // exact host -> trie
+	wildcards []*wildcardHost       // wildcard hosts, longest suffix first
+	routes    []*Route
+}
+
+// NewRouteTable compiles route configurations into a route table
+func NewRouteTable(routes []config.RouteConfig) (*RouteTable, error) {
+	t := newRouteTable()
+	for _, rc := range routes {
+		if _, err := t.Add(rc); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func newRouteTable() *RouteTable {
+	return &RouteTable{
+		root:  newRouteNode(),
+		hosts: make(map[string]*routeNode),
+	}
+}
+
+// trieFor returns the trie for a host pattern, creating it if needed
+func (t *RouteTable) trieFor(host string) *routeNode {
+	host = strings.ToLower(host)
+	switch {
+	case host == "":
+		return t.root
+
+	case strings.HasPrefix(host, "*."):
+		suffix := host[1:]
+		for _, wc := range t.wildcards {
+			if wc.suffix == suffix {
+				return wc.root
+			}
+		}
+		wc := &wildcardHost{suffix: suffix, root: newRouteNode()}
+		t.wildcards = append(t.wildcards, wc)
+		sort.SliceStable(t.wildcards, func(i, j int) bool {
+			return len(t.wildcards[i].suffix) > len(t.wildcards[j].suffix)
+		})
+		return wc.root
+
+	default:
+		node, ok := t.hosts[host]
+		if !ok {
+			node = newRouteNode()
+			t.hosts[host] = node
+		}
+		return node
+	}
+}
+
+// triesForHost returns the tries to search for a request host, in priority order
+func (t *RouteTable) triesForHost(host string) []*routeNode {
+	var tries []*routeNode
+	if host != "" {
+		if node, ok := t.hosts[host]; ok {
+			tries = append(tries, node)
+		}
+		for _, wc := range t.wildcards {
+			if strings.HasSuffix(host, wc.suffix) && len(host) > len(wc.suffix) {
+				tries = append(tries, wc.root)
+			}
+		}
+	}
+	return append(tries, t.root)
+}
+
+// Add compiles a single route and inserts it into the table
+func (t *RouteTable) Add(rc config.RouteConfig) (*Route, error) {
+	if !strings.HasPrefix(rc.Path, "/") {
+		return nil, fmt.Errorf("invalid route path %q: must start with /", rc.Path)
+	}
+	if strings.Contains(rc.Host, "*") && (!strings.HasPrefix(rc.Host, "*.") || strings.Count(rc.Host, "*") != 1) {
+		return nil, fmt.Errorf("invalid route host %q: wildcards must be of the form *.example.com", rc.Host)
+	}
+	segments := splitPath(rc.Path)
+
+	route := &Route{
+		Config:  rc,
+		methods: make(map[string]bool, len(rc.Methods)),
+		params:  make(map[int]string),
+	}
+	for _, m := range rc.Methods {
+		route.methods[strings.ToUpper(strings.TrimSpace(m))] = true
+	}
+
+	node := t.trieFor(rc.Host)
+	for i, seg := range segments {
+		switch {
+		case seg == "**":
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("invalid route path %q: ** is only allowed as the last segment", rc.Path)
+			}
+			node.glob = insertCandidate(node.glob, route)
+			t.routes = append(t.routes, route)
+			return route, nil
+
+		case strings.Contains(seg, "*"):
+			return nil, fmt.Errorf("invalid route path %q: unsupported wildcard segment %q", rc.Path, seg)
+
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			name := seg[1 : len(seg)-1]
+			if name == "" {
+				return nil, fmt.Errorf("invalid route path %q: empty parameter name", rc.Path)
+			}
+			route.params[i] = name
+			if node.param == nil {
+				node.param = newRouteNode()
+			}
+			node = node.param
+
+		default:
+			child, ok := node.static[seg]
+			if !ok {
+				child = newRouteNode()
+				node.static[seg] = child
+			}
+			node = child
+		}
+	}
+
+	node.exact = insertCandidate(node.exact, route)
+	t.routes = append(t.routes, route)
+	return route, nil
+}
+
+// Routes returns all compiled routes in configuration order
+func (t *RouteTable) Routes() []*Route {
+	routes := make([]*Route, len(t.routes))
+	copy(routes, t.routes)
+	return routes
+}
+
+// Len returns the number of routes in the table
+func (t *RouteTable) Len() int {
+	return len(t.routes)
+}
+
+// Match returns the most specific route for the given method and path.
+// Only routes without host, header or query criteria are considered, since
+// those cannot be evaluated without the request; use MatchRequest instead.
+// It returns ErrNoRoute when nothing matches the path, and a
+// *MethodNotAllowedError when the path matches but the method does not.
+func (t *RouteTable) Match(method, path string) (*RouteMatch, error) {
+	return t.match(method, path, []*routeNode{t.root}, func(rt *Route) bool {
+		return !rt.hasCriteria()
+	})
+}
+
+// MatchRequest returns the most specific route for the request, taking the
+// Host header, request headers and query parameters into account.
+// Errors are the same as for Match.
+func (t *RouteTable) MatchRequest(r *http.Request) (*RouteMatch, error) {
+	return t.match(r.Method, r.URL.Path, t.triesForHost(requestHost(r)), func(rt *Route) bool {
+		return rt.MatchesCriteria(r)
+	})
+}
+
+// match searches the given tries in order and returns the first route that
+// satisfies the criteria predicate and accepts the method
+func (t *RouteTable) match(method, path string, tries []*routeNode, criteria func(*Route) bool) (*RouteMatch, error) {
+	segments := splitPath(path)
+
+	var pathMatched []*Route
+	pick := func(candidates []*Route) *Route {
+		for _, rt := range candidates {
+			if !criteria(rt) {
+				continue
+			}
+			if rt.AllowsMethod(method) {
+				return rt
+			}
+			pathMatched = append(pathMatched, rt)
+		}
+		return nil
+	}
+
+	for _, root := range tries {
+		if route := root.lookup(segments, 0, pick); route != nil {
+			return &RouteMatch{Route: route, Params: route.extractParams(segments)}, nil
+		}
+	}
+
+	if len(pathMatched) > 0 {
+		return nil, &MethodNotAllowedError{
+			Method:  method,
+			Path:    path,
+			Allowed: allowedMethods(pathMatched),
+		}
+	}
+
+	return nil, ErrNoRoute
+}
+
+// lookup walks the trie depth-first in priority order (static, param, glob)
+// and returns the first candidate accepted by pick
+func (n *routeNode) lookup(segments []string, depth int, pick func([]*Route) *Route) *Route {
+	if depth == len(segments) {
+		if rt := pick(n.exact); rt != nil {
+			return rt
+		}
+		return pick(n.glob)
+	}
+
+	seg := segments[depth]
+	if child, ok := n.static[seg]; ok {
+		if rt := child.lookup(segments, depth+1, pick); rt != nil {
+			return rt
+		}
+	}
+
+	if n.param != nil {
+		if rt := n.param.lookup(segments, depth+1, pick); rt != nil {
+			return rt
+		}
+	}
+
+	return pick(n.glob)
+}
+
+// extractParams maps {param} segments of the route onto the request path
+func (rt *Route) extractParams(segments []string) map[string]string {
+	if len(rt.params) == 0 {
+		return nil
+	}
+
+	params := make(map[string]string, len(rt.params))
+	for i, name := range rt.params {
+		if i < len(segments) {
+			params[name] = segments[i]
+		}
+	}
+	return params
+}
+
+// allowedMethods collects the distinct methods accepted by the given routes,
+// including the HEAD implied by GET
+func allowedMethods(routes []*Route) []string {
+	seen := make(map[string]bool)
+	var allowed []string
+	add := func(m string) {
+		if !seen[m] {
+			seen[m] = true
+			allowed = append(allowed, m)
+		}
+	}
+	for _, rt := range routes {
+		for m := range rt.methods {
+			add(m)
+			if m == http.MethodGet {
+				add(http.MethodHead)
+			}
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// requestHost returns the lower-cased request host without port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// splitPath splits a URL path into non-empty segments
+func splitPath(path string) []string {
+	parts := strings.Split(path, "/")
+	segments := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			segments = append(segments, p)
+		}
+	}
+	return segments
+}
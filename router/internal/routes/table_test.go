@@ -0,0 +1,333 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stratus-meridian/apx/router/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestRouteTable_Precedence(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/api/**", Backend: "http://api", Mode: "sync"},
+		{Path: "/api/v2/**", Backend: "http://api-v2", Mode: "sync"},
+		{Path: "/api/v2/users/{id}", Backend: "http://users", Mode: "sync"},
+		{Path: "/api/v2/users/me", Backend: "http://me", Mode: "sync"},
+		{Path: "/health", Backend: "http://health", Mode: "sync"},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		wantBackend string
+	}{
+		{"/api/v1/anything", "http://api"},
+		{"/api", "http://api"},
+		{"/api/v2", "http://api-v2"},
+		{"/api/v2/orders/42", "http://api-v2"},
+		{"/api/v2/users/42", "http://users"},
+		{"/api/v2/users/me", "http://me"},
+		{"/api/v2/users/42/orders", "http://api-v2"},
+		{"/health", "http://health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Repeat the lookup to make sure the result never depends on iteration order
+			for i := 0; i < 20; i++ {
+				match, err := table.Match(http.MethodGet, tt.path)
+				if err != nil {
+					t.Fatalf("Match(%s) returned error: %v", tt.path, err)
+				}
+				if match.Route.Config.Backend != tt.wantBackend {
+					t.Fatalf("Match(%s) backend = %s, want %s", tt.path, match.Route.Config.Backend, tt.wantBackend)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteTable_NoRoute(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/health", Mode: "sync"},
+		{Path: "/api/v1/**", Mode: "sync"},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	for _, path := range []string{"/", "/healthz", "/health/live", "/api", "/api/v2/x"} {
+		if _, err := table.Match(http.MethodGet, path); !errors.Is(err, ErrNoRoute) {
+			t.Errorf("Match(%s) error = %v, want ErrNoRoute", path, err)
+		}
+	}
+}
+
+func TestRouteTable_Params(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/orgs/{org}/users/{user}", Mode: "sync"},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	match, err := table.Match(http.MethodGet, "/orgs/acme/users/42")
+	if err != nil {
+		t.Fatalf("Match failed: %v", err)
+	}
+	if match.Params["org"] != "acme" || match.Params["user"] != "42" {
+		t.Errorf("unexpected params: %v", match.Params)
+	}
+}
+
+func TestRouteTable_MethodFiltering(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/v1/payments", Backend: "http://create", Mode: "sync", Methods: []string{"POST"}},
+		{Path: "/v1/payments/**", Backend: "http://read", Mode: "sync", Methods: []string{"GET"}},
+		{Path: "/v1/refunds", Backend: "http://refunds", Mode: "sync", Methods: []string{"post", "PUT"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	t.Run("MethodSelectsRoute", func(t *testing.T) {
+		match, err := table.Match(http.MethodPost, "/v1/payments")
+		if err != nil || match.Route.Config.Backend != "http://create" {
+			t.Fatalf("POST /v1/payments = %v, %v; want create route", match, err)
+		}
+
+		// GET on the exact path falls through to the glob route
+		match, err = table.Match(http.MethodGet, "/v1/payments")
+		if err != nil || match.Route.Config.Backend != "http://read" {
+			t.Fatalf("GET /v1/payments = %v, %v; want read route", match, err)
+		}
+	})
+
+	t.Run("MethodsAreCaseInsensitive", func(t *testing.T) {
+		if _, err := table.Match(http.MethodPost, "/v1/refunds"); err != nil {
+			t.Fatalf("POST /v1/refunds failed: %v", err)
+		}
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		_, err := table.Match(http.MethodDelete, "/v1/refunds")
+		var methodErr *MethodNotAllowedError
+		if !errors.As(err, &methodErr) {
+			t.Fatalf("expected MethodNotAllowedError, got %v", err)
+		}
+		if len(methodErr.Allowed) != 2 || methodErr.Allowed[0] != "POST" || methodErr.Allowed[1] != "PUT" {
+			t.Errorf("Allowed = %v, want [POST PUT]", methodErr.Allowed)
+		}
+	})
+}
+
+func TestRouteTable_Head(t *testing.T) {
+	defaults := config.RouteConfig{Path: "/v1/orders/**", Backend: "http://orders", Mode: "sync"}
+	if err := config.NormalizeRoute(&defaults); err != nil {
+		t.Fatalf("NormalizeRoute failed: %v", err)
+	}
+	table, err := NewRouteTable([]config.RouteConfig{
+		defaults,
+		{Path: "/v1/reports", Backend: "http://reports", Mode: "sync", Methods: []string{"GET"}},
+		{Path: "/v1/uploads", Backend: "http://uploads", Mode: "sync", Methods: []string{"POST"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		wantAllowed bool
+	}{
+		{"/v1/orders/42", true},
+		{"/v1/reports", true},
+		{"/v1/uploads", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := table.Match(http.MethodHead, tt.path)
+			if tt.wantAllowed && err != nil {
+				t.Errorf("HEAD %s error: %v", tt.path, err)
+			}
+			if !tt.wantAllowed && err == nil {
+				t.Errorf("HEAD %s allowed, want 405", tt.path)
+			}
+		})
+	}
+
+	// The Allow header of a 405 lists HEAD with GET
+	_, err = table.Match(http.MethodDelete, "/v1/reports")
+	var methodErr *MethodNotAllowedError
+	if !errors.As(err, &methodErr) || strings.Join(methodErr.Allowed, ",") != "GET,HEAD" {
+		t.Errorf("DELETE /v1/reports = %v, want allowed GET,HEAD", err)
+	}
+}
+
+func TestRouteTable_InvalidPatterns(t *testing.T) {
+	for _, path := range []string{"api/**", "/api/**/x", "/api/*", "/api/{}"} {
+		if _, err := NewRouteTable([]config.RouteConfig{{Path: path}}); err == nil {
+			t.Errorf("NewRouteTable(%q) expected error", path)
+		}
+	}
+}
+
+func TestSyncProxyMulti_HandleWithFallback(t *testing.T) {
+	logger := zap.NewNop()
+	spm := NewSyncProxyMulti([]config.RouteConfig{
+		{Path: "/async/**", Mode: "async", Methods: []string{"POST"}},
+		{Path: "/bad/**/x", Backend: "http://bad", Mode: "sync"},
+	}, logger)
+	defer spm.Close()
+
+	if spm.Table().Len() != 1 {
+		t.Fatalf("expected invalid route to be skipped, got %d routes", spm.Table().Len())
+	}
+
+	asyncCalled := false
+	handler := spm.HandleWithFallback(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asyncCalled = true
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/async/jobs", nil))
+	if !asyncCalled || rr.Code != http.StatusAccepted {
+		t.Errorf("expected async handler for matching async route, got %d", rr.Code)
+	}
+
+	asyncCalled = false
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/async/jobs", nil))
+	if asyncCalled || rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for disallowed method, got %d", rr.Code)
+	}
+	if rr.Header().Get("Allow") != "POST" {
+		t.Errorf("Allow header = %q, want POST", rr.Header().Get("Allow"))
+	}
+
+	asyncCalled = false
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unconfigured", nil))
+	if !asyncCalled {
+		t.Errorf("expected unmatched path to fall back to async handler")
+	}
+}
+
+func TestRouteTable_HostMatching(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/api/v2/**", Backend: "http://default-v2"},
+		{Path: "/api/**", Backend: "http://payments", Host: "payments.example.com"},
+		{Path: "/api/**", Backend: "http://tenant-wildcard", Host: "*.example.com"},
+		{Path: "/api/**", Backend: "http://eu-wildcard", Host: "*.eu.example.com"},
+		{Path: "/api/**", Backend: "http://default"},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	tests := []struct {
+		host        string
+		path        string
+		wantBackend string
+	}{
+		{"payments.example.com", "/api/charges", "http://payments"},
+		{"PAYMENTS.example.com:8443", "/api/charges", "http://payments"},
+		{"billing.example.com", "/api/charges", "http://tenant-wildcard"},
+		{"a.eu.example.com", "/api/charges", "http://eu-wildcard"},
+		{"example.com", "/api/charges", "http://default"},
+		{"other.org", "/api/charges", "http://default"},
+		{"payments.example.com", "/api/v2/charges", "http://payments"},
+		{"other.org", "/api/v2/charges", "http://default-v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+
+			match, err := table.MatchRequest(req)
+			if err != nil {
+				t.Fatalf("MatchRequest failed: %v", err)
+			}
+			if match.Route.Config.Backend != tt.wantBackend {
+				t.Errorf("backend = %s, want %s", match.Route.Config.Backend, tt.wantBackend)
+			}
+		})
+	}
+}
+
+func TestRouteTable_HeaderAndQueryMatching(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/orders/**", Backend: "http://v1"},
+		{Path: "/orders/**", Backend: "http://v2", Headers: map[string]string{"X-Api-Version": "2"}},
+		{Path: "/orders/**", Backend: "http://beta", Headers: map[string]string{"X-Api-Version": "2"}, QueryParams: map[string]string{"beta": "*"}},
+		{Path: "/orders/**", Backend: "http://debug", QueryParams: map[string]string{"debug": "true"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		headers     map[string]string
+		wantBackend string
+	}{
+		{"NoCriteria", "/orders/1", nil, "http://v1"},
+		{"HeaderMatch", "/orders/1", map[string]string{"x-api-version": "2"}, "http://v2"},
+		{"HeaderMismatch", "/orders/1", map[string]string{"X-Api-Version": "3"}, "http://v1"},
+		{"HeaderAndQueryPresence", "/orders/1?beta", map[string]string{"X-Api-Version": "2"}, "http://beta"},
+		{"QueryValue", "/orders/1?debug=true", nil, "http://debug"},
+		{"QueryValueMismatch", "/orders/1?debug=false", nil, "http://v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			match, err := table.MatchRequest(req)
+			if err != nil {
+				t.Fatalf("MatchRequest failed: %v", err)
+			}
+			if match.Route.Config.Backend != tt.wantBackend {
+				t.Errorf("backend = %s, want %s", match.Route.Config.Backend, tt.wantBackend)
+			}
+		})
+	}
+
+	// Routes with request criteria are not considered by path-only matching
+	match, err := table.Match(http.MethodGet, "/orders/1")
+	if err != nil || match.Route.Config.Backend != "http://v1" {
+		t.Errorf("Match = %v, %v; want v1 route", match, err)
+	}
+}
+
+func TestRouteTable_CriteriaMismatchIsNotMethodError(t *testing.T) {
+	table, err := NewRouteTable([]config.RouteConfig{
+		{Path: "/admin/**", Host: "admin.example.com", Methods: []string{"GET"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouteTable failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users", nil)
+	req.Host = "api.example.com"
+	if _, err := table.MatchRequest(req); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute for host mismatch, got %v", err)
+	}
+
+	req.Host = "admin.example.com"
+	var methodErr *MethodNotAllowedError
+	if _, err := table.MatchRequest(req); !errors.As(err, &methodErr) {
+		t.Errorf("expected MethodNotAllowedError for matching host, got %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -21,11 +25,22 @@ const (
 	PrefixTest = "apx_test_"
 )
 
+// API key format lengths
+const (
+	KeyIDLength     = 16 // Hex characters in a key ID
+	KeySecretLength = 64 // Hex characters in a key secret
+	LegacyKeyLength = 41 // Prefix + 32 hex characters, without a key ID
+
+	keyLength = 9 + KeyIDLength + 1 + KeySecretLength
+)
+
 // APIKeyInfo contains parsed information from an API key
 type APIKeyInfo struct {
-	RawKey      string // Full API key
-	Prefix      string // "apx_live_" or "apx_test_"
-	IsProduction bool  // true if live key, false if test key
+	RawKey       string // Full API key
+	Prefix       string // "apx_live_" or "apx_test_"
+	IsProduction bool   // true if live key, false if test key
+	KeyID        string // Key ID; for legacy keys, derived from the key hash
+	Legacy       bool   // Legacy 41-character key without an embedded key ID
 }
 
 // ExtractAPIKey extracts the API key from the Authorization header.
@@ -50,10 +65,35 @@ func ExtractAPIKey(r *http.Request) (string, error) {
 	return apiKey, nil
 }
 
+// ExtractAPIKeyFrom extracts the API key from the Authorization header, the
+// named header or the named query parameter, in that order; empty names are
+// skipped. fromQuery reports whether the key came from the query string.
+func ExtractAPIKeyFrom(r *http.Request, header, queryParam string) (key string, fromQuery bool, err error) {
+	key, err = ExtractAPIKey(r)
+	if err == nil {
+		return key, false, nil
+	}
+
+	if header != "" {
+		if v := strings.TrimSpace(r.Header.Get(header)); v != "" {
+			return v, false, nil
+		}
+	}
+	if queryParam != "" {
+		if v := strings.TrimSpace(r.URL.Query().Get(queryParam)); v != "" {
+			return v, true, nil
+		}
+	}
+	return "", false, err
+}
+
 // ValidateAPIKeyFormat validates the format of an API key.
 // Valid formats:
-//   - apx_live_<32 hex characters>
-//   - apx_test_<32 hex characters>
+//   - apx_live_<16 hex key ID>_<64 hex secret>
+//   - apx_test_<16 hex key ID>_<64 hex secret>
+//
+// Legacy keys without a key ID (apx_live_<32 hex characters>, 41 characters)
+// are still accepted until they have been rotated.
 func ValidateAPIKeyFormat(apiKey string) error {
 	if apiKey == "" {
 		return ErrEmptyAPIKey
@@ -64,19 +104,31 @@ func ValidateAPIKeyFormat(apiKey string) error {
 		return fmt.Errorf("%w: must start with %s or %s", ErrInvalidAPIKey, PrefixLive, PrefixTest)
 	}
 
-	// Check total length: prefix (9 chars) + hex string (32 chars) = 41 chars
-	if len(apiKey) != 41 {
-		return fmt.Errorf("%w: invalid length %d, expected 41", ErrInvalidAPIKey, len(apiKey))
+	// Check total length: prefix (9 chars) + key ID (16) + "_" + secret (64) = 90
+	// chars, or prefix + hex string (32 chars) = 41 chars for legacy keys
+	switch len(apiKey) {
+	case keyLength:
+		if apiKey[9+KeyIDLength] != '_' {
+			return fmt.Errorf("%w: missing key ID separator", ErrInvalidAPIKey)
+		}
+		if err := validateHex(apiKey, 9, 9+KeyIDLength); err != nil {
+			return err
+		}
+		return validateHex(apiKey, 9+KeyIDLength+1, len(apiKey))
+	case LegacyKeyLength:
+		return validateHex(apiKey, 9, len(apiKey))
+	default:
+		return fmt.Errorf("%w: invalid length %d, expected %d or %d", ErrInvalidAPIKey, len(apiKey), keyLength, LegacyKeyLength)
 	}
+}
 
-	// Extract hex portion and validate it's all hex characters
-	hexPortion := apiKey[9:] // Skip the 9-char prefix
-	for i, c := range hexPortion {
+// validateHex checks that apiKey[from:to] is all hex characters
+func validateHex(apiKey string, from, to int) error {
+	for i, c := range apiKey[from:to] {
 		if !isHexChar(c) {
-			return fmt.Errorf("%w: invalid character at position %d: %c", ErrInvalidAPIKey, i+9, c)
+			return fmt.Errorf("%w: invalid character at position %d: %c", ErrInvalidAPIKey, from+i, c)
 		}
 	}
-
 	return nil
 }
 
@@ -98,9 +150,46 @@ func ParseAPIKey(apiKey string) (*APIKeyInfo, error) {
 		info.IsProduction = false
 	}
 
+	if len(apiKey) == LegacyKeyLength {
+		// Legacy keys are looked up by a hash-derived ID once migrated
+		info.Legacy = true
+		info.KeyID = HashAPIKey(apiKey)[:KeyIDLength]
+	} else {
+		info.KeyID = apiKey[9 : 9+KeyIDLength]
+	}
+
 	return info, nil
 }
 
+// GenerateAPIKey creates a new random API key with an embedded key ID. Only
+// its hash (HashAPIKey) should be stored.
+func GenerateAPIKey(live bool) (*APIKeyInfo, error) {
+	buf := make([]byte, (KeyIDLength+KeySecretLength)/2)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	random := hex.EncodeToString(buf)
+
+	prefix := PrefixTest
+	if live {
+		prefix = PrefixLive
+	}
+	return ParseAPIKey(prefix + random[:KeyIDLength] + "_" + random[KeyIDLength:])
+}
+
+// HashAPIKey returns the hex SHA-256 of an API key. Keys are random, so a
+// fast unsalted hash is sufficient and allows lookups by hash.
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAPIKeyHash reports whether apiKey matches a stored hash, in constant
+// time
+func VerifyAPIKeyHash(apiKey, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(apiKey)), []byte(hash)) == 1
+}
+
 // ExtractAndValidateAPIKey extracts and validates an API key from the request.
 // This is a convenience function that combines ExtractAPIKey and ValidateAPIKeyFormat.
 func ExtractAndValidateAPIKey(r *http.Request) (*APIKeyInfo, error) {
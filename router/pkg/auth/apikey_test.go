@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -96,6 +98,43 @@ func TestExtractAPIKey(t *testing.T) {
 	}
 }
 
+func TestExtractAPIKeyFrom(t *testing.T) {
+	const key = "apx_live_0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name          string
+		target        string
+		headers       map[string]string
+		wantKey       string
+		wantFromQuery bool
+		wantErr       error
+	}{
+		{"bearer first", "/x?api_key=other", map[string]string{"Authorization": "Bearer " + key, "X-API-Key": "other"}, key, false, nil},
+		{"custom header", "/x", map[string]string{"Authorization": "Basic dXNlcg==", "X-API-Key": key}, key, false, nil},
+		{"query parameter", "/x?a=1&api_key=" + key, nil, key, true, nil},
+		{"nothing", "/x", nil, "", false, ErrNoAuthHeader},
+		{"invalid bearer, nothing else", "/x", map[string]string{"Authorization": "Basic dXNlcg=="}, "", false, ErrInvalidAuthFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			got, fromQuery, err := ExtractAPIKeyFrom(req, "X-API-Key", "api_key")
+			if got != tt.wantKey || fromQuery != tt.wantFromQuery || !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExtractAPIKeyFrom() = %q, %v, %v; want %q, %v, %v", got, fromQuery, err, tt.wantKey, tt.wantFromQuery, tt.wantErr)
+			}
+		})
+	}
+
+	// Without a header or query parameter name only Authorization is read
+	req := httptest.NewRequest(http.MethodGet, "/x?api_key="+key, nil)
+	req.Header.Set("X-API-Key", key)
+	if _, _, err := ExtractAPIKeyFrom(req, "", ""); !errors.Is(err, ErrNoAuthHeader) {
+		t.Errorf("ExtractAPIKeyFrom() without locations error = %v", err)
+	}
+}
+
 func TestValidateAPIKeyFormat(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -162,6 +201,26 @@ func TestValidateAPIKeyFormat(t *testing.T) {
 			apiKey:      "apxlive_0123456789abcdef0123456789abcdef",
 			expectError: true,
 		},
+		{
+			name:        "valid key with key ID",
+			apiKey:      "apx_live_0123456789abcdef_" + strings.Repeat("ab", 32),
+			expectError: false,
+		},
+		{
+			name:        "key ID - missing separator",
+			apiKey:      "apx_live_0123456789abcdef0" + strings.Repeat("ab", 32),
+			expectError: true,
+		},
+		{
+			name:        "key ID - invalid character in ID",
+			apiKey:      "apx_live_0123456789abcdeg_" + strings.Repeat("ab", 32),
+			expectError: true,
+		},
+		{
+			name:        "key ID - invalid character in secret",
+			apiKey:      "apx_live_0123456789abcdef_" + strings.Repeat("ab", 31) + "a_",
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -393,3 +452,53 @@ func FuzzValidateAPIKeyFormat(f *testing.F) {
 		_ = ValidateAPIKeyFormat(apiKey)
 	})
 }
+
+func TestParseAPIKey_KeyID(t *testing.T) {
+	info, err := ParseAPIKey("apx_test_0123456789abcdef_" + strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.KeyID != "0123456789abcdef" || info.Legacy {
+		t.Errorf("expected key ID 0123456789abcdef, got %q (legacy %v)", info.KeyID, info.Legacy)
+	}
+
+	// Legacy keys get a stable ID derived from their hash
+	legacy := "apx_live_0123456789abcdef0123456789abcdef"
+	info, err = ParseAPIKey(legacy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !info.Legacy || info.KeyID != HashAPIKey(legacy)[:KeyIDLength] {
+		t.Errorf("expected legacy key with hash-derived ID, got %q (legacy %v)", info.KeyID, info.Legacy)
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	live, err := GenerateAPIKey(true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidateAPIKeyFormat(live.RawKey); err != nil || !live.IsProduction || live.Legacy {
+		t.Errorf("generated invalid live key %q: %v", live.RawKey, err)
+	}
+
+	test, _ := GenerateAPIKey(false)
+	if test.Prefix != PrefixTest || test.KeyID == live.KeyID {
+		t.Errorf("expected distinct test key, got %q", test.RawKey)
+	}
+}
+
+func TestVerifyAPIKeyHash(t *testing.T) {
+	key := "apx_live_0123456789abcdef_" + strings.Repeat("ab", 32)
+	hash := HashAPIKey(key)
+
+	if !VerifyAPIKeyHash(key, hash) {
+		t.Error("expected key to match its hash")
+	}
+	if VerifyAPIKeyHash(key[:len(key)-1]+"c", hash) {
+		t.Error("expected a different key not to match")
+	}
+	if VerifyAPIKeyHash(key, "") {
+		t.Error("expected an empty hash not to match")
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNoClientCertificate is returned when a request carries no client
+// certificate
+var ErrNoClientCertificate = errors.New("no client certificate")
+
+// CertificateIdentity is the identity presented by a verified client
+// certificate
+type CertificateIdentity struct {
+	Subject     string // Subject distinguished name
+	CommonName  string
+	SPIFFEID    string   // spiffe:// URI SAN, if any
+	URIs        []string // URI SANs, including the SPIFFE ID
+	DNSNames    []string
+	Emails      []string
+	Fingerprint string // Hex SHA-256 of the DER certificate
+}
+
+// NewCertificateIdentity extracts the identity of a client certificate
+func NewCertificateIdentity(cert *x509.Certificate) *CertificateIdentity {
+	sum := sha256.Sum256(cert.Raw)
+	id := &CertificateIdentity{
+		Subject:     cert.Subject.String(),
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		Emails:      cert.EmailAddresses,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+		if u.Scheme == "spiffe" && id.SPIFFEID == "" {
+			id.SPIFFEID = u.String()
+		}
+	}
+	return id
+}
+
+// Name returns the most specific identifier of the certificate: its SPIFFE
+// ID, else its first DNS SAN, else its subject
+func (id *CertificateIdentity) Name() string {
+	switch {
+	case id.SPIFFEID != "":
+		return id.SPIFFEID
+	case len(id.DNSNames) > 0:
+		return id.DNSNames[0]
+	default:
+		return id.Subject
+	}
+}
+
+// Matches reports whether pattern names this identity. A pattern matches a
+// URI SAN (including the SPIFFE ID), DNS SAN, email SAN, the common name or
+// the full subject DN; a trailing "*" matches any suffix.
+func (id *CertificateIdentity) Matches(pattern string) bool {
+	match := func(value string) bool {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(value, prefix)
+		}
+		return value == pattern
+	}
+
+	for _, values := range [][]string{id.URIs, id.DNSNames, id.Emails, {id.CommonName, id.Subject}} {
+		for _, v := range values {
+			if v != "" && match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// VerifyClientCertificate verifies a client certificate chain, leaf first,
+// against roots and returns the leaf's identity
+func VerifyClientCertificate(chain []*x509.Certificate, roots *x509.CertPool) (*CertificateIdentity, error) {
+	if len(chain) == 0 {
+		return nil, ErrNoClientCertificate
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return NewCertificateIdentity(chain[0]), nil
+}
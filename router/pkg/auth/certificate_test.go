@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if tmpl.ExtKeyUsage == nil {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issue certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func TestVerifyClientCertificate(t *testing.T) {
+	ca := newTestCA(t, "Partner CA")
+	spiffe, _ := url.Parse("spiffe://acme.example/ns/payments/sa/billing")
+	cert := ca.issue(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing", Organization: []string{"Acme"}},
+		URIs:     []*url.URL{spiffe},
+		DNSNames: []string{"billing.acme.example"},
+	})
+
+	id, err := VerifyClientCertificate([]*x509.Certificate{cert}, ca.pool())
+	if err != nil {
+		t.Fatalf("VerifyClientCertificate() error: %v", err)
+	}
+	if id.SPIFFEID != spiffe.String() || id.Name() != spiffe.String() {
+		t.Errorf("SPIFFEID = %q, Name() = %q", id.SPIFFEID, id.Name())
+	}
+	if len(id.Fingerprint) != 64 {
+		t.Errorf("Fingerprint = %q", id.Fingerprint)
+	}
+
+	// Certificates from another CA, or without client auth usage, are rejected
+	other := newTestCA(t, "Other CA")
+	if _, err := VerifyClientCertificate([]*x509.Certificate{cert}, other.pool()); err == nil {
+		t.Error("VerifyClientCertificate() accepted a certificate from an untrusted CA")
+	}
+	serverOnly := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if _, err := VerifyClientCertificate([]*x509.Certificate{serverOnly}, ca.pool()); err == nil {
+		t.Error("VerifyClientCertificate() accepted a server-only certificate")
+	}
+	if _, err := VerifyClientCertificate(nil, ca.pool()); !errors.Is(err, ErrNoClientCertificate) {
+		t.Errorf("VerifyClientCertificate(nil) error = %v", err)
+	}
+}
+
+func TestCertificateIdentity_Matches(t *testing.T) {
+	id := &CertificateIdentity{
+		Subject:    "CN=billing,O=Acme",
+		CommonName: "billing",
+		SPIFFEID:   "spiffe://acme.example/ns/payments/sa/billing",
+		URIs:       []string{"spiffe://acme.example/ns/payments/sa/billing"},
+		DNSNames:   []string{"billing.acme.example"},
+		Emails:     []string{"ops@acme.example"},
+	}
+
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"spiffe://acme.example/ns/payments/sa/billing", true},
+		{"spiffe://acme.example/ns/payments/*", true},
+		{"spiffe://acme.example/ns/orders/*", false},
+		{"billing.acme.example", true},
+		{"ops@acme.example", true},
+		{"billing", true},
+		{"CN=billing,O=Acme", true},
+		{"CN=billing", false},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		if got := id.Matches(tt.pattern); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestIdentitySigner(t *testing.T) {
+	if _, err := NewIdentitySigner([]byte("short")); err == nil {
+		t.Error("NewIdentitySigner() accepted a short key")
+	}
+
+	key := []byte(strings.Repeat("k", 32))
+	signer, err := NewIdentitySigner(key)
+	if err != nil {
+		t.Fatalf("NewIdentitySigner() error: %v", err)
+	}
+	now := time.Now()
+	signer.now = func() time.Time { return now }
+
+	value := signer.Sign(Identity{Subject: "spiffe://acme.example/billing", Tenant: "acme_prod", Fingerprint: "ab12"})
+	id, err := signer.Verify(value, time.Minute)
+	if err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if id.Subject != "spiffe://acme.example/billing" || id.Tenant != "acme_prod" || id.IssuedAt != now.Unix() {
+		t.Errorf("Verify() = %+v", id)
+	}
+
+	// Other keys, tampered payloads and stale headers are rejected
+	otherSigner, _ := NewIdentitySigner([]byte(strings.Repeat("x", 32)))
+	otherSigner.now = signer.now
+	if _, err := otherSigner.Verify(value, time.Minute); !errors.Is(err, ErrInvalidIdentity) {
+		t.Errorf("Verify() with another key error = %v", err)
+	}
+	forged := otherSigner.Sign(Identity{Subject: "spiffe://evil", Tenant: "acme_prod"})
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(value, ".")
+	if _, err := signer.Verify(payload+"."+sig, time.Minute); !errors.Is(err, ErrInvalidIdentity) {
+		t.Errorf("Verify() of a tampered payload error = %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := signer.Verify(value, time.Minute); !errors.Is(err, ErrInvalidIdentity) {
+		t.Errorf("Verify() of a stale header error = %v", err)
+	}
+}
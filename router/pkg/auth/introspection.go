@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/lru"
+)
+
+// Introspection errors
+var (
+	// ErrTokenInactive is returned for tokens the authorization server
+	// reports as inactive (revoked, expired or unknown)
+	ErrTokenInactive = errors.New("token is not active")
+
+	// ErrIntrospectionUnavailable is returned when the introspection
+	// endpoint cannot be reached or answers with an error
+	ErrIntrospectionUnavailable = errors.New("token introspection unavailable")
+)
+
+// Defaults for token introspection
+const (
+	DefaultIntrospectionCacheTTL    = 5 * time.Minute
+	DefaultIntrospectionNegativeTTL = 30 * time.Second
+	DefaultIntrospectionCacheSize   = 10000
+	DefaultIntrospectionTimeout     = 5 * time.Second
+)
+
+// IntrospectionConfig configures an RFC 7662 token introspection client
+type IntrospectionConfig struct {
+	Endpoint     string
+	ClientID     string // Client credentials the router authenticates with
+	ClientSecret string
+	Client       *http.Client  // Defaults to a client with a 5s timeout
+	CacheTTL     time.Duration // Upper bound for caching active tokens (default 5m)
+	NegativeTTL  time.Duration // How long inactive tokens are cached (default 30s)
+	MaxEntries   int           // Cache size bound (default 10000)
+}
+
+// Introspector validates opaque OAuth2 access tokens with the authorization
+// server's introspection endpoint. Responses are cached by token hash in an
+// LRU: active tokens until their exp (at most CacheTTL), inactive tokens for
+// NegativeTTL. Failed requests are not cached.
+type Introspector struct {
+	cfg   IntrospectionConfig
+	now   func() time.Time
+	cache *lru.Cache[Claims] // nil claims for inactive tokens
+}
+
+// NewIntrospector creates an introspection client
+func NewIntrospector(cfg IntrospectionConfig) *Introspector {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultIntrospectionTimeout}
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = DefaultIntrospectionCacheTTL
+	}
+	if cfg.NegativeTTL == 0 {
+		cfg.NegativeTTL = DefaultIntrospectionNegativeTTL
+	}
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = DefaultIntrospectionCacheSize
+	}
+
+	return &Introspector{
+		cfg:   cfg,
+		now:   time.Now,
+		cache: lru.New[Claims](cfg.MaxEntries, nil),
+	}
+}
+
+// Introspect returns the claims of an active token, or ErrTokenInactive
+func (i *Introspector) Introspect(ctx context.Context, token string) (Claims, error) {
+	key := tokenHash(token)
+	now := i.now()
+
+	if claims, ok := i.cache.Get(key, now); ok {
+		if claims == nil {
+			return nil, ErrTokenInactive
+		}
+		return claims, nil
+	}
+
+	claims, err := i.introspect(ctx, token)
+	if err != nil && !errors.Is(err, ErrTokenInactive) {
+		return nil, err
+	}
+
+	expires := now.Add(i.cfg.NegativeTTL)
+	if claims != nil {
+		expires = now.Add(i.cfg.CacheTTL)
+		if exp, ok := claims.Time("exp"); ok {
+			if !exp.After(now) {
+				return nil, ErrTokenExpired
+			}
+			if exp.Before(expires) {
+				expires = exp
+			}
+		}
+	}
+	i.cache.Add(key, claims, expires)
+
+	return claims, err
+}
+
+// introspect calls the introspection endpoint
+func (i *Introspector) introspect(ctx context.Context, token string) (Claims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.cfg.ClientID), url.QueryEscape(i.cfg.ClientSecret))
+	}
+
+	resp, err := i.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrIntrospectionUnavailable, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionUnavailable, err)
+	}
+	var claims Claims
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInactive
+	}
+	return claims, nil
+}
+
+// tokenHash is the cache key of a token, so raw tokens are not kept in memory
+// longer than the request
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
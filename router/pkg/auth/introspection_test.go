@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospector_Cache(t *testing.T) {
+	now := time.Now()
+	exp := now.Add(2 * time.Minute)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "router" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("token_type_hint") != "access_token" {
+			t.Errorf("token_type_hint = %q", r.FormValue("token_type_hint"))
+		}
+		switch r.FormValue("token") {
+		case "active-token":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"active": true, "scope": "read write", "client_id": "partner", "exp": exp.Unix(),
+			})
+		case "broken-token":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+		}
+	}))
+	defer srv.Close()
+
+	i := NewIntrospector(IntrospectionConfig{
+		Endpoint:     srv.URL,
+		ClientID:     "router",
+		ClientSecret: "s3cret",
+		NegativeTTL:  10 * time.Second,
+	})
+	i.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	claims, err := i.Introspect(ctx, "active-token")
+	if err != nil {
+		t.Fatalf("Introspect() error: %v", err)
+	}
+	if got := claims.Scopes(); len(got) != 2 || got[0] != "read" || got[1] != "write" {
+		t.Errorf("Scopes() = %v", got)
+	}
+
+	// Active tokens are cached until exp, even though CacheTTL is longer
+	now = now.Add(time.Minute)
+	i.Introspect(ctx, "active-token")
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls = %d, want 1 while cached", n)
+	}
+	now = exp.Add(time.Second)
+	if _, err := i.Introspect(ctx, "active-token"); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Introspect() after exp error = %v, want ErrTokenExpired", err)
+	}
+
+	// Inactive tokens are cached for NegativeTTL
+	calls.Store(0)
+	for j := 0; j < 3; j++ {
+		if _, err := i.Introspect(ctx, "revoked-token"); !errors.Is(err, ErrTokenInactive) {
+			t.Errorf("Introspect() error = %v, want ErrTokenInactive", err)
+		}
+	}
+	now = now.Add(11 * time.Second)
+	i.Introspect(ctx, "revoked-token")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2 after the negative TTL", n)
+	}
+
+	// Endpoint failures are not cached
+	calls.Store(0)
+	for j := 0; j < 2; j++ {
+		if _, err := i.Introspect(ctx, "broken-token"); !errors.Is(err, ErrIntrospectionUnavailable) {
+			t.Errorf("Introspect() error = %v, want ErrIntrospectionUnavailable", err)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2 for uncached failures", n)
+	}
+}
+
+func TestIntrospector_CacheBound(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+	}))
+	defer srv.Close()
+
+	i := NewIntrospector(IntrospectionConfig{Endpoint: srv.URL, MaxEntries: 3})
+	for _, token := range []string{"a", "b", "c", "d", "e"} {
+		i.Introspect(context.Background(), token)
+	}
+	if n := i.cache.Len(); n != 3 {
+		t.Errorf("cache size = %d, want 3", n)
+	}
+
+	// The least recently used token is evicted first
+	i.Introspect(context.Background(), "c")
+	i.Introspect(context.Background(), "f")
+	i.Introspect(context.Background(), "c")
+	if n := calls.Load(); n != 6 {
+		t.Errorf("calls = %d, want 6 with c still cached", n)
+	}
+}
@@ -0,0 +1,364 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// JWKS errors
+var (
+	ErrUnknownKey = errors.New("no key found for token key ID")
+	ErrInvalidJWK = errors.New("invalid JSON web key")
+)
+
+// Defaults for remote key sets
+const (
+	DefaultJWKSCacheTTL       = 10 * time.Minute
+	DefaultJWKSMinRefresh     = 30 * time.Second
+	DefaultJWKSRequestTimeout = 5 * time.Second
+)
+
+// PublicKey is a verification key from a JSON Web Key Set
+type PublicKey struct {
+	ID  string           // "kid"
+	Alg string           // "alg", empty if the key does not restrict it
+	Key crypto.PublicKey // *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+}
+
+// KeySet provides the keys used to verify JWT signatures
+type KeySet interface {
+	// Key returns the key with the given ID. An empty ID matches the only
+	// key of a single-key set.
+	Key(ctx context.Context, kid string) (*PublicKey, error)
+}
+
+// jwk is the JSON representation of a public JSON Web Key (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses a JSON Web Key Set document. Keys that are not signature
+// keys are skipped.
+func ParseJWKS(data []byte) ([]*PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWK, err)
+	}
+
+	keys := make([]*PublicKey, 0, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidJWK, k.Kid, err)
+		}
+		keys = append(keys, &PublicKey{ID: k.Kid, Alg: k.Alg, Key: pub})
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, errors.New("unsupported RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		// Round-trip through the uncompressed encoding, which checks that
+		// the point is on the curve
+		point := make([]byte, 65)
+		point[0] = 4
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+		if err != nil {
+			return nil, err
+		}
+		return pub, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// findKey returns the key with the given ID from keys
+func findKey(keys []*PublicKey, kid string) *PublicKey {
+	if kid == "" && len(keys) == 1 {
+		return keys[0]
+	}
+	for _, k := range keys {
+		if k.ID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// StaticKeySet is a fixed set of keys, e.g. loaded from a local file
+type StaticKeySet struct {
+	keys []*PublicKey
+}
+
+// NewStaticKeySet creates a key set from parsed keys
+func NewStaticKeySet(keys []*PublicKey) *StaticKeySet {
+	return &StaticKeySet{keys: keys}
+}
+
+// LoadJWKSFile reads a JSON Web Key Set from a local file
+func LoadJWKSFile(path string) (*StaticKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeySet(keys), nil
+}
+
+// Key implements KeySet
+func (s *StaticKeySet) Key(ctx context.Context, kid string) (*PublicKey, error) {
+	if k := findKey(s.keys, kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// RemoteKeySet fetches a JSON Web Key Set over HTTP and caches it. The set is
+// refetched when the cache expires (honouring Cache-Control max-age, but no
+// sooner than the minimum refresh interval) and when a token names a key ID
+// the set does not contain yet, so signing key rotations are picked up
+// without waiting for the cache to expire. Refetches for unknown key IDs are
+// rate limited, and concurrent lookups share one fetch. A failed refetch
+// keeps serving the cached keys and is retried after the minimum refresh
+// interval.
+type RemoteKeySet struct {
+	uri        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+	flight     singleflight.Group
+
+	mu        sync.Mutex
+	keys      []*PublicKey
+	expires   time.Time // Next fetch; the retry time after a failed fetch
+	fetchedAt time.Time
+}
+
+// RemoteKeySetConfig holds configuration for a remote key set
+type RemoteKeySetConfig struct {
+	Client     *http.Client  // Defaults to a client with a 5s timeout
+	TTL        time.Duration // Cache lifetime when the response has no max-age (default 10m)
+	MinRefresh time.Duration // Minimum time between fetches, including for unknown key IDs (default 30s)
+}
+
+// NewRemoteKeySet creates a key set served from uri
+func NewRemoteKeySet(uri string, cfg RemoteKeySetConfig) *RemoteKeySet {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultJWKSRequestTimeout}
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultJWKSCacheTTL
+	}
+	if cfg.MinRefresh == 0 {
+		cfg.MinRefresh = DefaultJWKSMinRefresh
+	}
+
+	return &RemoteKeySet{
+		uri:        uri,
+		client:     cfg.Client,
+		ttl:        cfg.TTL,
+		minRefresh: cfg.MinRefresh,
+		now:        time.Now,
+	}
+}
+
+// Key implements KeySet
+func (s *RemoteKeySet) Key(ctx context.Context, kid string) (*PublicKey, error) {
+	s.mu.Lock()
+	now := s.now()
+	key := findKey(s.keys, kid)
+	stale := now.After(s.expires)
+	rotated := key == nil && now.Sub(s.fetchedAt) >= s.minRefresh
+	s.mu.Unlock()
+
+	if stale || rotated {
+		keys, err := s.refresh(ctx)
+		if keys == nil {
+			return nil, err
+		}
+		// On error, keep serving the cached keys while the endpoint is failing
+		key = findKey(keys, kid)
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the key set, sharing one fetch between concurrent callers,
+// and returns the cached keys along with any error
+func (s *RemoteKeySet) refresh(ctx context.Context) ([]*PublicKey, error) {
+	ch := s.flight.DoChan("", func() (interface{}, error) {
+		// The fetch is shared, so it must outlive the request that started it
+		ctx := context.WithoutCancel(ctx)
+		if s.client.Timeout == 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, DefaultJWKSRequestTimeout)
+			defer cancel()
+		}
+		return nil, s.fetch(ctx)
+	})
+
+	var err error
+	select {
+	case res := <-ch:
+		err = res.Err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys, err
+}
+
+// fetch fetches and caches the key set. After a failure the cached keys are
+// kept and the next fetch waits for the minimum refresh interval.
+func (s *RemoteKeySet) fetch(ctx context.Context) error {
+	s.mu.Lock()
+	now := s.now()
+	s.fetchedAt = now
+	s.mu.Unlock()
+
+	keys, maxAge, err := s.get(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.expires = now.Add(s.minRefresh)
+		return err
+	}
+	s.keys = keys
+	// A max-age of 0 (or a very short one) must not refetch on every lookup
+	s.expires = now.Add(max(maxAge, s.minRefresh))
+	return nil
+}
+
+// get requests the key set and returns its keys and cache lifetime
+func (s *RemoteKeySet) get(ctx context.Context) ([]*PublicKey, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.uri, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to fetch JWKS: unexpected status code %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, cacheMaxAge(resp.Header, s.ttl), nil
+}
+
+// cacheMaxAge returns the max-age of a response, or def if it has none
+func cacheMaxAge(h http.Header, def time.Duration) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return def
+}
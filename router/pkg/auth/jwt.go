@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWT errors
+var (
+	ErrInvalidToken         = errors.New("invalid token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported token signing algorithm")
+	ErrInvalidSignature     = errors.New("invalid token signature")
+	ErrTokenExpired         = errors.New("token has expired")
+	ErrTokenNotYetValid     = errors.New("token is not valid yet")
+	ErrInvalidIssuer        = errors.New("invalid token issuer")
+	ErrInvalidAudience      = errors.New("invalid token audience")
+)
+
+// DefaultClockSkew is the clock skew allowed for exp and nbf checks
+const DefaultClockSkew = 30 * time.Second
+
+// Supported JWS signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Claims holds the claims of a verified JWT or of an active token's
+// introspection response
+type Claims map[string]interface{}
+
+// String returns a string claim, or "" if it is missing or not a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that is either an array of strings or a single
+// space-separated string (as used by the OAuth2 "scope" claim)
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Scopes returns the token's OAuth2 scopes from the "scope" claim, or the
+// "scp" claim some issuers use instead
+func (c Claims) Scopes() []string {
+	if scopes := c.Strings("scope"); len(scopes) > 0 {
+		return scopes
+	}
+	return c.Strings("scp")
+}
+
+// Time returns a NumericDate claim such as exp, and whether it is present
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		secs, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(int64(secs), 0), true
+	}
+	return time.Time{}, false
+}
+
+// JWTConfig holds the expectations a token must meet
+type JWTConfig struct {
+	Issuer    string        // Required "iss" (not checked if empty)
+	Audience  []string      // "aud" must contain one of these (not checked if empty)
+	ClockSkew time.Duration // Allowed skew for exp/nbf (default 30s)
+}
+
+// JWTVerifier verifies signed JWTs (RS256, ES256 and EdDSA) against a key set
+type JWTVerifier struct {
+	keys KeySet
+	cfg  JWTConfig
+	now  func() time.Time
+}
+
+// NewJWTVerifier creates a verifier for tokens signed with keys
+func NewJWTVerifier(keys KeySet, cfg JWTConfig) *JWTVerifier {
+	if cfg.ClockSkew == 0 {
+		cfg.ClockSkew = DefaultClockSkew
+	}
+	return &JWTVerifier{keys: keys, cfg: cfg, now: time.Now}
+}
+
+// IsJWT reports whether token has the shape of a compact JWS
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !strings.HasPrefix(token, PrefixLive) && !strings.HasPrefix(token, PrefixTest)
+}
+
+// Verify checks the token's signature and registered claims and returns its
+// claims. Tokens without an exp claim are rejected.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected three segments", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		Typ string `json:"typ"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	// The algorithm must fit the key, so a token cannot pick a weaker one
+	if key.Alg != "" && key.Alg != header.Alg {
+		return nil, fmt.Errorf("%w: %s for a %s key", ErrUnsupportedAlgorithm, header.Alg, key.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+	if err := verifySignature(header.Alg, key.Key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validateClaims checks exp, nbf, iss and aud
+func (v *JWTVerifier) validateClaims(claims Claims) error {
+	now := v.now()
+
+	exp, ok := claims.Time("exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(exp.Add(v.cfg.ClockSkew)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.cfg.ClockSkew).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+
+	if v.cfg.Issuer != "" && claims.String("iss") != v.cfg.Issuer {
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, claims.String("iss"))
+	}
+
+	if len(v.cfg.Audience) > 0 {
+		matched := false
+		for _, aud := range claims.Strings("aud") {
+			for _, want := range v.cfg.Audience {
+				if aud == want {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return ErrInvalidAudience
+		}
+	}
+	return nil
+}
+
+// verifySignature checks a JWS signature over signed
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	switch alg {
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires an RSA key", ErrUnsupportedAlgorithm, alg)
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires an EC key", ErrUnsupportedAlgorithm, alg)
+		}
+		// JWS encodes ECDSA signatures as fixed-size R || S
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		digest := sha256.Sum256(signed)
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+
+	case AlgEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s requires an Ed25519 key", ErrUnsupportedAlgorithm, alg)
+		}
+		if !ed25519.Verify(pub, signed, sig) {
+			return ErrInvalidSignature
+		}
+
+	default:
+		// Includes "none" and the HMAC algorithms, which would let anyone
+		// holding the public key mint tokens
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,405 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testKey is a signing key together with its public JWK
+type testKey struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+}
+
+func newTestKey(t *testing.T, kid, alg string) *testKey {
+	t.Helper()
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("generate %s key: %v", alg, err)
+	}
+	return &testKey{kid: kid, alg: alg, priv: priv}
+}
+
+func (k *testKey) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	m := map[string]string{"kid": k.kid, "alg": k.alg, "use": "sig"}
+	switch pub := k.priv.Public().(type) {
+	case *rsa.PublicKey:
+		m["kty"], m["n"], m["e"] = "RSA", b64(pub.N.Bytes()), b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, _ := pub.Bytes()
+		m["kty"], m["crv"], m["x"], m["y"] = "EC", "P-256", b64(point[1:33]), b64(point[33:])
+	case ed25519.PublicKey:
+		m["kty"], m["crv"], m["x"] = "OKP", "Ed25519", b64(pub)
+	}
+	return m
+}
+
+func jwksJSON(keys ...*testKey) []byte {
+	doc := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		doc.Keys = append(doc.Keys, k.jwk())
+	}
+	data, _ := json.Marshal(doc)
+	return data
+}
+
+// sign creates a compact JWS over claims
+func (k *testKey) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": k.alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var sig []byte
+	var err error
+	switch priv := k.priv.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, priv, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(priv, []byte(signed))
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func validClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": "https://idp.example.com",
+		"aud": []string{"payments-api"},
+		"sub": "client-1",
+		"exp": now.Add(time.Hour).Unix(),
+		"nbf": now.Add(-time.Minute).Unix(),
+	}
+}
+
+func TestJWTVerifier_Algorithms(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key := newTestKey(t, "k1", alg)
+			keys, err := ParseJWKS(jwksJSON(key))
+			if err != nil {
+				t.Fatalf("ParseJWKS() error: %v", err)
+			}
+			v := NewJWTVerifier(NewStaticKeySet(keys), JWTConfig{
+				Issuer:   "https://idp.example.com",
+				Audience: []string{"payments-api"},
+			})
+
+			token := key.sign(t, validClaims(time.Now()))
+			claims, err := v.Verify(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Verify() error: %v", err)
+			}
+			if claims.String("sub") != "client-1" {
+				t.Errorf("sub = %q, want client-1", claims.String("sub"))
+			}
+
+			// Flipping a payload bit breaks the signature
+			tampered := []byte(token)
+			tampered[len(tampered)/2] ^= 1
+			if _, err := v.Verify(context.Background(), string(tampered)); err == nil {
+				t.Error("Verify() accepted a tampered token")
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_Claims(t *testing.T) {
+	key := newTestKey(t, "k1", AlgES256)
+	keys, _ := ParseJWKS(jwksJSON(key))
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+		want   error
+	}{
+		{"valid", func(c map[string]interface{}) {}, nil},
+		{"expired within skew", func(c map[string]interface{}) { c["exp"] = now.Add(-10 * time.Second).Unix() }, nil},
+		{"expired", func(c map[string]interface{}) { c["exp"] = now.Add(-time.Minute).Unix() }, ErrTokenExpired},
+		{"missing exp", func(c map[string]interface{}) { delete(c, "exp") }, ErrInvalidToken},
+		{"not yet valid", func(c map[string]interface{}) { c["nbf"] = now.Add(time.Minute).Unix() }, ErrTokenNotYetValid},
+		{"nbf within skew", func(c map[string]interface{}) { c["nbf"] = now.Add(10 * time.Second).Unix() }, nil},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, ErrInvalidIssuer},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other-api" }, ErrInvalidAudience},
+		{"string audience", func(c map[string]interface{}) { c["aud"] = "payments-api" }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewJWTVerifier(NewStaticKeySet(keys), JWTConfig{
+				Issuer:    "https://idp.example.com",
+				Audience:  []string{"payments-api"},
+				ClockSkew: 30 * time.Second,
+			})
+			v.now = func() time.Time { return now }
+
+			claims := validClaims(now)
+			tt.modify(claims)
+			_, err := v.Verify(context.Background(), key.sign(t, claims))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_RejectsUnsafeAlgorithms(t *testing.T) {
+	key := newTestKey(t, "k1", AlgRS256)
+	keys, _ := ParseJWKS(jwksJSON(key))
+	v := NewJWTVerifier(NewStaticKeySet(keys), JWTConfig{})
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	payload, _ := json.Marshal(validClaims(time.Now()))
+	for _, alg := range []string{"none", "HS256"} {
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "k1"})
+		token := b64(header) + "." + b64(payload) + "."
+		if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("alg %s: error = %v, want ErrUnsupportedAlgorithm", alg, err)
+		}
+	}
+}
+
+func TestLoadJWKSFile(t *testing.T) {
+	key := newTestKey(t, "file-key", AlgEdDSA)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, jwksJSON(key), 0o644)
+
+	keys, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatalf("LoadJWKSFile() error: %v", err)
+	}
+	if _, err := NewJWTVerifier(keys, JWTConfig{}).Verify(context.Background(), key.sign(t, validClaims(time.Now()))); err != nil {
+		t.Errorf("Verify() error: %v", err)
+	}
+}
+
+func TestRemoteKeySet_CachingAndRotation(t *testing.T) {
+	oldKey := newTestKey(t, "2024-01", AlgRS256)
+	newKey := newTestKey(t, "2024-02", AlgRS256)
+
+	var fetches atomic.Int32
+	var published atomic.Pointer[[]byte]
+	initial := jwksJSON(oldKey)
+	published.Store(&initial)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(*published.Load())
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeySet(srv.URL, RemoteKeySetConfig{MinRefresh: time.Minute})
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	v := NewJWTVerifier(keys, JWTConfig{})
+	v.now = keys.now
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(ctx, oldKey.sign(t, validClaims(now))); err != nil {
+			t.Fatalf("Verify() error: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1 while cached", n)
+	}
+
+	// The issuer rotates to a new key; a token signed with it triggers a
+	// refetch once the minimum refresh interval has passed
+	rotated := jwksJSON(oldKey, newKey)
+	published.Store(&rotated)
+	if _, err := v.Verify(ctx, newKey.sign(t, validClaims(now))); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify() error = %v, want ErrUnknownKey within the refresh interval", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := v.Verify(ctx, newKey.sign(t, validClaims(now))); err != nil {
+		t.Errorf("Verify() with the rotated key error: %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2 after rotation", n)
+	}
+
+	// Cached keys keep working while the endpoint is down
+	srv.Close()
+	now = now.Add(2 * time.Hour)
+	if _, err := v.Verify(ctx, oldKey.sign(t, validClaims(now))); err != nil {
+		t.Errorf("Verify() with the JWKS endpoint down error: %v", err)
+	}
+}
+
+func TestRemoteKeySet_FailedRefresh(t *testing.T) {
+	key := newTestKey(t, "2024-01", AlgES256)
+
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(jwksJSON(key))
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeySet(srv.URL, RemoteKeySetConfig{TTL: time.Hour, MinRefresh: time.Minute})
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := keys.Key(ctx, key.kid); err != nil {
+		t.Fatalf("Key() error: %v", err)
+	}
+
+	// Once the cache expires, a failed refetch keeps the last good keys and
+	// is not retried on every lookup
+	failing.Store(true)
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := keys.Key(ctx, key.kid); err != nil {
+			t.Fatalf("Key() with the JWKS endpoint failing error: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2 until the retry time", n)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if _, err := keys.Key(ctx, key.kid); err != nil {
+		t.Fatalf("Key() error: %v", err)
+	}
+	if n := fetches.Load(); n != 3 {
+		t.Errorf("fetches = %d, want 3 after the retry time", n)
+	}
+}
+
+func TestRemoteKeySet_MaxAgeZero(t *testing.T) {
+	key := newTestKey(t, "2024-01", AlgES256)
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Write(jwksJSON(key))
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeySet(srv.URL, RemoteKeySetConfig{MinRefresh: time.Minute})
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// The set is cached for the minimum refresh interval
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		if _, err := keys.Key(ctx, key.kid); err != nil {
+			t.Fatalf("Key() error: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1 within the minimum refresh interval", n)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := keys.Key(ctx, key.kid); err != nil {
+		t.Fatalf("Key() error: %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2 once the interval has passed", n)
+	}
+}
+
+func TestRemoteKeySet_ConcurrentRefresh(t *testing.T) {
+	oldKey := newTestKey(t, "2024-01", AlgES256)
+	newKey := newTestKey(t, "2024-02", AlgES256)
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write(jwksJSON(oldKey, newKey))
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeySet(srv.URL, RemoteKeySetConfig{MinRefresh: time.Nanosecond})
+	ctx := context.Background()
+	if _, err := keys.Key(ctx, oldKey.kid); err != nil {
+		t.Fatalf("Key() error: %v", err)
+	}
+
+	// Lookups of an unknown key ID wait on one shared fetch
+	errs := make(chan error, 5)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := keys.Key(ctx, "2024-03")
+			errs <- err
+		}()
+	}
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Cached keys are served while the fetch is in flight, and a request
+	// that gives up waiting returns
+	if _, err := keys.Key(ctx, oldKey.kid); err != nil {
+		t.Errorf("Key() during a fetch error: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := keys.Key(cancelled, "2024-03"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key() with a cancelled context error = %v, want ErrUnknownKey", err)
+	}
+
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("Key() error = %v, want ErrUnknownKey", err)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+}
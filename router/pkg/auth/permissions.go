@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Permissions restricts what an API key may call. Empty fields do not
+// restrict: a key without routes may call any route.
+type Permissions struct {
+	Scopes  []string `json:"scopes,omitempty"`
+	Routes  []string `json:"routes,omitempty"`  // Path patterns; * matches one segment, ** any number
+	Methods []string `json:"methods,omitempty"` // e.g. GET and HEAD for a read-only key
+}
+
+// AllowsMethod reports whether the method is in the key's method allowlist
+func (p *Permissions) AllowsMethod(method string) bool {
+	if p == nil || len(p.Methods) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Methods, func(m string) bool {
+		return strings.EqualFold(m, method)
+	})
+}
+
+// AllowsPath reports whether the path matches the key's route allowlist
+func (p *Permissions) AllowsPath(path string) bool {
+	if p == nil || len(p.Routes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Routes, func(pattern string) bool {
+		return MatchPathPattern(pattern, path)
+	})
+}
+
+// MissingScopes returns the required scopes that were not granted
+func MissingScopes(granted, required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// MatchPathPattern matches a path against a pattern such as
+// /v1/payments/** or /v1/*/status. A * segment matches exactly one path
+// segment; a trailing ** matches the rest of the path, including nothing.
+func MatchPathPattern(pattern, path string) bool {
+	patternSegs := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegs := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, seg := range patternSegs {
+		if seg == "**" && i == len(patternSegs)-1 {
+			return true
+		}
+		if i >= len(pathSegs) || (seg != "*" && seg != pathSegs[i]) {
+			return false
+		}
+	}
+	return len(pathSegs) == len(patternSegs)
+}
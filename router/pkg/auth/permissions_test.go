@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/v1/payments/**", "/v1/payments", true},
+		{"/v1/payments/**", "/v1/payments/123/refunds", true},
+		{"/v1/payments/**", "/v1/paymentsx", false},
+		{"/v1/payments/**", "/v1/admin/payments", false},
+		{"/v1/*/status", "/v1/orders/status", true},
+		{"/v1/*/status", "/v1/orders/42/status", false},
+		{"/v1/orders", "/v1/orders/", true},
+		{"/v1/orders", "/v1/orders/42", false},
+		{"/**", "/anything/at/all", true},
+	}
+	for _, tt := range tests {
+		if got := MatchPathPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchPathPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	readOnly := &Permissions{Routes: []string{"/v1/payments/**"}, Methods: []string{"GET", "head"}}
+	if !readOnly.AllowsMethod("HEAD") || readOnly.AllowsMethod("POST") {
+		t.Error("method allowlist not applied")
+	}
+	if !readOnly.AllowsPath("/v1/payments/1") || readOnly.AllowsPath("/v1/admin") {
+		t.Error("route allowlist not applied")
+	}
+
+	// Keys without allowlists are unrestricted
+	var unrestricted *Permissions
+	if !unrestricted.AllowsMethod("DELETE") || !unrestricted.AllowsPath("/v1/admin") {
+		t.Error("nil permissions restricted a request")
+	}
+
+	missing := MissingScopes([]string{"payments:read"}, []string{"payments:read", "payments:write"})
+	if !slices.Equal(missing, []string{"payments:write"}) {
+		t.Errorf("MissingScopes() = %v", missing)
+	}
+}
@@ -35,6 +35,12 @@ type Components struct {
 	Firestore ComponentStatus `json:"firestore"`
 	PubSub    ComponentStatus `json:"pubsub"`
 	BigQuery  ComponentStatus `json:"bigquery"`
+	RateLimit ComponentStatus `json:"rate_limit,omitempty"`
+}
+
+// RateLimitStatus reports whether distributed rate limiting is degraded
+type RateLimitStatus interface {
+	Degraded() bool
 }
 
 // Checker performs health checks on router components
@@ -42,6 +48,7 @@ type Checker struct {
 	policyStore       *policy.Store
 	pubsubTopic       *pubsub.Topic
 	observabilityInit bool
+	rateLimit         RateLimitStatus
 	logger            *zap.Logger
 }
 
@@ -55,6 +62,14 @@ func NewChecker(policyStore *policy.Store, pubsubTopic *pubsub.Topic, observabil
 	}
 }
 
+// WithRateLimit adds the rate limiter's Redis status to the health response.
+// Rate limiting without Redis is degraded, not down: limits are still
+// enforced by the failure policy.
+func (c *Checker) WithRateLimit(status RateLimitStatus) *Checker {
+	c.rateLimit = status
+	return c
+}
+
 // CheckHealth performs all health checks and returns the complete health response
 func (c *Checker) CheckHealth(ctx context.Context) HealthResponse {
 	// Get component health statuses
@@ -65,6 +80,17 @@ func (c *Checker) CheckHealth(ctx context.Context) HealthResponse {
 	// Determine overall status
 	overallStatus := c.determineOverallStatus(firestoreStatus, pubsubStatus, bigqueryStatus)
 
+	var rateLimitStatus ComponentStatus
+	if c.rateLimit != nil {
+		rateLimitStatus = StatusHealthy
+		if c.rateLimit.Degraded() {
+			rateLimitStatus = StatusDegraded
+			if overallStatus == StatusHealthy {
+				overallStatus = StatusDegraded
+			}
+		}
+	}
+
 	// Get version from environment or default
 	version := os.Getenv("VERSION")
 	if version == "" {
@@ -79,6 +105,7 @@ func (c *Checker) CheckHealth(ctx context.Context) HealthResponse {
 			Firestore: firestoreStatus,
 			PubSub:    pubsubStatus,
 			BigQuery:  bigqueryStatus,
+			RateLimit: rateLimitStatus,
 		},
 	}
 }
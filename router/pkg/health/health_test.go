@@ -323,3 +323,31 @@ func TestTimestampFormat(t *testing.T) {
 		t.Errorf("timestamp is not valid RFC3339: %v", err)
 	}
 }
+
+type rateLimitStatus bool
+
+func (s rateLimitStatus) Degraded() bool { return bool(s) }
+
+func TestRateLimitStatus(t *testing.T) {
+	logger := zap.NewNop()
+	ctx := context.Background()
+
+	health := NewChecker(nil, nil, false, logger).CheckHealth(ctx)
+	if health.Components.RateLimit != "" {
+		t.Errorf("expected no rate_limit component, got %s", health.Components.RateLimit)
+	}
+
+	health = NewChecker(nil, nil, false, logger).WithRateLimit(rateLimitStatus(false)).CheckHealth(ctx)
+	if health.Components.RateLimit != StatusHealthy {
+		t.Errorf("expected rate_limit healthy, got %s", health.Components.RateLimit)
+	}
+
+	health = NewChecker(nil, nil, false, logger).WithRateLimit(rateLimitStatus(true)).CheckHealth(ctx)
+	if health.Components.RateLimit != StatusDegraded {
+		t.Errorf("expected rate_limit degraded, got %s", health.Components.RateLimit)
+	}
+	// Critical components still decide when the router is down
+	if health.Status != StatusDown {
+		t.Errorf("expected overall down, got %s", health.Status)
+	}
+}
@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// StateClosed lets all requests through and counts consecutive failures
+	StateClosed BreakerState = iota
+	// StateOpen rejects all requests until the open timeout elapses
+	StateOpen
+	// StateHalfOpen lets a limited number of probe requests through
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// Outcome is the result of a request guarded by a circuit breaker
+type Outcome int
+
+const (
+	// OutcomeSuccess resets the consecutive failure count
+	OutcomeSuccess Outcome = iota
+	// OutcomeFailure counts towards tripping the breaker
+	OutcomeFailure
+	// OutcomeIgnored does not affect the breaker (e.g. client cancellation)
+	OutcomeIgnored
+)
+
+// BreakerConfig holds circuit breaker thresholds
+type BreakerConfig struct {
+	ErrorThreshold      int           // Consecutive failures before the circuit opens
+	OpenTimeout         time.Duration // Time to wait before probing the backend again
+	HalfOpenMaxRequests int           // Concurrent probe requests allowed while half-open
+}
+
+// DefaultBreakerConfig returns the defaults from the Route CRD
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		ErrorThreshold:      50,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenMaxRequests: 1,
+	}
+}
+
+// CircuitOpenError is returned when a request is rejected by an open circuit
+type CircuitOpenError struct {
+	Backend    string
+	RetryAfter time.Duration // Time until the breaker lets a probe through
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s (retry after %s)", e.Backend, e.RetryAfter)
+}
+
+// CircuitBreaker is a closed/open/half-open breaker for a route's backend.
+//
+// In the closed state every request is allowed and consecutive failures are
+// counted; reaching ErrorThreshold opens the circuit. While open, requests
+// fail fast until OpenTimeout has elapsed, after which the breaker is
+// half-open and lets up to HalfOpenMaxRequests probes through. A successful
+// probe closes the circuit, a failed one opens it again.
+type CircuitBreaker struct {
+	route   string
+	backend string
+
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int  // in-flight half-open probes
+	removed  bool // dropped from its registry; no longer exports metrics
+
+	now func() time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker for a route's backend
+func NewCircuitBreaker(route, backend string, cfg BreakerConfig) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		route:   route,
+		backend: backend,
+		cfg:     normalizeBreakerConfig(cfg),
+		now:     time.Now,
+	}
+	cb.publish(StateClosed)
+	return cb
+}
+
+func normalizeBreakerConfig(cfg BreakerConfig) BreakerConfig {
+	defaults := DefaultBreakerConfig()
+	if cfg.ErrorThreshold <= 0 {
+		cfg.ErrorThreshold = defaults.ErrorThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaults.OpenTimeout
+	}
+	if cfg.HalfOpenMaxRequests <= 0 {
+		cfg.HalfOpenMaxRequests = defaults.HalfOpenMaxRequests
+	}
+	return cfg
+}
+
+// Configure updates the breaker thresholds without resetting its state
+func (cb *CircuitBreaker) Configure(cfg BreakerConfig) {
+	cb.mu.Lock()
+	cb.cfg = normalizeBreakerConfig(cfg)
+	cb.mu.Unlock()
+}
+
+// State returns the current breaker state
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == StateOpen && cb.now().Sub(cb.openedAt) >= cb.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return cb.state
+}
+
+// Allow asks the breaker to let a request through. On success the caller
+// must report the request's outcome through the returned done function
+// exactly once. When the circuit is open it returns a *CircuitOpenError.
+func (cb *CircuitBreaker) Allow() (done func(Outcome), err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	if cb.state == StateOpen {
+		if wait := cb.cfg.OpenTimeout - now.Sub(cb.openedAt); wait > 0 {
+			cb.reject()
+			return nil, &CircuitOpenError{Backend: cb.backend, RetryAfter: wait}
+		}
+		cb.transition(StateHalfOpen)
+	}
+
+	probe := false
+	if cb.state == StateHalfOpen {
+		if cb.probes >= cb.cfg.HalfOpenMaxRequests {
+			cb.reject()
+			return nil, &CircuitOpenError{Backend: cb.backend, RetryAfter: time.Second}
+		}
+		cb.probes++
+		probe = true
+	}
+
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() { cb.record(outcome, probe) })
+	}, nil
+}
+
+// record applies the outcome of a request to the breaker state
+func (cb *CircuitBreaker) record(outcome Outcome, probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe {
+		cb.probes--
+	}
+
+	switch outcome {
+	case OutcomeSuccess:
+		cb.failures = 0
+		if cb.state == StateHalfOpen {
+			cb.transition(StateClosed)
+		}
+
+	case OutcomeFailure:
+		cb.failures++
+		if cb.state == StateHalfOpen || (cb.state == StateClosed && cb.failures >= cb.cfg.ErrorThreshold) {
+			cb.openedAt = cb.now()
+			cb.transition(StateOpen)
+		}
+	}
+}
+
+// transition moves the breaker to a new state; callers hold cb.mu
+func (cb *CircuitBreaker) transition(to BreakerState) {
+	if cb.state == to {
+		return
+	}
+	if to == StateOpen && !cb.removed {
+		metrics.CircuitBreakerTrips.WithLabelValues(cb.route, cb.backend).Inc()
+	}
+	if to == StateClosed {
+		cb.failures = 0
+	}
+	cb.state = to
+	cb.publish(to)
+}
+
+// reject counts a request rejected by the open circuit; callers hold cb.mu
+func (cb *CircuitBreaker) reject() {
+	if !cb.removed {
+		metrics.CircuitBreakerRejections.WithLabelValues(cb.route, cb.backend).Inc()
+	}
+}
+
+// publish exports the breaker state as one-hot gauges; callers hold cb.mu
+func (cb *CircuitBreaker) publish(current BreakerState) {
+	if cb.removed {
+		return
+	}
+	for _, s := range []BreakerState{StateClosed, StateOpen, StateHalfOpen} {
+		value := 0.0
+		if s == current {
+			value = 1
+		}
+		metrics.CircuitBreakerState.WithLabelValues(cb.route, cb.backend, s.String()).Set(value)
+	}
+}
+
+// remove deletes the breaker's metrics. Requests still in flight on a
+// replaced route table may keep using it, but it no longer exports metrics.
+func (cb *CircuitBreaker) remove() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.removed = true
+	for _, s := range []BreakerState{StateClosed, StateOpen, StateHalfOpen} {
+		metrics.CircuitBreakerState.DeleteLabelValues(cb.route, cb.backend, s.String())
+	}
+	metrics.CircuitBreakerTrips.DeleteLabelValues(cb.route, cb.backend)
+	metrics.CircuitBreakerRejections.DeleteLabelValues(cb.route, cb.backend)
+}
+
+// breakerKey identifies a breaker in a BreakerRegistry
+type breakerKey struct {
+	route   string
+	backend string
+}
+
+// BreakerRegistry holds one circuit breaker per route and backend. Breakers
+// outlive route reloads so that a reload does not reset a tripped circuit;
+// Retain drops those of routes that were removed.
+type BreakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[breakerKey]*CircuitBreaker
+}
+
+// NewBreakerRegistry creates an empty registry
+func NewBreakerRegistry() *BreakerRegistry {
+	return &BreakerRegistry{breakers: make(map[breakerKey]*CircuitBreaker)}
+}
+
+// Get returns the breaker for a route's backend, creating it if needed. If
+// the breaker already exists its thresholds are updated to cfg. Routes
+// sharing a backend get separate breakers, each with its own thresholds.
+func (r *BreakerRegistry) Get(route, backend string, cfg BreakerConfig) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := breakerKey{route: route, backend: backend}
+	if cb, ok := r.breakers[key]; ok {
+		cb.Configure(cfg)
+		return cb
+	}
+	cb := NewCircuitBreaker(route, backend, cfg)
+	r.breakers[key] = cb
+	return cb
+}
+
+// Retain drops every breaker not in live, e.g. those of the routes removed
+// by a reload, and deletes their metrics
+func (r *BreakerRegistry) Retain(live []*CircuitBreaker) {
+	keep := make(map[*CircuitBreaker]bool, len(live))
+	for _, cb := range live {
+		keep[cb] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, cb := range r.breakers {
+		if !keep[cb] {
+			delete(r.breakers, key)
+			cb.remove()
+		}
+	}
+}
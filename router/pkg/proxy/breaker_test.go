@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced time source
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(threshold int, timeout time.Duration) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	cb := NewCircuitBreaker("/orders", "http://backend.test", BreakerConfig{ErrorThreshold: threshold, OpenTimeout: timeout})
+	cb.now = clock.now
+	return cb, clock
+}
+
+func record(t *testing.T, cb *CircuitBreaker, outcome Outcome) {
+	t.Helper()
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow() rejected request in state %s: %v", cb.State(), err)
+	}
+	done(outcome)
+}
+
+func TestCircuitBreaker_TripsAfterConsecutiveFailures(t *testing.T) {
+	cb, _ := newTestBreaker(3, 10*time.Second)
+
+	record(t, cb, OutcomeFailure)
+	record(t, cb, OutcomeFailure)
+	record(t, cb, OutcomeSuccess) // resets the count
+	record(t, cb, OutcomeFailure)
+	record(t, cb, OutcomeFailure)
+	if cb.State() != StateClosed {
+		t.Fatalf("state = %s, want closed", cb.State())
+	}
+
+	record(t, cb, OutcomeFailure)
+	if cb.State() != StateOpen {
+		t.Fatalf("state = %s, want open", cb.State())
+	}
+
+	_, err := cb.Allow()
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if openErr.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %v, want 10s", openErr.RetryAfter)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	cb, clock := newTestBreaker(1, 5*time.Second)
+	record(t, cb, OutcomeFailure)
+
+	clock.advance(2 * time.Second)
+	var openErr *CircuitOpenError
+	if _, err := cb.Allow(); !errors.As(err, &openErr) || openErr.RetryAfter != 3*time.Second {
+		t.Fatalf("expected open with 3s remaining, got %v", err)
+	}
+
+	clock.advance(3 * time.Second)
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("state = %s, want half_open", cb.State())
+	}
+
+	// Only one probe at a time
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if _, err := cb.Allow(); err == nil {
+		t.Fatal("expected concurrent probe to be rejected")
+	}
+
+	// A failed probe re-opens the circuit for a full timeout
+	done(OutcomeFailure)
+	if cb.State() != StateOpen {
+		t.Fatalf("state = %s, want open after failed probe", cb.State())
+	}
+
+	clock.advance(5 * time.Second)
+	record(t, cb, OutcomeSuccess)
+	if cb.State() != StateClosed {
+		t.Fatalf("state = %s, want closed after successful probe", cb.State())
+	}
+}
+
+func TestCircuitBreaker_IgnoredOutcome(t *testing.T) {
+	cb, clock := newTestBreaker(1, time.Second)
+	record(t, cb, OutcomeFailure)
+	clock.advance(time.Second)
+
+	// An abandoned probe frees the slot without changing state
+	record(t, cb, OutcomeIgnored)
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("state = %s, want half_open", cb.State())
+	}
+	record(t, cb, OutcomeSuccess)
+	if cb.State() != StateClosed {
+		t.Fatalf("state = %s, want closed", cb.State())
+	}
+}
+
+func TestBreakerRegistry_BreakerPerRouteAndBackend(t *testing.T) {
+	registry := NewBreakerRegistry()
+	a := registry.Get("/orders", "http://a", BreakerConfig{ErrorThreshold: 1})
+	if registry.Get("/orders", "http://a", BreakerConfig{ErrorThreshold: 2}) != a {
+		t.Fatal("expected the same breaker for the same route and backend")
+	}
+	if registry.Get("/orders", "http://b", BreakerConfig{}) == a {
+		t.Fatal("expected a separate breaker per backend")
+	}
+
+	// A route sharing the backend keeps its own thresholds
+	shared := registry.Get("/invoices", "http://a", BreakerConfig{ErrorThreshold: 1})
+	if shared == a {
+		t.Fatal("expected a separate breaker per route")
+	}
+	record(t, shared, OutcomeFailure)
+	if shared.State() != StateOpen {
+		t.Errorf("state = %s, want open with its own threshold", shared.State())
+	}
+
+	// The latest configuration applies
+	record(t, a, OutcomeFailure)
+	if a.State() != StateClosed {
+		t.Errorf("state = %s, want closed with updated threshold", a.State())
+	}
+}
+
+func TestBreakerRegistry_Retain(t *testing.T) {
+	registry := NewBreakerRegistry()
+	kept := registry.Get("/orders", "http://a", BreakerConfig{})
+	dropped := registry.Get("/invoices", "http://a", BreakerConfig{ErrorThreshold: 1})
+	record(t, dropped, OutcomeFailure)
+
+	registry.Retain([]*CircuitBreaker{kept})
+
+	if len(registry.breakers) != 1 {
+		t.Errorf("registry holds %d breakers, want 1", len(registry.breakers))
+	}
+	if registry.Get("/orders", "http://a", BreakerConfig{}) != kept {
+		t.Error("expected the retained breaker")
+	}
+	if cb := registry.Get("/invoices", "http://a", BreakerConfig{}); cb == dropped || cb.State() != StateClosed {
+		t.Error("expected a new closed breaker for a dropped route")
+	}
+}
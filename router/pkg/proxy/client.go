@@ -5,15 +5,23 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// DeadlineHeader tells the backend how many milliseconds it has left before
+// the router gives up on the request
+const DeadlineHeader = "X-Apx-Deadline-Ms"
+
 // Client handles HTTP proxying to backend services
 type Client struct {
 	httpClient *http.Client
@@ -35,6 +43,10 @@ type Config struct {
 
 	// TLS settings
 	InsecureSkipVerify bool
+
+	// UnencryptedHTTP2 makes the client speak HTTP/2 only, with prior
+	// knowledge (h2c) for http:// backends, as gRPC backends require
+	UnencryptedHTTP2 bool
 }
 
 // DefaultConfig returns sensible defaults
@@ -75,6 +87,12 @@ func NewClient(cfg *Config, logger *zap.Logger) *Client {
 		},
 	}
 
+	if cfg.UnencryptedHTTP2 {
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+
 	return &Client{
 		httpClient: &http.Client{
 			Transport: transport,
@@ -89,6 +107,30 @@ func NewClient(cfg *Config, logger *zap.Logger) *Client {
 
 // ProxyRequestWithPathStrip proxies an HTTP request to a backend, optionally stripping a path prefix
 func (c *Client) ProxyRequestWithPathStrip(ctx context.Context, req *http.Request, backendURL string, pathStrip string) (*http.Response, error) {
+	proxyReq, err := newProxyRequest(ctx, req, backendURL, pathStrip)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log the proxy request
+	c.logger.Debug("proxying request",
+		zap.String("method", proxyReq.Method),
+		zap.String("url", proxyReq.URL.String()),
+		zap.String("backend", backendURL),
+	)
+
+	// Execute the request
+	resp, err := c.httpClient.Do(proxyReq)
+	if err != nil {
+		return nil, fmt.Errorf("backend request failed: %w", err)
+	}
+
+	return resp, nil
+}
+
+// newProxyRequest builds the outgoing request for a backend: the URL is
+// rewritten, hop-by-hop headers are removed and forwarding headers are added
+func newProxyRequest(ctx context.Context, req *http.Request, backendURL string, pathStrip string) (*http.Request, error) {
 	// Parse backend URL
 	backend, err := url.Parse(backendURL)
 	if err != nil {
@@ -122,6 +164,14 @@ func (c *Client) ProxyRequestWithPathStrip(ctx context.Context, req *http.Reques
 		proxyReq.URL.Path = targetPath
 	}
 
+	// Connection-specific headers are not forwarded, except the request for
+	// trailers that gRPC and other trailer-aware backends depend on
+	wantsTrailers := headerHasToken(proxyReq.Header, "Te", "trailers")
+	RemoveHopHeaders(proxyReq.Header)
+	if wantsTrailers {
+		proxyReq.Header.Set("Te", "trailers")
+	}
+
 	// Update Host header to match backend
 	proxyReq.Host = backend.Host
 	proxyReq.Header.Set("Host", backend.Host)
@@ -147,20 +197,13 @@ func (c *Client) ProxyRequestWithPathStrip(ctx context.Context, req *http.Reques
 		}
 	}
 
-	// Log the proxy request
-	c.logger.Debug("proxying request",
-		zap.String("method", proxyReq.Method),
-		zap.String("url", proxyReq.URL.String()),
-		zap.String("backend", backendURL),
-	)
-
-	// Execute the request
-	resp, err := c.httpClient.Do(proxyReq)
-	if err != nil {
-		return nil, fmt.Errorf("backend request failed: %w", err)
+	// Propagate the remaining time budget; never trust a client-supplied value
+	proxyReq.Header.Del(DeadlineHeader)
+	if deadline, ok := ctx.Deadline(); ok {
+		proxyReq.Header.Set(DeadlineHeader, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 0), 10))
 	}
 
-	return resp, nil
+	return proxyReq, nil
 }
 
 // ProxyRequest proxies an HTTP request to a backend (without path stripping)
@@ -174,23 +217,204 @@ func (c *Client) Close() error {
 	return nil
 }
 
-// CopyResponse copies response from backend to client
+// DefaultFlushInterval is how often buffered response data is flushed to the
+// client while a response without a known length is being copied
+const DefaultFlushInterval = 100 * time.Millisecond
+
+// hopHeaders are connection-specific and must not be forwarded by proxies
+// (RFC 9110 section 7.6.1)
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // non-standard, sent by some clients
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopHeaders deletes hop-by-hop headers, including any listed in the
+// Connection header
+func RemoveHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// headerHasToken reports whether a comma-separated header contains token,
+// ignoring case
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(textproto.TrimString(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CopyResponse copies response from backend to client: end-to-end headers
+// first, then the status code, the body and finally any trailers.
+//
+// Event streams and gRPC messages are flushed after every write and other
+// responses without a known length every DefaultFlushInterval, so SSE,
+// streaming and chunked backends reach the client as they are produced. The copy stops with an error as soon as
+// the client goes away or the backend body fails, e.g. because the request
+// context was canceled.
 func CopyResponse(dst http.ResponseWriter, src *http.Response) error {
-	// Copy status code
-	dst.WriteHeader(src.StatusCode)
+	defer src.Body.Close()
 
-	// Copy headers
+	header := dst.Header()
 	for key, values := range src.Header {
 		for _, value := range values {
-			dst.Header().Add(key, value)
+			header.Add(key, value)
 		}
 	}
+	RemoveHopHeaders(header)
 
-	// Copy body
-	_, err := io.Copy(dst, src.Body)
-	if err != nil {
+	// Announce trailers known in advance so the client can expect them
+	announced := len(src.Trailer)
+	if announced > 0 {
+		names := make([]string, 0, announced)
+		for name := range src.Trailer {
+			names = append(names, name)
+		}
+		header.Add("Trailer", strings.Join(names, ", "))
+	}
+
+	dst.WriteHeader(src.StatusCode)
+
+	if err := copyBody(dst, src.Body, flushInterval(src)); err != nil {
 		return fmt.Errorf("failed to copy response body: %w", err)
 	}
 
-	return src.Body.Close()
+	// Trailers are only complete once the body has been read. Trailers that
+	// were not announced are sent with the TrailerPrefix.
+	if len(src.Trailer) > 0 {
+		for name, values := range src.Trailer {
+			if len(src.Trailer) != announced {
+				name = http.TrailerPrefix + name
+			}
+			for _, value := range values {
+				header.Add(name, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// flushInterval returns how often to flush a response; negative means after
+// every write and zero means never
+func flushInterval(res *http.Response) time.Duration {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if base, _ := grpcMediaType(mediaType); mediaType == "text/event-stream" || base != "" {
+		return -1
+	}
+	if res.ContentLength == -1 {
+		return DefaultFlushInterval
+	}
+	return 0
+}
+
+// copyBody copies src to dst, flushing according to interval
+func copyBody(dst http.ResponseWriter, src io.Reader, interval time.Duration) error {
+	rc := http.NewResponseController(dst)
+	var w io.Writer = dst
+	if interval != 0 {
+		fw := &flushWriter{dst: dst, rc: rc, interval: interval}
+		defer fw.stop()
+		w = fw
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// flushWriter flushes after every write (negative interval) or at most once
+// per interval while data is pending
+type flushWriter struct {
+	dst      io.Writer
+	rc       *http.ResponseController
+	interval time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending bool
+	stopped bool
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.dst.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if w.interval < 0 {
+		w.flush()
+		return n, nil
+	}
+	if !w.pending {
+		w.pending = true
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.interval, w.delayedFlush)
+		} else {
+			w.timer.Reset(w.interval)
+		}
+	}
+	return n, nil
+}
+
+func (w *flushWriter) delayedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending && !w.stopped {
+		w.flush()
+	}
+}
+
+// flush flushes buffered data to the client; callers hold w.mu
+func (w *flushWriter) flush() {
+	w.pending = false
+	// Writers that cannot flush simply keep buffering
+	_ = w.rc.Flush()
+}
+
+// stop flushes any pending data and stops the timer
+func (w *flushWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.pending {
+		w.flush()
+	}
 }
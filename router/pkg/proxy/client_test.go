@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestProxy starts a front server that proxies every request to backend
+func newTestProxy(t *testing.T, backend http.Handler) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(backend)
+	t.Cleanup(upstream.Close)
+
+	client := NewClient(nil, zap.NewNop())
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := client.ProxyRequest(r.Context(), r, upstream.URL)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		CopyResponse(w, resp)
+	}))
+	t.Cleanup(front.Close)
+	return front
+}
+
+func TestCopyResponse_Headers(t *testing.T) {
+	front := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Hop") != "" || r.Header.Get("Te") != "trailers" {
+			t.Errorf("hop-by-hop request headers forwarded: %v", r.Header)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("Connection", "X-Internal")
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL, nil)
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Te", "gzip, trailers")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("status = %d, want 201", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", resp.Header.Get("Content-Type"))
+	}
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) != 2 {
+		t.Errorf("Set-Cookie = %v, want both cookies", cookies)
+	}
+	if resp.Header.Get("X-Internal") != "" || resp.Header.Get("Keep-Alive") != "" {
+		t.Errorf("hop-by-hop response headers forwarded: %v", resp.Header)
+	}
+}
+
+func TestCopyResponse_Trailers(t *testing.T) {
+	front := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("payload"))
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Late", "late")
+	}))
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.ReadAll(resp.Body)
+
+	if resp.Trailer.Get("X-Checksum") != "abc123" || resp.Trailer.Get("X-Late") != "late" {
+		t.Errorf("trailers = %v, want X-Checksum and X-Late", resp.Trailer)
+	}
+}
+
+func TestCopyResponse_FlushesEventStreams(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	front := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The first event must arrive while the backend is still streaming
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		if s != "data: first\n" {
+			t.Errorf("first line = %q", s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not flushed to the client")
+	}
+}
+
+func TestCopyResponse_PropagatesClientCancellation(t *testing.T) {
+	backendDone := make(chan struct{})
+	front := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 64)))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(backendDone)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, front.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.ReadFull(resp.Body, make([]byte, 64))
+	cancel()
+
+	select {
+	case <-backendDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend request was not canceled after the client went away")
+	}
+}
@@ -0,0 +1,421 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// gRPC content types (the +proto, +json, ... suffix names the message codec)
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// grpcWebTrailerFlag marks the frame that carries the trailers of a gRPC-Web
+// response in the body
+const grpcWebTrailerFlag = 0x80
+
+// GRPCResult describes a proxied gRPC or gRPC-Web call
+type GRPCResult struct {
+	Web        bool       // The client spoke gRPC-Web
+	StatusCode int        // Backend HTTP status (0 if nothing was written to the client)
+	Code       codes.Code // gRPC status of the call
+	Message    string     // gRPC status message
+}
+
+// grpcMediaType splits a gRPC content type into its base type and codec
+// suffix, e.g. "application/grpc-web+proto" into "application/grpc-web" and
+// "+proto". The base type is empty for other content types.
+func grpcMediaType(contentType string) (base, suffix string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ""
+	}
+	base, suffix = mediaType, ""
+	if i := strings.IndexByte(mediaType, '+'); i >= 0 {
+		base, suffix = mediaType[:i], mediaType[i:]
+	}
+	switch base {
+	case grpcContentType, grpcWebContentType, grpcWebTextContentType:
+		return base, suffix
+	}
+	return "", ""
+}
+
+// IsGRPCRequest reports whether r is a gRPC call over HTTP/2
+func IsGRPCRequest(r *http.Request) bool {
+	base, _ := grpcMediaType(r.Header.Get("Content-Type"))
+	return base == grpcContentType
+}
+
+// IsGRPCWebRequest reports whether r is a gRPC-Web call, e.g. from a browser
+func IsGRPCWebRequest(r *http.Request) bool {
+	base, _ := grpcMediaType(r.Header.Get("Content-Type"))
+	return base == grpcWebContentType || base == grpcWebTextContentType
+}
+
+// GRPCTimeout parses the grpc-timeout header set by gRPC clients
+func GRPCTimeout(h http.Header) (time.Duration, bool) {
+	value := h.Get("Grpc-Timeout")
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// GRPCCodeFromHTTPStatus maps the HTTP status of a response without a
+// grpc-status onto a gRPC code, as gRPC clients do
+func GRPCCodeFromHTTPStatus(status int) codes.Code {
+	switch status {
+	case http.StatusOK:
+		return codes.Unknown // grpc-status missing
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// HTTPStatusFromGRPCCode maps a gRPC code onto the closest HTTP status, so
+// gRPC calls (always answered with HTTP 200) can share HTTP status labels
+func HTTPStatusFromGRPCCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client Closed Request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteGRPCError answers a gRPC or gRPC-Web call with a trailers-only
+// response carrying code and message
+func WriteGRPCError(w http.ResponseWriter, r *http.Request, code codes.Code, message string) {
+	contentType := grpcContentType
+	if IsGRPCWebRequest(r) {
+		contentType = r.Header.Get("Content-Type")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes a grpc-message value
+func encodeGRPCMessage(message string) string {
+	return strings.ReplaceAll(url.PathEscape(message), "%20", " ")
+}
+
+// grpcStatus reads the gRPC status of a response from its trailers, or from
+// its headers for trailers-only responses
+func grpcStatus(resp *http.Response) (codes.Code, string) {
+	for _, h := range []http.Header{resp.Trailer, resp.Header} {
+		if value := h.Get("Grpc-Status"); value != "" {
+			code, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return codes.Unknown, "invalid grpc-status " + value
+			}
+			message, err := url.PathUnescape(h.Get("Grpc-Message"))
+			if err != nil {
+				message = h.Get("Grpc-Message")
+			}
+			return codes.Code(code), message
+		}
+	}
+	return GRPCCodeFromHTTPStatus(resp.StatusCode), fmt.Sprintf("backend answered HTTP %d without grpc-status", resp.StatusCode)
+}
+
+// ProxyGRPC proxies a gRPC call to a backend over HTTP/2, streaming messages
+// in both directions as they arrive. gRPC-Web calls are translated to gRPC on
+// the way in and back to gRPC-Web, with the trailers in the body, on the way
+// out. The client must have been built with Config.UnencryptedHTTP2 to reach
+// plaintext backends.
+//
+// ctx bounds the whole call, including streams. Errors returned with a zero
+// StatusCode mean nothing has been written to the client yet, and Code tells
+// the caller which status to answer with.
+func (c *Client) ProxyGRPC(ctx context.Context, w http.ResponseWriter, req *http.Request, backendURL, pathStrip string) (*GRPCResult, error) {
+	base, suffix := grpcMediaType(req.Header.Get("Content-Type"))
+	result := &GRPCResult{Web: base != grpcContentType}
+
+	proxyReq, err := newProxyRequest(ctx, req, backendURL, pathStrip)
+	if err != nil {
+		result.Code = codes.Internal
+		return result, err
+	}
+	proxyReq.Header.Set("Te", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		proxyReq.Header.Set("Grpc-Timeout", strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 0), 10)+"m")
+	}
+	if result.Web {
+		proxyReq.Header.Set("Content-Type", grpcContentType+suffix)
+		proxyReq.Header.Del("X-Grpc-Web")
+		if base == grpcWebTextContentType {
+			proxyReq.Body = io.NopCloser(&base64Reader{r: req.Body})
+			proxyReq.ContentLength = -1
+			proxyReq.Header.Del("Content-Length")
+		}
+	}
+
+	// The route timeout bounds the call, not the server's read and write
+	// timeouts; HTTP/1 gRPC-Web clients may still be sending while the
+	// response starts
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	_ = rc.EnableFullDuplex()
+
+	c.logger.Debug("proxying grpc call",
+		zap.String("url", proxyReq.URL.String()),
+		zap.String("backend", backendURL),
+		zap.Bool("grpc_web", result.Web),
+	)
+
+	resp, err := c.httpClient.Do(proxyReq)
+	if err != nil {
+		result.Code = codes.Unavailable
+		if ctx.Err() != nil {
+			result.Code = codes.DeadlineExceeded
+			if errors.Is(ctx.Err(), context.Canceled) {
+				result.Code = codes.Canceled
+			}
+		}
+		return result, fmt.Errorf("backend grpc request failed: %w", err)
+	}
+	result.StatusCode = resp.StatusCode
+
+	if result.Web {
+		err = copyGRPCWebResponse(w, resp, base+suffix)
+	} else {
+		err = CopyResponse(w, resp)
+	}
+	if err != nil {
+		// The status never arrived; tell the client why the stream ended
+		result.Code, result.Message = codes.Unavailable, "backend stream failed"
+		if ctx.Err() != nil {
+			result.Code, result.Message = codes.DeadlineExceeded, "deadline exceeded"
+			if errors.Is(ctx.Err(), context.Canceled) {
+				result.Code, result.Message = codes.Canceled, "call canceled"
+			}
+		}
+		trailer := http.Header{}
+		trailer.Set("Grpc-Status", strconv.Itoa(int(result.Code)))
+		trailer.Set("Grpc-Message", encodeGRPCMessage(result.Message))
+		if result.Web {
+			grpcWebBody(w, base).Write(grpcWebTrailerFrame(trailer))
+			_ = rc.Flush()
+		} else {
+			for name, values := range trailer {
+				w.Header()[http.TrailerPrefix+name] = values
+			}
+		}
+		return result, err
+	}
+
+	result.Code, result.Message = grpcStatus(resp)
+	return result, nil
+}
+
+// copyGRPCWebResponse relays a gRPC response to a gRPC-Web client: the
+// messages are flushed as they arrive (base64 encoded for grpc-web-text)
+// and the trailers are sent as the final frame of the body
+func copyGRPCWebResponse(dst http.ResponseWriter, src *http.Response, contentType string) error {
+	defer src.Body.Close()
+
+	header := dst.Header()
+	for key, values := range src.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	RemoveHopHeaders(header)
+	header.Del("Content-Length")
+	header.Set("Content-Type", contentType)
+
+	dst.WriteHeader(src.StatusCode)
+
+	base, _ := grpcMediaType(contentType)
+	fw := &flushWriter{dst: grpcWebBody(dst, base), rc: http.NewResponseController(dst), interval: -1}
+	defer fw.stop()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := src.Body.Read(buf)
+		if n > 0 {
+			if _, err := fw.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to copy response body: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to copy response body: %w", readErr)
+		}
+	}
+
+	// Trailers-only responses already carried the status in the headers
+	if len(src.Trailer) > 0 {
+		if _, err := fw.Write(grpcWebTrailerFrame(src.Trailer)); err != nil {
+			return fmt.Errorf("failed to write trailers: %w", err)
+		}
+	}
+	return nil
+}
+
+// grpcWebBody returns the writer for a gRPC-Web response body of the given
+// base content type
+func grpcWebBody(w io.Writer, base string) io.Writer {
+	if base == grpcWebTextContentType {
+		return base64Writer{w}
+	}
+	return w
+}
+
+// grpcWebTrailerFrame encodes trailers as a gRPC-Web trailer frame
+func grpcWebTrailerFrame(trailer http.Header) []byte {
+	names := make([]string, 0, len(trailer))
+	for name := range trailer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var block bytes.Buffer
+	for _, name := range names {
+		for _, value := range trailer[name] {
+			fmt.Fprintf(&block, "%s: %s\r\n", strings.ToLower(name), value)
+		}
+	}
+
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	return append(frame, block.Bytes()...)
+}
+
+// base64Writer base64-encodes every write on its own, which gRPC-Web text
+// clients decode chunk by chunk
+type base64Writer struct {
+	w io.Writer
+}
+
+func (b base64Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(b.w, base64.StdEncoding.EncodeToString(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// base64Reader decodes a gRPC-Web text body. Clients may send it as
+// separately padded base64 chunks, like base64Writer writes responses.
+type base64Reader struct {
+	r   io.Reader
+	in  []byte // Input not decoded yet, less than one quantum
+	out []byte // Decoded output not read yet
+	err error
+}
+
+func (b *base64Reader) Read(p []byte) (int, error) {
+	for len(b.out) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.fill()
+	}
+	n := copy(p, b.out)
+	b.out = b.out[n:]
+	return n, nil
+}
+
+// fill reads more input and decodes its whole 4 byte quanta
+func (b *base64Reader) fill() {
+	var buf [4096]byte
+	n, err := b.r.Read(buf[:])
+	b.in = append(b.in, buf[:n]...)
+
+	whole := len(b.in) - len(b.in)%4
+	out := make([]byte, base64.StdEncoding.DecodedLen(whole))
+	decoded := 0
+	for off := 0; off < whole; {
+		// A chunk ends with the quantum holding its padding
+		end := whole
+		if i := bytes.IndexByte(b.in[off:whole], '='); i >= 0 {
+			end = off + (i/4+1)*4
+		}
+		n, derr := base64.StdEncoding.Decode(out[decoded:], b.in[off:end])
+		decoded += n
+		if derr != nil {
+			b.out, b.err = out[:decoded], fmt.Errorf("invalid grpc-web-text body: %w", derr)
+			return
+		}
+		off = end
+	}
+	b.out = out[:decoded]
+	b.in = append(b.in[:0], b.in[whole:]...)
+
+	if err == io.EOF && len(b.in) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	b.err = err
+}
@@ -0,0 +1,301 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCBackend starts a plaintext gRPC server exposing the health service
+func newGRPCBackend(t *testing.T) (*health.Server, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return hs, "http://" + lis.Addr().String()
+}
+
+// newGRPCProxy starts a front server accepting HTTP/1 and h2c that proxies
+// every call to backend; the result of every call is sent to the channel
+func newGRPCProxy(t *testing.T, backend string) (*httptest.Server, <-chan *GRPCResult) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.UnencryptedHTTP2 = true
+	client := NewClient(cfg, zap.NewNop())
+
+	results := make(chan *GRPCResult, 10)
+	front := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := client.ProxyGRPC(r.Context(), w, r, backend, "")
+		results <- result
+	}))
+	front.Config.Protocols = new(http.Protocols)
+	front.Config.Protocols.SetHTTP1(true)
+	front.Config.Protocols.SetUnencryptedHTTP2(true)
+	front.Start()
+	t.Cleanup(front.Close)
+	return front, results
+}
+
+func dialGRPC(t *testing.T, front *httptest.Server) healthpb.HealthClient {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///"+front.Listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestProxyGRPC_Unary(t *testing.T) {
+	_, backend := newGRPCBackend(t)
+	front, results := newGRPCProxy(t, backend)
+	client := dialGRPC(t, front)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Check() = %v, %v; want SERVING", resp, err)
+	}
+	if result := <-results; result.Code != codes.OK || result.Web {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// Application errors reach the client and the result unchanged
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Check(unknown) error = %v, want NotFound", err)
+	}
+	if result := <-results; result.Code != codes.NotFound {
+		t.Errorf("result code = %v, want NotFound", result.Code)
+	}
+}
+
+func TestProxyGRPC_ServerStreaming(t *testing.T) {
+	hs, backend := newGRPCBackend(t)
+	front, _ := newGRPCProxy(t, backend)
+	client := dialGRPC(t, front)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+	first, err := stream.Recv()
+	if err != nil || first.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("first update = %v, %v; want SERVING", first, err)
+	}
+
+	// Each message must reach the client while the stream stays open
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	second, err := stream.Recv()
+	if err != nil || second.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("second update = %v, %v; want NOT_SERVING", second, err)
+	}
+}
+
+// grpcWebFrames splits a gRPC-Web response body into its data messages and
+// trailer block
+func grpcWebFrames(t *testing.T, body []byte) (messages [][]byte, trailer string) {
+	t.Helper()
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("truncated frame header: %x", body)
+		}
+		n := binary.BigEndian.Uint32(body[1:5])
+		if uint32(len(body)-5) < n {
+			t.Fatalf("truncated frame: %x", body)
+		}
+		payload := body[5 : 5+n]
+		if body[0]&grpcWebTrailerFlag != 0 {
+			trailer = string(payload)
+		} else {
+			messages = append(messages, payload)
+		}
+		body = body[5+n:]
+	}
+	return messages, trailer
+}
+
+func TestProxyGRPC_Web(t *testing.T) {
+	_, backend := newGRPCBackend(t)
+	front, results := newGRPCProxy(t, backend)
+
+	// An empty HealthCheckRequest is a zero-length message
+	frame := []byte{0, 0, 0, 0, 0}
+
+	tests := []struct {
+		name        string
+		contentType string
+		encode      func([]byte) []byte
+		decode      func([]byte) []byte
+	}{
+		{
+			name:        "binary",
+			contentType: "application/grpc-web+proto",
+			encode:      func(b []byte) []byte { return b },
+			decode:      func(b []byte) []byte { return b },
+		},
+		{
+			name:        "text",
+			contentType: "application/grpc-web-text",
+			encode:      func(b []byte) []byte { return []byte(base64.StdEncoding.EncodeToString(b)) },
+			decode:      decodeBase64Chunks,
+		},
+		{
+			name:        "text chunks",
+			contentType: "application/grpc-web-text",
+			encode: func(b []byte) []byte {
+				return []byte(base64.StdEncoding.EncodeToString(b[:2]) + base64.StdEncoding.EncodeToString(b[2:]))
+			},
+			decode: decodeBase64Chunks,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, front.URL+"/grpc.health.v1.Health/Check", bytes.NewReader(tt.encode(frame)))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Grpc-Web", "1")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != tt.contentType {
+				t.Fatalf("got %d %q, want 200 %q", resp.StatusCode, resp.Header.Get("Content-Type"), tt.contentType)
+			}
+			messages, trailer := grpcWebFrames(t, tt.decode(body))
+			// HealthCheckResponse{Status: SERVING} is field 1 = 1
+			if len(messages) != 1 || !bytes.Equal(messages[0], []byte{0x08, 0x01}) {
+				t.Errorf("messages = %x, want one SERVING response", messages)
+			}
+			if !strings.Contains(trailer, "grpc-status: 0\r\n") {
+				t.Errorf("trailer = %q, want grpc-status 0", trailer)
+			}
+			if result := <-results; !result.Web || result.Code != codes.OK {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+// decodeBase64Chunks decodes concatenated, individually padded base64 chunks
+func decodeBase64Chunks(b []byte) []byte {
+	var out []byte
+	for len(b) > 0 {
+		end := len(b)
+		for i := 0; i+4 <= len(b); i += 4 {
+			if bytes.IndexByte(b[i:i+4], '=') >= 0 {
+				end = i + 4
+				break
+			}
+		}
+		chunk, _ := base64.StdEncoding.DecodeString(string(b[:end]))
+		out = append(out, chunk...)
+		b = b[end:]
+	}
+	return out
+}
+
+func TestBase64Reader(t *testing.T) {
+	enc := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"one chunk", enc([]byte("hello world")), "hello world", false},
+		{"padded chunks", enc([]byte("a")) + enc([]byte("bc")) + enc([]byte("def")), "abcdef", false},
+		{"empty", "", "", false},
+		{"truncated", enc([]byte("hello"))[:6], "hel", true},
+		{"corrupt", "aGVs!!!!", "hel", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte at a time, so quanta and chunks span reads
+			got, err := io.ReadAll(&base64Reader{r: iotest.OneByteReader(strings.NewReader(tt.input))})
+			if string(got) != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("got %q, %v; want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProxyGRPC_UnreachableBackend(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.UnencryptedHTTP2 = true
+	client := NewClient(cfg, zap.NewNop())
+
+	r := httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", nil)
+	r.Header.Set("Content-Type", "application/grpc")
+	result, err := client.ProxyGRPC(r.Context(), httptest.NewRecorder(), r, "http://127.0.0.1:1", "")
+	if err == nil || result.StatusCode != 0 || result.Code != codes.Unavailable {
+		t.Errorf("got %+v, %v; want Unavailable before any response", result, err)
+	}
+}
+
+func TestGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"100m", 100 * time.Millisecond, true},
+		{"5S", 5 * time.Second, true},
+		{"1H", time.Hour, true},
+		{"", 0, false},
+		{"10x", 0, false},
+		{"123456789m", 0, false}, // at most 8 digits
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		h.Set("Grpc-Timeout", tt.value)
+		if got, ok := GRPCTimeout(h); got != tt.want || ok != tt.ok {
+			t.Errorf("GRPCTimeout(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriteGRPCError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/svc/Method", nil)
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	rr := httptest.NewRecorder()
+	WriteGRPCError(rr, r, codes.Unauthenticated, "API key required: 100%")
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/grpc-web+proto" {
+		t.Errorf("got %d %q, want a 200 gRPC-Web response", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if rr.Header().Get("Grpc-Status") != "16" || rr.Header().Get("Grpc-Message") != "API key required: 100%25" {
+		t.Errorf("unexpected status headers: %v", rr.Header())
+	}
+}
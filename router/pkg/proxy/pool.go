@@ -0,0 +1,452 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Load balancing strategies
+const (
+	StrategyRoundRobin       = "round-robin"
+	StrategyLeastConnections = "least-connections"
+	StrategyWeighted         = "weighted"
+	StrategyConsistentHash   = "consistent-hash"
+)
+
+// virtualNodes is the number of hash ring points per unit of endpoint weight
+const virtualNodes = 100
+
+// ErrNoEndpoints is returned when a pool is configured without endpoints
+var ErrNoEndpoints = errors.New("backend pool has no endpoints")
+
+// EndpointConfig is a single pool endpoint
+type EndpointConfig struct {
+	URL    string
+	Weight int
+}
+
+// EjectionConfig controls passive ejection of failing endpoints
+type EjectionConfig struct {
+	ConsecutiveFailures int           // Failures before an endpoint is ejected
+	EjectionTime        time.Duration // How long an ejected endpoint receives no traffic
+}
+
+// HealthCheckConfig controls active health probes; probes are disabled
+// unless Path is set
+type HealthCheckConfig struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// PoolConfig configures a backend pool
+type PoolConfig struct {
+	Name        string
+	Strategy    string
+	Endpoints   []EndpointConfig
+	Ejection    EjectionConfig
+	HealthCheck HealthCheckConfig
+}
+
+// Endpoint is a backend pool member
+type Endpoint struct {
+	URL    string
+	Weight int
+
+	inflight atomic.Int64
+
+	mu             sync.Mutex
+	failures       int       // consecutive failed requests
+	ejectedUntil   time.Time // passive ejection
+	healthy        bool      // active health check state
+	probeFailures  int
+	probeSuccesses int
+
+	currentWeight int // smooth weighted round-robin state, guarded by Pool.mu
+}
+
+// InFlight returns the number of requests currently sent to the endpoint
+func (e *Endpoint) InFlight() int64 {
+	return e.inflight.Load()
+}
+
+// available reports whether the endpoint is healthy and not ejected
+func (e *Endpoint) available(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy && !now.Before(e.ejectedUntil)
+}
+
+type ringPoint struct {
+	hash     uint64
+	endpoint *Endpoint
+}
+
+// Pool spreads requests across backend endpoints.
+//
+// Endpoints that fail ConsecutiveFailures requests in a row are ejected for
+// EjectionTime, and endpoints failing active health probes are skipped until
+// they recover. If every endpoint is unavailable the pool ignores health and
+// keeps serving from all endpoints rather than failing all traffic.
+type Pool struct {
+	name      string
+	strategy  string
+	endpoints []*Endpoint
+	ejection  EjectionConfig
+	health    HealthCheckConfig
+	logger    *zap.Logger
+
+	next atomic.Uint64 // round-robin cursor
+	mu   sync.Mutex    // weighted round-robin state
+	ring []ringPoint   // consistent-hash ring, sorted by hash
+
+	probeClient *http.Client
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+
+	now func() time.Time
+}
+
+// NewPool creates a backend pool and starts active health probes if configured
+func NewPool(cfg PoolConfig, logger *zap.Logger) (*Pool, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	if cfg.Strategy == "" {
+		cfg.Strategy = StrategyRoundRobin
+	}
+	switch cfg.Strategy {
+	case StrategyRoundRobin, StrategyLeastConnections, StrategyWeighted, StrategyConsistentHash:
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", cfg.Strategy)
+	}
+
+	p := &Pool{
+		name:     cfg.Name,
+		strategy: cfg.Strategy,
+		ejection: cfg.Ejection,
+		health:   cfg.HealthCheck,
+		logger:   logger,
+		now:      time.Now,
+	}
+
+	for _, ec := range cfg.Endpoints {
+		weight := ec.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		p.endpoints = append(p.endpoints, &Endpoint{URL: ec.URL, Weight: weight, healthy: true})
+	}
+
+	if p.strategy == StrategyConsistentHash {
+		p.buildRing()
+	}
+
+	if p.health.Path != "" {
+		if p.health.Interval <= 0 {
+			p.health.Interval = 10 * time.Second
+		}
+		if p.health.Timeout <= 0 {
+			p.health.Timeout = 2 * time.Second
+		}
+		if p.health.UnhealthyThreshold <= 0 {
+			p.health.UnhealthyThreshold = 2
+		}
+		if p.health.HealthyThreshold <= 0 {
+			p.health.HealthyThreshold = 2
+		}
+		p.startHealthChecks()
+	}
+
+	return p, nil
+}
+
+// Name returns the pool name
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// Endpoints returns the pool members
+func (p *Pool) Endpoints() []*Endpoint {
+	return p.endpoints
+}
+
+// Pick selects an endpoint for a request and counts it as in flight; the
+// caller must call Release when the request is finished. key is used by the
+// consistent-hash strategy (requests without a key are spread round-robin).
+// avoid, if set, is skipped when another endpoint is available, so retries
+// go to a different endpoint.
+func (p *Pool) Pick(key string, avoid *Endpoint) *Endpoint {
+	candidates := p.candidates(avoid)
+
+	var ep *Endpoint
+	switch {
+	case len(candidates) == 1:
+		ep = candidates[0]
+	case p.strategy == StrategyLeastConnections:
+		ep = p.pickLeastConnections(candidates)
+	case p.strategy == StrategyWeighted:
+		ep = p.pickWeighted(candidates)
+	case p.strategy == StrategyConsistentHash && key != "":
+		ep = p.pickConsistentHash(key, candidates)
+	default:
+		ep = candidates[p.next.Add(1)%uint64(len(candidates))]
+	}
+
+	ep.inflight.Add(1)
+	return ep
+}
+
+// Release marks a request picked from the pool as finished
+func (p *Pool) Release(ep *Endpoint) {
+	ep.inflight.Add(-1)
+}
+
+// Report records the outcome of a request for passive ejection
+func (p *Pool) Report(ep *Endpoint, outcome Outcome) {
+	if outcome == OutcomeIgnored || p.ejection.ConsecutiveFailures <= 0 {
+		return
+	}
+
+	ep.mu.Lock()
+	if outcome == OutcomeSuccess {
+		ep.failures = 0
+		ep.mu.Unlock()
+		return
+	}
+	ep.failures++
+	eject := ep.failures >= p.ejection.ConsecutiveFailures
+	if eject {
+		ep.failures = 0
+		ep.ejectedUntil = p.now().Add(p.ejection.EjectionTime)
+	}
+	ep.mu.Unlock()
+
+	if eject {
+		metrics.BackendEndpointEjections.WithLabelValues(p.name, ep.URL).Inc()
+		p.logger.Warn("ejecting failing backend endpoint",
+			zap.String("pool", p.name),
+			zap.String("endpoint", ep.URL),
+			zap.Duration("ejection_time", p.ejection.EjectionTime),
+		)
+	}
+}
+
+// Close stops active health probes
+func (p *Pool) Close() {
+	if p.cancel != nil {
+		p.cancel()
+		p.wg.Wait()
+	}
+}
+
+// candidates returns the endpoints eligible for the next request
+func (p *Pool) candidates(avoid *Endpoint) []*Endpoint {
+	now := p.now()
+	available := make([]*Endpoint, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		if ep.available(now) {
+			available = append(available, ep)
+		}
+	}
+	if len(available) == 0 {
+		// Panic mode: better to try unhealthy endpoints than to fail everything
+		available = append(available, p.endpoints...)
+	}
+
+	if avoid != nil && len(available) > 1 {
+		filtered := available[:0]
+		for _, ep := range available {
+			if ep != avoid {
+				filtered = append(filtered, ep)
+			}
+		}
+		available = filtered
+	}
+	return available
+}
+
+// pickLeastConnections selects the endpoint with the fewest in-flight
+// requests relative to its weight, starting from a rotating offset so ties
+// are spread evenly
+func (p *Pool) pickLeastConnections(candidates []*Endpoint) *Endpoint {
+	offset := int(p.next.Add(1) % uint64(len(candidates)))
+	best := candidates[offset]
+	for i := 1; i < len(candidates); i++ {
+		ep := candidates[(offset+i)%len(candidates)]
+		if ep.InFlight()*int64(best.Weight) < best.InFlight()*int64(ep.Weight) {
+			best = ep
+		}
+	}
+	return best
+}
+
+// pickWeighted implements smooth weighted round-robin
+func (p *Pool) pickWeighted(candidates []*Endpoint) *Endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	var best *Endpoint
+	for _, ep := range candidates {
+		ep.currentWeight += ep.Weight
+		total += ep.Weight
+		if best == nil || ep.currentWeight > best.currentWeight {
+			best = ep
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// pickConsistentHash walks the hash ring clockwise from the key and returns
+// the first eligible endpoint
+func (p *Pool) pickConsistentHash(key string, candidates []*Endpoint) *Endpoint {
+	eligible := make(map[*Endpoint]bool, len(candidates))
+	for _, ep := range candidates {
+		eligible[ep] = true
+	}
+
+	h := hashKey(key)
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	for i := 0; i < len(p.ring); i++ {
+		point := p.ring[(start+i)%len(p.ring)]
+		if eligible[point.endpoint] {
+			return point.endpoint
+		}
+	}
+	return candidates[0]
+}
+
+// buildRing places virtual nodes for each endpoint on the hash ring
+func (p *Pool) buildRing() {
+	for _, ep := range p.endpoints {
+		for i := 0; i < ep.Weight*virtualNodes; i++ {
+			p.ring = append(p.ring, ringPoint{hash: hashKey(fmt.Sprintf("%s#%d", ep.URL, i)), endpoint: ep})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+}
+
+// hashKey hashes a key with FNV-1a followed by a 64-bit finalizer, which
+// spreads similar keys (e.g. url#1, url#2) evenly around the ring
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// startHealthChecks probes every endpoint on the configured interval
+func (p *Pool) startHealthChecks() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.probeClient = &http.Client{
+		Timeout: p.health.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, ep := range p.endpoints {
+		metrics.BackendEndpointHealthy.WithLabelValues(p.name, ep.URL).Set(1)
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.health.Interval)
+		defer ticker.Stop()
+
+		for {
+			p.probeAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// probeAll probes all endpoints concurrently
+func (p *Pool) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range p.endpoints {
+		wg.Add(1)
+		go func(ep *Endpoint) {
+			defer wg.Done()
+			p.recordProbe(ep, p.probe(ctx, ep))
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// probe sends a health check request; 2xx and 3xx responses are healthy
+func (p *Pool) probe(ctx context.Context, ep *Endpoint) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(ep.URL, "/")+p.health.Path, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", "apx-router-health-check")
+
+	resp, err := p.probeClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+// recordProbe applies a probe result using the healthy/unhealthy thresholds
+func (p *Pool) recordProbe(ep *Endpoint, ok bool) {
+	ep.mu.Lock()
+	changed := false
+	if ok {
+		ep.probeFailures = 0
+		ep.probeSuccesses++
+		if !ep.healthy && ep.probeSuccesses >= p.health.HealthyThreshold {
+			ep.healthy, changed = true, true
+		}
+	} else {
+		ep.probeSuccesses = 0
+		ep.probeFailures++
+		if ep.healthy && ep.probeFailures >= p.health.UnhealthyThreshold {
+			ep.healthy, changed = false, true
+		}
+	}
+	healthy := ep.healthy
+	ep.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	metrics.BackendEndpointHealthy.WithLabelValues(p.name, ep.URL).Set(value)
+	p.logger.Info("backend endpoint health changed",
+		zap.String("pool", p.name),
+		zap.String("endpoint", ep.URL),
+		zap.Bool("healthy", healthy),
+	)
+}
@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestPool(t *testing.T, cfg PoolConfig) *Pool {
+	t.Helper()
+	if cfg.Name == "" {
+		cfg.Name = "test-pool"
+	}
+	p, err := NewPool(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPool() error: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func endpoints(urls ...string) []EndpointConfig {
+	out := make([]EndpointConfig, len(urls))
+	for i, u := range urls {
+		out[i] = EndpointConfig{URL: u}
+	}
+	return out
+}
+
+// pickCounts picks n endpoints, releasing each immediately
+func pickCounts(p *Pool, n int, key string) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		ep := p.Pick(key, nil)
+		counts[ep.URL]++
+		p.Release(ep)
+	}
+	return counts
+}
+
+func TestNewPool_Validation(t *testing.T) {
+	if _, err := NewPool(PoolConfig{Name: "empty"}, zap.NewNop()); err != ErrNoEndpoints {
+		t.Errorf("expected ErrNoEndpoints, got %v", err)
+	}
+	if _, err := NewPool(PoolConfig{Name: "bad", Strategy: "random", Endpoints: endpoints("http://a")}, zap.NewNop()); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestPool_RoundRobin(t *testing.T) {
+	p := newTestPool(t, PoolConfig{Endpoints: endpoints("http://a", "http://b", "http://c")})
+
+	counts := pickCounts(p, 300, "")
+	for _, u := range []string{"http://a", "http://b", "http://c"} {
+		if counts[u] != 100 {
+			t.Errorf("%s picked %d times, want 100", u, counts[u])
+		}
+	}
+}
+
+func TestPool_LeastConnections(t *testing.T) {
+	p := newTestPool(t, PoolConfig{Strategy: StrategyLeastConnections, Endpoints: endpoints("http://a", "http://b")})
+
+	// While one request is held on an endpoint, new requests go to the other
+	busy := p.Pick("", nil)
+	for i := 0; i < 10; i++ {
+		if ep := p.Pick("", nil); ep == busy {
+			t.Fatalf("picked %s with %d in flight", ep.URL, ep.InFlight())
+		} else {
+			p.Release(ep)
+		}
+	}
+
+	p.Release(busy)
+	if counts := pickCounts(p, 10, ""); counts["http://a"] != 5 {
+		t.Errorf("idle endpoints should share traffic evenly, got %v", counts)
+	}
+}
+
+func TestPool_Weighted(t *testing.T) {
+	p := newTestPool(t, PoolConfig{
+		Strategy:  StrategyWeighted,
+		Endpoints: []EndpointConfig{{URL: "http://a", Weight: 3}, {URL: "http://b", Weight: 1}},
+	})
+
+	counts := pickCounts(p, 400, "")
+	if counts["http://a"] != 300 || counts["http://b"] != 100 {
+		t.Errorf("got %v, want 300/100", counts)
+	}
+
+	// Smooth WRR interleaves picks instead of bursting a, a, a, b
+	seq := ""
+	for i := 0; i < 4; i++ {
+		ep := p.Pick("", nil)
+		seq += ep.URL[len(ep.URL)-1:]
+		p.Release(ep)
+	}
+	if seq != "aaba" {
+		t.Errorf("pick sequence = %s, want aaba", seq)
+	}
+}
+
+func TestPool_ConsistentHash(t *testing.T) {
+	urls := []string{"http://a", "http://b", "http://c"}
+	p := newTestPool(t, PoolConfig{Strategy: StrategyConsistentHash, Endpoints: endpoints(urls...)})
+
+	assigned := make(map[string]string)
+	spread := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		ep := p.Pick(key, nil)
+		p.Release(ep)
+		assigned[key] = ep.URL
+		spread[ep.URL]++
+
+		if again := p.Pick(key, nil); again != ep {
+			t.Fatalf("key %s moved from %s to %s", key, ep.URL, again.URL)
+		} else {
+			p.Release(again)
+		}
+	}
+	for _, u := range urls {
+		if spread[u] < 50 {
+			t.Errorf("%s got %d of 300 keys; ring is unbalanced: %v", u, spread[u], spread)
+		}
+	}
+
+	// Ejecting one endpoint only moves the keys it owned
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	p.now = clock.now
+	p.ejection = EjectionConfig{ConsecutiveFailures: 1, EjectionTime: time.Minute}
+	p.Report(p.endpoints[0], OutcomeFailure)
+	for key, url := range assigned {
+		ep := p.Pick(key, nil)
+		p.Release(ep)
+		if url != "http://a" && ep.URL != url {
+			t.Errorf("key %s moved from %s to %s", key, url, ep.URL)
+		}
+		if ep.URL == "http://a" {
+			t.Errorf("key %s still routed to the ejected endpoint", key)
+		}
+	}
+}
+
+func TestPool_PassiveEjection(t *testing.T) {
+	p := newTestPool(t, PoolConfig{
+		Endpoints: endpoints("http://a", "http://b"),
+		Ejection:  EjectionConfig{ConsecutiveFailures: 2, EjectionTime: 30 * time.Second},
+	})
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	p.now = clock.now
+	a := p.endpoints[0]
+
+	p.Report(a, OutcomeFailure)
+	p.Report(a, OutcomeSuccess) // resets the count
+	p.Report(a, OutcomeFailure)
+	if counts := pickCounts(p, 10, ""); counts["http://a"] != 5 {
+		t.Fatalf("endpoint ejected too early: %v", counts)
+	}
+
+	p.Report(a, OutcomeFailure)
+	if counts := pickCounts(p, 10, ""); counts["http://a"] != 0 {
+		t.Errorf("ejected endpoint still picked: %v", counts)
+	}
+
+	clock.advance(30 * time.Second)
+	if counts := pickCounts(p, 10, ""); counts["http://a"] != 5 {
+		t.Errorf("endpoint not restored after the ejection time: %v", counts)
+	}
+}
+
+func TestPool_AllUnavailableFallsBackToAll(t *testing.T) {
+	p := newTestPool(t, PoolConfig{
+		Endpoints: endpoints("http://a", "http://b"),
+		Ejection:  EjectionConfig{ConsecutiveFailures: 1, EjectionTime: time.Minute},
+	})
+	for _, ep := range p.endpoints {
+		p.Report(ep, OutcomeFailure)
+	}
+
+	if counts := pickCounts(p, 10, ""); counts["http://a"] != 5 || counts["http://b"] != 5 {
+		t.Errorf("expected panic mode to use all endpoints, got %v", counts)
+	}
+}
+
+func TestPool_PickAvoidsPreviousEndpoint(t *testing.T) {
+	p := newTestPool(t, PoolConfig{Strategy: StrategyConsistentHash, Endpoints: endpoints("http://a", "http://b")})
+
+	first := p.Pick("tenant-1", nil)
+	p.Release(first)
+	if retry := p.Pick("tenant-1", first); retry == first {
+		t.Errorf("retry picked the same endpoint %s", first.URL)
+	}
+}
+
+func TestPool_ActiveHealthChecks(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+
+	p := newTestPool(t, PoolConfig{
+		Endpoints: endpoints(srv.URL, ok.URL),
+		HealthCheck: HealthCheckConfig{
+			Path:               "/healthz",
+			Interval:           10 * time.Millisecond,
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   2,
+		},
+	})
+	probed := p.endpoints[0]
+
+	waitFor(t, func() bool { return !probed.available(time.Now()) })
+	if counts := pickCounts(p, 4, ""); counts[srv.URL] != 0 {
+		t.Errorf("unhealthy endpoint still picked: %v", counts)
+	}
+
+	healthy.Store(true)
+	waitFor(t, func() bool { return probed.available(time.Now()) })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 2s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
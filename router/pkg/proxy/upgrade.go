@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratus-meridian/apx/router/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// ErrHandshakeTimeout is returned when the backend does not answer an
+// upgrade request within the handshake timeout
+var ErrHandshakeTimeout = errors.New("backend upgrade handshake timed out")
+
+// UpgradeStats describes a proxied connection upgrade
+type UpgradeStats struct {
+	Protocol   string        // Requested protocol, e.g. websocket
+	StatusCode int           // Backend handshake status (101 once upgraded, 0 if the backend was not reached)
+	BytesIn    int64         // Bytes relayed from the client to the backend
+	BytesOut   int64         // Bytes relayed from the backend to the client
+	Duration   time.Duration // Time from the completed handshake until the session closed
+}
+
+// Upgraded reports whether the backend switched protocols
+func (s *UpgradeStats) Upgraded() bool {
+	return s.StatusCode == http.StatusSwitchingProtocols
+}
+
+// HeaderPreparer is implemented by response writers that finish the
+// response headers in WriteHeader, e.g. adding rate limit headers or
+// removing internal ones. A hijacked connection bypasses WriteHeader, so
+// ProxyUpgrade calls PrepareHeader on each writer before writing its 101.
+type HeaderPreparer interface {
+	PrepareHeader(code int)
+}
+
+// prepareHeader calls PrepareHeader on w and the writers it wraps, in the
+// order WriteHeader would reach them
+func prepareHeader(w http.ResponseWriter, code int) {
+	for {
+		if p, ok := w.(HeaderPreparer); ok {
+			p.PrepareHeader(code)
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// IsUpgradeRequest reports whether r asks to switch protocols, e.g. to
+// WebSocket or h2c (RFC 9110 section 7.8)
+func IsUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && headerHasToken(r.Header, "Connection", "upgrade")
+}
+
+// ProxyUpgrade proxies a connection upgrade request to a backend. If the
+// backend switches protocols, the client connection is hijacked and bytes are
+// piped in both directions until either side closes the connection or ctx is
+// done; ProxyUpgrade blocks for the whole session. If the backend declines,
+// its response is relayed to the client like any other response.
+//
+// handshakeTimeout bounds the wait for the backend's handshake response; the
+// session itself has no timeout. Errors returned with a zero StatusCode mean
+// nothing has been written to the client yet.
+func (c *Client) ProxyUpgrade(ctx context.Context, w http.ResponseWriter, req *http.Request, backendURL, pathStrip string, handshakeTimeout time.Duration) (*UpgradeStats, error) {
+	protocol := req.Header.Get("Upgrade")
+	stats := &UpgradeStats{Protocol: strings.ToLower(protocol)}
+
+	// Cancelling the handshake context would also tear down the upgraded
+	// connection, so it lives until the session ends
+	hsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	proxyReq, err := newProxyRequest(hsCtx, req, backendURL, pathStrip)
+	if err != nil {
+		return stats, err
+	}
+	proxyReq.Header.Set("Connection", "Upgrade")
+	proxyReq.Header.Set("Upgrade", protocol)
+
+	c.logger.Debug("proxying upgrade request",
+		zap.String("protocol", stats.Protocol),
+		zap.String("url", proxyReq.URL.String()),
+		zap.String("backend", backendURL),
+	)
+
+	var timer *time.Timer
+	if handshakeTimeout > 0 {
+		timer = time.AfterFunc(handshakeTimeout, cancel)
+	}
+	resp, err := c.httpClient.Do(proxyReq)
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return stats, ErrHandshakeTimeout
+	}
+	if err != nil {
+		return stats, fmt.Errorf("backend upgrade request failed: %w", err)
+	}
+	stats.StatusCode = resp.StatusCode
+	metrics.UpgradeSessions.WithLabelValues(stats.Protocol, strconv.Itoa(resp.StatusCode)).Inc()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// The backend declined the upgrade; relay its answer
+		return stats, CopyResponse(w, resp)
+	}
+	defer resp.Body.Close()
+
+	// Until the client connection is hijacked nothing has been sent to the
+	// client, which the zero StatusCode tells the caller
+	switched := resp.Header.Get("Upgrade")
+	if !strings.EqualFold(switched, protocol) {
+		stats.StatusCode = 0
+		return stats, fmt.Errorf("backend switched to protocol %q, client asked for %q", switched, protocol)
+	}
+	backConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		stats.StatusCode = 0
+		return stats, errors.New("backend upgrade response body is not writable")
+	}
+
+	clientConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		stats.StatusCode = 0
+		return stats, fmt.Errorf("failed to hijack client connection: %w", err)
+	}
+	defer clientConn.Close()
+
+	// Read and write deadlines set by the server for the handshake must not
+	// end the session
+	clientConn.SetDeadline(time.Time{})
+
+	// Complete the handshake with the client, keeping the headers set by the
+	// middleware chain (request ID, rate limit headers, ...)
+	header := w.Header()
+	RemoveHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	prepareHeader(w, http.StatusSwitchingProtocols)
+	header.Set("Connection", "Upgrade")
+	header.Set("Upgrade", switched)
+	handshake := &http.Response{
+		StatusCode: http.StatusSwitchingProtocols,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+	}
+	if err := handshake.Write(brw); err != nil {
+		return stats, fmt.Errorf("failed to write handshake response: %w", err)
+	}
+	if err := brw.Flush(); err != nil {
+		return stats, fmt.Errorf("failed to write handshake response: %w", err)
+	}
+
+	start := time.Now()
+	var bytesIn, bytesOut int64
+	errc := make(chan error, 2)
+	go func() {
+		// The client may have sent data right after the handshake, which is
+		// already buffered in brw
+		n, err := io.Copy(backConn, brw.Reader)
+		bytesIn = n
+		errc <- err
+	}()
+	go func() {
+		n, err := io.Copy(clientConn, backConn)
+		bytesOut = n
+		errc <- err
+	}()
+
+	// Closing both connections when either side finishes unblocks the other copy
+	finished := 0
+	select {
+	case <-errc:
+		finished++
+	case <-ctx.Done():
+	}
+	clientConn.Close()
+	backConn.Close()
+	for ; finished < 2; finished++ {
+		<-errc
+	}
+
+	stats.BytesIn, stats.BytesOut = bytesIn, bytesOut
+	stats.Duration = time.Since(start)
+
+	metrics.UpgradeBytes.WithLabelValues(stats.Protocol, "in").Add(float64(bytesIn))
+	metrics.UpgradeBytes.WithLabelValues(stats.Protocol, "out").Add(float64(bytesOut))
+	metrics.UpgradeSessionDuration.WithLabelValues(stats.Protocol).Observe(stats.Duration.Seconds())
+
+	return stats, nil
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// echoUpgradeBackend switches to the "echo" protocol and echoes every byte
+// back until the client closes the connection
+func echoUpgradeBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsUpgradeRequest(r) || r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("backend hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\nX-Backend: yes\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dialUpgrade sends a raw upgrade request to addr and returns the connection
+// and the handshake response
+func dialUpgrade(t *testing.T, addr, protocol string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/socket", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", protocol)
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("read handshake failed: %v", err)
+	}
+	return conn, br, resp
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Upgrade", "websocket")
+	if IsUpgradeRequest(r) {
+		t.Error("Upgrade without Connection: upgrade is not an upgrade request")
+	}
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	if !IsUpgradeRequest(r) {
+		t.Error("expected an upgrade request")
+	}
+}
+
+func TestProxyUpgrade_PipesBothDirections(t *testing.T) {
+	backend := echoUpgradeBackend(t)
+	client := NewClient(nil, zap.NewNop())
+	statsc := make(chan *UpgradeStats, 1)
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "req-1")
+		stats, err := client.ProxyUpgrade(r.Context(), w, r, backend.URL, "", time.Second)
+		if err != nil {
+			t.Errorf("ProxyUpgrade() error: %v", err)
+		}
+		statsc <- stats
+	}))
+	defer front.Close()
+
+	conn, br, resp := dialUpgrade(t, front.Listener.Addr().String(), "echo")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d, want 101", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Backend") != "yes" || resp.Header.Get("X-Request-ID") != "req-1" {
+		t.Errorf("handshake headers = %v, want backend and router headers", resp.Header)
+	}
+
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("echo = %q (%v), want hello", buf, err)
+	}
+	conn.Close()
+
+	select {
+	case stats := <-statsc:
+		if !stats.Upgraded() || stats.BytesIn != 5 || stats.BytesOut != 5 || stats.Protocol != "echo" {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not end after the client closed the connection")
+	}
+}
+
+func TestProxyUpgrade_RelaysDeclinedUpgrade(t *testing.T) {
+	backend := echoUpgradeBackend(t)
+	client := NewClient(nil, zap.NewNop())
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := client.ProxyUpgrade(r.Context(), w, r, backend.URL, "", time.Second)
+		if err != nil || stats.StatusCode != http.StatusUpgradeRequired {
+			t.Errorf("ProxyUpgrade() = %+v, %v; want relayed 426", stats, err)
+		}
+	}))
+	defer front.Close()
+
+	_, _, resp := dialUpgrade(t, front.Listener.Addr().String(), "websocket")
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want 426 from the backend", resp.StatusCode)
+	}
+}
+
+func TestProxyUpgrade_HandshakeTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	client := NewClient(nil, zap.NewNop())
+	r := httptest.NewRequest(http.MethodGet, "/socket", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+
+	stats, err := client.ProxyUpgrade(r.Context(), httptest.NewRecorder(), r, backend.URL, "", 50*time.Millisecond)
+	if err != ErrHandshakeTimeout || stats.StatusCode != 0 {
+		t.Errorf("got %+v, %v; want ErrHandshakeTimeout before any response", stats, err)
+	}
+}
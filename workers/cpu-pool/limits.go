@@ -192,6 +192,19 @@ func (tl *TenantLimits) getLimit(tenantID string, tenantTier string) *TierLimit
 	}
 }
 
+// Timeout resolves the backend timeout of a request: the route timeout if
+// set, capped by the tenant's tier timeout
+func (tl *TenantLimits) Timeout(tenantID string, tenantTier string, routeTimeout time.Duration) time.Duration {
+	limit := tl.getLimit(tenantID, tenantTier).Timeout
+	if limit <= 0 {
+		limit = tl.config.DefaultTimeout
+	}
+	if routeTimeout > 0 && (limit <= 0 || routeTimeout < limit) {
+		return routeTimeout
+	}
+	return limit
+}
+
 // incrementActiveRequests increments the active request counter for a tenant
 func (tl *TenantLimits) incrementActiveRequests(tenantID string) {
 	tl.mu.Lock()
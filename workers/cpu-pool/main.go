@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -26,19 +28,27 @@ type RequestMessage struct {
 	TenantID      string            `json:"tenant_id"`
 	TenantTier    string            `json:"tenant_tier"`
 	Route         string            `json:"route"`
+	RoutePattern  string            `json:"route_pattern,omitempty"`
 	Method        string            `json:"method"`
 	PolicyVersion string            `json:"policy_version"`
+	Scopes        []string          `json:"scopes,omitempty"`
 	Headers       map[string]string `json:"headers"`
 	Body          json.RawMessage   `json:"body"`
 	ReceivedAt    time.Time         `json:"received_at"`
+	TimeoutMs     int               `json:"timeout_ms,omitempty"`
 }
 
+// DeadlineHeader tells the backend how many milliseconds it has left,
+// matching the router's sync proxy
+const DeadlineHeader = "X-Apx-Deadline-Ms"
+
 type Worker struct {
 	logger      *zap.Logger
 	redisClient *redis.Client
 	projectID   string
 	region      string
-	httpClient  *http.Client
+	httpClient  *http.Client // No client timeout; each request gets its tier timeout
+	limits      *TenantLimits
 	statusStore StatusStore
 	policyEval  *PolicyEvaluator
 }
@@ -101,6 +111,7 @@ func (p *PolicyEvaluator) Evaluate(ctx context.Context, req *RequestMessage) (bo
 			"id":   req.TenantID,
 			"tier": req.TenantTier,
 		},
+		"scopes":  req.Scopes,
 		"headers": req.Headers,
 	}
 
@@ -171,9 +182,8 @@ func main() {
 		redisClient: redisClient,
 		projectID:   projectID,
 		region:      region,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient:  &http.Client{},
+		limits:      NewTenantLimits(nil),
 		statusStore: statusStore,
 		policyEval:  policyEval,
 	}
@@ -345,6 +355,10 @@ func (w *Worker) callBackend(ctx context.Context, req *RequestMessage) (map[stri
 		body = bytes.NewReader(req.Body)
 	}
 
+	timeout := w.limits.Timeout(req.TenantID, req.TenantTier, time.Duration(req.TimeoutMs)*time.Millisecond)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	httpReq, err := http.NewRequestWithContext(ctx, req.Method, backendURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build backend request: %w", err)
@@ -354,17 +368,24 @@ func (w *Worker) callBackend(ctx context.Context, req *RequestMessage) (map[stri
 	for k, v := range req.Headers {
 		httpReq.Header.Set(k, v)
 	}
+	httpReq.Header.Set(DeadlineHeader, strconv.FormatInt(timeout.Milliseconds(), 10))
 
 	start := time.Now()
 	resp, err := w.httpClient.Do(httpReq)
 	latency := time.Since(start)
 	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("backend timed out after %s", timeout)
+		}
 		return nil, fmt.Errorf("backend request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("backend timed out after %s", timeout)
+		}
 		return nil, fmt.Errorf("failed to read backend response: %w", err)
 	}
 